@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// auditFile is a `var` so tests can rebind it. It is where the default file
+// sink writes.
+var auditFile = auditPath()
+
+// Audit event kinds.
+const (
+	// AuditPolicy records a command policy decision.
+	AuditPolicy = "policy"
+	// AuditSessionStart is written once ExecuteCommand has handed out a
+	// session, so a session whose end is never recorded still shows up.
+	AuditSessionStart = "session-start"
+	// AuditSessionEnd is written when the session is over.
+	AuditSessionEnd = "session-end"
+	// AuditExecEnabled is written when exec-ecs turns ECS Exec on for a
+	// service and redeploys it.
+	AuditExecEnabled = "exec-enabled"
+)
+
+// AuditEvent is one line of the audit log. Unlike history, entries are
+// never edited or pruned by exec-ecs.
+type AuditEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// Caller is the ARN STS reports for the credentials in use.
+	Caller      string `json:"caller,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Cluster     string `json:"cluster,omitempty"`
+	Service     string `json:"service,omitempty"`
+	Task        string `json:"task,omitempty"`
+	Container   string `json:"container,omitempty"`
+	Command     string `json:"command,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	// Decision, Rule and Reason describe a policy decision.
+	Decision string `json:"decision,omitempty"`
+	Rule     string `json:"rule,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	// DryRun marks decisions made by -policy-check, which connect nowhere.
+	DryRun bool `json:"dryRun,omitempty"`
+	// SessionID is the SSM session ExecuteCommand opened.
+	SessionID string    `json:"sessionId,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitzero"`
+	EndedAt   time.Time `json:"endedAt,omitzero"`
+	// ExitCode is only set on session-end events, where 0 matters.
+	ExitCode *int `json:"exitCode,omitempty"`
+	// Recorded tells whether an asciicast recording was saved, at
+	// Recording.
+	Recorded  bool   `json:"recorded,omitempty"`
+	Recording string `json:"recording,omitempty"`
+	// Error is why the session failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditConfig lists where audit events go. With no sinks configured they
+// go to the local file sink alone.
+type AuditConfig struct {
+	Sinks []AuditSinkConfig `yaml:"sinks"`
+}
+
+// Audit sink types.
+const (
+	AuditSinkFile   = "file"
+	AuditSinkSyslog = "syslog"
+	AuditSinkHTTP   = "http"
+)
+
+// AuditSinkConfig is one entry under `audit.sinks`. Which fields apply
+// depends on Type.
+type AuditSinkConfig struct {
+	Type string `yaml:"type"`
+	// Path is the file sink's file (default ConfigDir()/audit.jsonl).
+	Path string `yaml:"path"`
+	// Network and Address reach a remote syslog ("udp", "host:514");
+	// empty means the local syslog daemon. Tag defaults to exec-ecs.
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+	Tag     string `yaml:"tag"`
+	// URL receives each event as a JSON POST, with Headers added.
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// Retries is how many more times a failed POST is tried before the
+	// event is spooled (0 means defaultAuditRetries).
+	Retries int `yaml:"retries"`
+	// Timeout bounds each POST (0 means defaultAuditTimeout).
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// auditSink delivers one JSON-encoded event.
+type auditSink interface {
+	write(ctx context.Context, line []byte) error
+}
+
+// auditSinks builds the configured sinks. A sink whose config is unusable
+// is reported and left out, so the others still receive events.
+func (c *Cli) auditSinks() []auditSink {
+	configs := c.settings().Audit.Sinks
+	if len(configs) == 0 {
+		configs = []AuditSinkConfig{{Type: AuditSinkFile}}
+	}
+	sinks := make([]auditSink, 0, len(configs))
+	for _, cfg := range configs {
+		s, err := newAuditSink(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs: audit sink:", err)
+			continue
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks
+}
+
+func newAuditSink(cfg AuditSinkConfig) (auditSink, error) {
+	switch cfg.Type {
+	case AuditSinkFile, "":
+		path := auditFile
+		if cfg.Path != "" {
+			path = expandHome(cfg.Path)
+		}
+		return fileSink{path: path}, nil
+	case AuditSinkSyslog:
+		return newSyslogSink(cfg)
+	case AuditSinkHTTP:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("http sink needs a url")
+		}
+		return newHTTPSink(cfg), nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q (want file, syslog or http)", cfg.Type)
+}
+
+// appendAudit sends e to every sink. A failed sink is reported, not fatal,
+// for the same reason a broken recordings dir isn't.
+func (c *Cli) appendAudit(ctx context.Context, e AuditEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	// The session may have been ended by ^C; its record must still go out.
+	ctx = context.WithoutCancel(ctx)
+	for _, s := range c.auditSinks() {
+		if err := s.write(ctx, line); err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs: writing audit log:", err)
+		}
+	}
+}
+
+// fileSink appends events to a JSONL file under an exclusive lock, so
+// parallel sessions (and parallel exec-ecs processes) never interleave
+// their lines.
+type fileSink struct{ path string }
+
+func (s fileSink) write(_ context.Context, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	return appendLocked(s.path, append(line, '\n'))
+}
+
+// appendLocked appends data to path while holding an exclusive lock on it.
+func appendLocked(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	_, err = f.Write(data)
+	_ = unlockFile(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// callerIdentity returns the ARN behind awsCfg's credentials. Swapped out
+// in tests.
+var callerIdentity = func(ctx context.Context, awsCfg aws.Config) (string, error) {
+	out, err := sts.NewFromConfig(awsCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.Arn), nil
+}
+
+// callerArns caches callerIdentity per profile, since every session of a
+// fan-out would otherwise ask STS the same question.
+var callerArns sync.Map
+
+// auditCaller looks up the caller ARN for the audit log. A config without
+// credentials (as in tests) has nothing to ask STS with, and a failed
+// lookup leaves the field empty rather than blocking the session.
+func (c *Cli) auditCaller(ctx context.Context, awsCfg aws.Config) string {
+	if awsCfg.Credentials == nil {
+		return ""
+	}
+	if arn, ok := callerArns.Load(c.Profile); ok {
+		return arn.(string)
+	}
+	c.LogAWSCommand("sts", "get-caller-identity", "--profile", c.Profile)
+	arn, err := callerIdentity(ctx, awsCfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs: audit: could not look up caller identity:", err)
+		return ""
+	}
+	callerArns.Store(c.Profile, arn)
+	return arn
+}
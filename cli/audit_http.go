@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuditRetries = 3
+	defaultAuditTimeout = 5 * time.Second
+)
+
+// auditSpoolDir holds events an HTTP sink could not deliver, one
+// subdirectory per URL. A `var` so tests can rebind it.
+var auditSpoolDir = auditSpoolPath()
+
+// auditRetryDelay is the wait before retry n (1-based): 0.5s, 1s, 2s, ...
+// Swapped out in tests.
+var auditRetryDelay = func(n int) time.Duration {
+	return time.Duration(1<<(n-1)) * 500 * time.Millisecond
+}
+
+// auditDeliveryWait is how long write waits for its event to go out
+// before leaving the delivery to finish in the background. Swapped out in
+// tests.
+var auditDeliveryWait = time.Second
+
+// httpSink POSTs each event as JSON. Every event is spooled to disk first
+// and the spool is delivered oldest first, so the receiver sees events in
+// order, and one that can't be sent yet goes out with a later event. An
+// event may arrive twice if exec-ecs exits between a POST and removing it
+// from the spool.
+type httpSink struct {
+	cfg    AuditSinkConfig
+	client *http.Client
+	spool  string
+}
+
+func newHTTPSink(cfg AuditSinkConfig) *httpSink {
+	if cfg.Retries <= 0 {
+		cfg.Retries = defaultAuditRetries
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultAuditTimeout
+	}
+	sum := sha256.Sum256([]byte(cfg.URL))
+	return &httpSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		spool:  filepath.Join(auditSpoolDir, hex.EncodeToString(sum[:6])),
+	}
+}
+
+// write spools line and delivers the spool, but waits no longer than
+// auditDeliveryWait for that: a webhook that is down or slow must not hold
+// up the session the event is about.
+func (s *httpSink) write(ctx context.Context, line []byte) error {
+	if err := os.MkdirAll(s.spool, 0o700); err != nil {
+		return err
+	}
+	if err := s.spoolLine(line); err != nil {
+		return fmt.Errorf("%s: spooling the event: %w", s.host(), err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.deliver(context.WithoutCancel(ctx)) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s: %w; the event is spooled and will be sent with the next one", s.host(), err)
+		}
+		return nil
+	case <-time.After(auditDeliveryWait):
+		return nil
+	}
+}
+
+// deliver sends the spool while holding its lock, or two sessions ending
+// together could both send the same spooled events.
+func (s *httpSink) deliver(ctx context.Context) error {
+	lock, err := os.OpenFile(filepath.Join(s.spool, ".lock"), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Close() }()
+	if err := lockFile(lock); err != nil {
+		return err
+	}
+	defer func() { _ = unlockFile(lock) }()
+	return s.flushSpool(ctx)
+}
+
+// flushSpool delivers spooled events oldest first, stopping at the first
+// one that fails so the order is kept.
+func (s *httpSink) flushSpool(ctx context.Context) error {
+	entries, err := os.ReadDir(s.spool)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(s.spool, name)
+		line, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := s.post(ctx, line); err != nil {
+			return err
+		}
+		_ = os.Remove(path)
+	}
+	return nil
+}
+
+// spoolLine saves line under a name that sorts by time. It is written
+// under a temporary name first, since a delivery may be reading the spool.
+func (s *httpSink) spoolLine(line []byte) error {
+	f, err := os.CreateTemp(s.spool, fmt.Sprintf("%020d-*.tmp", time.Now().UnixNano()))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), strings.TrimSuffix(f.Name(), ".tmp")+".json")
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// post sends one event, retrying with backoff on errors and non-2xx
+// replies.
+func (s *httpSink) post(ctx context.Context, line []byte) error {
+	var err error
+	for attempt := 0; attempt <= s.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(auditRetryDelay(attempt)):
+			}
+		}
+		if err = s.postOnce(ctx, line); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *httpSink) postOnce(ctx context.Context, line []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			// The URL in the message may carry a token.
+			return uerr.Err
+		}
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook replied %s", resp.Status)
+	}
+	return nil
+}
+
+// host names the webhook in messages without any credentials its URL
+// may carry.
+func (s *httpSink) host() string {
+	if u, err := url.Parse(s.cfg.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "audit webhook"
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package cli
+
+import (
+	"context"
+	"log/syslog"
+)
+
+type syslogSink struct{ cfg AuditSinkConfig }
+
+func newSyslogSink(cfg AuditSinkConfig) (auditSink, error) {
+	if cfg.Tag == "" {
+		cfg.Tag = "exec-ecs"
+	}
+	return syslogSink{cfg: cfg}, nil
+}
+
+// write dials per event. A burst, such as -all-tasks starting its
+// sessions, pays for a connection per event, but a fresh connection
+// survives the syslog daemon restarting between events.
+func (s syslogSink) write(_ context.Context, line []byte) error {
+	w, err := syslog.Dial(s.cfg.Network, s.cfg.Address, syslog.LOG_INFO|syslog.LOG_AUTH, s.cfg.Tag)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return w.Info(string(line))
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package cli
+
+import "errors"
+
+func newSyslogSink(AuditSinkConfig) (auditSink, error) {
+	return nil, errors.New("the syslog sink is not supported on Windows")
+}
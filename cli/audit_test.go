@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestFileSinkKeepsConcurrentLinesWhole(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	sink := fileSink{path: path}
+	long := strings.Repeat("x", 64<<10)
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			line, _ := json.Marshal(AuditEvent{Event: AuditSessionStart, Command: fmt.Sprintf("%d %s", i, long)})
+			if err := sink.write(context.Background(), line); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if events := readAudit(t, path); len(events) != 16 {
+		t.Fatalf("got %d events", len(events))
+	}
+}
+
+// setAuditSpool spools to a temp dir and makes retries instant. Writes
+// wait for their delivery, so the tests see its outcome.
+func setAuditSpool(t *testing.T) {
+	t.Helper()
+	prevSpool, prevDelay, prevWait := auditSpoolDir, auditRetryDelay, auditDeliveryWait
+	auditSpoolDir = filepath.Join(t.TempDir(), "audit-spool")
+	auditRetryDelay = func(int) time.Duration { return 0 }
+	auditDeliveryWait = time.Minute
+	t.Cleanup(func() { auditSpoolDir, auditRetryDelay, auditDeliveryWait = prevSpool, prevDelay, prevWait })
+}
+
+func TestHTTPSinkRetriesThenSpools(t *testing.T) {
+	setAuditSpool(t)
+
+	var down atomic.Bool
+	var attempts atomic.Int32
+	var mu sync.Mutex
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if r.Header.Get("Authorization") != "Bearer tok" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	sink := newHTTPSink(AuditSinkConfig{Type: AuditSinkHTTP, URL: srv.URL, Retries: 2, Headers: map[string]string{"Authorization": "Bearer tok"}})
+	down.Store(true)
+	for _, line := range []string{`{"n":1}`, `{"n":2}`} {
+		if err := sink.write(context.Background(), []byte(line)); err == nil || !strings.Contains(err.Error(), "spooled") {
+			t.Fatalf("write while down: %v", err)
+		}
+	}
+	// The first write tries three times; the second tries the spooled
+	// event three times and gives up before sending its own.
+	if n := attempts.Load(); n != 6 {
+		t.Fatalf("attempts = %d", n)
+	}
+	if spooled, _ := filepath.Glob(filepath.Join(sink.spool, "*.json")); len(spooled) != 2 {
+		t.Fatalf("spooled = %v", spooled)
+	}
+
+	down.Store(false)
+	if err := sink.write(context.Background(), []byte(`{"n":3}`)); err != nil {
+		t.Fatalf("write after recovery: %v", err)
+	}
+	if strings.Join(received, " ") != `{"n":1} {"n":2} {"n":3}` {
+		t.Fatalf("received = %v", received)
+	}
+	if spooled, _ := filepath.Glob(filepath.Join(sink.spool, "*.json")); len(spooled) != 0 {
+		t.Fatalf("spool not drained: %v", spooled)
+	}
+}
+
+func TestHTTPSinkDoesNotWaitForSlowWebhook(t *testing.T) {
+	setAuditSpool(t)
+	auditDeliveryWait = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	sink := newHTTPSink(AuditSinkConfig{URL: srv.URL})
+	start := time.Now()
+	if err := sink.write(context.Background(), []byte(`{"n":1}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("write waited %s for the webhook", d)
+	}
+	if spooled, _ := filepath.Glob(filepath.Join(sink.spool, "*.json")); len(spooled) != 1 {
+		t.Fatalf("event not spooled while in flight: %v", spooled)
+	}
+
+	release <- struct{}{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		spooled, _ := filepath.Glob(filepath.Join(sink.spool, "*.json"))
+		if len(spooled) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background delivery never finished: %v", spooled)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(received, " ") != `{"n":1}` {
+		t.Fatalf("received = %v", received)
+	}
+}
+
+func TestHTTPSinkErrorHidesURLCredentials(t *testing.T) {
+	setAuditSpool(t)
+
+	sink := newHTTPSink(AuditSinkConfig{URL: "http://127.0.0.1:1/hook?token=secret", Retries: 1})
+	err := sink.write(context.Background(), []byte(`{}`))
+	if err == nil || strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestAuditSinksSkipsBadConfig(t *testing.T) {
+	setHistoryFile(t)
+
+	c := &Cli{Config: &Config{Audit: AuditConfig{Sinks: []AuditSinkConfig{
+		{Type: "kafka"},
+		{Type: AuditSinkHTTP},
+		{Type: AuditSinkFile, Path: filepath.Join(t.TempDir(), "a.jsonl")},
+	}}}}
+	sinks := c.auditSinks()
+	if len(sinks) != 1 {
+		t.Fatalf("sinks = %#v", sinks)
+	}
+	if _, ok := sinks[0].(fileSink); !ok {
+		t.Fatalf("sink = %#v", sinks[0])
+	}
+	if def := (&Cli{}).auditSinks(); len(def) != 1 || def[0].(fileSink).path != auditFile {
+		t.Fatalf("default sinks = %#v", def)
+	}
+}
+
+func TestExecECSAuditsSession(t *testing.T) {
+	prevStart, prevStarter, prevCaller := startExecuteCommand, sessionStarter, callerIdentity
+	t.Cleanup(func() {
+		startExecuteCommand, sessionStarter, callerIdentity = prevStart, prevStarter, prevCaller
+		callerArns.Delete("audit-test")
+	})
+	startExecuteCommand = func(context.Context, ecsExecuteCommander, ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId:  aws.String("ecs-execute-command-0abc"),
+			StreamUrl:  aws.String("wss://example/stream"),
+			TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	sessionStarter = func(context.Context, string, *ecstypes.Session, ptyOptions) (int, error) { return 7, nil }
+	lookups := 0
+	callerIdentity = func(context.Context, aws.Config) (string, error) {
+		lookups++
+		return "arn:aws:sts::111111111111:assumed-role/dev/alice", nil
+	}
+	setHistoryFile(t)
+
+	c := &Cli{Profile: "audit-test"}
+	awsCfg := aws.Config{Credentials: aws.AnonymousCredentials{}}
+	opts := ExecOptions{Region: "eu-west-1", ClusterArn: prodClusterArn, Service: AllTasksService, TaskArn: "t1", Container: "app", Command: "bash", Environment: EnvProd, NoHistory: true}
+	for range 2 {
+		if code, err := ExecECS(context.Background(), c, awsCfg, opts); code != 7 || err != nil {
+			t.Fatalf("code=%d err=%v", code, err)
+		}
+	}
+	if lookups != 1 {
+		t.Fatalf("caller looked up %d times", lookups)
+	}
+
+	events := readAudit(t, auditFile)
+	if len(events) != 4 {
+		t.Fatalf("audit = %+v", events)
+	}
+	start, end := events[0], events[1]
+	if start.Event != AuditSessionStart || start.SessionID != "ecs-execute-command-0abc" || start.Caller == "" ||
+		start.Task != "t1" || start.Service != "" || start.Environment != EnvProd || start.ExitCode != nil {
+		t.Fatalf("start = %+v", start)
+	}
+	if end.Event != AuditSessionEnd || end.SessionID != start.SessionID || end.ExitCode == nil || *end.ExitCode != 7 ||
+		end.StartedAt.IsZero() || end.EndedAt.Before(end.StartedAt) || end.Recorded {
+		t.Fatalf("end = %+v", end)
+	}
+	if _, err := os.Stat(historyFile); err == nil {
+		t.Fatal("-no-history must not write history")
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
@@ -50,13 +51,6 @@ func (c *Cli) AWSConfigPath() string {
 	return filepath.Join(homeDir(), ".aws", "config")
 }
 
-func maskTaskArn(taskArn string) string {
-	if len(taskArn) <= 13 {
-		return taskArn
-	}
-	return taskArn[:3] + strings.Repeat("*", len(taskArn)-13) + taskArn[len(taskArn)-10:]
-}
-
 // Small interfaces over the AWS SDK ECS client. We define them at the call
 // site (instead of importing the SDK's huge surface) so tests can supply
 // fakes without depending on the real SDK.
@@ -77,6 +71,35 @@ type ecsTaskDescriber interface {
 	DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
 }
 
+type ecsServiceDescriber interface {
+	DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error)
+}
+
+type ecsTaskProtectionGetter interface {
+	GetTaskProtection(ctx context.Context, params *ecs.GetTaskProtectionInput, optFns ...func(*ecs.Options)) (*ecs.GetTaskProtectionOutput, error)
+}
+
+// describeTasksBatchSize is the most task ARNs DescribeTasks accepts per call.
+const describeTasksBatchSize = 100
+
+// describeAllTasks describes arns in batches of describeTasksBatchSize so
+// services with more tasks than that are still described in full.
+func describeAllTasks(ctx context.Context, client ecsTaskDescriber, clusterArn string, arns []string) ([]ecstypes.Task, error) {
+	var tasks []ecstypes.Task
+	for start := 0; start < len(arns); start += describeTasksBatchSize {
+		end := min(start+describeTasksBatchSize, len(arns))
+		out, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &clusterArn,
+			Tasks:   arns[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, out.Tasks...)
+	}
+	return tasks, nil
+}
+
 // listAllClusterArns paginates ECS ListClusters so users with more than the
 // default page size of clusters still see every cluster.
 func listAllClusterArns(ctx context.Context, client ecsClusterLister) ([]string, error) {
@@ -122,16 +145,52 @@ func listAllServiceArns(ctx context.Context, client ecsServiceLister, clusterArn
 	}
 }
 
+// Pseudo-services the service step offers next to the real ones, for tasks
+// started by RunTask, scheduled tasks and one-off jobs.
+const (
+	AllTasksService        = "(all tasks)"
+	StandaloneTasksService = "(standalone tasks)"
+)
+
+// IsPseudoService reports whether service is one of the cluster-level
+// entries rather than a service ARN.
+func IsPseudoService(service string) bool {
+	return service == AllTasksService || service == StandaloneTasksService
+}
+
+// LogListTasks logs the list-tasks call for a service or, for a
+// pseudo-service, for the whole cluster.
+func (c *Cli) LogListTasks(clusterArn, service string) {
+	if IsPseudoService(service) {
+		c.LogAWSCommand("ecs", "list-tasks", "--cluster", clusterArn, "--profile", c.Profile, "--region", c.Region)
+		return
+	}
+	c.LogAWSCommand("ecs", "list-tasks", "--cluster", clusterArn, "--service-name", service, "--profile", c.Profile, "--region", c.Region)
+}
+
+// listAllTaskArns lists the running tasks of a service, or of the whole
+// cluster for a pseudo-service.
 func listAllTaskArns(ctx context.Context, client ecsTaskLister, clusterArn, serviceName string) ([]string, error) {
+	return listTaskArnsByStatus(ctx, client, clusterArn, serviceName, "")
+}
+
+// listTaskArnsByStatus is listAllTaskArns for tasks with the given desired
+// status; empty means RUNNING, as it does for ListTasks.
+func listTaskArnsByStatus(ctx context.Context, client ecsTaskLister, clusterArn, serviceName string, status ecstypes.DesiredStatus) ([]string, error) {
 	var (
 		arns      []string
 		nextToken *string
+		service   *string
 	)
+	if serviceName != "" && !IsPseudoService(serviceName) {
+		service = &serviceName
+	}
 	for {
 		out, err := client.ListTasks(ctx, &ecs.ListTasksInput{
-			Cluster:     &clusterArn,
-			ServiceName: &serviceName,
-			NextToken:   nextToken,
+			Cluster:       &clusterArn,
+			ServiceName:   service,
+			DesiredStatus: status,
+			NextToken:     nextToken,
 		})
 		if err != nil {
 			return nil, err
@@ -15,31 +15,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-func TestMaskTaskArn(t *testing.T) {
-	t.Parallel()
-
-	long := "arn:aws:ecs:us-east-1:123456789012:task/foo/abcdef0123456789"
-	tests := []struct {
-		name string
-		arn  string
-		want string
-	}{
-		{"short returned verbatim", "short", "short"},
-		{"boundary 13 chars verbatim", "1234567890123", "1234567890123"},
-		{"masks middle of long arn",
-			long,
-			long[:3] + strings.Repeat("*", len(long)-13) + long[len(long)-10:]},
-	}
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			t.Parallel()
-			if got := maskTaskArn(tc.arn); got != tc.want {
-				t.Fatalf("maskTaskArn(%q) = %q want %q", tc.arn, got, tc.want)
-			}
-		})
-	}
-}
-
 type fakeECS struct {
 	clustersPages   [][]string
 	clusterErr      error
@@ -52,6 +27,13 @@ type fakeECS struct {
 	taskCalls       int
 	describeTasks   []ecstypes.Task
 	describeTaskErr error
+	taskServices    []string
+	taskStatuses    []ecstypes.DesiredStatus
+	services        []ecstypes.Service
+	describeSvcErr  error
+	clusters        []ecstypes.Cluster
+	protected       []ecstypes.ProtectedTask
+	protectionErr   error
 }
 
 func (f *fakeECS) ListClusters(ctx context.Context, params *ecs.ListClustersInput, _ ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
@@ -92,6 +74,8 @@ func (f *fakeECS) ListTasks(ctx context.Context, params *ecs.ListTasksInput, _ .
 	if f.taskErr != nil {
 		return nil, f.taskErr
 	}
+	f.taskServices = append(f.taskServices, aws.ToString(params.ServiceName))
+	f.taskStatuses = append(f.taskStatuses, params.DesiredStatus)
 	idx := f.taskCalls
 	f.taskCalls++
 	if idx >= len(f.tasksPages) {
@@ -112,6 +96,27 @@ func (f *fakeECS) DescribeTasks(ctx context.Context, params *ecs.DescribeTasksIn
 	return &ecs.DescribeTasksOutput{Tasks: f.describeTasks}, nil
 }
 
+func (f *fakeECS) DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, _ ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	if f.describeSvcErr != nil {
+		return nil, f.describeSvcErr
+	}
+	return &ecs.DescribeServicesOutput{Services: f.services}, nil
+}
+
+func (f *fakeECS) DescribeClusters(ctx context.Context, params *ecs.DescribeClustersInput, _ ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+	if f.clusterErr != nil {
+		return nil, f.clusterErr
+	}
+	return &ecs.DescribeClustersOutput{Clusters: f.clusters}, nil
+}
+
+func (f *fakeECS) GetTaskProtection(ctx context.Context, params *ecs.GetTaskProtectionInput, _ ...func(*ecs.Options)) (*ecs.GetTaskProtectionOutput, error) {
+	if f.protectionErr != nil {
+		return nil, f.protectionErr
+	}
+	return &ecs.GetTaskProtectionOutput{ProtectedTasks: f.protected}, nil
+}
+
 func TestListAllClusterArnsPaginates(t *testing.T) {
 	t.Parallel()
 
@@ -233,21 +238,20 @@ func TestCliListServiceNamesArns(t *testing.T) {
 func TestCliListTaskNamesArns(t *testing.T) {
 	t.Parallel()
 	c := &Cli{}
-	f := &fakeECS{tasksPages: [][]string{{
-		"arn:aws:ecs:us-east-1:111111111111:task/cluster/abcdef0123456789",
-	}}}
+	arn := "arn:aws:ecs:us-east-1:111111111111:task/cluster/abcdef0123456789"
+	f := &fakeECS{
+		tasksPages:    [][]string{{arn}},
+		describeTasks: []ecstypes.Task{{TaskArn: aws.String(arn), LastStatus: aws.String("RUNNING")}},
+	}
 	names, m, err := c.ListTaskNamesArns(context.Background(), f, "cluster", "svc")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
-	if len(names) != 1 {
-		t.Fatalf("names = %v", names)
-	}
-	if !strings.Contains(names[0], "*") {
-		t.Fatalf("expected masked task name, got %q", names[0])
+	if len(names) != 1 || !strings.HasPrefix(names[0], "abcdef012345  RUNNING") {
+		t.Fatalf("names = %q", names)
 	}
-	if m[names[0]] == "" {
-		t.Fatalf("masked->arn missing")
+	if m[names[0]] != arn {
+		t.Fatalf("line->arn = %q", m[names[0]])
 	}
 	if _, _, err := c.ListTaskNamesArns(context.Background(), &fakeECS{taskErr: errors.New("boom")}, "c", "s"); err == nil {
 		t.Fatal("expected error")
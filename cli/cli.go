@@ -4,8 +4,10 @@ import (
 	"context"
 	"flag"
 	"log"
+	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	tea "github.com/charmbracelet/bubbletea"
@@ -29,6 +31,93 @@ type Cli struct {
 	Version     bool
 	Upgrade     bool
 	History     bool
+	// Once runs a single non-interactive session against a fully specified
+	// target and exits with the remote command's status.
+	Once bool
+	// Subcommand is the leading verb (e.g. "exec"), or empty for the
+	// default interactive picker.
+	Subcommand string
+	// Args holds the positional arguments left after flag parsing.
+	Args []string
+	// Forwards holds the raw `-L` port-forward specs for `forward`.
+	Forwards []string
+	// AllTasks runs Command on every task of the service instead of one.
+	AllTasks bool
+	// Parallel caps concurrent sessions for AllTasks.
+	Parallel int
+	// Output selects the AllTasks output format: "prefix" or "json".
+	Output string
+	// Record / NoRecord force session recording on or off, overriding
+	// config.yaml.
+	Record   bool
+	NoRecord bool
+	// Protect / NoProtect force task scale-in protection on or off,
+	// overriding config.yaml.
+	Protect   bool
+	NoProtect bool
+	// StatusLine / NoStatusLine force the in-session status bar on or off,
+	// overriding config.yaml.
+	StatusLine   bool
+	NoStatusLine bool
+	// Since, Grep and Follow shape `logs`: how far back to start, a filter
+	// pattern, and whether to keep following.
+	Since  time.Duration
+	Grep   string
+	Follow bool
+	// Refresh is how often `dashboard` reloads (0 means config.yaml or
+	// the default).
+	Refresh time.Duration
+	// Speed and MaxIdle tune `replay` playback.
+	Speed   float64
+	MaxIdle time.Duration
+	// Config is the parsed config.yaml (nil until loaded).
+	Config *Config
+	// Target is the name of a config.yaml target given as `@name`.
+	Target string
+	// Confirm pre-answers the prod confirmation with the cluster or
+	// service name.
+	Confirm string
+	// Policy is the parsed command policy (nil when there is none).
+	Policy *Policy
+	// PolicyCheck evaluates the policy for the chosen target and command
+	// and reports the decision instead of connecting.
+	PolicyCheck bool
+
+	// explicit records which flags were set on the command line, so
+	// config-supplied values only replace defaults.
+	explicit map[string]bool
+}
+
+// subcommands lists the verbs ParseArgs accepts as the first argument.
+// Flags may follow the verb: `exec-ecs exec -pr prod ...`.
+var subcommands = map[string]bool{
+	"cp":        true,
+	"dashboard": true,
+	"debug":     true,
+	"doctor":    true,
+	"exec":      true,
+	"forward":   true,
+	"logs":      true,
+	"stopped":   true,
+	"replay":    true,
+}
+
+// splitSubcommand peels a known verb off the front of argv so the rest can be
+// handed to the flag package unchanged.
+func splitSubcommand(args []string) (string, []string) {
+	if len(args) > 0 && subcommands[args[0]] {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
+// splitTarget peels an `@name` target off the front of argv (after any
+// verb), for the same reason.
+func splitTarget(args []string) (string, []string) {
+	if len(args) > 0 && strings.HasPrefix(args[0], "@") && len(args[0]) > 1 {
+		return args[0][1:], args[1:]
+	}
+	return "", args
 }
 
 func ParseArgs() Cli {
@@ -44,13 +133,32 @@ func ParseArgs() Cli {
 		version   bool
 		upgrade   bool
 		history   bool
+		once      bool
+		forwards  stringList
+		allTasks  bool
+		parallel  int
+		output    string
+		record    bool
+		noRecord  bool
+		protect   bool
+		noProtect bool
+		statusBar bool
+		noStatus  bool
+		since     time.Duration
+		grep      string
+		follow    bool
+		refresh   time.Duration
+		speed     float64
+		maxIdle   time.Duration
+		confirm   string
+		polCheck  bool
 	)
 
 	flag.BoolVar(&debug, "debug", false, "Enable debug mode for logging AWS commands")
 	flag.BoolVar(&version, "version", false, "Show the current version")
 	flag.BoolVar(&upgrade, "upgrade", false, "Upgrade to the latest version")
-	flag.BoolVar(&history, "history", false, "Show last 5 unique command history")
-	flag.BoolVar(&history, "H", false, "Show last 5 unique command history (shorthand)")
+	flag.BoolVar(&history, "history", false, "Browse command history (narrow it with -pr, -rg, -cl and -se)")
+	flag.BoolVar(&history, "H", false, "Shorthand for -history")
 	flag.StringVar(&profile, "pr", "", "AWS profile to use")
 	flag.StringVar(&region, "rg", "", "AWS region to use")
 	flag.StringVar(&cluster, "cl", "", "ECS cluster name")
@@ -58,34 +166,78 @@ func ParseArgs() Cli {
 	flag.StringVar(&task, "tk", "", "Task ARN")
 	flag.StringVar(&container, "cn", "", "Container name")
 	flag.StringVar(&command, "command", "bash", "Command to run in the container")
-	flag.Parse()
+	flag.BoolVar(&once, "once", false, "Run the command once without the picker and exit with the remote exit code (requires a fully specified target; not valid with other subcommands)")
+	flag.Var(&forwards, "L", "Port forward for `forward`, as local:remote or local:host:remote (repeatable)")
+	flag.BoolVar(&allTasks, "all-tasks", false, "Run the command on every task of the service (non-interactive; implies -once)")
+	flag.IntVar(&parallel, "parallel", defaultFanOutParallel, "Maximum concurrent sessions for -all-tasks")
+	flag.StringVar(&output, "output", FanOutPrefix, "Output for -all-tasks: prefix (lines tagged per task) or json (summary document); json also applies to `doctor`")
+	flag.BoolVar(&record, "record", false, "Record the session as an asciicast file under the config dir")
+	flag.BoolVar(&noRecord, "no-record", false, "Do not record the session, even if config.yaml enables recording")
+	flag.BoolVar(&protect, "protect", false, "Protect the task from service scale-in while the session is open")
+	flag.BoolVar(&noProtect, "no-protect", false, "Do not protect the task from scale-in, even if config.yaml enables it")
+	flag.BoolVar(&statusBar, "status-line", false, "Keep a status bar with the target, session time and SSO expiry on the bottom row of the session")
+	flag.BoolVar(&noStatus, "no-status-line", false, "Do not show the session status bar, even if config.yaml enables it")
+	flag.DurationVar(&since, "since", defaultLogsSince, "How far back `logs` starts, e.g. 1h")
+	flag.StringVar(&grep, "grep", "", "Only show `logs` events matching this text or CloudWatch Logs filter pattern")
+	flag.BoolVar(&follow, "follow", false, "Keep following `logs` for new events until Ctrl-C")
+	flag.BoolVar(&follow, "f", false, "Shorthand for -follow")
+	flag.DurationVar(&refresh, "refresh", 0, "How often `dashboard` reloads (default 15s)")
+	flag.Float64Var(&speed, "speed", 1, "Playback speed for `replay` (2 = twice as fast)")
+	flag.DurationVar(&maxIdle, "max-idle", 2*time.Second, "Cap pauses during `replay` (0 keeps the original timing)")
+	flag.StringVar(&confirm, "confirm", "", "Cluster or service name that confirms a prod target without the prompt")
+	flag.BoolVar(&polCheck, "policy-check", false, "Report whether the command policy allows the command on the chosen target, without connecting")
+
+	sub, args := splitSubcommand(os.Args[1:])
+	target, args := splitTarget(args)
+	_ = flag.CommandLine.Parse(args)
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
 
 	return Cli{
-		Debug:       debug,
-		Interactive: true,
-		Profile:     profile,
-		Region:      region,
-		ClusterArn:  cluster,
-		Service:     service,
-		TaskArn:     task,
-		Container:   container,
-		Command:     command,
-		Version:     version,
-		Upgrade:     upgrade,
-		History:     history,
+		Debug:        debug,
+		Interactive:  true,
+		Profile:      profile,
+		Region:       region,
+		ClusterArn:   cluster,
+		Service:      service,
+		TaskArn:      task,
+		Container:    container,
+		Command:      command,
+		Version:      version,
+		Upgrade:      upgrade,
+		History:      history,
+		Once:         once || sub == "exec",
+		Subcommand:   sub,
+		Args:         flag.Args(),
+		Forwards:     forwards,
+		AllTasks:     allTasks,
+		Parallel:     parallel,
+		Output:       output,
+		Record:       record,
+		NoRecord:     noRecord,
+		Protect:      protect,
+		NoProtect:    noProtect,
+		StatusLine:   statusBar,
+		NoStatusLine: noStatus,
+		Since:        since,
+		Grep:         grep,
+		Follow:       follow,
+		Refresh:      refresh,
+		Speed:        speed,
+		MaxIdle:      maxIdle,
+		Target:       target,
+		Confirm:      confirm,
+		PolicyCheck:  polCheck,
+		explicit:     explicit,
 	}
 }
 
-func (c *Cli) AppendToHistory(cmd string) {
-	AppendToHistory(cmd)
-}
-
-func (c *Cli) GetLastUniqueHistory(n int) []string {
-	return GetLastUniqueHistory(n)
+func (c *Cli) AppendToHistory(e HistoryEntry) {
+	AppendToHistory(e)
 }
 
-func (c *Cli) BubbleteaHistorySelect(label string, items []string) (string, error) {
-	return BubbleteaHistorySelect(label, items)
+func (c *Cli) BrowseHistory(filter string) (HistoryEntry, bool, error) {
+	return BrowseHistory(filter)
 }
 
 // Helper to get profile list only
@@ -126,20 +278,20 @@ func (c *Cli) ListServiceNamesArns(ctx context.Context, client ecsServiceLister,
 	return namesAndArns(services), arnMap(services), nil
 }
 
-// Helper to get task display names and a map from masked name to ARN.
-func (c *Cli) ListTaskNamesArns(ctx context.Context, client ecsTaskLister, clusterArn, serviceName string) ([]string, map[string]string, error) {
-	taskArns, err := listAllTaskArns(ctx, client, clusterArn, serviceName)
+// Helper to get task table lines and a map from line to ARN, for pickers
+// that take plain strings.
+func (c *Cli) ListTaskNamesArns(ctx context.Context, client ecsTaskInspector, clusterArn, serviceName string) ([]string, map[string]string, error) {
+	rows, err := c.ListTaskRows(ctx, client, clusterArn, serviceName)
 	if err != nil {
 		return nil, nil, err
 	}
-	nameToArn := make(map[string]string, len(taskArns))
-	masked := make([]string, 0, len(taskArns))
-	for _, arn := range taskArns {
-		mask := maskTaskArn(arn)
-		nameToArn[mask] = arn
-		masked = append(masked, mask)
+	table := taskTable(rows)
+	lines := table.lines()
+	lineToArn := make(map[string]string, len(lines))
+	for _, line := range lines {
+		lineToArn[line] = table.keyFor(line)
 	}
-	return masked, nameToArn, nil
+	return lines, lineToArn, nil
 }
 
 // Helper to get container names for a given task
@@ -63,10 +63,62 @@ func TestParseArgsOverrides(t *testing.T) {
 func TestCliHistoryAdapters(t *testing.T) {
 	setHistoryFile(t)
 	c := &Cli{}
-	c.AppendToHistory("cmd1")
-	c.AppendToHistory("cmd2")
-	got := c.GetLastUniqueHistory(2)
-	if len(got) != 2 || got[0] != "cmd2" || got[1] != "cmd1" {
+	c.AppendToHistory(cmdEntry("cmd1"))
+	c.AppendToHistory(cmdEntry("cmd2"))
+	got := LoadHistory()
+	if len(got) != 2 || got[0].Command != "cmd1" || got[1].Command != "cmd2" {
 		t.Fatalf("history = %v", got)
 	}
 }
+
+func TestParseArgsExecSubcommand(t *testing.T) {
+	resetFlagsAndArgs(t, []string{"exec-ecs", "exec", "-pr", "prof", "-command", "uptime", "extra"})
+	c := ParseArgs()
+	if c.Subcommand != "exec" || !c.Once {
+		t.Fatalf("exec subcommand should imply once: %+v", c)
+	}
+	if c.Profile != "prof" || c.Command != "uptime" {
+		t.Fatalf("flags after subcommand not applied: %+v", c)
+	}
+	if len(c.Args) != 1 || c.Args[0] != "extra" {
+		t.Fatalf("Args = %v", c.Args)
+	}
+}
+
+func TestParseArgsNamedTarget(t *testing.T) {
+	resetFlagsAndArgs(t, []string{"exec-ecs", "exec", "@web-prod", "-cn", "sidecar"})
+	c := ParseArgs()
+	if c.Subcommand != "exec" || c.Target != "web-prod" || c.Container != "sidecar" {
+		t.Fatalf("target not peeled off: %+v", c)
+	}
+	if !c.explicit["cn"] || c.explicit["command"] {
+		t.Fatalf("explicit flags = %v", c.explicit)
+	}
+}
+
+func TestParseArgsOnceFlag(t *testing.T) {
+	resetFlagsAndArgs(t, []string{"exec-ecs", "-once"})
+	c := ParseArgs()
+	if !c.Once || c.Subcommand != "" {
+		t.Fatalf("once flag wrong: %+v", c)
+	}
+}
+
+func TestParseArgsForwardSpecs(t *testing.T) {
+	resetFlagsAndArgs(t, []string{"exec-ecs", "forward", "-L", "8080:80", "-L", "5432:db:5432"})
+	c := ParseArgs()
+	if c.Subcommand != "forward" || c.Once {
+		t.Fatalf("forward subcommand wrong: %+v", c)
+	}
+	if len(c.Forwards) != 2 || c.Forwards[1] != "5432:db:5432" {
+		t.Fatalf("Forwards = %v", c.Forwards)
+	}
+}
+
+func TestParseArgsAllTasks(t *testing.T) {
+	resetFlagsAndArgs(t, []string{"exec-ecs", "--all-tasks", "-parallel", "8", "-output", "json"})
+	c := ParseArgs()
+	if !c.AllTasks || c.Parallel != 8 || c.Output != FanOutJSON {
+		t.Fatalf("all-tasks flags wrong: %+v", c)
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the optional user configuration in ConfigDir()/config.yaml.
+// Every field has a usable zero value, so a missing file is the same as an
+// empty one.
+type Config struct {
+	Recording RecordingConfig `yaml:"recording"`
+	// Protection guards the session's task against scale-in.
+	Protection ProtectionConfig `yaml:"protection"`
+	// Targets are named shortcuts, run as `exec-ecs @name`.
+	Targets map[string]TargetConfig `yaml:"targets"`
+	// Environments classify targets as prod, staging or dev.
+	Environments map[string]EnvironmentRule `yaml:"environments"`
+	// PolicyFile moves the command policy away from
+	// ConfigDir()/policy.yaml, e.g. to a file managed centrally.
+	PolicyFile string `yaml:"policy_file"`
+	// Audit says where the audit log goes.
+	Audit AuditConfig `yaml:"audit"`
+	// Reconnect says what to do when a session drops.
+	Reconnect ReconnectConfig `yaml:"reconnect"`
+	// EscapeChar starts in-session escape sequences (default ~).
+	EscapeChar string `yaml:"escape_char"`
+	// StatusLine keeps a status bar on the bottom row of interactive
+	// sessions unless -no-status-line is given.
+	StatusLine bool `yaml:"status_line"`
+	// Dashboard tunes `exec-ecs dashboard`.
+	Dashboard DashboardConfig `yaml:"dashboard"`
+}
+
+// RecordingConfig controls asciicast session recording.
+type RecordingConfig struct {
+	// Enabled records every interactive session unless -no-record is given.
+	Enabled bool `yaml:"enabled"`
+	// RetentionDays prunes recordings older than this many days
+	// (0 means defaultRecordingRetentionDays, negative keeps them forever).
+	RetentionDays int `yaml:"retention_days"`
+	// MaxFiles keeps at most this many recordings, newest first
+	// (0 means no limit).
+	MaxFiles int `yaml:"max_files"`
+}
+
+// ProtectionConfig controls ECS task scale-in protection during sessions.
+type ProtectionConfig struct {
+	// Enabled protects the task of every session unless -no-protect is
+	// given.
+	Enabled bool `yaml:"enabled"`
+	// ExpiresMinutes is the lifetime of each protection grant, renewed
+	// while the session is open (0 means defaultProtectionMinutes).
+	ExpiresMinutes int `yaml:"expires_minutes"`
+}
+
+func configPath() string { return filepath.Join(ConfigDir(), "config.yaml") }
+
+// LoadConfig reads config.yaml. A missing file yields an empty Config; a
+// malformed one is an error so typos don't silently disable settings.
+func LoadConfig() (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(configPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return &Config{}, fmt.Errorf("%s: %w", configPath(), err)
+	}
+	return cfg, nil
+}
+
+// settings returns the loaded config, or an empty one when none was loaded.
+func (c *Cli) settings() *Config {
+	if c.Config == nil {
+		return &Config{}
+	}
+	return c.Config
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setConfigDir points ConfigDir() at a fresh temp dir for the test.
+func setConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	prev := configDirOverride
+	configDirOverride = dir
+	t.Cleanup(func() { configDirOverride = prev })
+	return dir
+}
+
+func TestLoadConfigMissingFileIsEmpty(t *testing.T) {
+	setConfigDir(t)
+	cfg, err := LoadConfig()
+	if err != nil || cfg == nil || cfg.Recording.Enabled {
+		t.Fatalf("cfg=%+v err=%v", cfg, err)
+	}
+}
+
+func TestLoadConfigParsesRecording(t *testing.T) {
+	dir := setConfigDir(t)
+	yml := "recording:\n  enabled: true\n  retention_days: 7\n  max_files: 50\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(yml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	want := RecordingConfig{Enabled: true, RetentionDays: 7, MaxFiles: 50}
+	if cfg.Recording != want {
+		t.Fatalf("recording = %+v", cfg.Recording)
+	}
+}
+
+func TestLoadConfigRejectsMalformedYAML(t *testing.T) {
+	dir := setConfigDir(t)
+	_ = os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("recording: [unclosed"), 0o600)
+	cfg, err := LoadConfig()
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if cfg == nil {
+		t.Fatal("a usable empty config should still be returned")
+	}
+
+	_ = os.Remove(filepath.Join(dir, "config.yaml"))
+	_ = os.Mkdir(filepath.Join(dir, "config.yaml"), 0o700)
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("unreadable config should fail")
+	}
+}
+
+func TestCliSettingsDefaultsWhenUnloaded(t *testing.T) {
+	t.Parallel()
+	if (&Cli{}).settings() == nil {
+		t.Fatal("settings must never be nil")
+	}
+	cfg := &Config{Recording: RecordingConfig{Enabled: true}}
+	if (&Cli{Config: cfg}).settings() != cfg {
+		t.Fatal("loaded config should be returned as is")
+	}
+}
+
+func TestLoadConfigParsesTargets(t *testing.T) {
+	dir := setConfigDir(t)
+	yml := `targets:
+  web-prod:
+    profile: prod
+    region: eu-west-1
+    cluster: web
+    service: api
+    container: app
+    command: rails console
+    strategy: az
+    az: eu-west-1b
+`
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(yml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	want := TargetConfig{
+		Profile: "prod", Region: "eu-west-1", Cluster: "web", Service: "api",
+		Container: "app", Command: "rails console", Strategy: StrategyAZ, AZ: "eu-west-1b",
+	}
+	if got := cfg.Targets["web-prod"]; got != want {
+		t.Fatalf("target = %+v", got)
+	}
+}
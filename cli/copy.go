@@ -0,0 +1,676 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Upload data goes through the session's input as short text lines: 57 raw
+// bytes make a 76-character base64 line, as base64 itself writes them, and
+// 64 bytes of printf escapes stay far below the container terminal's line
+// limit.
+const (
+	uploadLineBase64 = 57
+	uploadLinePrintf = 64
+)
+
+// partSuffix marks in-flight files on either side so an interrupted copy
+// never leaves a truncated file under the real name.
+const partSuffix = ".exec-ecs-part"
+
+// remoteRunner runs a one-line sh script in the target container with in
+// (nil for none) as its input, streams its output into out and returns the
+// script's exit status.
+type remoteRunner func(ctx context.Context, script string, in io.Reader, out io.Writer) (int, error)
+
+// CopyOptions captures everything Copy needs. Exactly one of Src / Dst must
+// name a container path, written with a leading ':' (`:/tmp/heap.hprof`).
+type CopyOptions struct {
+	Region     string
+	ClusterArn string
+	// Service is only used to match the command policy. Optional.
+	Service   string
+	TaskArn   string
+	Container string
+	Src       string
+	Dst       string
+	// Environment is the target's class from GuardTarget.
+	Environment string
+}
+
+// ParseCopyPaths validates a cp source/destination pair and reports which
+// side lives in the container. The returned paths have the ':' stripped.
+func ParseCopyPaths(src, dst string) (download bool, local, remote string, err error) {
+	srcRemote := strings.HasPrefix(src, ":")
+	dstRemote := strings.HasPrefix(dst, ":")
+	switch {
+	case srcRemote == dstRemote:
+		return false, "", "", errors.New("exactly one of SRC and DST must be a container path starting with ':' (e.g. :/tmp/app.log)")
+	case srcRemote:
+		remote, local = strings.TrimPrefix(src, ":"), dst
+		download = true
+	default:
+		local, remote = src, strings.TrimPrefix(dst, ":")
+	}
+	if remote == "" || local == "" {
+		return false, "", "", errors.New("cp paths must not be empty")
+	}
+	return download, local, remote, nil
+}
+
+// Copy moves a file or directory between the local machine and a container
+// over the ECS Exec channel. Nothing beyond a POSIX sh is assumed on the
+// container side: data travels as base64 when the container has it, and
+// falls back to od (downloads) or printf octal escapes (uploads) otherwise.
+// No tar is needed. Every file is verified by size and, when the container
+// has sha256sum, by digest.
+//
+// The policy check and the audit log see the copy as a whole, as the
+// command `cp SRC DST`, rather than the helper scripts it runs.
+func Copy(ctx context.Context, c *Cli, awsCfg aws.Config, opts CopyOptions) (err error) {
+	finish, err := c.auditOperation(ctx, awsCfg, ExecOptions{
+		Region:      opts.Region,
+		ClusterArn:  opts.ClusterArn,
+		Service:     opts.Service,
+		TaskArn:     opts.TaskArn,
+		Container:   opts.Container,
+		Command:     "cp " + opts.Src + " " + opts.Dst,
+		Environment: opts.Environment,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		code := 0
+		if err != nil {
+			code = ExitSessionError
+		}
+		finish(code, err)
+	}()
+
+	run := func(ctx context.Context, script string, in io.Reader, out io.Writer) (int, error) {
+		if in == nil {
+			in = strings.NewReader("")
+		}
+		return ExecECS(ctx, c, awsCfg, ExecOptions{
+			Region:            opts.Region,
+			ClusterArn:        opts.ClusterArn,
+			TaskArn:           opts.TaskArn,
+			Container:         opts.Container,
+			Command:           script,
+			CaptureExitStatus: true,
+			Stdout:            out,
+			Stdin:             in,
+			NoHistory:         true,
+			Internal:          true,
+			Environment:       opts.Environment,
+		})
+	}
+	return newCopier(run, os.Stderr).copy(ctx, opts.Src, opts.Dst)
+}
+
+type copier struct {
+	run      remoteRunner
+	progress io.Writer
+}
+
+func newCopier(run remoteRunner, progress io.Writer) *copier {
+	return &copier{run: run, progress: progress}
+}
+
+func (cp *copier) copy(ctx context.Context, src, dst string) error {
+	download, local, remote, err := ParseCopyPaths(src, dst)
+	if err != nil {
+		return err
+	}
+	if download {
+		return cp.download(ctx, remote, local)
+	}
+	return cp.upload(ctx, local, remote)
+}
+
+// remoteInfo is what the probe script learns about a container path.
+type remoteInfo struct {
+	kind  string // "file", "dir" or "missing"
+	tools map[string]bool
+}
+
+func (cp *copier) probe(ctx context.Context, remote string) (remoteInfo, error) {
+	f := newFrame()
+	script := "P=" + shellQuote(remote) + "; echo " + f.begin +
+		`; if [ -d "$P" ]; then echo type=dir; elif [ -f "$P" ]; then echo type=file; else echo type=missing; fi` +
+		"; for t in base64 od sha256sum wc; do command -v $t >/dev/null 2>&1 && echo tool=$t; done; echo " + f.end
+	if err := cp.runFrame(ctx, script, nil, f, "probe "+remote); err != nil {
+		return remoteInfo{}, err
+	}
+	info := remoteInfo{tools: map[string]bool{}}
+	for _, line := range f.meta {
+		if v, ok := strings.CutPrefix(line, "type="); ok {
+			info.kind = v
+		}
+		if v, ok := strings.CutPrefix(line, "tool="); ok {
+			info.tools[v] = true
+		}
+	}
+	if info.kind == "" {
+		return remoteInfo{}, fmt.Errorf("probe %s: no answer from container", remote)
+	}
+	return info, nil
+}
+
+// runFrame runs script with input in and feeds its output through f,
+// failing on a non-zero exit status or a frame that never closed.
+func (cp *copier) runFrame(ctx context.Context, script string, in io.Reader, f *frame, what string) error {
+	code, err := cp.run(ctx, script, in, f)
+	f.Flush()
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	if f.err != nil {
+		return fmt.Errorf("%s: %w", what, f.err)
+	}
+	if code != 0 {
+		return fmt.Errorf("%s: remote command exited with code %d", what, code)
+	}
+	if f.state != frameDone {
+		return fmt.Errorf("%s: output was cut short", what)
+	}
+	return nil
+}
+
+func (cp *copier) download(ctx context.Context, remote, local string) error {
+	info, err := cp.probe(ctx, remote)
+	if err != nil {
+		return err
+	}
+	enc := ""
+	switch {
+	case info.tools["base64"]:
+		enc = "base64"
+	case info.tools["od"]:
+		enc = "od"
+	default:
+		return errors.New("the container has neither base64 nor od; cannot read files from it")
+	}
+
+	target := local
+	if st, err := os.Stat(local); err == nil && st.IsDir() {
+		target = filepath.Join(local, path.Base(remote))
+	}
+
+	switch info.kind {
+	case "missing":
+		return fmt.Errorf("%s: no such file or directory in the container", remote)
+	case "file":
+		return cp.downloadFile(ctx, remote, target, enc)
+	}
+
+	entries, err := cp.listRemoteDir(ctx, remote)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		rel := strings.TrimPrefix(strings.TrimPrefix(e.path, remote), "/")
+		dest := filepath.Join(target, filepath.FromSlash(rel))
+		if e.dir {
+			if err := os.MkdirAll(dest, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := cp.downloadFile(ctx, e.path, dest, enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type remoteEntry struct {
+	path string
+	dir  bool
+}
+
+// listRemoteDir walks a container directory with a pure-sh recursive
+// function (no find needed). Symlinks are skipped.
+func (cp *copier) listRemoteDir(ctx context.Context, remote string) ([]remoteEntry, error) {
+	f := newFrame()
+	script := `walk() { for f in "$1"/* "$1"/.[!.]* "$1"/..?*; do if [ -L "$f" ]; then continue; elif [ -d "$f" ]; then echo "d:$f"; walk "$f"; elif [ -f "$f" ]; then echo "f:$f"; fi; done; }; echo ` +
+		f.begin + "; walk " + shellQuote(strings.TrimSuffix(remote, "/")) + "; echo " + f.end
+	if err := cp.runFrame(ctx, script, nil, f, "list "+remote); err != nil {
+		return nil, err
+	}
+	entries := make([]remoteEntry, 0, len(f.meta))
+	for _, line := range f.meta {
+		kind, p, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		entries = append(entries, remoteEntry{path: p, dir: kind == "d"})
+	}
+	return entries, nil
+}
+
+// remoteChecksumScript prints size= and sha256= lines for "$P" using
+// whichever of wc / sha256sum the container has.
+const remoteChecksumScript = `command -v wc >/dev/null 2>&1 && echo "size=$(wc -c < "$P")"; command -v sha256sum >/dev/null 2>&1 && { s=$(sha256sum "$P"); echo "sha256=${s%% *}"; }`
+
+func (cp *copier) downloadFile(ctx context.Context, remote, local, enc string) error {
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return err
+	}
+	part := local + partSuffix
+	out, err := os.OpenFile(part, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(part) }()
+
+	dump := `base64 "$P"`
+	if enc == "od" {
+		dump = `od -An -v -tx1 "$P"`
+	}
+	f := newFrame()
+	hash := sha256.New()
+	bar := newProgressBar(cp.progress, remote)
+	f.decode = enc
+	f.sink = io.MultiWriter(out, hash, bar)
+	f.onMeta = func(line string) {
+		if v, ok := strings.CutPrefix(line, "size="); ok {
+			bar.total, _ = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	script := "P=" + shellQuote(remote) + "; echo " + f.begin + "; " + remoteChecksumScript + "; echo " + f.data + "; " + dump + "; echo " + f.end
+
+	runErr := cp.runFrame(ctx, script, nil, f, "read "+remote)
+	bar.Finish()
+	if cerr := out.Close(); runErr == nil {
+		runErr = cerr
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if err := cp.verify(remote, f.meta, bar.done, hex.EncodeToString(hash.Sum(nil))); err != nil {
+		return err
+	}
+	return os.Rename(part, local)
+}
+
+func (cp *copier) upload(ctx context.Context, local, remote string) error {
+	st, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	info, err := cp.probe(ctx, remote)
+	if err != nil {
+		return err
+	}
+	enc := "printf"
+	if info.tools["base64"] {
+		enc = "base64"
+	}
+
+	target := remote
+	if info.kind == "dir" {
+		target = strings.TrimSuffix(remote, "/") + "/" + filepath.Base(local)
+	}
+	if !st.IsDir() {
+		return cp.uploadFile(ctx, local, target, enc)
+	}
+
+	var dirs []string
+	var files []string
+	err = filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(local, p)
+		dest := target
+		if rel != "." {
+			dest = target + "/" + filepath.ToSlash(rel)
+		}
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, dest)
+		case d.Type().IsRegular():
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	quoted := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		quoted = append(quoted, shellQuote(d))
+	}
+	f := newFrame()
+	if err := cp.runFrame(ctx, "mkdir -p "+strings.Join(quoted, " ")+" && echo "+f.begin+" && echo "+f.end, nil, f, "create "+target); err != nil {
+		return err
+	}
+	for _, p := range files {
+		rel, _ := filepath.Rel(local, p)
+		if err := cp.uploadFile(ctx, p, target+"/"+filepath.ToSlash(rel), enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadFile streams local into one session. The container side reads
+// lines up to f.eof rather than to the end of its input, which a session's
+// terminal can't signal, then moves the part file into place and reports
+// its size and digest.
+func (cp *copier) uploadFile(ctx context.Context, local, remote, enc string) error {
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+	st, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	f := newFrame()
+	part := shellQuote(remote + partSuffix)
+	decode := `printf '%s\n' "$l"; done | base64 -d > ` + part
+	if enc == "printf" {
+		decode = `printf "$l"; done > ` + part
+	}
+	// The container's terminal would echo every line back; stty, where
+	// there is one, stops that.
+	script := "stty -echo 2>/dev/null; P=" + shellQuote(remote) + `; while IFS= read -r l; do [ "$l" = ` + f.eof + " ] && break; " + decode +
+		" && mv -f " + part + ` "$P" && echo ` + f.begin + "; " + remoteChecksumScript + "; echo " + f.end
+
+	hash := sha256.New()
+	bar := newProgressBar(cp.progress, local)
+	bar.total = st.Size()
+	in, out := io.Pipe()
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		_ = out.CloseWithError(writeUploadLines(out, io.TeeReader(src, io.MultiWriter(hash, bar)), enc, f.eof))
+	}()
+	runErr := cp.runFrame(ctx, script, in, f, "write "+remote)
+	// A session that ended early leaves the writer blocked on the pipe.
+	_ = in.Close()
+	<-sent
+	bar.Finish()
+	if runErr != nil {
+		return runErr
+	}
+	return cp.verify(remote, f.meta, bar.done, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// writeUploadLines writes r to w as lines of base64 or printf octal
+// escapes, followed by the eof line.
+func writeUploadLines(w io.Writer, r io.Reader, enc, eof string) error {
+	size := uploadLineBase64
+	if enc == "printf" {
+		size = uploadLinePrintf
+	}
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, size)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			line := base64.StdEncoding.EncodeToString(buf[:n])
+			if enc == "printf" {
+				line = octalEscape(buf[:n])
+			}
+			if _, werr := bw.WriteString(line + "\n"); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := bw.WriteString(eof + "\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// verify compares the container's size= / sha256= report with what we saw
+// locally. Missing tools on the container side downgrade the check (with a
+// warning) rather than failing the copy.
+func (cp *copier) verify(name string, meta []string, size int64, sum string) error {
+	checked := false
+	for _, line := range meta {
+		if v, ok := strings.CutPrefix(line, "size="); ok {
+			remoteSize, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err == nil && remoteSize != size {
+				return fmt.Errorf("%s: size mismatch (container %d bytes, local %d bytes)", name, remoteSize, size)
+			}
+			checked = true
+		}
+		if v, ok := strings.CutPrefix(line, "sha256="); ok {
+			if !strings.EqualFold(strings.TrimSpace(v), sum) {
+				return fmt.Errorf("%s: sha256 mismatch (container %s, local %s)", name, strings.TrimSpace(v), sum)
+			}
+			checked = true
+		}
+	}
+	if !checked {
+		fmt.Fprintf(cp.progress, "warning: %s copied without verification (container has neither wc nor sha256sum)\n", name)
+	}
+	return nil
+}
+
+// octalEscape renders data as printf-format octal escapes, which every POSIX
+// sh printf builtin understands.
+func octalEscape(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data) * 4)
+	for _, c := range data {
+		fmt.Fprintf(&b, `\%03o`, c)
+	}
+	return b.String()
+}
+
+// Frame states, in order.
+const (
+	frameBefore = iota
+	frameMeta
+	frameData
+	frameDone
+)
+
+// frame parses the output of a copy script. The plugin prints its own
+// banner lines around the session, so every script brackets the part we
+// care about with nonce markers: lines between begin and data (or end) are
+// metadata, lines between data and end are payload for decode. eof ends
+// the data an upload sends the other way.
+type frame struct {
+	begin, data, end, eof string
+
+	state   int
+	partial []byte
+	meta    []string
+	onMeta  func(string)
+
+	decode  string // "base64" or "od"
+	sink    io.Writer
+	pending string
+	err     error
+}
+
+func newFrame() *frame {
+	var b [6]byte
+	_, _ = rand.Read(b[:])
+	nonce := hex.EncodeToString(b[:])
+	return &frame{
+		begin: "__EXEC_ECS_BEGIN_" + nonce + "__",
+		data:  "__EXEC_ECS_DATA_" + nonce + "__",
+		end:   "__EXEC_ECS_END_" + nonce + "__",
+		eof:   "__EXEC_ECS_EOF_" + nonce + "__",
+	}
+}
+
+func (f *frame) Write(p []byte) (int, error) {
+	f.partial = append(f.partial, p...)
+	for {
+		nl := strings.IndexByte(string(f.partial), '\n')
+		if nl < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimRight(string(f.partial[:nl]), "\r")
+		f.partial = f.partial[nl+1:]
+		f.line(line)
+	}
+}
+
+// Flush processes a trailing line that arrived without a newline.
+func (f *frame) Flush() {
+	if len(f.partial) > 0 {
+		f.line(strings.TrimRight(string(f.partial), "\r"))
+		f.partial = nil
+	}
+}
+
+func (f *frame) line(line string) {
+	switch f.state {
+	case frameBefore:
+		if line == f.begin {
+			f.state = frameMeta
+		}
+	case frameMeta:
+		switch line {
+		case f.data:
+			f.state = frameData
+		case f.end:
+			f.state = frameDone
+		default:
+			f.meta = append(f.meta, line)
+			if f.onMeta != nil {
+				f.onMeta(line)
+			}
+		}
+	case frameData:
+		if line == f.end {
+			f.finishData()
+			f.state = frameDone
+			return
+		}
+		f.decodeLine(line)
+	}
+}
+
+func (f *frame) decodeLine(line string) {
+	if f.err != nil || f.sink == nil {
+		return
+	}
+	var out []byte
+	switch f.decode {
+	case "od":
+		for _, tok := range strings.Fields(line) {
+			v, err := strconv.ParseUint(tok, 16, 8)
+			if err != nil {
+				f.err = fmt.Errorf("bad od output %q", tok)
+				return
+			}
+			out = append(out, byte(v))
+		}
+	default:
+		f.pending += strings.TrimSpace(line)
+		n := len(f.pending) / 4 * 4
+		decoded, err := base64.StdEncoding.DecodeString(f.pending[:n])
+		if err != nil {
+			f.err = fmt.Errorf("bad base64 output: %w", err)
+			return
+		}
+		f.pending = f.pending[n:]
+		out = decoded
+	}
+	if _, err := f.sink.Write(out); err != nil {
+		f.err = err
+	}
+}
+
+func (f *frame) finishData() {
+	if f.pending != "" && f.err == nil {
+		f.err = fmt.Errorf("bad base64 output: %d dangling characters", len(f.pending))
+	}
+}
+
+// progressBar renders a single self-overwriting status line. Redraws are
+// throttled so a fast stream doesn't flood a slow terminal.
+type progressBar struct {
+	w     io.Writer
+	label string
+	total int64
+	done  int64
+	last  time.Time
+}
+
+func newProgressBar(w io.Writer, label string) *progressBar {
+	return &progressBar{w: w, label: label}
+}
+
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if time.Since(p.last) >= 100*time.Millisecond {
+		p.render()
+	}
+	return len(b), nil
+}
+
+// Finish draws the final state and moves to a fresh line.
+func (p *progressBar) Finish() {
+	p.render()
+	fmt.Fprintln(p.w)
+}
+
+func (p *progressBar) render() {
+	p.last = time.Now()
+	label := p.label
+	if len(label) > 30 {
+		label = "…" + label[len(label)-29:]
+	}
+	if p.total <= 0 {
+		fmt.Fprintf(p.w, "\r%-30s %s", label, humanBytes(p.done))
+		return
+	}
+	const width = 24
+	filled := min(int(p.done*width/p.total), width)
+	fmt.Fprintf(p.w, "\r%-30s [%s%s] %3d%% %s/%s", label,
+		strings.Repeat("#", filled), strings.Repeat(".", width-filled),
+		min(int(p.done*100/p.total), 100), humanBytes(p.done), humanBytes(p.total))
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
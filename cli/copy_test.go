@@ -0,0 +1,412 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestParseCopyPaths(t *testing.T) {
+	t.Parallel()
+
+	down, local, remote, err := ParseCopyPaths(":/tmp/heap.hprof", "./heap.hprof")
+	if err != nil || !down || local != "./heap.hprof" || remote != "/tmp/heap.hprof" {
+		t.Fatalf("download = %v %q %q %v", down, local, remote, err)
+	}
+	down, local, remote, err = ParseCopyPaths("run.sh", ":/tmp/run.sh")
+	if err != nil || down || local != "run.sh" || remote != "/tmp/run.sh" {
+		t.Fatalf("upload = %v %q %q %v", down, local, remote, err)
+	}
+	for _, pair := range [][2]string{{"a", "b"}, {":a", ":b"}, {":", "b"}, {"", ":b"}} {
+		if _, _, _, err := ParseCopyPaths(pair[0], pair[1]); err == nil {
+			t.Fatalf("ParseCopyPaths(%q, %q) should fail", pair[0], pair[1])
+		}
+	}
+}
+
+// localRunner pretends the local machine is the container: scripts run
+// under /bin/sh with PATH limited to tools, wrapped in the kind of banner
+// noise session-manager-plugin prints.
+func localRunner(t *testing.T, tools ...string) remoteRunner {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("copy scripts need a POSIX shell")
+	}
+	bin := t.TempDir()
+	for _, tool := range append(tools, "mv", "mkdir") {
+		p, err := exec.LookPath(tool)
+		if err != nil {
+			t.Skipf("%s not available: %v", tool, err)
+		}
+		if err := os.Symlink(p, filepath.Join(bin, tool)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func(ctx context.Context, script string, in io.Reader, out io.Writer) (int, error) {
+		_, _ = io.WriteString(out, "\r\nStarting session with SessionId: ecs-execute-command-123\r\n")
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", script)
+		cmd.Env = []string{"PATH=" + bin}
+		cmd.Stdin = in
+		cmd.Stdout = out
+		cmd.Stderr = out
+		err := cmd.Run()
+		_, _ = io.WriteString(out, "\r\n\r\nExiting session with sessionId: ecs-execute-command-123.\r\n")
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 0, err
+	}
+}
+
+var allTools = []string{"base64", "od", "sha256sum", "wc"}
+
+// testPayload covers every byte value plus a chunk-straddling tail.
+func testPayload() []byte {
+	var b []byte
+	for i := 0; i < 3; i++ {
+		for c := 0; c < 256; c++ {
+			b = append(b, byte(c))
+		}
+	}
+	return append(b, []byte("tail\n")...)
+}
+
+func TestCopyFileRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		tools []string
+	}{
+		{"base64", allTools},
+		{"od and printf only", []string{"od", "wc", "sha256sum"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src.bin")
+			payload := testPayload()
+			if err := os.WriteFile(src, payload, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var progress bytes.Buffer
+			cp := newCopier(localRunner(t, tc.tools...), &progress)
+			remote := filepath.Join(dir, "container.bin")
+			if err := cp.copy(context.Background(), src, ":"+remote); err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			got, _ := os.ReadFile(remote)
+			if !bytes.Equal(got, payload) {
+				t.Fatalf("uploaded %d bytes, want %d", len(got), len(payload))
+			}
+
+			back := filepath.Join(dir, "back.bin")
+			if err := cp.copy(context.Background(), ":"+remote, back); err != nil {
+				t.Fatalf("download: %v", err)
+			}
+			got, _ = os.ReadFile(back)
+			if !bytes.Equal(got, payload) {
+				t.Fatalf("downloaded %d bytes, want %d", len(got), len(payload))
+			}
+			if _, err := os.Stat(back + partSuffix); !os.IsNotExist(err) {
+				t.Fatal("part file should be renamed away")
+			}
+			if !strings.Contains(progress.String(), "100%") {
+				t.Fatalf("progress never reached 100%%: %q", progress.String())
+			}
+		})
+	}
+}
+
+func TestCopyRunsOverExecSessions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("copy scripts need a POSIX shell")
+	}
+	prevStart := startExecuteCommand
+	prevStarter := sessionStarter
+	t.Cleanup(func() {
+		startExecuteCommand = prevStart
+		sessionStarter = prevStarter
+	})
+
+	// Run each wrapped ExecuteCommand locally, as the agent would.
+	var sent string
+	sessions := 0
+	startExecuteCommand = func(_ context.Context, _ ecsExecuteCommander, opts ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		sessions++
+		sent = opts.Command
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok")}}, nil
+	}
+	sessionStarter = func(ctx context.Context, _ string, _ *ecstypes.Session, opts ptyOptions) (int, error) {
+		if opts.Stdin == nil {
+			t.Fatal("cp sessions must not read the terminal")
+		}
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", sent)
+		cmd.Stdout = opts.Stdout
+		return 0, cmd.Run()
+	}
+	setHistoryFile(t)
+	auditPath := setAuditFile(t)
+
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.txt")
+	_ = os.WriteFile(remote, []byte("from the container\n"), 0o644)
+	local := filepath.Join(dir, "local.txt")
+	opts := CopyOptions{
+		Region: "eu-west-1", ClusterArn: "c", TaskArn: "t", Container: "app",
+		Src: ":" + remote, Dst: local,
+	}
+	// The policy sees `cp`, never the sh scripts that carry it out.
+	c := &Cli{Policy: loadTestPolicy(t, "default: deny\nrules:\n  - allow: [bash, 'cp *']\n")}
+	if err := Copy(context.Background(), c, aws.Config{}, opts); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != "from the container\n" {
+		t.Fatalf("content = %q", got)
+	}
+	if h := LoadHistory(); len(h) != 0 {
+		t.Fatalf("cp must not record history, got %v", h)
+	}
+	events := readAudit(t, auditPath)
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, e.Event)
+	}
+	if strings.Join(kinds, " ") != "policy session-start session-end" || events[1].Command != "cp :"+remote+" "+local {
+		t.Fatalf("audit = %+v", events)
+	}
+
+	c.Policy = loadTestPolicy(t, "default: deny\nrules:\n  - allow: [bash]\n")
+	before := sessions
+	if err := Copy(context.Background(), c, aws.Config{}, opts); err == nil || !strings.Contains(err.Error(), "denies") {
+		t.Fatalf("denied cp err = %v", err)
+	}
+	if sessions != before {
+		t.Fatal("a denied cp must not open sessions")
+	}
+}
+
+func TestUploadStreamsEachFileThroughOneSession(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "big.bin")
+	payload := bytes.Repeat(testPayload(), 200)
+	_ = os.WriteFile(src, payload, 0o644)
+
+	run := localRunner(t, allTools...)
+	sessions := 0
+	counting := func(ctx context.Context, script string, in io.Reader, out io.Writer) (int, error) {
+		sessions++
+		return run(ctx, script, in, out)
+	}
+	remote := filepath.Join(dir, "remote.bin")
+	if err := newCopier(counting, io.Discard).copy(context.Background(), src, ":"+remote); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if got, _ := os.ReadFile(remote); !bytes.Equal(got, payload) {
+		t.Fatalf("uploaded %d bytes, want %d", len(got), len(payload))
+	}
+	// One probe, then one session for the whole file.
+	if sessions != 2 {
+		t.Fatalf("sessions = %d", sessions)
+	}
+}
+
+func TestCopyIntoExistingDirectories(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app.log")
+	_ = os.WriteFile(src, []byte("line\n"), 0o644)
+	remoteDir := filepath.Join(dir, "remote")
+	localDir := filepath.Join(dir, "local")
+	_ = os.Mkdir(remoteDir, 0o755)
+	_ = os.Mkdir(localDir, 0o755)
+
+	cp := newCopier(localRunner(t, allTools...), io.Discard)
+	if err := cp.copy(context.Background(), src, ":"+remoteDir); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if err := cp.copy(context.Background(), ":"+filepath.Join(remoteDir, "app.log"), localDir); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(localDir, "app.log")); string(got) != "line\n" {
+		t.Fatalf("content = %q", got)
+	}
+}
+
+func TestCopyDirectoryRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	tree := map[string]string{
+		"a.txt":            "alpha",
+		"sub/b.txt":        "beta",
+		"sub/.hidden":      "secret",
+		"sub/deeper/empty": "",
+		"it's quoted.txt":  "q",
+	}
+	src := filepath.Join(dir, "conf")
+	for rel, body := range tree {
+		p := filepath.Join(src, rel)
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		_ = os.WriteFile(p, []byte(body), 0o644)
+	}
+	_ = os.MkdirAll(filepath.Join(src, "emptydir"), 0o755)
+
+	cp := newCopier(localRunner(t, allTools...), io.Discard)
+	remote := filepath.Join(dir, "remote-conf")
+	if err := cp.copy(context.Background(), src, ":"+remote); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	back := filepath.Join(dir, "back")
+	if err := cp.copy(context.Background(), ":"+remote, back); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	for rel, body := range tree {
+		got, err := os.ReadFile(filepath.Join(back, rel))
+		if err != nil || string(got) != body {
+			t.Fatalf("%s = %q, %v", rel, got, err)
+		}
+	}
+	if st, err := os.Stat(filepath.Join(back, "emptydir")); err != nil || !st.IsDir() {
+		t.Fatalf("empty dir not copied: %v", err)
+	}
+}
+
+func TestCopyErrors(t *testing.T) {
+	dir := t.TempDir()
+	cp := newCopier(localRunner(t, allTools...), io.Discard)
+
+	err := cp.copy(context.Background(), ":"+filepath.Join(dir, "nope"), dir)
+	if err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Fatalf("missing remote err = %v", err)
+	}
+	if err := cp.copy(context.Background(), filepath.Join(dir, "nope"), ":"+dir); err == nil {
+		t.Fatal("missing local source should fail")
+	}
+	if err := cp.copy(context.Background(), "a", "b"); err == nil {
+		t.Fatal("two local paths should fail")
+	}
+
+	bare := newCopier(localRunner(t), io.Discard)
+	src := filepath.Join(dir, "f")
+	_ = os.WriteFile(src, []byte("x"), 0o644)
+	if err := bare.copy(context.Background(), ":"+src, filepath.Join(dir, "g")); err == nil || !strings.Contains(err.Error(), "neither base64 nor od") {
+		t.Fatalf("no decoder err = %v", err)
+	}
+
+	failing := newCopier(func(context.Context, string, io.Reader, io.Writer) (int, error) {
+		return 0, errors.New("TargetNotConnected")
+	}, io.Discard)
+	if err := failing.copy(context.Background(), src, ":/x"); err == nil || !strings.Contains(err.Error(), "TargetNotConnected") {
+		t.Fatalf("session err = %v", err)
+	}
+	exiting := newCopier(func(context.Context, string, io.Reader, io.Writer) (int, error) { return 3, nil }, io.Discard)
+	if err := exiting.copy(context.Background(), src, ":/x"); err == nil || !strings.Contains(err.Error(), "code 3") {
+		t.Fatalf("exit err = %v", err)
+	}
+	silent := newCopier(func(context.Context, string, io.Reader, io.Writer) (int, error) { return 0, nil }, io.Discard)
+	if err := silent.copy(context.Background(), src, ":/x"); err == nil || !strings.Contains(err.Error(), "cut short") {
+		t.Fatalf("truncated err = %v", err)
+	}
+}
+
+func TestCopyUnverifiedWarns(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "f")
+	_ = os.WriteFile(src, []byte("data"), 0o644)
+
+	var progress bytes.Buffer
+	cp := newCopier(localRunner(t, "base64"), &progress)
+	if err := cp.copy(context.Background(), src, ":"+filepath.Join(dir, "g")); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if !strings.Contains(progress.String(), "without verification") {
+		t.Fatalf("expected a warning, got %q", progress.String())
+	}
+}
+
+func TestVerifyDetectsMismatch(t *testing.T) {
+	t.Parallel()
+
+	cp := newCopier(nil, io.Discard)
+	if err := cp.verify("f", []string{"size=  5"}, 4, "ab"); err == nil || !strings.Contains(err.Error(), "size mismatch") {
+		t.Fatalf("size err = %v", err)
+	}
+	if err := cp.verify("f", []string{"size=4", "sha256=cd"}, 4, "ab"); err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatalf("sha err = %v", err)
+	}
+	if err := cp.verify("f", []string{"size=4", "sha256=AB"}, 4, "ab"); err != nil {
+		t.Fatalf("matching err = %v", err)
+	}
+}
+
+func TestFrameDecodesSplitWrites(t *testing.T) {
+	t.Parallel()
+
+	var sink bytes.Buffer
+	f := newFrame()
+	f.decode = "base64"
+	f.sink = &sink
+	stream := "noise\r\n" + f.begin + "\r\nsize=5\r\n" + f.data + "\r\naGVs\r\nbG8=\r\n" + f.end + "\r\ntrailer"
+	for i := 0; i < len(stream); i += 3 {
+		_, _ = f.Write([]byte(stream[i:min(i+3, len(stream))]))
+	}
+	f.Flush()
+	if f.state != frameDone || f.err != nil {
+		t.Fatalf("state=%d err=%v", f.state, f.err)
+	}
+	if sink.String() != "hello" || len(f.meta) != 1 || f.meta[0] != "size=5" {
+		t.Fatalf("sink=%q meta=%v", sink.String(), f.meta)
+	}
+}
+
+func TestFrameRejectsGarbage(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct{ decode, body string }{
+		{"od", "zz"},
+		{"base64", "!!!!"},
+		{"base64", "abc"},
+	} {
+		f := newFrame()
+		f.decode = tc.decode
+		f.sink = io.Discard
+		_, _ = f.Write([]byte(f.begin + "\n" + f.data + "\n" + tc.body + "\n" + f.end + "\n"))
+		if f.err == nil {
+			t.Fatalf("%s %q should fail", tc.decode, tc.body)
+		}
+	}
+}
+
+func TestOctalEscape(t *testing.T) {
+	t.Parallel()
+
+	if got := octalEscape([]byte{0, 'A', 255}); got != `\000\101\377` {
+		t.Fatalf("escape = %q", got)
+	}
+}
+
+func TestProgressBarAndHumanBytes(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	bar := newProgressBar(&out, strings.Repeat("x", 40))
+	_, _ = bar.Write(make([]byte, 10))
+	bar.Finish()
+	if !strings.Contains(out.String(), "10 B") || !strings.Contains(out.String(), "…") {
+		t.Fatalf("unknown-size bar = %q", out.String())
+	}
+
+	for n, want := range map[int64]string{512: "512 B", 2048: "2.0 KiB", 3 << 20: "3.0 MiB"} {
+		if got := humanBytes(n); got != want {
+			t.Fatalf("humanBytes(%d) = %q want %q", n, got, want)
+		}
+	}
+}
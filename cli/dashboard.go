@@ -0,0 +1,429 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// defaultDashboardRefresh is how often the dashboard reloads unless
+	// -refresh or dashboard.refresh_seconds says otherwise.
+	defaultDashboardRefresh = 15 * time.Second
+	// dashboardChurnWindow is how far back stopped tasks count as churn.
+	// ECS forgets stopped tasks after about this long anyway.
+	dashboardChurnWindow = time.Hour
+	// describeClustersBatchSize is the most clusters DescribeClusters
+	// accepts per call.
+	describeClustersBatchSize = 100
+)
+
+// DashboardConfig controls `exec-ecs dashboard`.
+type DashboardConfig struct {
+	// RefreshSeconds is how often the dashboard reloads
+	// (0 means defaultDashboardRefresh).
+	RefreshSeconds int `yaml:"refresh_seconds"`
+}
+
+// DashboardRefresh is how often the dashboard reloads: -refresh wins over
+// dashboard.refresh_seconds in config.yaml.
+func (c *Cli) DashboardRefresh() time.Duration {
+	if c.Refresh > 0 {
+		return c.Refresh
+	}
+	if s := c.settings().Dashboard.RefreshSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultDashboardRefresh
+}
+
+// dashboardECS is what the dashboard reads.
+type dashboardECS interface {
+	ecsClusterLister
+	ecsClusterDescriber
+	ecsServiceInspector
+	ecsStoppedTaskLister
+}
+
+// DashboardSnapshot is one load of the dashboard.
+type DashboardSnapshot struct {
+	At       time.Time
+	Clusters []DashboardCluster
+}
+
+// DashboardCluster is one cluster and its services.
+type DashboardCluster struct {
+	Arn            string
+	Name           string
+	Status         string
+	RunningTasks   int32
+	PendingTasks   int32
+	ActiveServices int32
+	Services       []DashboardService
+}
+
+// DashboardService is a service with the tasks it lost recently.
+type DashboardService struct {
+	ServiceRow
+	// StoppedLastHour counts the service's tasks that stopped within
+	// dashboardChurnWindow.
+	StoppedLastHour int
+}
+
+// DashboardPick is the service chosen on the dashboard.
+type DashboardPick struct {
+	ClusterArn string
+	Service    string
+}
+
+// LoadDashboard describes the given clusters, or every cluster in the
+// region when there are none, with their services and recent stopped
+// tasks. Clusters are loaded side by side and sorted by name.
+func (c *Cli) LoadDashboard(ctx context.Context, client dashboardECS, clusterArns []string) (DashboardSnapshot, error) {
+	now := time.Now()
+	if len(clusterArns) == 0 {
+		c.LogAWSCommand("ecs", "list-clusters", "--profile", c.Profile, "--region", c.Region)
+		var err error
+		if clusterArns, err = listAllClusterArns(ctx, client); err != nil {
+			return DashboardSnapshot{}, err
+		}
+	}
+	var described []ecstypes.Cluster
+	for start := 0; start < len(clusterArns); start += describeClustersBatchSize {
+		end := min(start+describeClustersBatchSize, len(clusterArns))
+		c.LogAWSCommand("ecs", "describe-clusters", "--clusters", strings.Join(clusterArns[start:end], " "), "--profile", c.Profile, "--region", c.Region)
+		out, err := client.DescribeClusters(ctx, &ecs.DescribeClustersInput{Clusters: clusterArns[start:end]})
+		if err != nil {
+			return DashboardSnapshot{}, err
+		}
+		described = append(described, out.Clusters...)
+	}
+
+	clusters := make([]DashboardCluster, len(described))
+	errs := make([]error, len(described))
+	var wg sync.WaitGroup
+	for i, cl := range described {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clusters[i], errs[i] = c.loadDashboardCluster(ctx, client, cl, now)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return DashboardSnapshot{}, err
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	return DashboardSnapshot{At: now, Clusters: clusters}, nil
+}
+
+func (c *Cli) loadDashboardCluster(ctx context.Context, client dashboardECS, cl ecstypes.Cluster, now time.Time) (DashboardCluster, error) {
+	arn := aws.ToString(cl.ClusterArn)
+	out := DashboardCluster{
+		Arn:            arn,
+		Name:           aws.ToString(cl.ClusterName),
+		Status:         aws.ToString(cl.Status),
+		RunningTasks:   cl.RunningTasksCount,
+		PendingTasks:   cl.PendingTasksCount,
+		ActiveServices: cl.ActiveServicesCount,
+	}
+	rows, err := c.ListServiceRows(ctx, client, arn)
+	if err != nil {
+		return out, fmt.Errorf("%s: %w", out.Name, err)
+	}
+	churn, err := c.stoppedByService(ctx, client, arn, now.Add(-dashboardChurnWindow))
+	if err != nil {
+		return out, fmt.Errorf("%s: %w", out.Name, err)
+	}
+	for _, r := range rows {
+		out.Services = append(out.Services, DashboardService{ServiceRow: r, StoppedLastHour: churn[r.Name]})
+	}
+	return out, nil
+}
+
+// stoppedByService counts the cluster's tasks that stopped after since, by
+// service name. One listing covers every service.
+func (c *Cli) stoppedByService(ctx context.Context, client ecsStoppedTaskLister, clusterArn string, since time.Time) (map[string]int, error) {
+	c.LogAWSCommand("ecs", "list-tasks", "--cluster", clusterArn, "--desired-status", "STOPPED", "--profile", c.Profile, "--region", c.Region)
+	arns, err := listTaskArnsByStatus(ctx, client, clusterArn, "", ecstypes.DesiredStatusStopped)
+	if err != nil || len(arns) == 0 {
+		return nil, err
+	}
+	tasks, err := describeAllTasks(ctx, client, clusterArn, arns)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, t := range tasks {
+		service, ok := strings.CutPrefix(aws.ToString(t.Group), "service:")
+		if ok && aws.ToTime(t.StoppedAt).After(since) {
+			counts[service]++
+		}
+	}
+	return counts, nil
+}
+
+// dashboardHeaders are the dashboard's column titles.
+var dashboardHeaders = []string{"SERVICE", "DESIRED", "RUNNING", "PENDING", "ROLLOUT", "STOPPED 1H", "TASK DEF", "LAST EVENT"}
+
+// dashboardEventWidth caps the last-event column.
+const dashboardEventWidth = 60
+
+type dashboardLoadedMsg struct {
+	snap DashboardSnapshot
+	err  error
+}
+
+// dashboardTickMsg asks for a reload. gen ties it to the load that
+// scheduled it, so a manual refresh doesn't start a second timer.
+type dashboardTickMsg struct{ gen int }
+
+// dashboardRow is a service as the dashboard lists it.
+type dashboardRow struct {
+	cluster int
+	service DashboardService
+}
+
+// dashboardModel is the auto-refreshing overview. Rows are the services of
+// every cluster in order; the cursor stays on the same service across
+// reloads.
+type dashboardModel struct {
+	title   string
+	refresh time.Duration
+	load    func() (DashboardSnapshot, error)
+
+	snap    DashboardSnapshot
+	rows    []dashboardRow
+	table   *menuTable
+	loaded  bool
+	loading bool
+	gen     int
+	err     error
+	cursor  int
+	width   int
+	height  int
+	pick    *DashboardPick
+}
+
+func newDashboardModel(title string, refresh time.Duration, load func() (DashboardSnapshot, error)) dashboardModel {
+	return dashboardModel{title: title, refresh: refresh, load: load, loading: true, width: 100, height: maxLayoutHeight}
+}
+
+func (m dashboardModel) loadCmd() tea.Cmd {
+	return func() tea.Msg {
+		snap, err := m.load()
+		return dashboardLoadedMsg{snap: snap, err: err}
+	}
+}
+
+func (m dashboardModel) Init() tea.Cmd { return m.loadCmd() }
+
+func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case dashboardLoadedMsg:
+		m.loading = false
+		m.err = msg.err
+		if msg.err == nil {
+			m.setSnapshot(msg.snap)
+		}
+		m.gen++
+		gen := m.gen
+		return m, tea.Tick(m.refresh, func(time.Time) tea.Msg { return dashboardTickMsg{gen: gen} })
+	case dashboardTickMsg:
+		if m.loading || msg.gen != m.gen {
+			return m, nil
+		}
+		m.loading = true
+		return m, m.loadCmd()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		case "up", "k":
+			m.cursor = max(0, m.cursor-1)
+		case "down", "j":
+			m.cursor = max(0, min(len(m.rows)-1, m.cursor+1))
+		case "home", "g":
+			m.cursor = 0
+		case "end", "G":
+			m.cursor = max(0, len(m.rows)-1)
+		case "r":
+			if !m.loading {
+				m.loading = true
+				return m, m.loadCmd()
+			}
+		case "enter":
+			if m.cursor < len(m.rows) {
+				row := m.rows[m.cursor]
+				m.pick = &DashboardPick{ClusterArn: m.snap.Clusters[row.cluster].Arn, Service: row.service.Arn}
+				return m, tea.Quit
+			}
+		}
+	}
+	return m, nil
+}
+
+// setSnapshot shows snap, keeping the cursor on the service it was on.
+func (m *dashboardModel) setSnapshot(snap DashboardSnapshot) {
+	current := ""
+	if m.cursor < len(m.rows) {
+		current = m.rows[m.cursor].service.Arn
+	}
+	m.snap, m.loaded = snap, true
+	m.rows = nil
+	for i, cl := range snap.Clusters {
+		for _, s := range cl.Services {
+			m.rows = append(m.rows, dashboardRow{cluster: i, service: s})
+		}
+	}
+	m.table = dashboardTable(snap.At, m.rows)
+	m.cursor = min(m.cursor, max(0, len(m.rows)-1))
+	for i, r := range m.rows {
+		if r.service.Arn == current {
+			m.cursor = i
+		}
+	}
+}
+
+// dashboardTable lays the rows out in columns that line up across
+// clusters.
+func dashboardTable(now time.Time, rows []dashboardRow) *menuTable {
+	cells := make([][]string, len(rows))
+	keys := make([]string, len(rows))
+	for i, r := range rows {
+		s := r.service
+		event := "-"
+		if len(s.Events) > 0 {
+			event = compactAge(now, s.Events[0].At) + " " + s.Events[0].Message
+			if runes := []rune(event); len(runes) > dashboardEventWidth {
+				event = string(runes[:dashboardEventWidth-1]) + "…"
+			}
+		}
+		cells[i] = []string{s.Name, fmt.Sprint(s.Desired), fmt.Sprint(s.Running), fmt.Sprint(s.Pending), dashIfEmpty(s.Rollout), fmt.Sprint(s.StoppedLastHour), dashIfEmpty(s.TaskDef), event}
+		keys[i] = s.Arn
+	}
+	return newMenuTable(dashboardHeaders, cells, nil, keys)
+}
+
+// unhealthy reports whether a service needs a look: short of tasks, a
+// failed rollout, or tasks stopping.
+func (s DashboardService) unhealthy() bool {
+	return s.Running < s.Desired || s.Rollout == string(ecstypes.DeploymentRolloutStateFailed) || s.StoppedLastHour > 0
+}
+
+func (m dashboardModel) View() string {
+	width := max(40, m.width)
+	var b strings.Builder
+
+	title := lipgloss.NewStyle().Foreground(CurrentTheme.TitleFg).Bold(true).Render(m.title)
+	state := "every " + m.refresh.String()
+	if m.loaded {
+		state = "updated " + m.snap.At.Local().Format("15:04:05") + " · " + state
+	}
+	if m.loading {
+		state = "refreshing… · " + state
+	}
+	b.WriteString(title + strings.Repeat(" ", max(1, width-lipgloss.Width(title)-lipgloss.Width(state))) + state + "\n")
+	if m.err != nil {
+		b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("Refresh failed: "+m.err.Error()) + "\n")
+	}
+	if !m.loaded {
+		b.WriteString("\nLoading clusters and services...\n")
+		return b.String()
+	}
+	if len(m.rows) == 0 {
+		b.WriteString("\nNo services found.\n")
+	}
+
+	// Cluster headings take a line each; show the window of lines around
+	// the cursor that fits above the detail pane.
+	type line struct {
+		text string
+		row  int // -1 for a cluster heading
+	}
+	var lines []line
+	lineOfCursor := 0
+	bodyLines := m.table.lines()
+	for i, r := range m.rows {
+		if i == 0 || r.cluster != m.rows[i-1].cluster {
+			cl := m.snap.Clusters[r.cluster]
+			heading := fmt.Sprintf("%s  %s  %d services  %d running  %d pending", cl.Name, cl.Status, cl.ActiveServices, cl.RunningTasks, cl.PendingTasks)
+			lines = append(lines, line{text: heading, row: -1})
+		}
+		if i == m.cursor {
+			lineOfCursor = len(lines)
+		}
+		lines = append(lines, line{text: bodyLines[i], row: i})
+	}
+	// Title, header, rule, help and the selected row's border.
+	room := max(3, m.height-detailRows-8)
+	start := 0
+	if lineOfCursor >= room {
+		start = lineOfCursor - room + 1
+	}
+	end := min(len(lines), start+room)
+
+	if len(m.rows) > 0 {
+		b.WriteString("\n" + lipgloss.NewStyle().Foreground(CurrentTheme.TitleFg).Bold(true).Render("  "+m.table.header()) + "\n")
+	}
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	heading := lipgloss.NewStyle().Foreground(CurrentTheme.MainBorder).Bold(true)
+	for _, l := range lines[start:end] {
+		switch {
+		case l.row < 0:
+			b.WriteString(heading.Render(l.text))
+		case l.row == m.cursor:
+			b.WriteString(CurrentTheme.SelectedItem.Render(selectedMarker + " " + l.text))
+		case m.rows[l.row].service.unhealthy():
+			b.WriteString(warn.Render("  " + l.text))
+		default:
+			b.WriteString(CurrentTheme.ItemStyle.Render("  " + l.text))
+		}
+		b.WriteString("\n")
+	}
+
+	if m.cursor < len(m.rows) {
+		b.WriteString(lipgloss.NewStyle().Foreground(CurrentTheme.MainBorder).Render(strings.Repeat("─", width)) + "\n")
+		detail := strings.Split(serviceDetail(m.snap.At, m.rows[m.cursor].service.ServiceRow), "\n")
+		for _, l := range detail[:min(len(detail), detailRows-1)] {
+			if r := []rune(l); len(r) > width {
+				l = string(r[:width-1]) + "…"
+			}
+			b.WriteString(l + "\n")
+		}
+	}
+	b.WriteString(lipgloss.NewStyle().Foreground(CurrentTheme.StatusFg).Background(CurrentTheme.StatusBg).Render(" ↑↓ Move  Enter Tasks  r Refresh  q Quit "))
+	return b.String()
+}
+
+// RunDashboard shows the dashboard for clusterArns (every cluster in the
+// region when empty) until the user quits or picks a service.
+func (c *Cli) RunDashboard(ctx context.Context, client dashboardECS, clusterArns []string) (*DashboardPick, error) {
+	profile := c.Profile
+	if profile == "" {
+		profile = "default"
+	}
+	title := fmt.Sprintf("exec-ecs dashboard · %s · %s", profile, c.Region)
+	m := newDashboardModel(title, c.DashboardRefresh(), func() (DashboardSnapshot, error) {
+		return c.LoadDashboard(ctx, client, clusterArns)
+	})
+	opts := append([]tea.ProgramOption{tea.WithAltScreen(), tea.WithContext(ctx)}, promptExtraOpts...)
+	final, err := tea.NewProgram(m, opts...).Run()
+	if err != nil {
+		return nil, err
+	}
+	return final.(dashboardModel).pick, nil
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestLoadDashboard(t *testing.T) {
+	t.Parallel()
+
+	api, worker := richService("api"), richService("worker")
+	now := time.Now()
+	f := &fakeServiceECS{fakeECS: fakeECS{
+		clustersPages: [][]string{{"arn:aws:ecs:eu-west-1:1:cluster/web"}},
+		clusters: []ecstypes.Cluster{{
+			ClusterArn: aws.String("arn:aws:ecs:eu-west-1:1:cluster/web"), ClusterName: aws.String("web"), Status: aws.String("ACTIVE"),
+			RunningTasksCount: 4, PendingTasksCount: 1, ActiveServicesCount: 2,
+		}},
+		servicesPages: [][]string{{aws.ToString(worker.ServiceArn), aws.ToString(api.ServiceArn)}},
+		services:      []ecstypes.Service{api, worker},
+		tasksPages:    [][]string{{"s1", "s2", "s3"}},
+		describeTasks: []ecstypes.Task{
+			{TaskArn: aws.String("s1"), Group: aws.String("service:api"), StoppedAt: aws.Time(now.Add(-10 * time.Minute))},
+			{TaskArn: aws.String("s2"), Group: aws.String("service:api"), StoppedAt: aws.Time(now.Add(-2 * time.Hour))},
+			{TaskArn: aws.String("s3"), Group: aws.String("family:migrate"), StoppedAt: aws.Time(now.Add(-time.Minute))},
+		},
+	}}
+	snap, err := (&Cli{}).LoadDashboard(context.Background(), f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Clusters) != 1 || f.clusterCalls != 1 {
+		t.Fatalf("clusters = %+v", snap.Clusters)
+	}
+	cl := snap.Clusters[0]
+	if cl.Name != "web" || cl.RunningTasks != 4 || len(cl.Services) != 2 || cl.Services[0].Name != "api" {
+		t.Fatalf("cluster = %+v", cl)
+	}
+	if cl.Services[0].StoppedLastHour != 1 || cl.Services[1].StoppedLastHour != 0 {
+		t.Fatalf("churn = %d, %d", cl.Services[0].StoppedLastHour, cl.Services[1].StoppedLastHour)
+	}
+	if f.taskStatuses[0] != ecstypes.DesiredStatusStopped || f.taskServices[0] != "" {
+		t.Fatalf("stopped tasks listed with %v %v", f.taskStatuses, f.taskServices)
+	}
+}
+
+func TestDashboardRefresh(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{Dashboard: DashboardConfig{RefreshSeconds: 30}}
+	cases := []struct {
+		c    Cli
+		want time.Duration
+	}{
+		{Cli{}, defaultDashboardRefresh},
+		{Cli{Config: cfg}, 30 * time.Second},
+		{Cli{Config: cfg, Refresh: 5 * time.Second}, 5 * time.Second},
+	}
+	for i, tc := range cases {
+		if got := tc.c.DashboardRefresh(); got != tc.want {
+			t.Errorf("case %d: got %s", i, got)
+		}
+	}
+}
+
+func dashboardSnapshot(names ...string) DashboardSnapshot {
+	cl := DashboardCluster{Arn: "arn:aws:ecs:eu-west-1:1:cluster/web", Name: "web", Status: "ACTIVE"}
+	for _, name := range names {
+		cl.Services = append(cl.Services, DashboardService{ServiceRow: serviceRows([]ecstypes.Service{richService(name)})[0]})
+	}
+	return DashboardSnapshot{At: tableClock, Clusters: []DashboardCluster{cl}}
+}
+
+func TestDashboardModel(t *testing.T) {
+	t.Parallel()
+
+	m := newDashboardModel("exec-ecs dashboard · shop · eu-west-1", time.Minute, nil)
+	next, cmd := m.Update(dashboardLoadedMsg{snap: dashboardSnapshot("api", "worker")})
+	m = next.(dashboardModel)
+	if cmd == nil || m.gen != 1 {
+		t.Fatal("a load schedules the next refresh")
+	}
+	next, _ = m.Update(keyMsg("down"))
+	m = next.(dashboardModel)
+
+	view := m.View()
+	for _, want := range []string{"web  ACTIVE", "SERVICE  DESIRED", "STOPPED 1H", selectedMarker + " worker", "(service worker) has started 1 tasks"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("view missing %q:\n%s", want, view)
+		}
+	}
+
+	// A reload that adds a service keeps the cursor on worker.
+	next, _ = m.Update(dashboardLoadedMsg{snap: dashboardSnapshot("admin", "api", "worker")})
+	m = next.(dashboardModel)
+	if m.cursor != 2 {
+		t.Fatalf("cursor = %d", m.cursor)
+	}
+	// A tick from an older timer doesn't reload.
+	if _, cmd := m.Update(dashboardTickMsg{gen: 1}); cmd != nil {
+		t.Fatal("stale tick reloaded")
+	}
+
+	next, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(dashboardModel)
+	if cmd == nil || m.pick == nil || m.pick.Service != "arn:aws:ecs:eu-west-1:1:service/web/worker" || m.pick.ClusterArn != "arn:aws:ecs:eu-west-1:1:cluster/web" {
+		t.Fatalf("pick = %+v", m.pick)
+	}
+}
@@ -0,0 +1,361 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Debug tasks are started with debugStartedBy so the reaper can find them
+// cheaply, and tagged with who owns them and when they may be stopped.
+const (
+	debugStartedBy  = "exec-ecs-debug"
+	debugOwnerTag   = "exec-ecs:debug-owner"
+	debugExpiresTag = "exec-ecs:debug-expires"
+)
+
+// debugLifetime bounds a debug task: its container sleeps this long and
+// the reaper stops it afterwards even if the owner looks alive.
+const debugLifetime = 12 * time.Hour
+
+// debugStartTimeout is how long Debug waits for the task and its exec agent.
+const debugStartTimeout = 10 * time.Minute
+
+// debugPollInterval paces the wait for RUNNING, swapped out in tests.
+var debugPollInterval = 3 * time.Second
+
+// DebugClient is the part of the ECS API `debug` uses.
+type DebugClient interface {
+	ecsTaskLister
+	ecsTaskDescriber
+	ecsServiceDescriber
+	DescribeTaskDefinition(ctx context.Context, params *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error)
+	RunTask(ctx context.Context, params *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error)
+	StopTask(ctx context.Context, params *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error)
+}
+
+// NewDebugClient is NewECSClient for `debug`.
+func NewDebugClient(cfg aws.Config, region string) DebugClient {
+	return ecs.NewFromConfig(cfg, func(o *ecs.Options) { o.Region = region })
+}
+
+// DebugOptions captures everything Debug needs.
+type DebugOptions struct {
+	Region     string
+	ClusterArn string
+	Service    string
+	// Container is the one kept alive for the session; empty means the
+	// task definition's only essential container, or ChooseContainer's pick.
+	Container string
+	Command   string
+	// ChooseContainer picks among several essential containers. nil makes
+	// that an error instead.
+	ChooseContainer func(names []string) (string, error)
+	// Environment is the target's class, passed on to ExecECS.
+	Environment string
+}
+
+// ResolveDebugService settles cluster and service for `debug` without
+// prompting; no task is needed, since debug starts its own.
+func ResolveDebugService(ctx context.Context, c *Cli, client ECSClient, state State) (State, error) {
+	if state.Profile == "" || state.Region == "" {
+		return state, fmt.Errorf("debug needs a profile and region")
+	}
+	state, err := resolveCluster(ctx, c, client, state)
+	if err != nil {
+		return state, err
+	}
+	return resolveService(ctx, c, client, state)
+}
+
+// Debug starts a copy of opts.Service's task definition with the service's
+// network settings, execs into it, and stops it once the session ends or
+// ctx is cancelled. Orphans from earlier runs are reaped first.
+func Debug(ctx context.Context, c *Cli, awsCfg aws.Config, client DebugClient, opts DebugOptions) (int, error) {
+	if IsPseudoService(opts.Service) {
+		return ExitUsage, fmt.Errorf("debug copies a service's task definition; choose a service, not %s", opts.Service)
+	}
+	if n, err := ReapDebugTasks(ctx, c, client, opts.ClusterArn); err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs: could not check for orphaned debug tasks:", err)
+	} else if n > 0 {
+		fmt.Printf("Stopped %d orphaned debug task(s).\n", n)
+	}
+
+	input, container, err := debugRunTaskInput(ctx, c, client, opts)
+	if err != nil {
+		return ExitSessionError, err
+	}
+	c.LogAWSCommand("ecs", "run-task", "--cluster", opts.ClusterArn, "--task-definition", aws.ToString(input.TaskDefinition), "--enable-execute-command", "--started-by", debugStartedBy, "--profile", c.Profile, "--region", opts.Region)
+	out, err := client.RunTask(ctx, input)
+	if err != nil {
+		return ExitSessionError, fmt.Errorf("run debug task: %w", err)
+	}
+	if len(out.Tasks) == 0 {
+		reason := "no task started"
+		if len(out.Failures) > 0 {
+			reason = aws.ToString(out.Failures[0].Reason)
+		}
+		return ExitSessionError, fmt.Errorf("run debug task: %s", reason)
+	}
+	taskArn := aws.ToString(out.Tasks[0].TaskArn)
+	// Stop the task however we leave, even when ctx was cancelled by ^C.
+	defer stopDebugTask(context.WithoutCancel(ctx), c, client, opts.ClusterArn, taskArn)
+
+	fmt.Printf("Started debug task %s; waiting for it to run...\n", displayTail(taskArn))
+	waitCtx, cancel := context.WithTimeout(ctx, debugStartTimeout)
+	defer cancel()
+	if err := waitForDebugTask(waitCtx, c, client, opts.ClusterArn, taskArn, container); err != nil {
+		return ExitSessionError, err
+	}
+
+	return ExecECS(ctx, c, awsCfg, ExecOptions{
+		Region:     opts.Region,
+		ClusterArn: opts.ClusterArn,
+		TaskArn:    taskArn,
+		Container:  container,
+		Command:    opts.Command,
+		// The task is gone once we return, and replaying the entry would
+		// land in a task that serves traffic: the thing debug avoids.
+		NoHistory:   true,
+		Record:      c.RecordingEnabled(),
+		Environment: opts.Environment,
+	})
+}
+
+// debugRunTaskInput builds the RunTask call from the service: its task
+// definition, network configuration and launch type or capacity provider
+// strategy, with container overridden to sleep for debugLifetime.
+func debugRunTaskInput(ctx context.Context, c *Cli, client DebugClient, opts DebugOptions) (*ecs.RunTaskInput, string, error) {
+	c.LogAWSCommand("ecs", "describe-services", "--cluster", opts.ClusterArn, "--services", opts.Service, "--profile", c.Profile, "--region", opts.Region)
+	svcs, err := client.DescribeServices(ctx, &ecs.DescribeServicesInput{Cluster: &opts.ClusterArn, Services: []string{opts.Service}})
+	if err != nil {
+		return nil, "", fmt.Errorf("describe service: %w", err)
+	}
+	if len(svcs.Services) == 0 {
+		return nil, "", fmt.Errorf("service %s not found", displayTail(opts.Service))
+	}
+	svc := svcs.Services[0]
+
+	c.LogAWSCommand("ecs", "describe-task-definition", "--task-definition", aws.ToString(svc.TaskDefinition), "--profile", c.Profile, "--region", opts.Region)
+	td, err := client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: svc.TaskDefinition})
+	if err != nil {
+		return nil, "", fmt.Errorf("describe task definition: %w", err)
+	}
+	container, err := debugContainer(td.TaskDefinition, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	input := &ecs.RunTaskInput{
+		Cluster:              &opts.ClusterArn,
+		TaskDefinition:       svc.TaskDefinition,
+		Count:                aws.Int32(1),
+		EnableExecuteCommand: true,
+		NetworkConfiguration: svc.NetworkConfiguration,
+		PlatformVersion:      svc.PlatformVersion,
+		StartedBy:            aws.String(debugStartedBy),
+		Overrides: &ecstypes.TaskOverride{ContainerOverrides: []ecstypes.ContainerOverride{{
+			Name:    &container,
+			Command: []string{"sleep", strconv.Itoa(int(debugLifetime.Seconds()))},
+		}}},
+		Tags: []ecstypes.Tag{
+			{Key: aws.String(debugOwnerTag), Value: aws.String(debugOwner())},
+			{Key: aws.String(debugExpiresTag), Value: aws.String(time.Now().Add(debugLifetime).UTC().Format(time.RFC3339))},
+		},
+	}
+	if len(svc.CapacityProviderStrategy) > 0 {
+		input.CapacityProviderStrategy = svc.CapacityProviderStrategy
+	} else {
+		input.LaunchType = svc.LaunchType
+	}
+	return input, container, nil
+}
+
+// debugContainer picks the container to keep alive.
+func debugContainer(td *ecstypes.TaskDefinition, opts DebugOptions) (string, error) {
+	var all, essential []string
+	if td != nil {
+		for _, cd := range td.ContainerDefinitions {
+			name := aws.ToString(cd.Name)
+			all = append(all, name)
+			// Essential defaults to true when unset.
+			if cd.Essential == nil || *cd.Essential {
+				essential = append(essential, name)
+			}
+		}
+	}
+	if opts.Container != "" {
+		for _, name := range all {
+			if name == opts.Container {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("task definition has no container %q (containers: %s)", opts.Container, strings.Join(all, ", "))
+	}
+	switch {
+	case len(essential) == 1:
+		return essential[0], nil
+	case len(essential) == 0:
+		return "", errors.New("task definition has no essential container")
+	case opts.ChooseContainer != nil:
+		return opts.ChooseContainer(essential)
+	}
+	return "", fmt.Errorf("container is ambiguous: %d essential containers (%s); pass -cn", len(essential), strings.Join(essential, ", "))
+}
+
+// waitForDebugTask polls until the task runs with its exec agent up.
+func waitForDebugTask(ctx context.Context, c *Cli, client ecsTaskDescriber, clusterArn, taskArn, container string) error {
+	last := ""
+	for {
+		c.LogAWSCommand("ecs", "describe-tasks", "--cluster", clusterArn, "--tasks", taskArn, "--profile", c.Profile, "--region", c.Region)
+		out, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{Cluster: &clusterArn, Tasks: []string{taskArn}})
+		if err != nil {
+			return fmt.Errorf("describe debug task: %w", err)
+		}
+		if len(out.Tasks) > 0 {
+			task := out.Tasks[0]
+			status := aws.ToString(task.LastStatus)
+			if status == "STOPPED" {
+				return fmt.Errorf("debug task stopped before it was ready: %s", aws.ToString(task.StoppedReason))
+			}
+			if status == "RUNNING" && execAgentRunning(task, container) {
+				return nil
+			}
+			if status != last {
+				fmt.Println("  " + status)
+				last = status
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for debug task: %w", ctx.Err())
+		case <-time.After(debugPollInterval):
+		}
+	}
+}
+
+func stopDebugTask(ctx context.Context, c *Cli, client DebugClient, clusterArn, taskArn string) {
+	c.LogAWSCommand("ecs", "stop-task", "--cluster", clusterArn, "--task", taskArn, "--profile", c.Profile, "--region", c.Region)
+	_, err := client.StopTask(ctx, &ecs.StopTaskInput{Cluster: &clusterArn, Task: &taskArn, Reason: aws.String("exec-ecs debug session ended")})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "exec-ecs: could not stop debug task %s: %v\n", displayTail(taskArn), err)
+		return
+	}
+	fmt.Printf("Stopped debug task %s.\n", displayTail(taskArn))
+}
+
+// ReapDebugTasks stops debug tasks in the cluster that outlived their
+// expiry tag, or whose owner on this machine is no longer running.
+// Tasks owned by other machines are left alone until they expire.
+func ReapDebugTasks(ctx context.Context, c *Cli, client DebugClient, clusterArn string) (int, error) {
+	c.LogAWSCommand("ecs", "list-tasks", "--cluster", clusterArn, "--started-by", debugStartedBy, "--profile", c.Profile, "--region", c.Region)
+	var (
+		arns      []string
+		nextToken *string
+	)
+	for {
+		out, err := client.ListTasks(ctx, &ecs.ListTasksInput{Cluster: &clusterArn, StartedBy: aws.String(debugStartedBy), NextToken: nextToken})
+		if err != nil {
+			return 0, err
+		}
+		arns = append(arns, out.TaskArns...)
+		if aws.ToString(out.NextToken) == "" {
+			break
+		}
+		nextToken = out.NextToken
+	}
+	if len(arns) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	host := debugHost()
+	reaped := 0
+	for start := 0; start < len(arns); start += describeTasksBatchSize {
+		end := min(start+describeTasksBatchSize, len(arns))
+		out, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: &clusterArn,
+			Tasks:   arns[start:end],
+			Include: []ecstypes.TaskField{ecstypes.TaskFieldTags},
+		})
+		if err != nil {
+			return reaped, err
+		}
+		for _, task := range out.Tasks {
+			if !debugTaskOrphaned(task, now, host) {
+				continue
+			}
+			arn := aws.ToString(task.TaskArn)
+			c.LogAWSCommand("ecs", "stop-task", "--cluster", clusterArn, "--task", arn, "--profile", c.Profile, "--region", c.Region)
+			if _, err := client.StopTask(ctx, &ecs.StopTaskInput{Cluster: &clusterArn, Task: &arn, Reason: aws.String("exec-ecs debug task orphaned")}); err != nil {
+				return reaped, err
+			}
+			reaped++
+		}
+	}
+	return reaped, nil
+}
+
+func debugTaskOrphaned(task ecstypes.Task, now time.Time, host string) bool {
+	var owner, expires string
+	for _, tag := range task.Tags {
+		switch aws.ToString(tag.Key) {
+		case debugOwnerTag:
+			owner = aws.ToString(tag.Value)
+		case debugExpiresTag:
+			expires = aws.ToString(tag.Value)
+		}
+	}
+	if owner == "" {
+		// Started by someone else with our startedBy; not ours to judge.
+		return false
+	}
+	if t, err := time.Parse(time.RFC3339, expires); err == nil && now.After(t) {
+		return true
+	}
+	ownerHost, pid, ok := strings.Cut(owner, ":")
+	if !ok || ownerHost != host {
+		return false
+	}
+	n, err := strconv.Atoi(pid)
+	return err == nil && n != os.Getpid() && !processAlive(n)
+}
+
+// debugOwner identifies this run as user@host:pid.
+func debugOwner() string {
+	return fmt.Sprintf("%s:%d", debugHost(), os.Getpid())
+}
+
+func debugHost() string {
+	host, _ := os.Hostname()
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return name + "@" + host
+}
+
+// processAlive reports whether pid is running on this machine, swapped out
+// in tests.
+var processAlive = func(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess already failed for a missing process.
+		return true
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+type fakeDebugECS struct {
+	service    ecstypes.Service
+	taskDef    ecstypes.TaskDefinition
+	debugTasks []ecstypes.Task // what ListTasks(StartedBy) finds
+	statuses   []ecstypes.Task // successive DescribeTasks answers while waiting
+	runErr     error
+	ran        *ecs.RunTaskInput
+	stopped    []string
+	describes  int
+	listInputs []*ecs.ListTasksInput
+}
+
+func (f *fakeDebugECS) ListTasks(_ context.Context, in *ecs.ListTasksInput, _ ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+	f.listInputs = append(f.listInputs, in)
+	var arns []string
+	for _, t := range f.debugTasks {
+		arns = append(arns, aws.ToString(t.TaskArn))
+	}
+	return &ecs.ListTasksOutput{TaskArns: arns}, nil
+}
+
+func (f *fakeDebugECS) DescribeTasks(_ context.Context, in *ecs.DescribeTasksInput, _ ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	if len(in.Include) > 0 {
+		return &ecs.DescribeTasksOutput{Tasks: f.debugTasks}, nil
+	}
+	i := min(f.describes, len(f.statuses)-1)
+	f.describes++
+	return &ecs.DescribeTasksOutput{Tasks: []ecstypes.Task{f.statuses[i]}}, nil
+}
+
+func (f *fakeDebugECS) DescribeServices(_ context.Context, _ *ecs.DescribeServicesInput, _ ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	return &ecs.DescribeServicesOutput{Services: []ecstypes.Service{f.service}}, nil
+}
+
+func (f *fakeDebugECS) DescribeTaskDefinition(_ context.Context, _ *ecs.DescribeTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &f.taskDef}, nil
+}
+
+func (f *fakeDebugECS) RunTask(_ context.Context, in *ecs.RunTaskInput, _ ...func(*ecs.Options)) (*ecs.RunTaskOutput, error) {
+	f.ran = in
+	if f.runErr != nil {
+		return nil, f.runErr
+	}
+	return &ecs.RunTaskOutput{Tasks: []ecstypes.Task{{TaskArn: aws.String("arn:aws:ecs:eu-west-1:1:task/web/dbg1")}}}, nil
+}
+
+func (f *fakeDebugECS) StopTask(ctx context.Context, in *ecs.StopTaskInput, _ ...func(*ecs.Options)) (*ecs.StopTaskOutput, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	f.stopped = append(f.stopped, aws.ToString(in.Task))
+	return &ecs.StopTaskOutput{}, nil
+}
+
+func debugStatus(status, agent string) ecstypes.Task {
+	return ecstypes.Task{
+		TaskArn:       aws.String("arn:aws:ecs:eu-west-1:1:task/web/dbg1"),
+		LastStatus:    aws.String(status),
+		StoppedReason: aws.String("Essential container in task exited"),
+		Containers: []ecstypes.Container{{
+			Name:          aws.String("app"),
+			ManagedAgents: []ecstypes.ManagedAgent{{Name: ecstypes.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String(agent)}},
+		}},
+	}
+}
+
+func newFakeDebugECS() *fakeDebugECS {
+	return &fakeDebugECS{
+		service: ecstypes.Service{
+			TaskDefinition: aws.String("arn:aws:ecs:eu-west-1:1:task-definition/api:7"),
+			NetworkConfiguration: &ecstypes.NetworkConfiguration{AwsvpcConfiguration: &ecstypes.AwsVpcConfiguration{
+				Subnets:        []string{"subnet-1"},
+				SecurityGroups: []string{"sg-1"},
+			}},
+			CapacityProviderStrategy: []ecstypes.CapacityProviderStrategyItem{{CapacityProvider: aws.String("FARGATE_SPOT")}},
+			LaunchType:               ecstypes.LaunchTypeFargate,
+		},
+		taskDef: ecstypes.TaskDefinition{ContainerDefinitions: []ecstypes.ContainerDefinition{
+			{Name: aws.String("app")},
+			{Name: aws.String("log-router"), Essential: aws.Bool(false)},
+		}},
+		statuses: []ecstypes.Task{debugStatus("PROVISIONING", ""), debugStatus("RUNNING", "PENDING"), debugStatus("RUNNING", "RUNNING")},
+	}
+}
+
+func setDebugPollInterval(t *testing.T) {
+	t.Helper()
+	prev := debugPollInterval
+	debugPollInterval = time.Millisecond
+	t.Cleanup(func() { debugPollInterval = prev })
+}
+
+func TestDebugRunsServiceTaskAndStopsIt(t *testing.T) {
+	setDebugPollInterval(t)
+	path := setHistoryFile(t)
+	prevStart, prevStarter := startExecuteCommand, sessionStarter
+	t.Cleanup(func() { startExecuteCommand, sessionStarter = prevStart, prevStarter })
+	var execd ExecOptions
+	startExecuteCommand = func(_ context.Context, _ ecsExecuteCommander, opts ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		execd = opts
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("t")}}, nil
+	}
+	sessionStarter = func(context.Context, string, *ecstypes.Session, ptyOptions) (int, error) { return 3, nil }
+
+	f := newFakeDebugECS()
+	code, err := Debug(context.Background(), &Cli{}, aws.Config{}, f, DebugOptions{
+		Region: "eu-west-1", ClusterArn: "web", Service: "api", Command: "sh",
+	})
+	if err != nil || code != 3 {
+		t.Fatalf("Debug = %d, %v", code, err)
+	}
+
+	in := f.ran
+	if !in.EnableExecuteCommand || aws.ToString(in.StartedBy) != debugStartedBy || aws.ToString(in.TaskDefinition) != "arn:aws:ecs:eu-west-1:1:task-definition/api:7" {
+		t.Fatalf("RunTask input = %+v", in)
+	}
+	if in.NetworkConfiguration.AwsvpcConfiguration.Subnets[0] != "subnet-1" || len(in.CapacityProviderStrategy) != 1 || in.LaunchType != "" {
+		t.Fatalf("RunTask placement = %+v / %v / %q", in.NetworkConfiguration, in.CapacityProviderStrategy, in.LaunchType)
+	}
+	override := in.Overrides.ContainerOverrides[0]
+	if aws.ToString(override.Name) != "app" || override.Command[0] != "sleep" {
+		t.Fatalf("override = %+v", override)
+	}
+	tags := map[string]string{}
+	for _, tag := range in.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if !strings.HasSuffix(tags[debugOwnerTag], ":"+strconv.Itoa(os.Getpid())) || tags[debugExpiresTag] == "" {
+		t.Fatalf("tags = %v", tags)
+	}
+	if execd.TaskArn != "arn:aws:ecs:eu-west-1:1:task/web/dbg1" || execd.Container != "app" || !execd.NoHistory {
+		t.Fatalf("exec options = %+v", execd)
+	}
+	if len(f.stopped) != 1 {
+		t.Fatalf("stopped = %v", f.stopped)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("debug session should not be recorded in history (stat err %v)", err)
+	}
+}
+
+func TestDebugStopsTaskThatNeverBecomesReady(t *testing.T) {
+	setDebugPollInterval(t)
+	f := newFakeDebugECS()
+	f.service.CapacityProviderStrategy = nil
+	f.statuses = []ecstypes.Task{debugStatus("PENDING", ""), debugStatus("STOPPED", "")}
+
+	_, err := Debug(context.Background(), &Cli{}, aws.Config{}, f, DebugOptions{Region: "eu-west-1", ClusterArn: "web", Service: "api"})
+	if err == nil || !strings.Contains(err.Error(), "Essential container in task exited") {
+		t.Fatalf("err = %v", err)
+	}
+	if f.ran.LaunchType != ecstypes.LaunchTypeFargate {
+		t.Fatalf("launch type = %q", f.ran.LaunchType)
+	}
+	if len(f.stopped) != 1 {
+		t.Fatalf("stopped = %v", f.stopped)
+	}
+}
+
+func TestDebugStopsTaskWhenCancelled(t *testing.T) {
+	setDebugPollInterval(t)
+	f := newFakeDebugECS()
+	f.statuses = []ecstypes.Task{debugStatus("PENDING", "")}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := Debug(ctx, &Cli{}, aws.Config{}, f, DebugOptions{Region: "eu-west-1", ClusterArn: "web", Service: "api"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	if len(f.stopped) != 1 {
+		t.Fatalf("a cancelled run must still stop its task, stopped = %v", f.stopped)
+	}
+}
+
+func TestDebugRejectsPseudoServiceAndRunFailure(t *testing.T) {
+	f := newFakeDebugECS()
+	if code, err := Debug(context.Background(), &Cli{}, aws.Config{}, f, DebugOptions{Service: AllTasksService}); code != ExitUsage || err == nil {
+		t.Fatalf("pseudo service = %d, %v", code, err)
+	}
+	f.runErr = errors.New("no capacity")
+	if _, err := Debug(context.Background(), &Cli{}, aws.Config{}, f, DebugOptions{ClusterArn: "web", Service: "api"}); err == nil || !strings.Contains(err.Error(), "no capacity") {
+		t.Fatalf("run failure = %v", err)
+	}
+	if len(f.stopped) != 0 {
+		t.Fatalf("nothing to stop when RunTask fails, stopped = %v", f.stopped)
+	}
+}
+
+func TestDebugContainer(t *testing.T) {
+	td := &ecstypes.TaskDefinition{ContainerDefinitions: []ecstypes.ContainerDefinition{
+		{Name: aws.String("app")},
+		{Name: aws.String("worker"), Essential: aws.Bool(true)},
+		{Name: aws.String("xray"), Essential: aws.Bool(false)},
+	}}
+	if got, err := debugContainer(td, DebugOptions{Container: "xray"}); err != nil || got != "xray" {
+		t.Fatalf("explicit = %q, %v", got, err)
+	}
+	if _, err := debugContainer(td, DebugOptions{Container: "nope"}); err == nil {
+		t.Fatal("unknown container should fail")
+	}
+	if _, err := debugContainer(td, DebugOptions{}); err == nil || !strings.Contains(err.Error(), "-cn") {
+		t.Fatalf("ambiguous = %v", err)
+	}
+	var offered []string
+	got, err := debugContainer(td, DebugOptions{ChooseContainer: func(names []string) (string, error) {
+		offered = names
+		return names[1], nil
+	}})
+	if err != nil || got != "worker" || len(offered) != 2 {
+		t.Fatalf("chosen = %q, %v (offered %v)", got, err, offered)
+	}
+	if _, err := debugContainer(&ecstypes.TaskDefinition{}, DebugOptions{}); err == nil {
+		t.Fatal("no essential container should fail")
+	}
+}
+
+func TestReapDebugTasks(t *testing.T) {
+	prev := processAlive
+	t.Cleanup(func() { processAlive = prev })
+	processAlive = func(pid int) bool { return pid == 100 }
+
+	host := debugHost()
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	task := func(id, owner, expires string) ecstypes.Task {
+		t := ecstypes.Task{TaskArn: aws.String(id)}
+		if owner != "" {
+			t.Tags = append(t.Tags, ecstypes.Tag{Key: aws.String(debugOwnerTag), Value: aws.String(owner)})
+		}
+		t.Tags = append(t.Tags, ecstypes.Tag{Key: aws.String(debugExpiresTag), Value: aws.String(expires)})
+		return t
+	}
+	f := &fakeDebugECS{debugTasks: []ecstypes.Task{
+		task("expired", "someone@elsewhere:1", past),
+		task("dead-owner", host+":200", future),
+		task("live-owner", host+":100", future),
+		task("other-host", "someone@elsewhere:200", future),
+		task("untagged", "", past),
+	}}
+
+	n, err := ReapDebugTasks(context.Background(), &Cli{}, f, "web")
+	if err != nil || n != 2 {
+		t.Fatalf("reaped %d, %v", n, err)
+	}
+	if strings.Join(f.stopped, ",") != "expired,dead-owner" {
+		t.Fatalf("stopped = %v", f.stopped)
+	}
+	if aws.ToString(f.listInputs[0].StartedBy) != debugStartedBy {
+		t.Fatalf("list input = %+v", f.listInputs[0])
+	}
+}
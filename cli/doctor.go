@@ -0,0 +1,307 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// ExitChecksFailed is doctor's exit status when at least one check failed.
+const ExitChecksFailed = 1
+
+// Check outcomes, in increasing order of trouble.
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// ssmMessagesActions are what the task role needs for ECS Exec at all.
+var ssmMessagesActions = []string{
+	"ssmmessages:CreateControlChannel",
+	"ssmmessages:CreateDataChannel",
+	"ssmmessages:OpenControlChannel",
+	"ssmmessages:OpenDataChannel",
+}
+
+// DoctorCheck is one line of the doctor checklist.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	// Hint says how to fix a warning or failure.
+	Hint string `json:"hint,omitempty"`
+}
+
+// DoctorReport is everything `exec-ecs doctor` found for one target.
+type DoctorReport struct {
+	Profile   string        `json:"profile"`
+	Region    string        `json:"region"`
+	Cluster   string        `json:"cluster"`
+	Task      string        `json:"task"`
+	Container string        `json:"container,omitempty"`
+	Checks    []DoctorCheck `json:"checks"`
+}
+
+// Failed reports whether any check failed outright.
+func (r DoctorReport) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *DoctorReport) add(name, status, detail, hint string) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+}
+
+type doctorECS interface {
+	ecsTaskDescriber
+	ecsClusterDescriber
+	DescribeTaskDefinition(ctx context.Context, params *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error)
+}
+
+type iamPolicySimulator interface {
+	SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error)
+}
+
+// DoctorClients are the AWS APIs doctor calls.
+type DoctorClients struct {
+	ECS doctorECS
+	IAM iamPolicySimulator
+	STS stsCallerIdentity
+}
+
+// NewDoctorClients builds the doctor's clients from one AWS config.
+func NewDoctorClients(cfg aws.Config, region string) DoctorClients {
+	return DoctorClients{
+		ECS: ecs.NewFromConfig(cfg, func(o *ecs.Options) { o.Region = region }),
+		IAM: iam.NewFromConfig(cfg),
+		STS: sts.NewFromConfig(cfg),
+	}
+}
+
+// pluginVersion runs `session-manager-plugin --version`, swapped out in tests.
+var pluginVersion = func(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "session-manager-plugin", "--version").Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// Doctor checks a target end to end for the usual reasons ECS Exec hands
+// back an empty session. When the task itself can't be described the
+// checks that depend on it are left out rather than reported as noise.
+func Doctor(ctx context.Context, c *Cli, clients DoctorClients, state State) DoctorReport {
+	r := DoctorReport{Profile: state.Profile, Region: state.Region, Cluster: state.ClusterArn, Task: state.TaskArn, Container: state.Container}
+
+	if v, err := pluginVersion(ctx); err != nil {
+		hint := "Install it: https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"
+		if !errors.Is(err, exec.ErrNotFound) {
+			hint = "Reinstall session-manager-plugin; it is on PATH but did not run."
+		}
+		r.add("session-manager-plugin", CheckFail, err.Error(), hint)
+	} else {
+		r.add("session-manager-plugin", CheckOK, "version "+v, "")
+	}
+
+	c.LogAWSCommand("sts", "get-caller-identity", "--profile", c.Profile)
+	if id, err := clients.STS.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+		r.add("AWS identity", CheckFail, err.Error(), fmt.Sprintf("Log in again: aws sso login --profile %s", state.Profile))
+	} else {
+		r.add("AWS identity", CheckOK, aws.ToString(id.Arn), "")
+	}
+
+	c.LogAWSCommand("ecs", "describe-tasks", "--cluster", state.ClusterArn, "--tasks", state.TaskArn, "--profile", c.Profile, "--region", c.Region)
+	out, err := clients.ECS.DescribeTasks(ctx, &ecs.DescribeTasksInput{Cluster: &state.ClusterArn, Tasks: []string{state.TaskArn}})
+	if err == nil && len(out.Tasks) == 0 {
+		err = fmt.Errorf("task %s not found", displayTail(state.TaskArn))
+	}
+	if err != nil {
+		r.add("task", CheckFail, err.Error(), "Pick a running task; stopped tasks disappear from ECS after about an hour.")
+		return r
+	}
+	task := out.Tasks[0]
+
+	if task.EnableExecuteCommand {
+		r.add("enableExecuteCommand", CheckOK, "on", "")
+	} else {
+		r.add("enableExecuteCommand", CheckFail, "off for this task",
+			"aws ecs update-service --cluster <cluster> --service <service> --enable-execute-command --force-new-deployment (only tasks started afterwards get it)")
+	}
+	checkExecAgents(&r, task, state.Container)
+
+	actions := append([]string(nil), ssmMessagesActions...)
+	c.LogAWSCommand("ecs", "describe-clusters", "--clusters", state.ClusterArn, "--include", "CONFIGURATIONS", "--profile", c.Profile, "--region", c.Region)
+	clusters, err := clients.ECS.DescribeClusters(ctx, &ecs.DescribeClustersInput{
+		Clusters: []string{state.ClusterArn},
+		Include:  []ecstypes.ClusterField{ecstypes.ClusterFieldConfigurations},
+	})
+	if err != nil || len(clusters.Clusters) == 0 {
+		detail := "cluster not found"
+		if err != nil {
+			detail = err.Error()
+		}
+		r.add("cluster exec configuration", CheckWarn, detail, "Doctor needs ecs:DescribeClusters to check KMS and logging settings.")
+	} else {
+		extra := checkClusterExecConfig(&r, clusters.Clusters[0])
+		actions = append(actions, extra...)
+	}
+
+	roleArn, err := taskRoleArn(ctx, c, clients.ECS, task)
+	switch {
+	case err != nil:
+		r.add("task role", CheckWarn, err.Error(), "Doctor needs ecs:DescribeTaskDefinition to find the task role.")
+	case roleArn == "":
+		r.add("task role", CheckFail, "the task has no task role",
+			"Set taskRoleArn in the task definition to a role allowing "+strings.Join(ssmMessagesActions, ", ")+".")
+	default:
+		r.add("task role", CheckOK, roleArn, "")
+		checkRolePermissions(ctx, c, &r, clients.IAM, roleArn, actions)
+	}
+	return r
+}
+
+// checkExecAgents reports the ExecuteCommandAgent on each container, or
+// only on container when one was chosen.
+func checkExecAgents(r *DoctorReport, task ecstypes.Task, container string) {
+	for _, ca := range execAgents(task, container) {
+		check, agent := "exec agent ("+ca.container+")", ca.agent
+		switch {
+		case agent == nil:
+			r.add(check, CheckFail, "no ExecuteCommandAgent",
+				"The task started without ECS Exec; redeploy after enabling it. On EC2, the ECS agent must be 1.50.2 or newer.")
+		case aws.ToString(agent.LastStatus) == "RUNNING":
+			r.add(check, CheckOK, "RUNNING", "")
+		default:
+			detail := aws.ToString(agent.LastStatus)
+			if reason := aws.ToString(agent.Reason); reason != "" {
+				detail += ": " + reason
+			}
+			r.add(check, CheckFail, detail,
+				"The agent must reach SSM: allow HTTPS egress, or add VPC endpoints for ssmmessages. The container also needs a writable filesystem.")
+		}
+	}
+}
+
+// checkClusterExecConfig reports KMS and logging settings and returns the
+// extra task-role actions those settings require.
+func checkClusterExecConfig(r *DoctorReport, cluster ecstypes.Cluster) []string {
+	var cfg *ecstypes.ExecuteCommandConfiguration
+	if cluster.Configuration != nil {
+		cfg = cluster.Configuration.ExecuteCommandConfiguration
+	}
+	if cfg == nil {
+		r.add("cluster exec configuration", CheckOK, "defaults (no KMS key, logging DEFAULT)", "")
+		return nil
+	}
+	var (
+		extra []string
+		parts []string
+	)
+	if key := aws.ToString(cfg.KmsKeyId); key != "" {
+		parts = append(parts, "KMS key "+key)
+		extra = append(extra, "kms:Decrypt")
+	} else {
+		parts = append(parts, "no KMS key")
+	}
+	logging := string(cfg.Logging)
+	if logging == "" {
+		logging = string(ecstypes.ExecuteCommandLoggingDefault)
+	}
+	parts = append(parts, "logging "+logging)
+	if cfg.Logging == ecstypes.ExecuteCommandLoggingOverride && cfg.LogConfiguration != nil {
+		if group := aws.ToString(cfg.LogConfiguration.CloudWatchLogGroupName); group != "" {
+			parts = append(parts, "to CloudWatch group "+group)
+			extra = append(extra, "logs:CreateLogStream", "logs:DescribeLogStreams", "logs:PutLogEvents")
+		}
+		if bucket := aws.ToString(cfg.LogConfiguration.S3BucketName); bucket != "" {
+			parts = append(parts, "to S3 bucket "+bucket)
+			extra = append(extra, "s3:PutObject")
+		}
+	}
+	r.add("cluster exec configuration", CheckOK, strings.Join(parts, ", "), "")
+	return extra
+}
+
+// taskRoleArn is the task's role: a run-time override if there is one,
+// otherwise the task definition's.
+func taskRoleArn(ctx context.Context, c *Cli, client doctorECS, task ecstypes.Task) (string, error) {
+	if task.Overrides != nil && aws.ToString(task.Overrides.TaskRoleArn) != "" {
+		return aws.ToString(task.Overrides.TaskRoleArn), nil
+	}
+	c.LogAWSCommand("ecs", "describe-task-definition", "--task-definition", aws.ToString(task.TaskDefinitionArn), "--profile", c.Profile, "--region", c.Region)
+	out, err := client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: task.TaskDefinitionArn})
+	if err != nil {
+		return "", err
+	}
+	if out.TaskDefinition == nil {
+		return "", nil
+	}
+	return aws.ToString(out.TaskDefinition.TaskRoleArn), nil
+}
+
+// checkRolePermissions asks IAM whether roleArn is allowed actions.
+func checkRolePermissions(ctx context.Context, c *Cli, r *DoctorReport, client iamPolicySimulator, roleArn string, actions []string) {
+	c.LogAWSCommand("iam", "simulate-principal-policy", "--policy-source-arn", roleArn, "--action-names", strings.Join(actions, " "), "--profile", c.Profile)
+	out, err := client.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: &roleArn,
+		ActionNames:     actions,
+	})
+	if err != nil {
+		r.add("task role permissions", CheckWarn, "could not simulate: "+err.Error(),
+			"Doctor needs iam:SimulatePrincipalPolicy to check the role; ask an admin or check the role's policies by hand.")
+		return
+	}
+	var denied []string
+	for _, res := range out.EvaluationResults {
+		if res.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed {
+			denied = append(denied, aws.ToString(res.EvalActionName))
+		}
+	}
+	if len(denied) > 0 {
+		r.add("task role permissions", CheckFail, "denied: "+strings.Join(denied, ", "),
+			"Allow these actions on the task role (not the execution role).")
+		return
+	}
+	r.add("task role permissions", CheckOK, fmt.Sprintf("allowed: %d action(s)", len(actions)), "")
+}
+
+// doctorMarks are the checklist symbols per status.
+var doctorMarks = map[string]string{CheckOK: "✔", CheckWarn: "!", CheckFail: "✖"}
+
+// WriteDoctorReport prints r as a checklist, or as JSON when asJSON is set.
+func WriteDoctorReport(w io.Writer, r DoctorReport, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	target := displayTail(r.Task)
+	if r.Container != "" {
+		target += "/" + r.Container
+	}
+	fmt.Fprintf(w, "ECS Exec checks for %s (%s, %s)\n\n", target, r.Profile, r.Region)
+	width := 0
+	for _, c := range r.Checks {
+		width = max(width, len(c.Name))
+	}
+	for _, c := range r.Checks {
+		fmt.Fprintf(w, "  %s %-*s  %s\n", doctorMarks[c.Status], width, c.Name, c.Detail)
+		if c.Hint != "" {
+			fmt.Fprintf(w, "    %*s  → %s\n", width, "", c.Hint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type fakeDoctorECS struct {
+	task       *ecstypes.Task
+	taskErr    error
+	cluster    *ecstypes.Cluster
+	clusterErr error
+	roleArn    string
+	taskDefErr error
+}
+
+func (f *fakeDoctorECS) DescribeTasks(context.Context, *ecs.DescribeTasksInput, ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	if f.taskErr != nil {
+		return nil, f.taskErr
+	}
+	out := &ecs.DescribeTasksOutput{}
+	if f.task != nil {
+		out.Tasks = []ecstypes.Task{*f.task}
+	}
+	return out, nil
+}
+
+func (f *fakeDoctorECS) DescribeClusters(context.Context, *ecs.DescribeClustersInput, ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+	if f.clusterErr != nil {
+		return nil, f.clusterErr
+	}
+	out := &ecs.DescribeClustersOutput{}
+	if f.cluster != nil {
+		out.Clusters = []ecstypes.Cluster{*f.cluster}
+	}
+	return out, nil
+}
+
+func (f *fakeDoctorECS) DescribeTaskDefinition(context.Context, *ecs.DescribeTaskDefinitionInput, ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+	if f.taskDefErr != nil {
+		return nil, f.taskDefErr
+	}
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecstypes.TaskDefinition{TaskRoleArn: aws.String(f.roleArn)}}, nil
+}
+
+type fakeSimulator struct {
+	deny   map[string]bool
+	err    error
+	asked  []string
+	policy string
+}
+
+func (f *fakeSimulator) SimulatePrincipalPolicy(_ context.Context, in *iam.SimulatePrincipalPolicyInput, _ ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.asked = in.ActionNames
+	f.policy = aws.ToString(in.PolicySourceArn)
+	out := &iam.SimulatePrincipalPolicyOutput{}
+	for _, a := range in.ActionNames {
+		decision := iamtypes.PolicyEvaluationDecisionTypeAllowed
+		if f.deny[a] {
+			decision = iamtypes.PolicyEvaluationDecisionTypeImplicitDeny
+		}
+		out.EvaluationResults = append(out.EvaluationResults, iamtypes.EvaluationResult{EvalActionName: aws.String(a), EvalDecision: decision})
+	}
+	return out, nil
+}
+
+type fakeIdentity struct{ err error }
+
+func (f fakeIdentity) GetCallerIdentity(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.GetCallerIdentityOutput{Arn: aws.String("arn:aws:sts::1:assumed-role/dev/me")}, nil
+}
+
+func setPluginVersion(t *testing.T, v string, err error) {
+	t.Helper()
+	prev := pluginVersion
+	pluginVersion = func(context.Context) (string, error) { return v, err }
+	t.Cleanup(func() { pluginVersion = prev })
+}
+
+func execTask(agentStatus string) *ecstypes.Task {
+	agent := ecstypes.ManagedAgent{Name: ecstypes.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String(agentStatus)}
+	return &ecstypes.Task{
+		TaskArn:              aws.String("arn:aws:ecs:r:1:task/web/abc"),
+		TaskDefinitionArn:    aws.String("arn:aws:ecs:r:1:task-definition/api:3"),
+		EnableExecuteCommand: true,
+		Containers: []ecstypes.Container{
+			{Name: aws.String("app"), ManagedAgents: []ecstypes.ManagedAgent{agent}},
+			{Name: aws.String("envoy")},
+		},
+	}
+}
+
+func checkStatus(t *testing.T, r DoctorReport, name string) DoctorCheck {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %q check in %+v", name, r.Checks)
+	return DoctorCheck{}
+}
+
+func TestDoctorHealthyTarget(t *testing.T) {
+	setPluginVersion(t, "1.2.553.0", nil)
+	sim := &fakeSimulator{}
+	clients := DoctorClients{
+		ECS: &fakeDoctorECS{task: execTask("RUNNING"), cluster: &ecstypes.Cluster{}, roleArn: "arn:aws:iam::1:role/api-task"},
+		IAM: sim,
+		STS: fakeIdentity{},
+	}
+	r := Doctor(context.Background(), &Cli{}, clients, State{Profile: "p", Region: "r", ClusterArn: "c", TaskArn: "t", Container: "app"})
+	if r.Failed() {
+		t.Fatalf("healthy target failed: %+v", r.Checks)
+	}
+	// Only the chosen container's agent is checked.
+	for _, c := range r.Checks {
+		if strings.Contains(c.Name, "envoy") {
+			t.Fatal("envoy should be skipped when -cn app is chosen")
+		}
+	}
+	if sim.policy != "arn:aws:iam::1:role/api-task" || len(sim.asked) != len(ssmMessagesActions) {
+		t.Fatalf("simulated %q for %v", sim.policy, sim.asked)
+	}
+}
+
+func TestDoctorReportsProblems(t *testing.T) {
+	setPluginVersion(t, "", exec.ErrNotFound)
+	task := execTask("STOPPED")
+	task.EnableExecuteCommand = false
+	task.Containers[0].ManagedAgents[0].Reason = aws.String("no route to ssmmessages")
+	task.Overrides = &ecstypes.TaskOverride{TaskRoleArn: aws.String("arn:aws:iam::1:role/override")}
+	sim := &fakeSimulator{deny: map[string]bool{"ssmmessages:OpenDataChannel": true, "kms:Decrypt": true}}
+	clients := DoctorClients{
+		ECS: &fakeDoctorECS{task: task, cluster: &ecstypes.Cluster{Configuration: &ecstypes.ClusterConfiguration{
+			ExecuteCommandConfiguration: &ecstypes.ExecuteCommandConfiguration{
+				KmsKeyId: aws.String("key-1"),
+				Logging:  ecstypes.ExecuteCommandLoggingOverride,
+				LogConfiguration: &ecstypes.ExecuteCommandLogConfiguration{
+					CloudWatchLogGroupName: aws.String("/exec"),
+					S3BucketName:           aws.String("audit"),
+				},
+			},
+		}}},
+		IAM: sim,
+		STS: fakeIdentity{err: errors.New("expired")},
+	}
+	r := Doctor(context.Background(), &Cli{}, clients, State{Profile: "p", TaskArn: "t"})
+	if !r.Failed() {
+		t.Fatal("expected failures")
+	}
+	for name, want := range map[string]string{
+		"session-manager-plugin": CheckFail,
+		"AWS identity":           CheckFail,
+		"enableExecuteCommand":   CheckFail,
+		"exec agent (app)":       CheckFail,
+		"exec agent (envoy)":     CheckFail,
+		"task role permissions":  CheckFail,
+	} {
+		if got := checkStatus(t, r, name); got.Status != want || got.Hint == "" {
+			t.Errorf("%s = %+v", name, got)
+		}
+	}
+	if d := checkStatus(t, r, "exec agent (app)").Detail; d != "STOPPED: no route to ssmmessages" {
+		t.Errorf("agent detail = %q", d)
+	}
+	if d := checkStatus(t, r, "cluster exec configuration").Detail; !strings.Contains(d, "KMS key key-1") || !strings.Contains(d, "S3 bucket audit") {
+		t.Errorf("cluster detail = %q", d)
+	}
+	if d := checkStatus(t, r, "task role permissions").Detail; d != "denied: ssmmessages:OpenDataChannel, kms:Decrypt" {
+		t.Errorf("permissions detail = %q", d)
+	}
+	if sim.policy != "arn:aws:iam::1:role/override" || len(sim.asked) != len(ssmMessagesActions)+5 {
+		t.Errorf("simulated %q for %v", sim.policy, sim.asked)
+	}
+}
+
+func TestDoctorDegradesWithoutPermissions(t *testing.T) {
+	setPluginVersion(t, "", errors.New("exit status 1"))
+	denied := errors.New("AccessDenied")
+
+	r := Doctor(context.Background(), &Cli{}, DoctorClients{
+		ECS: &fakeDoctorECS{task: execTask("RUNNING"), clusterErr: denied, taskDefErr: denied},
+		STS: fakeIdentity{},
+	}, State{})
+	if got := checkStatus(t, r, "cluster exec configuration"); got.Status != CheckWarn {
+		t.Errorf("cluster = %+v", got)
+	}
+	if got := checkStatus(t, r, "task role"); got.Status != CheckWarn {
+		t.Errorf("task role = %+v", got)
+	}
+	if got := checkStatus(t, r, "session-manager-plugin"); !strings.Contains(got.Hint, "Reinstall") {
+		t.Errorf("plugin hint = %q", got.Hint)
+	}
+
+	r = Doctor(context.Background(), &Cli{}, DoctorClients{
+		ECS: &fakeDoctorECS{task: execTask("RUNNING"), roleArn: "arn:aws:iam::1:role/x"},
+		IAM: &fakeSimulator{err: denied},
+		STS: fakeIdentity{},
+	}, State{})
+	if got := checkStatus(t, r, "task role permissions"); got.Status != CheckWarn {
+		t.Errorf("simulation = %+v", got)
+	}
+	if got := checkStatus(t, r, "cluster exec configuration"); got.Status != CheckWarn || got.Detail != "cluster not found" {
+		t.Errorf("missing cluster = %+v", got)
+	}
+
+	r = Doctor(context.Background(), &Cli{}, DoctorClients{ECS: &fakeDoctorECS{task: execTask("RUNNING"), cluster: &ecstypes.Cluster{}}, STS: fakeIdentity{}}, State{})
+	if got := checkStatus(t, r, "task role"); got.Status != CheckFail {
+		t.Errorf("no role = %+v", got)
+	}
+}
+
+func TestDoctorStopsWithoutTask(t *testing.T) {
+	setPluginVersion(t, "1.2", nil)
+
+	r := Doctor(context.Background(), &Cli{}, DoctorClients{ECS: &fakeDoctorECS{}, STS: fakeIdentity{}}, State{TaskArn: "arn:aws:ecs:r:1:task/web/gone"})
+	if got := checkStatus(t, r, "task"); got.Status != CheckFail || got.Detail != "task gone not found" {
+		t.Fatalf("task = %+v", got)
+	}
+	if len(r.Checks) != 3 {
+		t.Fatalf("checks after a missing task = %+v", r.Checks)
+	}
+}
+
+func TestWriteDoctorReport(t *testing.T) {
+	t.Parallel()
+
+	r := DoctorReport{Profile: "p", Region: "r", Task: "arn:aws:ecs:r:1:task/web/abc", Container: "app", Checks: []DoctorCheck{
+		{Name: "AWS identity", Status: CheckOK, Detail: "me"},
+		{Name: "task role", Status: CheckFail, Detail: "none", Hint: "add one"},
+	}}
+	var buf bytes.Buffer
+	if err := WriteDoctorReport(&buf, r, false); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"ECS Exec checks for abc/app (p, r)", "✔ AWS identity  me", "✖ task role     none", "→ add one"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("checklist missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := WriteDoctorReport(&buf, r, true); err != nil {
+		t.Fatal(err)
+	}
+	var back DoctorReport
+	if err := json.Unmarshal(buf.Bytes(), &back); err != nil || len(back.Checks) != 2 || back.Checks[1].Hint != "add one" {
+		t.Fatalf("json round trip: %v %+v", err, back)
+	}
+}
@@ -5,11 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
 // ecsExecuteCommander is the small interface we need from the ECS SDK client
@@ -21,7 +27,34 @@ type ecsExecuteCommander interface {
 // sessionStarter spawns the session-manager-plugin process with the supplied
 // session JSON. The default implementation execs the real binary; tests
 // inject a stub.
-var sessionStarter func(ctx context.Context, region string, session *ecstypes.Session) (int, error) = startSessionManagerPlugin
+var sessionStarter func(ctx context.Context, region string, session *ecstypes.Session, opts ptyOptions) (int, error) = startSessionManagerPlugin
+
+// ptyOptions customises the terminal bridge runPTYCommand sets up. The zero
+// value forwards the user's stdin/stdout verbatim.
+type ptyOptions struct {
+	// Stdout receives everything the child writes. nil means os.Stdout.
+	Stdout io.Writer
+	// Stdin replaces the user's terminal as the child's input. When set,
+	// the local terminal is left alone (no raw mode, no resize forwarding).
+	Stdin io.Reader
+	// Recorder, when set, receives a timestamped copy of the session.
+	Recorder *castRecorder
+	// StartRecording opens a recording when ~r asks for one mid-session.
+	StartRecording func() (*castRecorder, error)
+	// Escape starts escape sequences on the user's terminal; 0 disables
+	// them. A replaced Stdin never has escapes.
+	Escape byte
+	// Suspendable enables ~^Z, for sessions with a picker to return to.
+	Suspendable bool
+	// Info describes the session for ~i.
+	Info func() string
+	// Terminate ends the session on the SSM side before ~. stops the
+	// plugin.
+	Terminate func()
+	// StatusLine renders the status bar for a terminal width columns wide.
+	// When set, the user's terminal keeps its bottom row for the bar.
+	StatusLine func(width int) string
+}
 
 // ExecOptions captures everything ExecECS needs to launch a session.
 type ExecOptions struct {
@@ -30,6 +63,46 @@ type ExecOptions struct {
 	TaskArn    string
 	Container  string
 	Command    string
+	// Service is recorded in history so a replay can pick a fresh task
+	// once TaskArn has stopped. Optional.
+	Service string
+	// CaptureExitStatus wraps Command so the remote shell reports its exit
+	// status through the SSM stream. session-manager-plugin itself exits 0
+	// whatever the remote command did, so this is the only way to surface
+	// the real status to scripts.
+	CaptureExitStatus bool
+	// Stdout overrides where session output is written. nil means os.Stdout.
+	Stdout io.Writer
+	// Stdin overrides the session input. nil means the user's terminal.
+	Stdin io.Reader
+	// NoHistory skips the history entry, for sessions exec-ecs runs on its
+	// own behalf (file transfers and the like).
+	NoHistory bool
+	// Internal marks one of the helper sessions of a larger operation,
+	// such as cp, whose caller checks the policy and audits the operation
+	// as a whole (see auditOperation). The session does neither itself.
+	Internal bool
+	// Record saves the session as an asciicast file under
+	// ConfigDir()/recordings.
+	Record bool
+	// Protect enables ECS scale-in protection for the task while the
+	// session is open.
+	Protect bool
+	// Environment is the target's class from GuardTarget, shown in the
+	// terminal title.
+	Environment string
+	// Result, when set, is filled in once a session that started is over.
+	Result *SessionResult
+	// Suspendable lets ~^Z close the session to go back to the picker.
+	Suspendable bool
+}
+
+// SessionResult describes a session that ran, for the post-session menu.
+type SessionResult struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	// Recording is the saved asciicast, or "" when none was saved.
+	Recording string
 }
 
 // ExecECS calls ecs:ExecuteCommand via the SDK, then drives the resulting
@@ -38,8 +111,23 @@ type ExecOptions struct {
 // loop back to the menu after the session exits.
 //
 // Returns the exit code of the inner session (0 on a clean shell exit, the
-// plugin's exit code otherwise).
-func ExecECS(ctx context.Context, c *Cli, awsCfg aws.Config, opts ExecOptions) (int, error) {
+// plugin's exit code otherwise). With CaptureExitStatus set it is the remote
+// command's own exit status instead.
+func ExecECS(ctx context.Context, c *Cli, awsCfg aws.Config, opts ExecOptions) (code int, err error) {
+	if !opts.Internal {
+		decision := c.checkPolicy(ctx, opts)
+		if c.PolicyCheck {
+			fmt.Fprintf(policyCheckOutput, "%s: %q in %s/%s (%s)\n", decision.verdict(), opts.Command, displayTail(opts.ClusterArn), opts.Container, decisionSource(decision))
+			if !decision.Allowed {
+				return ExitPolicyDenied, nil
+			}
+			return 0, nil
+		}
+		if !decision.Allowed {
+			return ExitPolicyDenied, policyError(opts, decision)
+		}
+	}
+
 	c.LogAWSCommand("ecs", "execute-command",
 		"--cluster", opts.ClusterArn,
 		"--task", opts.TaskArn,
@@ -54,7 +142,15 @@ func ExecECS(ctx context.Context, c *Cli, awsCfg aws.Config, opts ExecOptions) (
 		o.Region = opts.Region
 	})
 
-	resp, err := startExecuteCommand(ctx, client, opts)
+	sendOpts := opts
+	var status *exitStatusWriter
+	if opts.CaptureExitStatus {
+		marker := newExitMarker()
+		sendOpts.Command = wrapCommandForExitStatus(opts.Command, marker)
+		status = newExitStatusWriter(opts.Stdout, marker)
+	}
+
+	resp, err := startExecuteCommand(ctx, client, sendOpts)
 	if err != nil {
 		return 1, fmt.Errorf("ecs:ExecuteCommand failed: %w", err)
 	}
@@ -62,13 +158,213 @@ func ExecECS(ctx context.Context, c *Cli, awsCfg aws.Config, opts ExecOptions) (
 		aws.ToString(resp.Session.SessionId) == "" ||
 		aws.ToString(resp.Session.StreamUrl) == "" ||
 		aws.ToString(resp.Session.TokenValue) == "" {
-		return 1, errors.New("ecs:ExecuteCommand returned an empty session — is the task running with `enable-execute-command`?")
+		return 1, errors.New("ecs:ExecuteCommand returned an empty session — is the task running with `enable-execute-command`? Run `exec-ecs doctor` to check")
+	}
+
+	if !opts.NoHistory {
+		started := time.Now()
+		service := opts.Service
+		if IsPseudoService(service) {
+			// A replay can't pick a replacement from "(all tasks)".
+			service = ""
+		}
+		defer func() {
+			c.AppendToHistory(HistoryEntry{
+				Profile:    c.Profile,
+				Region:     opts.Region,
+				Cluster:    opts.ClusterArn,
+				Service:    service,
+				Task:       opts.TaskArn,
+				Container:  opts.Container,
+				Command:    opts.Command,
+				StartedAt:  started.UTC(),
+				DurationMs: time.Since(started).Milliseconds(),
+				ExitCode:   code,
+			})
+		}()
 	}
 
-	c.AppendToHistory(fmt.Sprintf("# ecs exec cluster=%s task=%s container=%s region=%s command=%q",
-		opts.ClusterArn, opts.TaskArn, opts.Container, opts.Region, opts.Command))
+	// Sessions exec-ecs runs on its own behalf are audited too, unless
+	// their operation is: the audit log is about what reached the
+	// container, not what the user typed.
+	var recording string
+	audit := c.sessionAudit(ctx, awsCfg, opts)
+	audit.SessionID = aws.ToString(resp.Session.SessionId)
+	if !opts.Internal {
+		start := audit
+		start.Event = AuditSessionStart
+		c.appendAudit(ctx, start)
+		defer func() {
+			end := audit
+			end.Event = AuditSessionEnd
+			end.EndedAt = time.Now().UTC()
+			end.ExitCode = &code
+			end.Recorded, end.Recording = recording != "", recording
+			if err != nil {
+				end.Error = err.Error()
+			}
+			c.appendAudit(ctx, end)
+		}()
+	}
+	if opts.Result != nil {
+		defer func() {
+			*opts.Result = SessionResult{StartedAt: audit.StartedAt, Duration: time.Since(audit.StartedAt), Recording: recording}
+		}()
+	}
+
+	if opts.Protect {
+		release := protectTask(ctx, c, client, opts)
+		defer release()
+	}
+
+	if opts.Stdout == nil && opts.Stdin == nil {
+		restoreTitle := setTerminalTitle(os.Stdout, sessionTitle(opts))
+		defer restoreTitle()
+	}
+
+	escapeChar, escErr := c.EscapeChar()
+	if escErr != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", escErr)
+	}
+	ptyOpts := ptyOptions{
+		Stdout:      opts.Stdout,
+		Stdin:       opts.Stdin,
+		Escape:      escapeChar,
+		Suspendable: opts.Suspendable,
+		Info:        func() string { return sessionInfo(opts, audit) },
+		Terminate: func() {
+			c.LogAWSCommand("ssm", "terminate-session", "--session-id", audit.SessionID, "--profile", c.Profile, "--region", opts.Region)
+			if err := terminateSession(ctx, awsCfg, opts.Region, audit.SessionID); err != nil {
+				fmt.Fprintln(os.Stderr, "exec-ecs: terminating the session:", err)
+			}
+		},
+	}
+	if c.StatusLineEnabled() {
+		ptyOpts.StatusLine = newStatusLine(c, opts, audit.StartedAt).render
+	}
+	// The recorder may also be started by ~r once the session is open.
+	var recMu sync.Mutex
+	var rec *castRecorder
+	ptyOpts.StartRecording = func() (*castRecorder, error) {
+		r, err := startRecording(c, opts)
+		if err == nil {
+			recMu.Lock()
+			rec = r
+			recMu.Unlock()
+		}
+		return r, err
+	}
+	defer func() {
+		recMu.Lock()
+		defer recMu.Unlock()
+		if rec == nil {
+			return
+		}
+		if err := rec.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs: saving recording:", err)
+			return
+		}
+		recording = rec.path
+		fmt.Fprintln(os.Stderr, "Session recorded to", rec.path)
+	}()
+	if opts.Record {
+		r, err := ptyOpts.StartRecording()
+		if err != nil {
+			// A broken recordings dir must not lock people out of a
+			// container in the middle of an incident.
+			fmt.Fprintln(os.Stderr, "exec-ecs: recording disabled:", err)
+		} else {
+			ptyOpts.Recorder = r
+		}
+	}
+	if status == nil {
+		return sessionStarter(ctx, opts.Region, resp.Session, ptyOpts)
+	}
+	ptyOpts.Stdout = status
+	code, err = sessionStarter(ctx, opts.Region, resp.Session, ptyOpts)
+	status.Flush()
+	if err != nil {
+		return code, err
+	}
+	if !status.Found() {
+		return ExitSessionError, fmt.Errorf("session ended without reporting the remote exit status (plugin exited with code %d)", code)
+	}
+	return status.Code(), nil
+}
+
+// sessionAudit is the audit record of a session or operation, short of
+// the event kind and what only its end knows. Internal sessions skip the
+// STS lookup of the caller, which nothing of theirs is audited with.
+func (c *Cli) sessionAudit(ctx context.Context, awsCfg aws.Config, opts ExecOptions) AuditEvent {
+	audit := AuditEvent{
+		Profile:     c.Profile,
+		Region:      opts.Region,
+		Cluster:     opts.ClusterArn,
+		Service:     opts.Service,
+		Task:        opts.TaskArn,
+		Container:   opts.Container,
+		Command:     opts.Command,
+		Environment: opts.Environment,
+		StartedAt:   time.Now().UTC(),
+	}
+	if !opts.Internal {
+		audit.Caller = c.auditCaller(ctx, awsCfg)
+	}
+	if IsPseudoService(audit.Service) {
+		audit.Service = ""
+	}
+	return audit
+}
+
+// auditOperation checks an operation made of Internal sessions against the
+// policy, with opts.Command describing the whole operation (`cp SRC DST`),
+// and writes its session-start event. The returned func writes the
+// matching session-end.
+func (c *Cli) auditOperation(ctx context.Context, awsCfg aws.Config, opts ExecOptions) (func(code int, err error), error) {
+	if decision := c.checkPolicy(ctx, opts); !decision.Allowed {
+		return nil, policyError(opts, decision)
+	}
+	audit := c.sessionAudit(ctx, awsCfg, opts)
+	start := audit
+	start.Event = AuditSessionStart
+	c.appendAudit(ctx, start)
+	return func(code int, err error) {
+		end := audit
+		end.Event = AuditSessionEnd
+		end.EndedAt = time.Now().UTC()
+		end.ExitCode = &code
+		if err != nil {
+			end.Error = err.Error()
+		}
+		c.appendAudit(ctx, end)
+	}, nil
+}
+
+// sessionInfo is what ~i shows, short of the recording state the PTY
+// bridge adds.
+func sessionInfo(opts ExecOptions, audit AuditEvent) string {
+	target := sessionTarget(opts)
+	if opts.Environment != "" {
+		target += " (" + opts.Environment + ")"
+	}
+	identity := audit.Caller
+	if identity == "" {
+		identity = "unknown"
+	}
+	return strings.Join([]string{
+		"target:    " + target,
+		"command:   " + opts.Command,
+		"identity:  " + identity,
+		"session:   " + audit.SessionID,
+		"up:        " + time.Since(audit.StartedAt).Round(time.Second).String(),
+	}, "\r\n")
+}
 
-	return sessionStarter(ctx, opts.Region, resp.Session)
+// terminateSession ends an SSM session; swapped out in tests.
+var terminateSession = func(ctx context.Context, awsCfg aws.Config, region, sessionID string) error {
+	client := ssm.NewFromConfig(awsCfg, func(o *ssm.Options) { o.Region = region })
+	_, err := client.TerminateSession(ctx, &ssm.TerminateSessionInput{SessionId: aws.String(sessionID)})
+	return err
 }
 
 // startExecuteCommand is the SDK call, factored out for testability.
@@ -94,7 +390,7 @@ type sessionJSON struct {
 // startSessionManagerPlugin spawns the real plugin, wiring it up to a PTY so
 // the inner shell behaves identically to running `aws ecs execute-command`.
 // Returns the plugin's exit code so the caller can decide whether to loop.
-func startSessionManagerPlugin(ctx context.Context, region string, session *ecstypes.Session) (int, error) {
+func startSessionManagerPlugin(ctx context.Context, region string, session *ecstypes.Session, opts ptyOptions) (int, error) {
 	if session == nil {
 		return 1, errors.New("nil session")
 	}
@@ -115,5 +411,5 @@ func startSessionManagerPlugin(ctx context.Context, region string, session *ecst
 		region,
 		"StartSession",
 	)
-	return runPTYCommand(cmd)
+	return runPTYCommand(cmd, opts)
 }
@@ -1,8 +1,12 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -30,7 +34,7 @@ func TestExecECSFailsWithEmptySession(t *testing.T) {
 	startExecuteCommand = func(ctx context.Context, _ ecsExecuteCommander, opts ExecOptions) (*ecs.ExecuteCommandOutput, error) {
 		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{}}, nil
 	}
-	sessionStarter = func(ctx context.Context, region string, sess *ecstypes.Session) (int, error) {
+	sessionStarter = func(ctx context.Context, region string, sess *ecstypes.Session, _ ptyOptions) (int, error) {
 		t.Fatal("sessionStarter should not run for empty session")
 		return 0, nil
 	}
@@ -78,7 +82,7 @@ func TestExecECSInvokesStarter(t *testing.T) {
 		}}, nil
 	}
 	called := false
-	sessionStarter = func(ctx context.Context, region string, sess *ecstypes.Session) (int, error) {
+	sessionStarter = func(ctx context.Context, region string, sess *ecstypes.Session, _ ptyOptions) (int, error) {
 		called = true
 		if region != "eu-west-1" {
 			t.Fatalf("region = %q", region)
@@ -90,9 +94,9 @@ func TestExecECSInvokesStarter(t *testing.T) {
 	}
 
 	setHistoryFile(t)
-	c := &Cli{}
+	c := &Cli{Profile: "dev"}
 	code, err := ExecECS(context.Background(), c, aws.Config{}, ExecOptions{
-		Region: "eu-west-1", ClusterArn: "c", TaskArn: "t", Container: "main", Command: "bash",
+		Region: "eu-west-1", ClusterArn: "c", Service: "s", TaskArn: "t", Container: "main", Command: "bash",
 	})
 	if err != nil {
 		t.Fatalf("err: %v", err)
@@ -104,17 +108,167 @@ func TestExecECSInvokesStarter(t *testing.T) {
 		t.Fatal("sessionStarter not called")
 	}
 
-	// Confirm the history was appended with a structured note rather than
-	// a literal `aws ecs execute-command ...` line.
-	hist := GetLastUniqueHistory(1)
-	if len(hist) != 1 || !contains(hist[0], "ecs exec cluster=c") {
+	// The history entry is written after the session so it carries the
+	// outcome, and names the target rather than a shell command line.
+	hist := LoadHistory()
+	if len(hist) != 1 {
 		t.Fatalf("history = %v", hist)
 	}
+	e := hist[0]
+	if e.Profile != "dev" || e.Region != "eu-west-1" || e.Cluster != "c" || e.Service != "s" ||
+		e.Task != "t" || e.Container != "main" || e.Command != "bash" {
+		t.Fatalf("entry target = %+v", e)
+	}
+	if e.ExitCode != 42 || e.StartedAt.IsZero() || e.DurationMs < 0 {
+		t.Fatalf("entry outcome = %+v", e)
+	}
+
+	// A cluster-level pick is recorded without a service, so a replay
+	// doesn't try to list "(all tasks)".
+	if _, err := ExecECS(context.Background(), c, aws.Config{}, ExecOptions{
+		Region: "eu-west-1", ClusterArn: "c", Service: AllTasksService, TaskArn: "t", Container: "main", Command: "bash",
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if hist := LoadHistory(); len(hist) != 2 || hist[1].Service != "" {
+		t.Fatalf("pseudo-service entry = %+v", hist)
+	}
+}
+
+func TestExecECSCaptureExitStatus(t *testing.T) {
+	prevStart := startExecuteCommand
+	prevStarter := sessionStarter
+	t.Cleanup(func() {
+		startExecuteCommand = prevStart
+		sessionStarter = prevStarter
+	})
+
+	var sent string
+	startExecuteCommand = func(ctx context.Context, _ ecsExecuteCommander, opts ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		sent = opts.Command
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId:  aws.String("s-1"),
+			StreamUrl:  aws.String("wss://example/stream"),
+			TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	sessionStarter = func(ctx context.Context, region string, sess *ecstypes.Session, opts ptyOptions) (int, error) {
+		// Echo what the wrapped remote shell would print.
+		marker := sent[strings.Index(sent, exitMarkerPrefix):strings.LastIndex(sent, "$?")]
+		_, _ = opts.Stdout.Write([]byte("result\r\n" + marker + "7\r\n"))
+		return 0, nil
+	}
+
+	setHistoryFile(t)
+	var out bytes.Buffer
+	code, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, ExecOptions{
+		Region: "eu-west-1", ClusterArn: "c", TaskArn: "t", Container: "main", Command: "false",
+		CaptureExitStatus: true, Stdout: &out,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if code != 7 {
+		t.Fatalf("code = %d, want remote status 7", code)
+	}
+	if !strings.HasPrefix(sent, "/bin/sh -c ") {
+		t.Fatalf("command not wrapped: %q", sent)
+	}
+	if out.String() != "result\r\n" {
+		t.Fatalf("output = %q", out.String())
+	}
+}
+
+// A command that ends the shell itself still reports its status, since
+// -once exists to hand that status to scripts.
+func TestExecECSCaptureExitStatusWhenCommandEndsShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the wrapped command needs a POSIX shell")
+	}
+	prevStart := startExecuteCommand
+	prevStarter := sessionStarter
+	t.Cleanup(func() {
+		startExecuteCommand = prevStart
+		sessionStarter = prevStarter
+	})
+
+	var sent string
+	startExecuteCommand = func(ctx context.Context, _ ecsExecuteCommander, opts ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		sent = opts.Command
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId:  aws.String("s-1"),
+			StreamUrl:  aws.String("wss://example/stream"),
+			TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	sessionStarter = func(ctx context.Context, region string, sess *ecstypes.Session, opts ptyOptions) (int, error) {
+		// Run the wrapped command as the agent would, splitting it with
+		// shell quoting.
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", sent)
+		cmd.Stdout = opts.Stdout
+		_ = cmd.Run()
+		return 0, nil
+	}
+
+	setHistoryFile(t)
+	cases := []struct {
+		command string
+		want    int
+	}{
+		{"exit 3", 3},
+		{"exec sh -c 'exit 4'", 4},
+		{"set -e; false; echo unreachable", 1},
+		{"echo done", 0},
+	}
+	for _, tc := range cases {
+		var out bytes.Buffer
+		code, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, ExecOptions{
+			Region: "eu-west-1", ClusterArn: "c", TaskArn: "t", Container: "main", Command: tc.command,
+			CaptureExitStatus: true, Stdout: &out,
+		})
+		if err != nil || code != tc.want {
+			t.Errorf("%s: code = %d, err = %v; want %d", tc.command, code, err, tc.want)
+		}
+		if strings.Contains(out.String(), exitMarkerPrefix) || strings.Contains(out.String(), "unreachable") {
+			t.Errorf("%s: output = %q", tc.command, out.String())
+		}
+	}
+}
+
+func TestExecECSCaptureWithoutStatusLine(t *testing.T) {
+	prevStart := startExecuteCommand
+	prevStarter := sessionStarter
+	t.Cleanup(func() {
+		startExecuteCommand = prevStart
+		sessionStarter = prevStarter
+	})
+
+	startExecuteCommand = func(ctx context.Context, _ ecsExecuteCommander, opts ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId:  aws.String("s-1"),
+			StreamUrl:  aws.String("wss://example/stream"),
+			TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	sessionStarter = func(ctx context.Context, region string, sess *ecstypes.Session, opts ptyOptions) (int, error) {
+		return 0, nil
+	}
+
+	setHistoryFile(t)
+	code, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, ExecOptions{
+		Region: "eu-west-1", Command: "true", CaptureExitStatus: true, Stdout: &bytes.Buffer{},
+	})
+	if err == nil {
+		t.Fatal("missing status line should be an error")
+	}
+	if code != ExitSessionError {
+		t.Fatalf("code = %d", code)
+	}
 }
 
 func TestStartSessionManagerPluginRejectsNil(t *testing.T) {
 	t.Parallel()
-	code, err := startSessionManagerPlugin(context.Background(), "us-east-1", nil)
+	code, err := startSessionManagerPlugin(context.Background(), "us-east-1", nil, ptyOptions{})
 	if err == nil {
 		t.Fatal("expected error for nil session")
 	}
@@ -133,7 +287,7 @@ func TestStartSessionManagerPluginNoBinary(t *testing.T) {
 		StreamUrl:  aws.String("wss://x"),
 		TokenValue: aws.String("t"),
 	}
-	code, err := startSessionManagerPlugin(context.Background(), "us-east-1", session)
+	code, err := startSessionManagerPlugin(context.Background(), "us-east-1", session, ptyOptions{})
 	if err == nil {
 		t.Fatal("expected exec failure when binary is absent")
 	}
@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// enableExecTimeout is how long EnableServiceExec waits for a task of the
+// new deployment to be ready.
+const enableExecTimeout = 15 * time.Minute
+
+// enableExecPollInterval paces the wait for the redeployment, swapped out
+// in tests.
+var enableExecPollInterval = 5 * time.Second
+
+// ExecEnableClient updates a service and watches its new tasks come up.
+type ExecEnableClient interface {
+	environmentLookup
+	ecsTaskLister
+	ecsTaskDescriber
+	UpdateService(ctx context.Context, params *ecs.UpdateServiceInput, optFns ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error)
+}
+
+// NewExecEnableClient is a thin constructor so callers don't import ecs
+// directly.
+func NewExecEnableClient(cfg aws.Config, region string) ExecEnableClient {
+	return ecs.NewFromConfig(cfg, func(o *ecs.Options) { o.Region = region })
+}
+
+// ConfirmEnableExec explains what enabling ECS Exec on the service does and
+// asks before doing it. A prod target needs the service name typed, as
+// GuardTarget does for sessions; anything else needs a yes. Without a
+// terminal the answer is no.
+func (c *Cli) ConfirmEnableExec(ctx context.Context, client environmentLookup, state State) (bool, error) {
+	if !stdinIsTerminal() {
+		return false, errors.New("enabling ECS Exec needs a terminal to confirm on")
+	}
+	env := c.ClassifyTarget(ctx, client, state)
+	service := displayTail(state.Service)
+	fmt.Fprintf(confirmOutput, "This turns on ECS Exec for service %s in %s (UpdateService --enable-execute-command --force-new-deployment).\n", service, displayTail(state.ClusterArn))
+	fmt.Fprintln(confirmOutput, "Every task of the service is replaced; the task role also needs the ssmmessages permissions (see `exec-ecs doctor`).")
+	reader := bufio.NewReader(confirmInput)
+	if env == EnvProd {
+		badge, _ := environmentStyle(env)
+		fmt.Fprintf(confirmOutput, "%s Type the service name to redeploy this production service: ", badge.Render("PROD"))
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+		return strings.TrimSpace(line) == service, nil
+	}
+	fmt.Fprint(confirmOutput, "Redeploy it now? [y/N] ")
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return slices.Contains([]string{"y", "yes"}, strings.ToLower(strings.TrimSpace(line))), nil
+}
+
+// EnableServiceExec sets enableExecuteCommand on the service and forces a
+// new deployment, then waits for a task of that deployment to run with its
+// exec agents up and returns its ARN. A failed rollout ends the wait.
+func (c *Cli) EnableServiceExec(ctx context.Context, client ExecEnableClient, state State) (string, error) {
+	c.LogAWSCommand("ecs", "update-service", "--cluster", state.ClusterArn, "--service", state.Service, "--enable-execute-command", "--force-new-deployment", "--profile", c.Profile, "--region", state.Region)
+	out, err := client.UpdateService(ctx, &ecs.UpdateServiceInput{
+		Cluster:              &state.ClusterArn,
+		Service:              &state.Service,
+		EnableExecuteCommand: aws.Bool(true),
+		ForceNewDeployment:   true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("update service: %w", err)
+	}
+	c.appendAudit(ctx, AuditEvent{
+		Event:       AuditExecEnabled,
+		Profile:     c.Profile,
+		Region:      state.Region,
+		Cluster:     state.ClusterArn,
+		Service:     state.Service,
+		Environment: CurrentEnvironment,
+	})
+	deployment := primaryDeployment(out.Service)
+	if deployment == nil {
+		return "", errors.New("update service: no primary deployment in the response")
+	}
+	id := aws.ToString(deployment.Id)
+	fmt.Fprintf(confirmOutput, "ECS Exec enabled; waiting for deployment %s to start tasks...\n", id)
+
+	ctx, cancel := context.WithTimeout(ctx, enableExecTimeout)
+	defer cancel()
+	last := ""
+	for {
+		arn, progress, err := c.execDeploymentStatus(ctx, client, state, id)
+		if err != nil || arn != "" {
+			return arn, err
+		}
+		if progress != last {
+			fmt.Fprintln(confirmOutput, "  "+progress)
+			last = progress
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("waiting for deployment %s: %w", id, ctx.Err())
+		case <-time.After(enableExecPollInterval):
+		}
+	}
+}
+
+// execDeploymentStatus checks deployment id once. It returns a ready task
+// of the deployment if there is one, and otherwise a line of progress.
+func (c *Cli) execDeploymentStatus(ctx context.Context, client ExecEnableClient, state State, id string) (string, string, error) {
+	c.LogAWSCommand("ecs", "describe-services", "--cluster", state.ClusterArn, "--services", state.Service, "--profile", c.Profile, "--region", state.Region)
+	svcs, err := client.DescribeServices(ctx, &ecs.DescribeServicesInput{Cluster: &state.ClusterArn, Services: []string{state.Service}})
+	if err != nil {
+		return "", "", fmt.Errorf("describe service: %w", err)
+	}
+	var d *ecstypes.Deployment
+	if len(svcs.Services) > 0 {
+		i := slices.IndexFunc(svcs.Services[0].Deployments, func(d ecstypes.Deployment) bool { return aws.ToString(d.Id) == id })
+		if i >= 0 {
+			d = &svcs.Services[0].Deployments[i]
+		}
+	}
+	if d == nil {
+		return "", "", fmt.Errorf("deployment %s is gone from service %s", id, displayTail(state.Service))
+	}
+	if d.RolloutState == ecstypes.DeploymentRolloutStateFailed {
+		return "", "", fmt.Errorf("deployment %s failed: %s", id, aws.ToString(d.RolloutStateReason))
+	}
+	progress := fmt.Sprintf("%s: %d/%d running, %d pending", taskDefLabel(aws.ToString(d.TaskDefinition)), d.RunningCount, d.DesiredCount, d.PendingCount)
+	if d.RunningCount == 0 {
+		return "", progress, nil
+	}
+
+	c.LogAWSCommand("ecs", "list-tasks", "--cluster", state.ClusterArn, "--service-name", state.Service, "--profile", c.Profile, "--region", state.Region)
+	arns, err := listAllTaskArns(ctx, client, state.ClusterArn, state.Service)
+	if err != nil || len(arns) == 0 {
+		return "", progress, err
+	}
+	tasks, err := describeAllTasks(ctx, client, state.ClusterArn, arns)
+	if err != nil {
+		return "", "", fmt.Errorf("describe tasks: %w", err)
+	}
+	for _, t := range tasks {
+		// Service tasks are started by their deployment.
+		if aws.ToString(t.StartedBy) == id && t.EnableExecuteCommand && aws.ToString(t.LastStatus) == "RUNNING" && execAgentRunning(t, "") {
+			return aws.ToString(t.TaskArn), "", nil
+		}
+	}
+	return "", progress + ", waiting for the exec agent", nil
+}
+
+// primaryDeployment is the service's PRIMARY deployment, or nil.
+func primaryDeployment(s *ecstypes.Service) *ecstypes.Deployment {
+	if s == nil {
+		return nil
+	}
+	for i, d := range s.Deployments {
+		if aws.ToString(d.Status) == "PRIMARY" {
+			return &s.Deployments[i]
+		}
+	}
+	return nil
+}
+
+// containerAgent is the ExecuteCommandAgent of one container; agent is
+// nil when the container started without ECS Exec.
+type containerAgent struct {
+	container string
+	agent     *ecstypes.ManagedAgent
+}
+
+// execAgents lists the ExecuteCommandAgent of each container of the task,
+// or of container alone when it is not empty.
+func execAgents(task ecstypes.Task, container string) []containerAgent {
+	var agents []containerAgent
+	for _, ct := range task.Containers {
+		name := aws.ToString(ct.Name)
+		if container != "" && name != container {
+			continue
+		}
+		ca := containerAgent{container: name}
+		for i := range ct.ManagedAgents {
+			if ct.ManagedAgents[i].Name == ecstypes.ManagedAgentNameExecuteCommandAgent {
+				ca.agent = &ct.ManagedAgents[i]
+			}
+		}
+		agents = append(agents, ca)
+	}
+	return agents
+}
+
+// execAgentRunning reports whether the exec agent is RUNNING on container,
+// or on every container that has one when container is empty. A task with
+// no agent at all is not ready.
+func execAgentRunning(task ecstypes.Task, container string) bool {
+	found := false
+	for _, ca := range execAgents(task, container) {
+		if ca.agent == nil {
+			continue
+		}
+		if aws.ToString(ca.agent.LastStatus) != "RUNNING" {
+			return false
+		}
+		found = true
+	}
+	return found
+}
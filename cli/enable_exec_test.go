@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const execServiceArn = "arn:aws:ecs:eu-west-1:1:service/web/api"
+
+// fakeExecECS answers each DescribeServices with the next of polls, the
+// last one repeating, and records UpdateService calls.
+type fakeExecECS struct {
+	fakeECS
+	polls    [][]ecstypes.Deployment
+	describe int
+	updates  []*ecs.UpdateServiceInput
+}
+
+func (f *fakeExecECS) UpdateService(_ context.Context, in *ecs.UpdateServiceInput, _ ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error) {
+	f.updates = append(f.updates, in)
+	return &ecs.UpdateServiceOutput{Service: &ecstypes.Service{Deployments: f.polls[0]}}, nil
+}
+
+func (f *fakeExecECS) DescribeServices(context.Context, *ecs.DescribeServicesInput, ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	deployments := f.polls[min(f.describe, len(f.polls)-1)]
+	f.describe++
+	return &ecs.DescribeServicesOutput{Services: []ecstypes.Service{{Deployments: deployments}}}, nil
+}
+
+func execDeployment(id string, running int32, state ecstypes.DeploymentRolloutState) ecstypes.Deployment {
+	return ecstypes.Deployment{
+		Id: aws.String(id), Status: aws.String("PRIMARY"), TaskDefinition: aws.String("api:12"),
+		DesiredCount: 2, RunningCount: running, PendingCount: 2 - running, RolloutState: state,
+	}
+}
+
+func agentTask(arn, startedBy string, agent string) ecstypes.Task {
+	return ecstypes.Task{
+		TaskArn: aws.String(arn), StartedBy: aws.String(startedBy), LastStatus: aws.String("RUNNING"), EnableExecuteCommand: startedBy == "ecs-svc/2",
+		Containers: []ecstypes.Container{{ManagedAgents: []ecstypes.ManagedAgent{{Name: ecstypes.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String(agent)}}}},
+	}
+}
+
+func stubEnableExec(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	prevIn, prevOut, prevTTY, prevPoll := confirmInput, confirmOutput, stdinIsTerminal, enableExecPollInterval
+	t.Cleanup(func() {
+		confirmInput, confirmOutput, stdinIsTerminal, enableExecPollInterval = prevIn, prevOut, prevTTY, prevPoll
+	})
+	var out bytes.Buffer
+	confirmOutput = &out
+	stdinIsTerminal = func() bool { return true }
+	enableExecPollInterval = 0
+	return &out
+}
+
+func TestEnableServiceExecWaitsForNewTask(t *testing.T) {
+	out := stubEnableExec(t)
+	path := setAuditFile(t)
+
+	f := &fakeExecECS{
+		polls: [][]ecstypes.Deployment{
+			{execDeployment("ecs-svc/2", 0, ecstypes.DeploymentRolloutStateInProgress)},
+			{execDeployment("ecs-svc/2", 1, ecstypes.DeploymentRolloutStateInProgress)},
+		},
+		fakeECS: fakeECS{
+			tasksPages: [][]string{{"old", "new"}},
+			describeTasks: []ecstypes.Task{
+				agentTask("old", "ecs-svc/1", "RUNNING"),
+				agentTask("new", "ecs-svc/2", "RUNNING"),
+			},
+		},
+	}
+	state := State{Profile: "shop", Region: "eu-west-1", ClusterArn: "web", Service: execServiceArn}
+	arn, err := (&Cli{Profile: "shop"}).EnableServiceExec(context.Background(), f, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arn != "new" {
+		t.Fatalf("task = %q", arn)
+	}
+	if len(f.updates) != 1 || !aws.ToBool(f.updates[0].EnableExecuteCommand) || !f.updates[0].ForceNewDeployment {
+		t.Fatalf("updates = %+v", f.updates)
+	}
+	if !strings.Contains(out.String(), "api:12: 0/2 running, 2 pending") {
+		t.Fatalf("progress = %q", out.String())
+	}
+	events := readAudit(t, path)
+	if len(events) != 1 || events[0].Event != AuditExecEnabled || events[0].Service != execServiceArn {
+		t.Fatalf("audit = %+v", events)
+	}
+}
+
+func TestEnableServiceExecFailedRollout(t *testing.T) {
+	stubEnableExec(t)
+	setAuditFile(t)
+
+	failed := execDeployment("ecs-svc/2", 0, ecstypes.DeploymentRolloutStateFailed)
+	failed.RolloutStateReason = aws.String("tasks failed to start")
+	f := &fakeExecECS{polls: [][]ecstypes.Deployment{
+		{execDeployment("ecs-svc/2", 0, ecstypes.DeploymentRolloutStateInProgress)},
+		{failed},
+	}}
+	_, err := (&Cli{}).EnableServiceExec(context.Background(), f, State{ClusterArn: "web", Service: execServiceArn})
+	if err == nil || !strings.Contains(err.Error(), "tasks failed to start") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestExecAgentRunning(t *testing.T) {
+	t.Parallel()
+
+	if !execAgentRunning(agentTask("t", "ecs-svc/2", "RUNNING"), "") {
+		t.Fatal("running agent")
+	}
+	if execAgentRunning(agentTask("t", "ecs-svc/2", "PENDING"), "") || execAgentRunning(ecstypes.Task{}, "") {
+		t.Fatal("pending or missing agent counts as running")
+	}
+
+	task := ecstypes.Task{Containers: []ecstypes.Container{
+		{Name: aws.String("app"), ManagedAgents: []ecstypes.ManagedAgent{{Name: ecstypes.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String("RUNNING")}}},
+		{Name: aws.String("sidecar"), ManagedAgents: []ecstypes.ManagedAgent{{Name: ecstypes.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String("PENDING")}}},
+	}}
+	if !execAgentRunning(task, "app") {
+		t.Fatal("app agent is running")
+	}
+	if execAgentRunning(task, "sidecar") || execAgentRunning(task, "") || execAgentRunning(task, "web") {
+		t.Fatal("pending or unknown container counts as running")
+	}
+}
+
+func TestConfirmEnableExec(t *testing.T) {
+	stubEnableExec(t)
+
+	dev := State{ClusterArn: "web-dev", Service: execServiceArn}
+	prod := State{ClusterArn: prodClusterArn, Service: execServiceArn}
+	c := envCli(map[string]EnvironmentRule{EnvProd: {Clusters: []string{"*-prod"}}})
+	cases := []struct {
+		state  State
+		answer string
+		want   bool
+	}{
+		{dev, "y\n", true},
+		{dev, "\n", false},
+		{prod, "y\n", false},
+		{prod, "api\n", true},
+	}
+	for _, tc := range cases {
+		confirmInput = strings.NewReader(tc.answer)
+		if got, err := c.ConfirmEnableExec(context.Background(), nil, tc.state); got != tc.want || err != nil {
+			t.Errorf("%s answering %q: got %v, %v", tc.state.ClusterArn, tc.answer, got, err)
+		}
+	}
+
+	stdinIsTerminal = func() bool { return false }
+	if ok, err := c.ConfirmEnableExec(context.Background(), nil, dev); ok || err == nil {
+		t.Fatal("no terminal should refuse")
+	}
+}
@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+)
+
+// Environment classes a target can fall into.
+const (
+	EnvProd    = "prod"
+	EnvStaging = "staging"
+	EnvDev     = "dev"
+)
+
+// environmentOrder is the order rules are tried in: a target matching
+// several classes gets the most sensitive one.
+var environmentOrder = []string{EnvProd, EnvStaging, EnvDev}
+
+// EnvironmentRule is one entry under `environments:` in config.yaml. A
+// target belongs to the environment when any single pattern matches.
+// Profiles and clusters are globs (`*-prod`); tag values may be globs too.
+type EnvironmentRule struct {
+	Profiles []string `yaml:"profiles"`
+	Accounts []string `yaml:"accounts"`
+	// Clusters match the cluster name, not its ARN.
+	Clusters []string `yaml:"clusters"`
+	// Tags match the cluster's or the service's resource tags.
+	Tags map[string]string `yaml:"tags"`
+}
+
+// CurrentEnvironment is the class of the target being picked or entered,
+// or "" when no rule matches. Menus colour their title bar and breadcrumb
+// by it, the same way they follow CurrentTheme.
+var CurrentEnvironment string
+
+// environmentColors are the same in every theme, so prod looks like prod
+// whatever theme is picked.
+var environmentColors = map[string]struct{ Bg, Fg lipgloss.Color }{
+	EnvProd:    {Bg: lipgloss.Color("#c0392b"), Fg: lipgloss.Color("#ffffff")},
+	EnvStaging: {Bg: lipgloss.Color("#d68910"), Fg: lipgloss.Color("#000000")},
+	EnvDev:     {Bg: lipgloss.Color("#1e8449"), Fg: lipgloss.Color("#ffffff")},
+}
+
+// environmentStyle returns the badge style for env, and false for an
+// unclassified target.
+func environmentStyle(env string) (lipgloss.Style, bool) {
+	colors, ok := environmentColors[env]
+	if !ok {
+		return lipgloss.NewStyle(), false
+	}
+	return lipgloss.NewStyle().Foreground(colors.Fg).Background(colors.Bg).Bold(true).Padding(0, 1), true
+}
+
+// ecsClusterDescriber is what ClassifyTarget needs to read a cluster's
+// account and tags.
+type ecsClusterDescriber interface {
+	DescribeClusters(ctx context.Context, params *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error)
+}
+
+type environmentLookup interface {
+	ecsClusterDescriber
+	ecsServiceDescriber
+}
+
+// targetFacts is what the rules look at.
+type targetFacts struct {
+	Profile string
+	Account string
+	Cluster string
+	Tags    map[string]string
+}
+
+func (r EnvironmentRule) matches(f targetFacts) bool {
+	for _, p := range r.Profiles {
+		if globMatch(p, f.Profile) {
+			return true
+		}
+	}
+	if f.Account != "" && slices.Contains(r.Accounts, f.Account) {
+		return true
+	}
+	for _, p := range r.Clusters {
+		if globMatch(p, f.Cluster) {
+			return true
+		}
+	}
+	for k, p := range r.Tags {
+		if v, ok := f.Tags[k]; ok && globMatch(p, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func globMatch(pattern, s string) bool {
+	if s == "" {
+		return false
+	}
+	ok, err := path.Match(pattern, s)
+	return err == nil && ok
+}
+
+func (c *Cli) classify(f targetFacts) string {
+	rules := c.settings().Environments
+	for _, env := range environmentOrder {
+		if rule, ok := rules[env]; ok && rule.matches(f) {
+			return env
+		}
+	}
+	return ""
+}
+
+// ClassifyTarget returns the environment state belongs to, or "". The
+// account comes from the cluster ARN when there is one. With a client,
+// missing accounts and any resource tags the rules ask about are looked up
+// too. When a lookup the prod rule depends on fails, the target is treated
+// as prod: the guard must fail closed, not wave through a cluster that is
+// prod only by its tags. Pass a nil client to classify on what state
+// already says, without API calls.
+func (c *Cli) ClassifyTarget(ctx context.Context, client environmentLookup, state State) string {
+	if len(c.settings().Environments) == 0 {
+		return ""
+	}
+	facts := targetFacts{
+		Profile: state.Profile,
+		Account: arnAccount(state.ClusterArn),
+		Cluster: displayTail(state.ClusterArn),
+	}
+	if client == nil || state.ClusterArn == "" {
+		return c.classify(facts)
+	}
+
+	needAccount, needTags := false, false
+	for _, rule := range c.settings().Environments {
+		needAccount = needAccount || len(rule.Accounts) > 0
+		needTags = needTags || len(rule.Tags) > 0
+	}
+	prod := c.settings().Environments[EnvProd]
+	var lookupErr error
+	if (needAccount && facts.Account == "") || needTags {
+		cluster, err := c.describeClusterTags(ctx, client, state.ClusterArn)
+		if err == nil {
+			facts.Account = arnAccount(aws.ToString(cluster.ClusterArn))
+			facts.Tags = tagMap(cluster.Tags)
+		} else if (len(prod.Accounts) > 0 && facts.Account == "") || len(prod.Tags) > 0 {
+			lookupErr = err
+		}
+	}
+	if needTags && state.Service != "" && !IsPseudoService(state.Service) {
+		c.LogAWSCommand("ecs", "describe-services", "--cluster", state.ClusterArn, "--services", state.Service, "--include", "TAGS", "--profile", c.Profile, "--region", c.Region)
+		out, err := client.DescribeServices(ctx, &ecs.DescribeServicesInput{
+			Cluster:  &state.ClusterArn,
+			Services: []string{state.Service},
+			Include:  []ecstypes.ServiceField{ecstypes.ServiceFieldTags},
+		})
+		if err == nil && len(out.Services) > 0 {
+			if facts.Tags == nil {
+				facts.Tags = map[string]string{}
+			}
+			for k, v := range tagMap(out.Services[0].Tags) {
+				facts.Tags[k] = v
+			}
+		} else if err != nil && len(prod.Tags) > 0 {
+			lookupErr = err
+		}
+	}
+	env := c.classify(facts)
+	if lookupErr != nil && env != EnvProd {
+		fmt.Fprintf(os.Stderr, "exec-ecs: could not look up what the prod rule matches on (%v); treating %s as prod\n", lookupErr, displayTail(state.ClusterArn))
+		return EnvProd
+	}
+	return env
+}
+
+// describeClusterTags describes one cluster with its tags, which also
+// yields its ARN when only the name was given.
+func (c *Cli) describeClusterTags(ctx context.Context, client ecsClusterDescriber, cluster string) (ecstypes.Cluster, error) {
+	c.LogAWSCommand("ecs", "describe-clusters", "--clusters", cluster, "--include", "TAGS", "--profile", c.Profile, "--region", c.Region)
+	out, err := client.DescribeClusters(ctx, &ecs.DescribeClustersInput{
+		Clusters: []string{cluster},
+		Include:  []ecstypes.ClusterField{ecstypes.ClusterFieldTags},
+	})
+	if err != nil {
+		return ecstypes.Cluster{}, err
+	}
+	if len(out.Clusters) == 0 {
+		return ecstypes.Cluster{}, fmt.Errorf("cluster %s not found", displayTail(cluster))
+	}
+	return out.Clusters[0], nil
+}
+
+func tagMap(tags []ecstypes.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	return m
+}
+
+// arnAccount is the account ID field of an ARN, or "" for a plain name.
+func arnAccount(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
+
+// Swapped out in tests.
+var (
+	confirmInput    io.Reader = os.Stdin
+	confirmOutput   io.Writer = os.Stderr
+	stdinIsTerminal           = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+)
+
+// GuardTarget classifies state, makes it the CurrentEnvironment, and for a
+// prod target asks for the cluster or service name to be typed before the
+// session may open. -confirm answers the question up front, which is the
+// only way through without a terminal. The returned error means "do not
+// connect".
+func (c *Cli) GuardTarget(ctx context.Context, client environmentLookup, state State) (string, error) {
+	env := c.ClassifyTarget(ctx, client, state)
+	CurrentEnvironment = env
+	if env != EnvProd || c.PolicyCheck {
+		// A -policy-check never connects, so there is nothing to confirm.
+		return env, nil
+	}
+
+	names := []string{displayTail(state.ClusterArn)}
+	if state.Service != "" && !IsPseudoService(state.Service) {
+		names = append(names, displayTail(state.Service))
+	}
+	if c.Confirm != "" {
+		if slices.Contains(names, c.Confirm) {
+			return env, nil
+		}
+		return env, fmt.Errorf("-confirm %q does not name this prod target (want %s)", c.Confirm, strings.Join(names, " or "))
+	}
+	if !stdinIsTerminal() {
+		return env, fmt.Errorf("%s is a prod target; pass -confirm %s to connect without a terminal", strings.Join(names, "/"), names[len(names)-1])
+	}
+
+	badge, _ := environmentStyle(env)
+	fmt.Fprintf(confirmOutput, "%s You are about to connect to a production target (%s).\n", badge.Render("PROD"), strings.Join(names, "/"))
+	what := "cluster"
+	if len(names) > 1 {
+		what = "cluster or service"
+	}
+	fmt.Fprintf(confirmOutput, "Type the %s name to continue: ", what)
+	line, err := bufio.NewReader(confirmInput).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return env, err
+	}
+	if answer := strings.TrimSpace(line); answer == "" || !slices.Contains(names, answer) {
+		return env, errors.New("confirmation did not match; not connecting")
+	}
+	return env, nil
+}
+
+// sessionTitle is the terminal title while a session is open.
+func sessionTitle(opts ExecOptions) string {
+	parts := []string{displayTail(opts.ClusterArn)}
+	if opts.Service != "" && !IsPseudoService(opts.Service) {
+		parts = append(parts, displayTail(opts.Service))
+	}
+	parts = append(parts, opts.Container)
+	title := "exec-ecs: " + strings.Join(parts, "/")
+	if opts.Environment != "" {
+		title = "[" + strings.ToUpper(opts.Environment) + "] " + title
+	}
+	return title
+}
+
+// setTerminalTitle saves the terminal's title, sets it to title and returns
+// a func that puts the old one back. It does nothing unless w is a
+// terminal.
+var setTerminalTitle = func(w *os.File, title string) func() {
+	if !term.IsTerminal(int(w.Fd())) {
+		return func() {}
+	}
+	// CSI 22/23 push and pop the title on xterm-compatible terminals;
+	// the rest ignore them.
+	fmt.Fprintf(w, "\x1b[22;0t\x1b]0;%s\x07", title)
+	return func() { fmt.Fprint(w, "\x1b[23;0t") }
+}
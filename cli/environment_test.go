@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const prodClusterArn = "arn:aws:ecs:eu-west-1:111111111111:cluster/web-prod"
+
+func envCli(rules map[string]EnvironmentRule) *Cli {
+	return &Cli{Config: &Config{Environments: rules}}
+}
+
+func TestClassifyTargetWithoutClient(t *testing.T) {
+	t.Parallel()
+
+	c := envCli(map[string]EnvironmentRule{
+		EnvProd:    {Profiles: []string{"*-prod"}, Accounts: []string{"111111111111"}},
+		EnvStaging: {Clusters: []string{"web-*"}},
+		EnvDev:     {Profiles: []string{"sandbox"}},
+	})
+	cases := []struct {
+		state State
+		want  string
+	}{
+		{State{Profile: "shop-prod"}, EnvProd},
+		{State{Profile: "shop", ClusterArn: prodClusterArn}, EnvProd},
+		{State{Profile: "shop", ClusterArn: "web-staging"}, EnvStaging},
+		{State{Profile: "sandbox", ClusterArn: "api"}, EnvDev},
+		{State{Profile: "shop", ClusterArn: "api"}, ""},
+		{State{}, ""},
+	}
+	for _, tc := range cases {
+		if got := c.ClassifyTarget(context.Background(), nil, tc.state); got != tc.want {
+			t.Errorf("ClassifyTarget(%+v) = %q, want %q", tc.state, got, tc.want)
+		}
+	}
+	if got := (&Cli{}).ClassifyTarget(context.Background(), nil, State{Profile: "shop-prod"}); got != "" {
+		t.Fatalf("no rules should classify nothing, got %q", got)
+	}
+}
+
+func TestClassifyTargetLooksUpAccountAndTags(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{
+		clusters: []ecstypes.Cluster{{ClusterArn: aws.String(prodClusterArn)}},
+		services: []ecstypes.Service{{Tags: []ecstypes.Tag{{Key: aws.String("Environment"), Value: aws.String("production")}}}},
+	}
+	byAccount := envCli(map[string]EnvironmentRule{EnvProd: {Accounts: []string{"111111111111"}}})
+	if got := byAccount.ClassifyTarget(context.Background(), f, State{ClusterArn: "web-prod"}); got != EnvProd {
+		t.Fatalf("account lookup: got %q", got)
+	}
+
+	byTag := envCli(map[string]EnvironmentRule{EnvProd: {Tags: map[string]string{"Environment": "prod*"}}})
+	if got := byTag.ClassifyTarget(context.Background(), f, State{ClusterArn: prodClusterArn, Service: "api"}); got != EnvProd {
+		t.Fatalf("service tag: got %q", got)
+	}
+	if got := byTag.ClassifyTarget(context.Background(), f, State{ClusterArn: prodClusterArn, Service: AllTasksService}); got != "" {
+		t.Fatalf("pseudo-service must not be described, got %q", got)
+	}
+
+}
+
+func TestClassifyTargetFailsClosed(t *testing.T) {
+	t.Parallel()
+
+	byAccount := envCli(map[string]EnvironmentRule{EnvProd: {Accounts: []string{"111111111111"}}})
+	byTag := envCli(map[string]EnvironmentRule{
+		EnvProd: {Tags: map[string]string{"Environment": "prod*"}},
+		EnvDev:  {Clusters: []string{"web-*"}},
+	})
+	stagingTags := envCli(map[string]EnvironmentRule{EnvStaging: {Tags: map[string]string{"Environment": "staging"}}})
+
+	brokenCluster := &fakeECS{clusterErr: errors.New("AccessDenied")}
+	brokenService := &fakeECS{describeSvcErr: errors.New("AccessDenied")}
+	cases := []struct {
+		name   string
+		c      *Cli
+		client environmentLookup
+		state  State
+		want   string
+	}{
+		{"account", byAccount, brokenCluster, State{ClusterArn: "web-prod"}, EnvProd},
+		{"account in the ARN", byAccount, brokenCluster, State{ClusterArn: "arn:aws:ecs:eu-west-1:222222222222:cluster/web"}, ""},
+		{"cluster tags", byTag, brokenCluster, State{ClusterArn: "web-dev"}, EnvProd},
+		{"service tags", byTag, brokenService, State{ClusterArn: "web-dev", Service: "api"}, EnvProd},
+		{"no prod tag rule", stagingTags, brokenCluster, State{ClusterArn: "web-dev"}, ""},
+	}
+	for _, tc := range cases {
+		if got := tc.c.ClassifyTarget(context.Background(), tc.client, tc.state); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGuardTarget(t *testing.T) {
+	prevIn, prevOut, prevTTY, prevEnv := confirmInput, confirmOutput, stdinIsTerminal, CurrentEnvironment
+	t.Cleanup(func() {
+		confirmInput, confirmOutput, stdinIsTerminal, CurrentEnvironment = prevIn, prevOut, prevTTY, prevEnv
+	})
+	var out bytes.Buffer
+	confirmOutput = &out
+	stdinIsTerminal = func() bool { return true }
+
+	rules := map[string]EnvironmentRule{EnvProd: {Clusters: []string{"*-prod"}}, EnvDev: {Clusters: []string{"*-dev"}}}
+	state := State{ClusterArn: prodClusterArn, Service: "arn:aws:ecs:eu-west-1:111111111111:service/web-prod/api"}
+
+	env, err := envCli(rules).GuardTarget(context.Background(), nil, State{ClusterArn: "web-dev"})
+	if env != EnvDev || err != nil || CurrentEnvironment != EnvDev {
+		t.Fatalf("dev target: env=%q err=%v current=%q", env, err, CurrentEnvironment)
+	}
+
+	for _, answer := range []string{"web-prod\n", "api\n"} {
+		confirmInput = strings.NewReader(answer)
+		if _, err := envCli(rules).GuardTarget(context.Background(), nil, state); err != nil {
+			t.Fatalf("answer %q: %v", answer, err)
+		}
+	}
+	if !strings.Contains(out.String(), "Type the cluster or service name") {
+		t.Fatalf("prompt = %q", out.String())
+	}
+	for _, answer := range []string{"", "web\n", "WEB-PROD\n"} {
+		confirmInput = strings.NewReader(answer)
+		if _, err := envCli(rules).GuardTarget(context.Background(), nil, state); err == nil {
+			t.Fatalf("answer %q should be refused", answer)
+		}
+	}
+
+	stdinIsTerminal = func() bool { return false }
+	if _, err := envCli(rules).GuardTarget(context.Background(), nil, state); err == nil || !strings.Contains(err.Error(), "-confirm") {
+		t.Fatalf("no terminal: err = %v", err)
+	}
+	c := envCli(rules)
+	c.Confirm = "api"
+	if _, err := c.GuardTarget(context.Background(), nil, state); err != nil {
+		t.Fatalf("-confirm api: %v", err)
+	}
+	c.Confirm = "other"
+	if _, err := c.GuardTarget(context.Background(), nil, state); err == nil {
+		t.Fatal("-confirm with the wrong name should fail")
+	}
+}
+
+func TestSessionTitle(t *testing.T) {
+	t.Parallel()
+
+	opts := ExecOptions{ClusterArn: prodClusterArn, Service: "api", Container: "app", Environment: EnvProd}
+	if got := sessionTitle(opts); got != "[PROD] exec-ecs: web-prod/api/app" {
+		t.Fatalf("title = %q", got)
+	}
+	opts.Service, opts.Environment = StandaloneTasksService, ""
+	if got := sessionTitle(opts); got != "exec-ecs: web-prod/app" {
+		t.Fatalf("title = %q", got)
+	}
+}
+
+func TestMenuHeaderShowsEnvironment(t *testing.T) {
+	prev := CurrentEnvironment
+	t.Cleanup(func() { CurrentEnvironment = prev })
+
+	m := initialModelWithBreadcrumb("Choose ECS service", []string{"api"}, "", true, "Profile: shop > Cluster: web-prod")
+	if strings.Contains(m.menuHeader(), "PROD") {
+		t.Fatal("unclassified target should not show a badge")
+	}
+	CurrentEnvironment = EnvProd
+	if !strings.Contains(m.menuHeader(), "exec-ecs · PROD") {
+		t.Fatalf("header = %q", m.menuHeader())
+	}
+}
+
+func TestLoadConfigParsesEnvironments(t *testing.T) {
+	dir := setConfigDir(t)
+	yml := "environments:\n  prod:\n    profiles: ['*-prod']\n    accounts: ['111111111111']\n    tags:\n      Environment: production\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(yml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	prod := cfg.Environments[EnvProd]
+	if len(prod.Profiles) != 1 || prod.Accounts[0] != "111111111111" || prod.Tags["Environment"] != "production" {
+		t.Fatalf("prod = %+v", prod)
+	}
+}
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// defaultEscapeChar starts an escape sequence, as in ssh.
+const defaultEscapeChar = '~'
+
+// Escape commands, typed after the escape char at the start of a line.
+const (
+	escDisconnect = '.'
+	escSuspend    = 0x1a // ctrl+z
+	escInfo       = 'i'
+	escRecord     = 'r'
+	escHelp       = '?'
+)
+
+// ErrDisconnected and ErrSuspended are how ExecECS reports a session the
+// user left with an escape sequence. The session is over either way: SSM
+// sessions can't be detached, so suspending closes it too and only differs
+// in where the user lands.
+var (
+	ErrDisconnected = errors.New("disconnected")
+	ErrSuspended    = errors.New("session suspended")
+)
+
+// EscapeChar is the configured escape char, or 0 when escapes are off.
+// escape_char in config.yaml takes a single character, a caret form such
+// as "^]", or "none".
+func (c *Cli) EscapeChar() (byte, error) {
+	s := c.settings().EscapeChar
+	switch {
+	case s == "":
+		return defaultEscapeChar, nil
+	case s == "none":
+		return 0, nil
+	case len(s) == 1 && s[0] > ' ' && s[0] < 0x7f:
+		return s[0], nil
+	case len(s) == 2 && s[0] == '^' && s[1] >= '@' && s[1] <= '_':
+		return s[1] & 0x1f, nil
+	}
+	return defaultEscapeChar, fmt.Errorf("escape_char %q is not a character, a ^X control char or none; using ~", s)
+}
+
+// escapeScanner finds escape sequences in what the user types. The escape
+// char only counts right after a newline (or at the very start), so it can
+// still be typed mid-line; doubling it sends one. A sequence that isn't a
+// command is sent on as typed.
+type escapeScanner struct {
+	char byte
+	// suspendable enables ~^Z, which needs a picker to go back to.
+	suspendable bool
+	lineStart   bool
+	pending     bool
+}
+
+func newEscapeScanner(char byte, suspendable bool) *escapeScanner {
+	return &escapeScanner{char: char, suspendable: suspendable, lineStart: true}
+}
+
+// feed takes one typed byte. It returns the bytes to pass to the session
+// and, when the byte completes an escape sequence, the command.
+func (s *escapeScanner) feed(b byte) (send []byte, cmd byte) {
+	if s.pending {
+		s.pending = false
+		switch {
+		case b == escDisconnect, b == escInfo, b == escRecord, b == escHelp,
+			b == escSuspend && s.suspendable:
+			// Another sequence may follow at once.
+			s.lineStart = true
+			return nil, b
+		case b == s.char:
+			s.lineStart = false
+			return []byte{b}, 0
+		}
+		s.lineStart = b == '\r' || b == '\n'
+		return []byte{s.char, b}, 0
+	}
+	if s.lineStart && b == s.char {
+		s.pending = true
+		return nil, 0
+	}
+	s.lineStart = b == '\r' || b == '\n'
+	return []byte{b}, 0
+}
+
+// escapeHelp lists the escape commands, for ~?.
+func escapeHelp(char byte, suspendable bool) string {
+	e := escapeName(char)
+	lines := []string{
+		"Supported escape sequences:",
+		e + ".   - disconnect",
+	}
+	if suspendable {
+		lines = append(lines, e+"^Z  - close the session and go back to the picker")
+	}
+	lines = append(lines,
+		e+"i   - show session info",
+		e+"r   - start, pause or resume recording",
+		e+"?   - this message",
+		e+e+"  - send the escape character",
+		"(Escape sequences are only recognized immediately after a newline.)",
+	)
+	return strings.Join(lines, "\r\n")
+}
+
+// escapeName shows the escape char the way escape_char spells it.
+func escapeName(char byte) string {
+	if char < ' ' {
+		return "^" + string(rune(char|0x40))
+	}
+	return string(rune(char))
+}
+
+// recordingSwitch holds a session's recorder, which ~r may start or pause
+// while the session is open.
+type recordingSwitch struct {
+	mu    sync.Mutex
+	rec   *castRecorder
+	start func() (*castRecorder, error)
+}
+
+func (s *recordingSwitch) current() *castRecorder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rec
+}
+
+// toggle starts a recording when there is none and otherwise pauses or
+// resumes it. It returns a message for the user.
+func (s *recordingSwitch) toggle(cols, rows int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rec == nil {
+		if s.start == nil {
+			return "recording is not available for this session"
+		}
+		rec, err := s.start()
+		if err != nil {
+			return "could not start recording: " + err.Error()
+		}
+		rec.begin(cols, rows)
+		s.rec = rec
+		return "recording to " + rec.path
+	}
+	if s.rec.togglePaused() {
+		return "recording paused"
+	}
+	return "recording resumed"
+}
+
+// status describes the recording for ~i.
+func (s *recordingSwitch) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.rec == nil:
+		return "off"
+	case s.rec.isPaused():
+		return "paused (" + s.rec.path + ")"
+	}
+	return "on (" + s.rec.path + ")"
+}
+
+// recordingTee copies session output to the current recording, if any.
+type recordingTee struct {
+	w   io.Writer
+	rec *recordingSwitch
+}
+
+func (t recordingTee) Write(p []byte) (int, error) {
+	if rec := t.rec.current(); rec != nil {
+		_, _ = rec.Output().Write(p)
+	}
+	return t.w.Write(p)
+}
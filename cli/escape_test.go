@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// scan feeds typed into a scanner and returns what reaches the session
+// and the commands recognised, in order.
+func scan(s *escapeScanner, typed string) (string, string) {
+	var sent, cmds []byte
+	for i := 0; i < len(typed); i++ {
+		send, cmd := s.feed(typed[i])
+		sent = append(sent, send...)
+		if cmd != 0 {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return string(sent), string(cmds)
+}
+
+func TestEscapeScanner(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		typed, sent, cmds string
+	}{
+		{"~.", "", "."},
+		{"ls\r~i", "ls\r", "i"},
+		{"echo ~.\r", "echo ~.\r", ""},
+		{"~~.", "~.", ""},
+		{"~x", "~x", ""},
+		{"~\r~?", "~\r", "?"},
+		{"~i~r", "", "ir"},
+		{"~\x1a", "", "\x1a"},
+	}
+	for _, tc := range cases {
+		sent, cmds := scan(newEscapeScanner('~', true), tc.typed)
+		if sent != tc.sent || cmds != tc.cmds {
+			t.Errorf("%q: sent %q cmds %q, want %q %q", tc.typed, sent, cmds, tc.sent, tc.cmds)
+		}
+	}
+
+	if sent, cmds := scan(newEscapeScanner('~', false), "~\x1a"); sent != "~\x1a" || cmds != "" {
+		t.Fatalf("~^Z without a picker should pass through, got %q %q", sent, cmds)
+	}
+	if sent, cmds := scan(newEscapeScanner(0x1d, true), "~.\r\x1d."); sent != "~.\r" || cmds != "." {
+		t.Fatalf("^] escape: sent %q cmds %q", sent, cmds)
+	}
+}
+
+func TestEscapeChar(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		setting string
+		want    byte
+		ok      bool
+	}{
+		{"", '~', true},
+		{"none", 0, true},
+		{"%", '%', true},
+		{"^]", 0x1d, true},
+		{"ab", '~', false},
+		{" ", '~', false},
+	}
+	for _, tc := range cases {
+		got, err := (&Cli{Config: &Config{EscapeChar: tc.setting}}).EscapeChar()
+		if got != tc.want || (err == nil) != tc.ok {
+			t.Errorf("%q: got %q err=%v", tc.setting, got, err)
+		}
+	}
+	if !strings.Contains(escapeHelp(0x1d, false), "^].") || strings.Contains(escapeHelp('~', false), "^Z") {
+		t.Fatal("help should use the configured char and skip ~^Z without a picker")
+	}
+}
+
+func TestRecordingSwitch(t *testing.T) {
+	t.Parallel()
+
+	if msg := (&recordingSwitch{}).toggle(80, 24); !strings.Contains(msg, "not available") {
+		t.Fatalf("msg = %q", msg)
+	}
+
+	path := filepath.Join(t.TempDir(), "s.cast")
+	s := &recordingSwitch{start: func() (*castRecorder, error) { return newCastRecorder(path, "t") }}
+	var out bytes.Buffer
+	tee := recordingTee{w: &out, rec: s}
+	_, _ = tee.Write([]byte("before "))
+	if msg := s.toggle(80, 24); msg != "recording to "+path {
+		t.Fatalf("start: %q", msg)
+	}
+	_, _ = tee.Write([]byte("kept "))
+	if msg := s.toggle(80, 24); msg != "recording paused" || !strings.HasPrefix(s.status(), "paused") {
+		t.Fatalf("pause: %q %q", msg, s.status())
+	}
+	_, _ = tee.Write([]byte("secret "))
+	if msg := s.toggle(80, 24); msg != "recording resumed" {
+		t.Fatalf("resume: %q", msg)
+	}
+	_, _ = tee.Write([]byte("after"))
+	if err := s.current().Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "before kept secret after" {
+		t.Fatalf("terminal got %q", out.String())
+	}
+	var transcript bytes.Buffer
+	if err := ShowTranscript(path, &transcript); err != nil || transcript.String() != "kept after" {
+		t.Fatalf("recorded %q err=%v", transcript.String(), err)
+	}
+}
+
+func TestExecECSWiresEscapes(t *testing.T) {
+	setHistoryFile(t)
+	prevStart, prevStarter, prevTerminate := startExecuteCommand, sessionStarter, terminateSession
+	t.Cleanup(func() { startExecuteCommand, sessionStarter, terminateSession = prevStart, prevStarter, prevTerminate })
+	startExecuteCommand = func(context.Context, ecsExecuteCommander, ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId: aws.String("ecs-execute-command-0abc"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	var terminated string
+	terminateSession = func(_ context.Context, _ aws.Config, _, id string) error {
+		terminated = id
+		return nil
+	}
+	sessionStarter = func(_ context.Context, _ string, _ *ecstypes.Session, opts ptyOptions) (int, error) {
+		if opts.Escape != '~' || !opts.Suspendable || opts.StartRecording == nil {
+			t.Fatalf("pty options = %+v", opts)
+		}
+		if info := opts.Info(); !strings.Contains(info, "web-prod/t1/app (prod)") || !strings.Contains(info, "ecs-execute-command-0abc") {
+			t.Fatalf("info = %q", info)
+		}
+		opts.Terminate()
+		return ExitSessionError, ErrDisconnected
+	}
+
+	opts := ExecOptions{Region: "eu-west-1", ClusterArn: prodClusterArn, TaskArn: "t1", Container: "app", Command: "bash", Environment: EnvProd, Suspendable: true}
+	code, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, opts)
+	if code != ExitSessionError || err != ErrDisconnected || terminated != "ecs-execute-command-0abc" {
+		t.Fatalf("code=%d err=%v terminated=%q", code, err, terminated)
+	}
+	if (&Cli{}).SessionDropped(code, err) {
+		t.Fatal("~. is not a drop to reconnect from")
+	}
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Exit codes used by the non-interactive mode. Anything else is the remote
+// command's own status. 255 mirrors ssh: "the tool failed, not your command".
+const (
+	ExitUsage        = 2
+	ExitSessionError = 255
+)
+
+// exitMarkerPrefix tags the line the wrapped remote shell prints after the
+// user's command finishes. A per-session nonce is appended so ordinary
+// output can never be mistaken for the status line.
+const exitMarkerPrefix = "__EXEC_ECS_EXIT_"
+
+func newExitMarker() string {
+	var b [6]byte
+	_, _ = rand.Read(b[:])
+	return exitMarkerPrefix + hex.EncodeToString(b[:]) + "__:"
+}
+
+// wrapCommandForExitStatus runs command under /bin/sh and echoes its status
+// behind marker from an EXIT trap, so a command that ends the shell with
+// exit or set -e still reports it. The command runs in a subshell so exec
+// cannot replace the shell that owns the trap. The ECS agent splits Command
+// with shell-like quoting but does not run it through a shell, so the
+// single-quoted payload survives intact.
+func wrapCommandForExitStatus(command, marker string) string {
+	script := `trap 'echo "` + marker + `$?"' EXIT; (` + command + `)`
+	return "/bin/sh -c " + shellQuote(script)
+}
+
+// shellQuote wraps s in single quotes, escaping any embedded single quotes
+// the POSIX way.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// exitStatusWriter passes session output through to w while stripping the
+// marker line emitted by wrapCommandForExitStatus and recording the status
+// it carries. Bytes that could be the start of a marker are held back until
+// the line is complete, so nothing partial leaks to the user.
+type exitStatusWriter struct {
+	w      io.Writer
+	marker []byte
+	buf    []byte
+	code   int
+	found  bool
+}
+
+func newExitStatusWriter(w io.Writer, marker string) *exitStatusWriter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &exitStatusWriter{w: w, marker: []byte(marker)}
+}
+
+func (e *exitStatusWriter) Write(p []byte) (int, error) {
+	e.buf = append(e.buf, p...)
+	for {
+		idx := bytes.Index(e.buf, e.marker)
+		if idx < 0 {
+			break
+		}
+		if _, err := e.w.Write(e.buf[:idx]); err != nil {
+			return len(p), err
+		}
+		e.buf = e.buf[idx:]
+		nl := bytes.IndexByte(e.buf, '\n')
+		if nl < 0 {
+			// Status line not complete yet; wait for more bytes.
+			return len(p), nil
+		}
+		value := strings.TrimSpace(string(e.buf[len(e.marker):nl]))
+		if code, err := strconv.Atoi(value); err == nil {
+			e.code = code
+			e.found = true
+		}
+		e.buf = e.buf[nl+1:]
+	}
+	keep := partialPrefixLen(e.buf, e.marker)
+	if _, err := e.w.Write(e.buf[:len(e.buf)-keep]); err != nil {
+		return len(p), err
+	}
+	e.buf = append(e.buf[:0], e.buf[len(e.buf)-keep:]...)
+	return len(p), nil
+}
+
+// Flush writes out anything still held back. Call it once the session ends.
+func (e *exitStatusWriter) Flush() {
+	if len(e.buf) > 0 {
+		_, _ = e.w.Write(e.buf)
+		e.buf = e.buf[:0]
+	}
+}
+
+// Found reports whether the remote shell printed its status line.
+func (e *exitStatusWriter) Found() bool { return e.found }
+
+// Code is the remote exit status. Only meaningful when Found is true.
+func (e *exitStatusWriter) Code() int { return e.code }
+
+// partialPrefixLen returns the length of the longest suffix of buf that is
+// a proper prefix of marker.
+func partialPrefixLen(buf, marker []byte) int {
+	n := min(len(buf), len(marker)-1)
+	for ; n > 0; n-- {
+		if bytes.HasPrefix(marker, buf[len(buf)-n:]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// ResolveTarget fills in any State field left empty by the flags without
+// prompting. A field is only filled when the lookup yields exactly one
+// candidate; otherwise the returned error names the candidates and the flag
+// that disambiguates them, so scripts fail fast instead of hanging on a
+// picker nobody can see.
+//
+// Profile and Region must already be set.
+func ResolveTarget(ctx context.Context, c *Cli, client ECSClient, state State) (State, error) {
+	if state.Profile == "" || state.Region == "" {
+		return state, fmt.Errorf("a non-interactive run needs both -pr and -rg")
+	}
+
+	state, err := resolveCluster(ctx, c, client, state)
+	if err != nil {
+		return state, err
+	}
+
+	// A task ARN pins the target on its own; only resolve the service when
+	// we still need it to find a task.
+	if state.TaskArn == "" {
+		if state, err = resolveService(ctx, c, client, state); err != nil {
+			return state, err
+		}
+
+		c.LogAWSCommand("ecs", "list-tasks", "--cluster", state.ClusterArn, "--service-name", state.Service, "--profile", c.Profile, "--region", c.Region)
+		arns, err := listAllTaskArns(ctx, client, state.ClusterArn, state.Service)
+		if err != nil {
+			return state, fmt.Errorf("list tasks: %w", err)
+		}
+		arn, err := singleCandidate("task", "-tk", arns)
+		if err != nil {
+			return state, err
+		}
+		state.TaskArn = arn
+	}
+
+	return resolveContainer(ctx, c, client, state)
+}
+
+func resolveCluster(ctx context.Context, c *Cli, client ECSClient, state State) (State, error) {
+	if state.ClusterArn != "" {
+		return state, nil
+	}
+	c.LogAWSCommand("ecs", "list-clusters", "--profile", c.Profile, "--region", c.Region)
+	arns, err := listAllClusterArns(ctx, client)
+	if err != nil {
+		return state, fmt.Errorf("list clusters: %w", err)
+	}
+	arn, err := singleCandidate("cluster", "-cl", arns)
+	if err != nil {
+		return state, err
+	}
+	state.ClusterArn = arn
+	return state, nil
+}
+
+func resolveService(ctx context.Context, c *Cli, client ECSClient, state State) (State, error) {
+	if state.Service != "" {
+		return state, nil
+	}
+	c.LogAWSCommand("ecs", "list-services", "--cluster", state.ClusterArn, "--profile", c.Profile, "--region", c.Region)
+	arns, err := listAllServiceArns(ctx, client, state.ClusterArn)
+	if err != nil {
+		return state, fmt.Errorf("list services: %w", err)
+	}
+	arn, err := singleCandidate("service", "-se", arns)
+	if err != nil {
+		return state, err
+	}
+	state.Service = arn
+	return state, nil
+}
+
+// resolveContainer fills state.Container from the containers of
+// state.TaskArn.
+func resolveContainer(ctx context.Context, c *Cli, client ECSClient, state State) (State, error) {
+	if state.Container != "" {
+		return state, nil
+	}
+	c.LogAWSCommand("ecs", "describe-tasks", "--cluster", state.ClusterArn, "--tasks", state.TaskArn, "--profile", c.Profile, "--region", c.Region)
+	names, err := c.ListContainerNames(ctx, client, state.ClusterArn, state.TaskArn)
+	if err != nil {
+		return state, fmt.Errorf("describe task: %w", err)
+	}
+	name, err := singleCandidate("container", "-cn", names)
+	if err != nil {
+		return state, err
+	}
+	state.Container = name
+	return state, nil
+}
+
+// singleCandidate returns the only element of values, or an error that lists
+// the (short) names of every candidate and which flag picks one.
+func singleCandidate(kind, flagName string, values []string) (string, error) {
+	switch len(values) {
+	case 0:
+		return "", fmt.Errorf("no %s found", kind)
+	case 1:
+		return values[0], nil
+	}
+	return "", fmt.Errorf("%s is ambiguous: %d candidates (%s); pass %s", kind, len(values), strings.Join(namesAndArns(values), ", "), flagName)
+}
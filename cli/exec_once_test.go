@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestWrapCommandForExitStatus(t *testing.T) {
+	t.Parallel()
+
+	got := wrapCommandForExitStatus("echo 'hi'", "__M__:")
+	want := `/bin/sh -c 'trap '\''echo "__M__:$?"'\'' EXIT; (echo '\''hi'\'')'`
+	if got != want {
+		t.Fatalf("wrap = %s\nwant  %s", got, want)
+	}
+}
+
+func TestNewExitMarkerIsUnique(t *testing.T) {
+	t.Parallel()
+
+	a, b := newExitMarker(), newExitMarker()
+	if a == b {
+		t.Fatalf("markers should differ: %q", a)
+	}
+	if !strings.HasPrefix(a, exitMarkerPrefix) || !strings.HasSuffix(a, "__:") {
+		t.Fatalf("marker shape = %q", a)
+	}
+}
+
+func TestExitStatusWriterStripsMarkerLine(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	w := newExitStatusWriter(&out, "__M__:")
+	_, _ = w.Write([]byte("hello\r\n__M__:3\r\nbye"))
+	w.Flush()
+
+	if got := out.String(); got != "hello\r\nbye" {
+		t.Fatalf("output = %q", got)
+	}
+	if !w.Found() || w.Code() != 3 {
+		t.Fatalf("found=%v code=%d", w.Found(), w.Code())
+	}
+}
+
+func TestExitStatusWriterHandlesSplitWrites(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	w := newExitStatusWriter(&out, "__M__:")
+	for _, chunk := range []string{"out", "put\r\n__", "M_", "_:4", "2\r", "\n"} {
+		_, _ = w.Write([]byte(chunk))
+	}
+	w.Flush()
+
+	if got := out.String(); got != "output\r\n" {
+		t.Fatalf("output = %q", got)
+	}
+	if !w.Found() || w.Code() != 42 {
+		t.Fatalf("found=%v code=%d", w.Found(), w.Code())
+	}
+}
+
+func TestExitStatusWriterReleasesFalsePrefix(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	w := newExitStatusWriter(&out, "__M__:")
+	_, _ = w.Write([]byte("a__"))
+	if out.String() != "a" {
+		t.Fatalf("possible marker prefix should be held back, got %q", out.String())
+	}
+	_, _ = w.Write([]byte("x"))
+	if out.String() != "a__x" {
+		t.Fatalf("false prefix should be released, got %q", out.String())
+	}
+	if w.Found() {
+		t.Fatal("no marker was written")
+	}
+}
+
+func TestSingleCandidate(t *testing.T) {
+	t.Parallel()
+
+	if _, err := singleCandidate("task", "-tk", nil); err == nil || !strings.Contains(err.Error(), "no task") {
+		t.Fatalf("empty err = %v", err)
+	}
+	if v, err := singleCandidate("task", "-tk", []string{"only"}); err != nil || v != "only" {
+		t.Fatalf("single = %q %v", v, err)
+	}
+	_, err := singleCandidate("service", "-se", []string{"arn:x/svc/a", "arn:x/svc/b"})
+	if err == nil {
+		t.Fatal("expected ambiguity error")
+	}
+	for _, want := range []string{"ambiguous", "a, b", "-se"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q missing %q", err, want)
+		}
+	}
+}
+
+// containerTask builds a described task holding the named containers.
+func containerTask(names ...string) ecstypes.Task {
+	task := ecstypes.Task{}
+	for _, n := range names {
+		name := n
+		task.Containers = append(task.Containers, ecstypes.Container{Name: &name})
+	}
+	return task
+}
+
+func TestResolveTargetFillsSingleCandidates(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{
+		clustersPages: [][]string{{"arn:aws:ecs:r:1:cluster/prod"}},
+		servicesPages: [][]string{{"arn:aws:ecs:r:1:service/prod/api"}},
+		tasksPages:    [][]string{{"arn:aws:ecs:r:1:task/prod/abc"}},
+		describeTasks: []ecstypes.Task{containerTask("app")},
+	}
+	got, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	want := State{
+		Profile: "p", Region: "r",
+		ClusterArn: "arn:aws:ecs:r:1:cluster/prod",
+		Service:    "arn:aws:ecs:r:1:service/prod/api",
+		TaskArn:    "arn:aws:ecs:r:1:task/prod/abc",
+		Container:  "app",
+	}
+	if got != want {
+		t.Fatalf("state = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestResolveTargetTaskSkipsServiceLookup(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{describeTasks: []ecstypes.Task{containerTask("app")}}
+	got, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r", ClusterArn: "c", TaskArn: "t"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if f.serviceCalls != 0 || f.taskCalls != 0 {
+		t.Fatalf("explicit task should not list services/tasks: %+v", f)
+	}
+	if got.Service != "" || got.Container != "app" {
+		t.Fatalf("state = %+v", got)
+	}
+}
+
+func TestResolveTargetAmbiguousContainer(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{describeTasks: []ecstypes.Task{containerTask("app", "envoy")}}
+	_, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r", ClusterArn: "c", TaskArn: "t"})
+	if err == nil || !strings.Contains(err.Error(), "-cn") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestResolveTargetErrors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ResolveTarget(context.Background(), &Cli{}, &fakeECS{}, State{Profile: "p"}); err == nil {
+		t.Fatal("missing region should fail")
+	}
+
+	f := &fakeECS{clusterErr: errors.New("denied")}
+	if _, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r"}); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("cluster err = %v", err)
+	}
+
+	f = &fakeECS{clustersPages: [][]string{{"a/one", "a/two"}}}
+	if _, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r"}); err == nil || !strings.Contains(err.Error(), "-cl") {
+		t.Fatalf("ambiguous cluster err = %v", err)
+	}
+
+	f = &fakeECS{serviceErr: errors.New("svc boom")}
+	if _, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r", ClusterArn: "c"}); err == nil || !strings.Contains(err.Error(), "svc boom") {
+		t.Fatalf("service err = %v", err)
+	}
+
+	f = &fakeECS{taskErr: errors.New("task boom")}
+	if _, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r", ClusterArn: "c", Service: "s"}); err == nil || !strings.Contains(err.Error(), "task boom") {
+		t.Fatalf("task err = %v", err)
+	}
+
+	f = &fakeECS{}
+	if _, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r", ClusterArn: "c", Service: "s"}); err == nil || !strings.Contains(err.Error(), "no task") {
+		t.Fatalf("no task err = %v", err)
+	}
+
+	f = &fakeECS{describeTaskErr: errors.New("describe boom")}
+	if _, err := ResolveTarget(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r", ClusterArn: "c", TaskArn: "t"}); err == nil || !strings.Contains(err.Error(), "describe boom") {
+		t.Fatalf("describe err = %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// defaultFanOutParallel bounds how many exec sessions --all-tasks keeps open
+// at once when -parallel is not given.
+const defaultFanOutParallel = 4
+
+// Output formats for --all-tasks.
+const (
+	FanOutPrefix = "prefix"
+	FanOutJSON   = "json"
+)
+
+// ResolveServiceTasks is ResolveTarget for --all-tasks: it settles cluster
+// and service without prompting, then returns every task of the service.
+// The container is resolved against the first task, since all tasks of a
+// service share a task definition.
+func ResolveServiceTasks(ctx context.Context, c *Cli, client ECSClient, state State) (State, []string, error) {
+	if state.Profile == "" || state.Region == "" {
+		return state, nil, fmt.Errorf("--all-tasks needs both -pr and -rg")
+	}
+	state, err := resolveCluster(ctx, c, client, state)
+	if err != nil {
+		return state, nil, err
+	}
+	if state, err = resolveService(ctx, c, client, state); err != nil {
+		return state, nil, err
+	}
+
+	c.LogAWSCommand("ecs", "list-tasks", "--cluster", state.ClusterArn, "--service-name", state.Service, "--profile", c.Profile, "--region", c.Region)
+	arns, err := listAllTaskArns(ctx, client, state.ClusterArn, state.Service)
+	if err != nil {
+		return state, nil, fmt.Errorf("list tasks: %w", err)
+	}
+	if len(arns) == 0 {
+		return state, nil, fmt.Errorf("no running task in service %s", displayTail(state.Service))
+	}
+
+	state.TaskArn = arns[0]
+	state, err = resolveContainer(ctx, c, client, state)
+	state.TaskArn = ""
+	return state, arns, err
+}
+
+// FanOutOptions captures everything FanOut needs.
+type FanOutOptions struct {
+	Region     string
+	ClusterArn string
+	Service    string
+	Container  string
+	Command    string
+	TaskArns   []string
+	// Parallel caps concurrent sessions (0 means defaultFanOutParallel).
+	Parallel int
+	// Format is FanOutPrefix (stream lines tagged with the task) or
+	// FanOutJSON (collect everything into one summary document).
+	Format string
+	// Stdout receives the prefixed lines or the JSON summary. nil means
+	// os.Stdout.
+	Stdout io.Writer
+	// Environment is the target's class from GuardTarget.
+	Environment string
+}
+
+// TaskResult is the outcome of running the command on one task.
+type TaskResult struct {
+	Task       string `json:"task"`
+	TaskArn    string `json:"taskArn"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// FanOutSummary is the document printed by `--all-tasks -output json`.
+type FanOutSummary struct {
+	Cluster   string       `json:"cluster"`
+	Service   string       `json:"service"`
+	Container string       `json:"container"`
+	Command   string       `json:"command"`
+	Results   []TaskResult `json:"results"`
+}
+
+// FanOut runs opts.Command on every task in opts.TaskArns, at most
+// opts.Parallel at a time. A task that fails (session error or non-zero
+// status) never stops the others. The returned exit code is 0 when every
+// task succeeded and otherwise the highest status seen, so a session
+// failure (ExitSessionError) dominates.
+func FanOut(ctx context.Context, c *Cli, awsCfg aws.Config, opts FanOutOptions) ([]TaskResult, int) {
+	out := opts.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = defaultFanOutParallel
+	}
+
+	var (
+		wg      sync.WaitGroup
+		outMu   sync.Mutex
+		sem     = make(chan struct{}, parallel)
+		results = make([]TaskResult, len(opts.TaskArns))
+	)
+	for i, arn := range opts.TaskArns {
+		wg.Add(1)
+		go func(i int, arn string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := TaskResult{Task: displayTail(arn), TaskArn: arn}
+			var (
+				sink     io.Writer
+				captured bytes.Buffer
+				prefixed *prefixWriter
+			)
+			if opts.Format == FanOutJSON {
+				sink = &captured
+			} else {
+				prefixed = newPrefixWriter(out, &outMu, "["+res.Task+"/"+opts.Container+"] ")
+				sink = prefixed
+			}
+
+			start := time.Now()
+			code, err := ExecECS(ctx, c, awsCfg, ExecOptions{
+				Region:            opts.Region,
+				ClusterArn:        opts.ClusterArn,
+				Service:           opts.Service,
+				TaskArn:           arn,
+				Container:         opts.Container,
+				Command:           opts.Command,
+				CaptureExitStatus: true,
+				Stdout:            sink,
+				Stdin:             strings.NewReader(""),
+				NoHistory:         true,
+				Environment:       opts.Environment,
+			})
+			res.DurationMs = time.Since(start).Milliseconds()
+			res.ExitCode = code
+			if err != nil {
+				// Whatever the plugin returned, the command never ran to
+				// completion on this task.
+				res.ExitCode = ExitSessionError
+				res.Error = err.Error()
+			}
+			if prefixed != nil {
+				prefixed.Flush()
+				if err != nil {
+					prefixed.line("error: " + err.Error())
+				}
+			}
+			res.Output = stripPluginBanners(captured.String())
+			results[i] = res
+		}(i, arn)
+	}
+	wg.Wait()
+
+	exit := 0
+	for _, r := range results {
+		exit = max(exit, r.ExitCode)
+	}
+
+	if opts.Format == FanOutJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(FanOutSummary{
+			Cluster:   displayTail(opts.ClusterArn),
+			Service:   displayTail(opts.Service),
+			Container: opts.Container,
+			Command:   opts.Command,
+			Results:   results,
+		})
+		return results, exit
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.ExitCode != 0 {
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d/%d tasks succeeded\n", len(results)-failed, len(results))
+	return results, exit
+}
+
+// prefixWriter tags every complete line with prefix before handing it to w,
+// kubectl-logs style. Writers for different tasks share mu so lines from
+// concurrent sessions never interleave mid-line.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, mu *sync.Mutex, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, mu: mu, prefix: prefix}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		nl := bytes.IndexByte(p.buf, '\n')
+		if nl < 0 {
+			return len(b), nil
+		}
+		p.line(strings.TrimRight(string(p.buf[:nl]), "\r"))
+		p.buf = p.buf[nl+1:]
+	}
+}
+
+// Flush emits a final unterminated line, if any.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.line(strings.TrimRight(string(p.buf), "\r"))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) line(s string) {
+	if isPluginBanner(s) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _ = io.WriteString(p.w, p.prefix+s+"\n")
+}
+
+// isPluginBanner reports whether line is one of the session start/exit
+// notices session-manager-plugin prints around every session.
+func isPluginBanner(line string) bool {
+	return strings.HasPrefix(line, "Starting session with SessionId:") ||
+		strings.HasPrefix(line, "Exiting session with sessionId:")
+}
+
+// stripPluginBanners normalises captured session output to plain "\n" lines
+// without the plugin's banners.
+func stripPluginBanners(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		if !isPluginBanner(l) {
+			kept = append(kept, l)
+		}
+	}
+	return strings.TrimLeft(strings.Join(kept, "\n"), "\n")
+}
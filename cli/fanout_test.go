@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestResolveServiceTasks(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{
+		clustersPages: [][]string{{"arn:aws:ecs:r:1:cluster/prod"}},
+		servicesPages: [][]string{{"arn:aws:ecs:r:1:service/prod/api"}},
+		tasksPages:    [][]string{{"arn:t/a", "arn:t/b"}, {"arn:t/c"}},
+		describeTasks: []ecstypes.Task{containerTask("app")},
+	}
+	state, tasks, err := ResolveServiceTasks(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tasks) != 3 || state.Container != "app" || state.TaskArn != "" {
+		t.Fatalf("state=%+v tasks=%v", state, tasks)
+	}
+	if state.Service != "arn:aws:ecs:r:1:service/prod/api" {
+		t.Fatalf("service = %q", state.Service)
+	}
+}
+
+func TestResolveServiceTasksErrors(t *testing.T) {
+	t.Parallel()
+
+	if _, _, err := ResolveServiceTasks(context.Background(), &Cli{}, &fakeECS{}, State{Profile: "p"}); err == nil {
+		t.Fatal("missing region should fail")
+	}
+	f := &fakeECS{clustersPages: [][]string{{"a/one", "a/two"}}}
+	if _, _, err := ResolveServiceTasks(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r"}); err == nil || !strings.Contains(err.Error(), "-cl") {
+		t.Fatalf("ambiguous cluster err = %v", err)
+	}
+	f = &fakeECS{servicesPages: [][]string{{"s/one", "s/two"}}}
+	if _, _, err := ResolveServiceTasks(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r", ClusterArn: "c"}); err == nil || !strings.Contains(err.Error(), "-se") {
+		t.Fatalf("ambiguous service err = %v", err)
+	}
+	f = &fakeECS{taskErr: errors.New("task boom")}
+	if _, _, err := ResolveServiceTasks(context.Background(), &Cli{}, f, State{Profile: "p", Region: "r", ClusterArn: "c", Service: "s"}); err == nil || !strings.Contains(err.Error(), "task boom") {
+		t.Fatalf("list err = %v", err)
+	}
+	if _, _, err := ResolveServiceTasks(context.Background(), &Cli{}, &fakeECS{}, State{Profile: "p", Region: "r", ClusterArn: "c", Service: "s/api"}); err == nil || !strings.Contains(err.Error(), "no running task") {
+		t.Fatalf("empty service err = %v", err)
+	}
+}
+
+// stubFanOutSessions makes every exec session print "hello from <task>" and
+// exit with the status in codes (keyed by task ARN). Tasks listed in broken
+// fail to start. It returns the peak number of concurrent sessions.
+func stubFanOutSessions(t *testing.T, codes map[string]int, broken map[string]bool) *int32 {
+	t.Helper()
+	prevStart := startExecuteCommand
+	prevStarter := sessionStarter
+	t.Cleanup(func() {
+		startExecuteCommand = prevStart
+		sessionStarter = prevStarter
+	})
+
+	var (
+		mu      sync.Mutex
+		byID    = map[string]string{}
+		active  int32
+		maxSeen int32
+	)
+	startExecuteCommand = func(_ context.Context, _ ecsExecuteCommander, opts ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		if broken[opts.TaskArn] {
+			return nil, errors.New("TargetNotConnectedException")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		id := "sess-" + opts.TaskArn
+		byID[id] = opts.Command
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId: aws.String(id), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	sessionStarter = func(_ context.Context, _ string, sess *ecstypes.Session, opts ptyOptions) (int, error) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			old := atomic.LoadInt32(&maxSeen)
+			if n <= old || atomic.CompareAndSwapInt32(&maxSeen, old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+
+		id := aws.ToString(sess.SessionId)
+		task := strings.TrimPrefix(id, "sess-")
+		mu.Lock()
+		sent := byID[id]
+		mu.Unlock()
+		marker := sent[strings.Index(sent, exitMarkerPrefix):strings.LastIndex(sent, "$?")]
+		_, _ = opts.Stdout.Write([]byte("\r\nStarting session with SessionId: " + id + "\r\nhello from " + task + "\r\npartial"))
+		_, _ = opts.Stdout.Write([]byte("\r\n" + marker + strconv.Itoa(codes[task]) + "\r\n"))
+		return 0, nil
+	}
+	return &maxSeen
+}
+
+func TestFanOutPrefixesOutputAndBoundsConcurrency(t *testing.T) {
+	tasks := []string{"arn:t/a", "arn:t/b", "arn:t/c", "arn:t/d", "arn:t/e"}
+	peak := stubFanOutSessions(t, map[string]int{"arn:t/c": 3}, map[string]bool{"arn:t/d": true})
+
+	var out bytes.Buffer
+	results, code := FanOut(context.Background(), &Cli{}, aws.Config{}, FanOutOptions{
+		Region: "r", ClusterArn: "c", Container: "app", Command: "uptime",
+		TaskArns: tasks, Parallel: 2, Stdout: &out,
+	})
+	if *peak > 2 {
+		t.Fatalf("ran %d sessions at once, limit was 2", *peak)
+	}
+	if code != ExitSessionError {
+		t.Fatalf("exit = %d, want the session failure to dominate", code)
+	}
+	if len(results) != len(tasks) {
+		t.Fatalf("results = %d", len(results))
+	}
+	if results[2].ExitCode != 3 || results[0].ExitCode != 0 || results[4].ExitCode != 0 {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[3].Error == "" {
+		t.Fatal("broken task should report its error")
+	}
+
+	text := out.String()
+	for _, want := range []string{"[a/app] hello from arn:t/a\n", "[a/app] partial\n", "[e/app] hello from arn:t/e\n", "[d/app] error: "} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("output missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Starting session") {
+		t.Fatalf("plugin banner leaked:\n%s", text)
+	}
+}
+
+func TestFanOutJSONSummary(t *testing.T) {
+	stubFanOutSessions(t, map[string]int{"arn:t/b": 1}, nil)
+
+	var out bytes.Buffer
+	_, code := FanOut(context.Background(), &Cli{}, aws.Config{}, FanOutOptions{
+		Region: "r", ClusterArn: "arn:c/prod", Service: "arn:s/prod/api", Container: "app", Command: "uptime",
+		TaskArns: []string{"arn:t/a", "arn:t/b"}, Format: FanOutJSON, Stdout: &out,
+	})
+	if code != 1 {
+		t.Fatalf("exit = %d", code)
+	}
+	var summary FanOutSummary
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("not JSON: %v\n%s", err, out.String())
+	}
+	if summary.Cluster != "prod" || summary.Service != "api" || len(summary.Results) != 2 {
+		t.Fatalf("summary = %+v", summary)
+	}
+	a := summary.Results[0]
+	if a.Task != "a" || a.ExitCode != 0 || a.Output != "hello from arn:t/a\npartial\n" || a.DurationMs < 0 {
+		t.Fatalf("result a = %+v", a)
+	}
+	if summary.Results[1].ExitCode != 1 {
+		t.Fatalf("result b = %+v", summary.Results[1])
+	}
+}
+
+func TestPrefixWriterKeepsLinesWhole(t *testing.T) {
+	t.Parallel()
+
+	var (
+		out bytes.Buffer
+		mu  sync.Mutex
+	)
+	w := newPrefixWriter(&out, &mu, "[x] ")
+	_, _ = w.Write([]byte("one\r\ntw"))
+	if out.String() != "[x] one\n" {
+		t.Fatalf("out = %q", out.String())
+	}
+	_, _ = w.Write([]byte("o\nthree"))
+	w.Flush()
+	if out.String() != "[x] one\n[x] two\n[x] three\n" {
+		t.Fatalf("out = %q", out.String())
+	}
+}
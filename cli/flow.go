@@ -90,7 +90,8 @@ func PickCluster(ctx context.Context, c *Cli, sel Selector, client ecsClusterLis
 	return state, ActionAdvance, nil
 }
 
-// PickService prompts for an ECS service inside the chosen cluster.
+// PickService prompts for an ECS service inside the chosen cluster, or for
+// one of the cluster-level pseudo-services.
 func PickService(ctx context.Context, c *Cli, sel Selector, client ecsServiceLister, state State) (State, PickAction, error) {
 	c.LogAWSCommand("ecs", "list-services", "--cluster", state.ClusterArn, "--profile", c.Profile, "--region", c.Region)
 	services, serviceArns, err := c.ListServiceNamesArns(ctx, client, state.ClusterArn)
@@ -99,10 +100,9 @@ func PickService(ctx context.Context, c *Cli, sel Selector, client ecsServiceLis
 		resetState(&state, stepIdxService)
 		return state, ActionBack, nil
 	}
-	if len(services) == 0 {
-		fmt.Println("No ECS services found. Going back.")
-		resetState(&state, stepIdxService)
-		return state, ActionBack, nil
+	for _, pseudo := range []string{AllTasksService, StandaloneTasksService} {
+		services = append(services, pseudo)
+		serviceArns[pseudo] = pseudo
 	}
 	selected, goBack := sel.Select("Choose ECS service", services, keyForValue(serviceArns, state.Service), true)
 	if goBack {
@@ -115,9 +115,9 @@ func PickService(ctx context.Context, c *Cli, sel Selector, client ecsServiceLis
 	return state, ActionAdvance, nil
 }
 
-// PickTask prompts for an ECS task inside the chosen service.
-func PickTask(ctx context.Context, c *Cli, sel Selector, client ecsTaskLister, state State) (State, PickAction, error) {
-	c.LogAWSCommand("ecs", "list-tasks", "--cluster", state.ClusterArn, "--service-name", state.Service, "--profile", c.Profile, "--region", c.Region)
+// PickTask prompts for an ECS task inside the chosen service (or cluster).
+func PickTask(ctx context.Context, c *Cli, sel Selector, client ecsTaskInspector, state State) (State, PickAction, error) {
+	c.LogListTasks(state.ClusterArn, state.Service)
 	tasks, taskArns, err := c.ListTaskNamesArns(ctx, client, state.ClusterArn, state.Service)
 	if err != nil {
 		fmt.Println("Failed to list ECS tasks:", err)
@@ -215,6 +215,9 @@ type ECSClient interface {
 	ecsServiceLister
 	ecsTaskLister
 	ecsTaskDescriber
+	ecsServiceDescriber
+	ecsTaskProtectionGetter
+	ecsClusterDescriber
 }
 
 // NewECSClient is a thin constructor so callers don't import ecs directly.
@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -18,6 +19,7 @@ func awsZeroCfg() aws.Config { return aws.Config{} }
 type stubSelector struct {
 	answers []stubAnswer
 	calls   int
+	offered []string
 }
 
 type stubAnswer struct {
@@ -37,7 +39,7 @@ func (s *stubSelector) Select(_ string, items []string, _ string, _ bool) (strin
 	}
 	// If the canned selection isn't in the offered items, return it anyway
 	// so the test can verify behaviour against arbitrary strings.
-	_ = items
+	s.offered = items
 	return a.selection, false
 }
 
@@ -225,16 +227,19 @@ func TestPickServiceError(t *testing.T) {
 	}
 }
 
-func TestPickServiceEmpty(t *testing.T) {
+func TestPickServiceOffersClusterLevelEntries(t *testing.T) {
 	c := &Cli{}
 	f := &fakeECS{}
-	sel := &stubSelector{answers: []stubAnswer{{selection: "x"}}}
-	_, action, err := PickService(context.Background(), c, sel, f, State{ClusterArn: "c"})
+	sel := &stubSelector{answers: []stubAnswer{{selection: StandaloneTasksService}}}
+	out, action, err := PickService(context.Background(), c, sel, f, State{ClusterArn: "c"})
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
-	if action != ActionBack {
-		t.Fatalf("action = %v", action)
+	if action != ActionAdvance || out.Service != StandaloneTasksService {
+		t.Fatalf("action = %v service = %q", action, out.Service)
+	}
+	if !reflect.DeepEqual(sel.offered, []string{AllTasksService, StandaloneTasksService}) {
+		t.Fatalf("offered = %v", sel.offered)
 	}
 }
 
@@ -253,12 +258,14 @@ func TestPickServiceGoBack(t *testing.T) {
 
 func TestPickTaskAdvances(t *testing.T) {
 	c := &Cli{Profile: "p", Region: "r"}
-	f := &fakeECS{tasksPages: [][]string{{"arn:aws:ecs:us-east-1:111111111111:task/cluster/abcdef0123456789"}}}
-	// The picker exposes the masked task ARN; emulate that by selecting
-	// whatever it offers via the stubSelector indirection: we use the
-	// "first item" trick by passing the same string maskTaskArn produces.
-	masked := maskTaskArn("arn:aws:ecs:us-east-1:111111111111:task/cluster/abcdef0123456789")
-	sel := &stubSelector{answers: []stubAnswer{{selection: masked}}}
+	arn := "arn:aws:ecs:us-east-1:111111111111:task/cluster/abcdef0123456789"
+	f := &fakeECS{
+		tasksPages:    [][]string{{arn}},
+		describeTasks: []ecstypes.Task{{TaskArn: aws.String(arn), LastStatus: aws.String("RUNNING")}},
+	}
+	// The picker offers one table line per task; select the only one.
+	line := taskTable(taskRows(f.describeTasks)).lines()[0]
+	sel := &stubSelector{answers: []stubAnswer{{selection: line}}}
 	out, action, err := PickTask(context.Background(), c, sel, f, State{ClusterArn: "c", Service: "s"})
 	if err != nil {
 		t.Fatalf("err: %v", err)
@@ -266,8 +273,8 @@ func TestPickTaskAdvances(t *testing.T) {
 	if action != ActionAdvance {
 		t.Fatalf("action = %v", action)
 	}
-	if out.TaskArn == "" {
-		t.Fatal("task arn not set")
+	if out.TaskArn != arn {
+		t.Fatalf("task arn = %q", out.TaskArn)
 	}
 }
 
@@ -293,7 +300,8 @@ func TestPickTaskEmpty(t *testing.T) {
 
 func TestPickTaskGoBack(t *testing.T) {
 	c := &Cli{}
-	f := &fakeECS{tasksPages: [][]string{{"arn:aws:ecs:us-east-1:111111111111:task/cluster/abcdef0123456789"}}}
+	arn := "arn:aws:ecs:us-east-1:111111111111:task/cluster/abcdef0123456789"
+	f := &fakeECS{tasksPages: [][]string{{arn}}, describeTasks: []ecstypes.Task{{TaskArn: aws.String(arn)}}}
 	sel := &stubSelector{answers: []stubAnswer{{goBack: true}}}
 	_, action, _ := PickTask(context.Background(), c, sel, f, State{ClusterArn: "c", Service: "s"})
 	if action != ActionBack {
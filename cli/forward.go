@@ -0,0 +1,332 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// SSM documents used for port forwarding. The first forwards to a port on
+// the task itself, the second uses the task as a jump host to reach any
+// address the task can (RDS, ElastiCache, internal ALBs, …).
+const (
+	portForwardDocument       = "AWS-StartPortForwardingSession"
+	remotePortForwardDocument = "AWS-StartPortForwardingSessionToRemoteHost"
+)
+
+// forwardReadyLine is what session-manager-plugin prints once the local
+// listener is accepting connections.
+const forwardReadyLine = "Waiting for connections"
+
+// ForwardSpec is one parsed `-L` argument.
+type ForwardSpec struct {
+	LocalPort  string
+	Host       string // empty means "the task itself"
+	RemotePort string
+}
+
+// ParseForwardSpec accepts `local:remote` (forward to the task) or
+// `local:host:remote` (forward through the task to host).
+func ParseForwardSpec(s string) (ForwardSpec, error) {
+	parts := strings.Split(s, ":")
+	var spec ForwardSpec
+	switch len(parts) {
+	case 2:
+		spec = ForwardSpec{LocalPort: parts[0], RemotePort: parts[1]}
+	case 3:
+		spec = ForwardSpec{LocalPort: parts[0], Host: parts[1], RemotePort: parts[2]}
+		if spec.Host == "" {
+			return ForwardSpec{}, fmt.Errorf("invalid forward %q: empty host", s)
+		}
+	default:
+		return ForwardSpec{}, fmt.Errorf("invalid forward %q: want local:remote or local:host:remote", s)
+	}
+	for _, p := range []string{spec.LocalPort, spec.RemotePort} {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return ForwardSpec{}, fmt.Errorf("invalid forward %q: %q is not a port", s, p)
+		}
+	}
+	return spec, nil
+}
+
+// String renders the spec back in `-L` form.
+func (f ForwardSpec) String() string {
+	if f.Host == "" {
+		return f.LocalPort + ":" + f.RemotePort
+	}
+	return f.LocalPort + ":" + f.Host + ":" + f.RemotePort
+}
+
+func (f ForwardSpec) documentName() string {
+	if f.Host == "" {
+		return portForwardDocument
+	}
+	return remotePortForwardDocument
+}
+
+func (f ForwardSpec) parameters() map[string][]string {
+	params := map[string][]string{
+		"portNumber":      {f.RemotePort},
+		"localPortNumber": {f.LocalPort},
+	}
+	if f.Host != "" {
+		params["host"] = []string{f.Host}
+	}
+	return params
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// ssmTarget builds the SSM target ID ECS registers for a container:
+// ecs:<cluster-name>_<task-id>_<container-runtime-id>.
+func ssmTarget(clusterArn, taskArn, runtimeID string) string {
+	return "ecs:" + displayTail(clusterArn) + "_" + displayTail(taskArn) + "_" + runtimeID
+}
+
+// displayTail returns the last `/`-separated segment of an ARN (or the
+// input unchanged when it is already a bare name).
+func displayTail(arn string) string {
+	parts := strings.Split(arn, "/")
+	return parts[len(parts)-1]
+}
+
+// ContainerRuntimeID looks up the runtime ID of a container in a task, which
+// SSM needs to address it.
+func ContainerRuntimeID(ctx context.Context, client ecsTaskDescriber, clusterArn, taskArn, container string) (string, error) {
+	out, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(clusterArn),
+		Tasks:   []string{taskArn},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(out.Tasks) == 0 {
+		return "", fmt.Errorf("task %s not found", displayTail(taskArn))
+	}
+	for _, cont := range out.Tasks[0].Containers {
+		if aws.ToString(cont.Name) != container {
+			continue
+		}
+		if id := aws.ToString(cont.RuntimeId); id != "" {
+			return id, nil
+		}
+		return "", fmt.Errorf("container %q has no runtime ID yet — is it running?", container)
+	}
+	return "", fmt.Errorf("container %q not found in task %s", container, displayTail(taskArn))
+}
+
+// ssmSessionClient is the subset of the SSM SDK used for port forwarding.
+type ssmSessionClient interface {
+	StartSession(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error)
+	TerminateSession(ctx context.Context, params *ssm.TerminateSessionInput, optFns ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error)
+}
+
+// newSSMClient is overridable in tests.
+var newSSMClient = func(cfg aws.Config, region string) ssmSessionClient {
+	return ssm.NewFromConfig(cfg, func(o *ssm.Options) { o.Region = region })
+}
+
+// ssmStartRequest is the request half session-manager-plugin wants next to
+// the session: it uses it to re-open the session after network blips.
+type ssmStartRequest struct {
+	Target       string              `json:"Target"`
+	DocumentName string              `json:"DocumentName"`
+	Parameters   map[string][]string `json:"Parameters"`
+}
+
+// portForwardStarter runs one port-forwarding plugin process until it exits
+// or ctx is cancelled. ready is invoked once the local listener is up.
+// Overridable in tests.
+var portForwardStarter = startPortForwardPlugin
+
+// ForwardOptions captures everything Forward needs.
+type ForwardOptions struct {
+	Region     string
+	ClusterArn string
+	// Service and Environment are only recorded in the audit log.
+	Service     string
+	TaskArn     string
+	Container   string
+	Specs       []ForwardSpec
+	Environment string
+}
+
+// Forward opens one SSM port-forwarding session per spec through the chosen
+// container and blocks until every session has ended (normally because the
+// user pressed Ctrl-C and ctx was cancelled). Each session is audited like
+// an exec session, with the command `forward -L SPEC`.
+func Forward(ctx context.Context, c *Cli, awsCfg aws.Config, client ecsTaskDescriber, opts ForwardOptions) error {
+	if len(opts.Specs) == 0 {
+		return errors.New("nothing to forward; pass at least one -L local:[host:]remote")
+	}
+
+	c.LogAWSCommand("ecs", "describe-tasks", "--cluster", opts.ClusterArn, "--tasks", opts.TaskArn, "--profile", c.Profile, "--region", opts.Region)
+	runtimeID, err := ContainerRuntimeID(ctx, client, opts.ClusterArn, opts.TaskArn, opts.Container)
+	if err != nil {
+		return err
+	}
+	target := ssmTarget(opts.ClusterArn, opts.TaskArn, runtimeID)
+	ssmClient := newSSMClient(awsCfg, opts.Region)
+	audit := c.sessionAudit(ctx, awsCfg, ExecOptions{
+		Region:      opts.Region,
+		ClusterArn:  opts.ClusterArn,
+		Service:     opts.Service,
+		TaskArn:     opts.TaskArn,
+		Container:   opts.Container,
+		Environment: opts.Environment,
+	})
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, spec := range opts.Specs {
+		req := ssmStartRequest{Target: target, DocumentName: spec.documentName(), Parameters: spec.parameters()}
+		args := []string{"--target", req.Target, "--document-name", req.DocumentName, "--parameters", spec.String()}
+		c.LogAWSCommand("ssm", append(append([]string{"start-session"}, args...), "--profile", c.Profile, "--region", opts.Region)...)
+
+		out, err := ssmClient.StartSession(ctx, &ssm.StartSessionInput{
+			Target:       aws.String(req.Target),
+			DocumentName: aws.String(req.DocumentName),
+			Parameters:   req.Parameters,
+		})
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("ssm:StartSession for %s: %w", spec, err))
+			mu.Unlock()
+			continue
+		}
+
+		start := audit
+		start.Event = AuditSessionStart
+		start.Command = "forward -L " + spec.String()
+		start.SessionID = aws.ToString(out.SessionId)
+		start.StartedAt = time.Now().UTC()
+		c.appendAudit(ctx, start)
+
+		wg.Add(1)
+		go func(spec ForwardSpec, out *ssm.StartSessionOutput, req ssmStartRequest) {
+			defer wg.Done()
+			ready := func() {
+				dest := "task port " + spec.RemotePort
+				if spec.Host != "" {
+					dest = spec.Host + ":" + spec.RemotePort
+				}
+				fmt.Printf("Forwarding 127.0.0.1:%s -> %s (via %s/%s)\n", spec.LocalPort, dest, displayTail(opts.TaskArn), opts.Container)
+			}
+			runErr := portForwardStarter(ctx, opts.Region, c.Profile, out, req, ready)
+			// Tell SSM we're done instead of leaving the session to idle out.
+			_, _ = ssmClient.TerminateSession(context.WithoutCancel(ctx), &ssm.TerminateSessionInput{SessionId: out.SessionId})
+			end := start
+			end.Event = AuditSessionEnd
+			end.EndedAt = time.Now().UTC()
+			code := 0
+			if runErr != nil && ctx.Err() == nil {
+				code = ExitSessionError
+				end.Error = runErr.Error()
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("forward %s: %w", spec, runErr))
+				mu.Unlock()
+			}
+			end.ExitCode = &code
+			c.appendAudit(context.WithoutCancel(ctx), end)
+		}(spec, out, req)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// startPortForwardPlugin launches session-manager-plugin for an SSM session
+// using the same argv convention as startSessionManagerPlugin, plus the
+// profile, request and endpoint the plugin needs for port forwarding. No PTY
+// is involved: the plugin's output is scanned for the ready line and only
+// echoed when it looks like an error.
+func startPortForwardPlugin(ctx context.Context, region, profile string, session *ssm.StartSessionOutput, req ssmStartRequest, ready func()) error {
+	if session == nil {
+		return errors.New("nil session")
+	}
+	sessData, err := json.Marshal(sessionJSON{
+		SessionID:  aws.ToString(session.SessionId),
+		StreamURL:  aws.ToString(session.StreamUrl),
+		TokenValue: aws.ToString(session.TokenValue),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "session-manager-plugin",
+		string(sessData),
+		region,
+		"StartSession",
+		profile,
+		string(reqData),
+		"https://ssm."+region+".amazonaws.com",
+	)
+	// Interrupt rather than kill so the plugin closes its listener and
+	// tells the agent the session is over.
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start session-manager-plugin: %w", err)
+	}
+
+	var lastLine string
+	scanDone := make(chan struct{})
+	go func() {
+		defer close(scanDone)
+		scanner := bufio.NewScanner(pr)
+		announced := false
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			lastLine = line
+			if !announced && strings.Contains(line, forwardReadyLine) {
+				announced = true
+				ready()
+			}
+		}
+	}()
+
+	waitErr := cmd.Wait()
+	_ = pw.Close()
+	<-scanDone
+	if waitErr != nil && ctx.Err() == nil {
+		if lastLine != "" {
+			return fmt.Errorf("%w: %s", waitErr, lastLine)
+		}
+		return waitErr
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    ForwardSpec
+		wantErr bool
+	}{
+		{"8080:80", ForwardSpec{LocalPort: "8080", RemotePort: "80"}, false},
+		{"5432:db.internal:5432", ForwardSpec{LocalPort: "5432", Host: "db.internal", RemotePort: "5432"}, false},
+		{"8080", ForwardSpec{}, true},
+		{"a:80", ForwardSpec{}, true},
+		{"8080:70000", ForwardSpec{}, true},
+		{"1::2", ForwardSpec{}, true},
+		{"1:2:3:4", ForwardSpec{}, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseForwardSpec(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("ParseForwardSpec(%q) err = %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ParseForwardSpec(%q) = %+v want %+v", tc.in, got, tc.want)
+		}
+		if err == nil && got.String() != tc.in {
+			t.Fatalf("String() = %q want %q", got.String(), tc.in)
+		}
+	}
+}
+
+func TestForwardSpecDocumentAndParameters(t *testing.T) {
+	t.Parallel()
+
+	local := ForwardSpec{LocalPort: "8080", RemotePort: "80"}
+	if local.documentName() != portForwardDocument {
+		t.Fatalf("doc = %q", local.documentName())
+	}
+	if _, ok := local.parameters()["host"]; ok {
+		t.Fatal("task-local forward must not send host")
+	}
+
+	remote := ForwardSpec{LocalPort: "6379", Host: "redis", RemotePort: "6379"}
+	if remote.documentName() != remotePortForwardDocument {
+		t.Fatalf("doc = %q", remote.documentName())
+	}
+	want := map[string][]string{"portNumber": {"6379"}, "localPortNumber": {"6379"}, "host": {"redis"}}
+	if !reflect.DeepEqual(remote.parameters(), want) {
+		t.Fatalf("params = %v", remote.parameters())
+	}
+}
+
+func TestStringListCollectsRepeats(t *testing.T) {
+	t.Parallel()
+
+	var s stringList
+	_ = s.Set("a")
+	_ = s.Set("b")
+	if s.String() != "a,b" {
+		t.Fatalf("String = %q", s.String())
+	}
+}
+
+func TestSSMTarget(t *testing.T) {
+	t.Parallel()
+
+	got := ssmTarget("arn:aws:ecs:r:1:cluster/prod", "arn:aws:ecs:r:1:task/prod/abc123", "abc123-999")
+	if got != "ecs:prod_abc123_abc123-999" {
+		t.Fatalf("target = %q", got)
+	}
+}
+
+func runtimeTask(name, runtimeID string) ecstypes.Task {
+	return ecstypes.Task{Containers: []ecstypes.Container{{Name: aws.String(name), RuntimeId: aws.String(runtimeID)}}}
+}
+
+func TestContainerRuntimeID(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{describeTasks: []ecstypes.Task{runtimeTask("app", "rt-1")}}
+	id, err := ContainerRuntimeID(context.Background(), f, "c", "t", "app")
+	if err != nil || id != "rt-1" {
+		t.Fatalf("id=%q err=%v", id, err)
+	}
+	if _, err := ContainerRuntimeID(context.Background(), f, "c", "t", "other"); err == nil {
+		t.Fatal("missing container should fail")
+	}
+	f = &fakeECS{describeTasks: []ecstypes.Task{runtimeTask("app", "")}}
+	if _, err := ContainerRuntimeID(context.Background(), f, "c", "t", "app"); err == nil {
+		t.Fatal("empty runtime id should fail")
+	}
+	if _, err := ContainerRuntimeID(context.Background(), &fakeECS{}, "c", "t", "app"); err == nil {
+		t.Fatal("missing task should fail")
+	}
+	if _, err := ContainerRuntimeID(context.Background(), &fakeECS{describeTaskErr: errors.New("boom")}, "c", "t", "app"); err == nil {
+		t.Fatal("describe error should propagate")
+	}
+}
+
+type fakeSSM struct {
+	mu         sync.Mutex
+	started    []*ssm.StartSessionInput
+	terminated []string
+	startErr   error
+}
+
+func (f *fakeSSM) StartSession(_ context.Context, in *ssm.StartSessionInput, _ ...func(*ssm.Options)) (*ssm.StartSessionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.startErr != nil {
+		return nil, f.startErr
+	}
+	f.started = append(f.started, in)
+	id := "sess-" + in.Parameters["localPortNumber"][0]
+	return &ssm.StartSessionOutput{SessionId: aws.String(id), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok")}, nil
+}
+
+func (f *fakeSSM) TerminateSession(_ context.Context, in *ssm.TerminateSessionInput, _ ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.terminated = append(f.terminated, aws.ToString(in.SessionId))
+	return &ssm.TerminateSessionOutput{}, nil
+}
+
+func stubSSM(t *testing.T, f *fakeSSM) {
+	t.Helper()
+	prev := newSSMClient
+	newSSMClient = func(aws.Config, string) ssmSessionClient { return f }
+	t.Cleanup(func() { newSSMClient = prev })
+}
+
+func TestForwardStartsOneSessionPerSpec(t *testing.T) {
+	f := &fakeSSM{}
+	stubSSM(t, f)
+	path := setAuditFile(t)
+	prev := portForwardStarter
+	t.Cleanup(func() { portForwardStarter = prev })
+
+	var (
+		mu      sync.Mutex
+		targets []string
+		readies int
+	)
+	portForwardStarter = func(_ context.Context, region, profile string, sess *ssm.StartSessionOutput, req ssmStartRequest, ready func()) error {
+		mu.Lock()
+		defer mu.Unlock()
+		targets = append(targets, req.Target)
+		ready()
+		readies++
+		return nil
+	}
+
+	ecsFake := &fakeECS{describeTasks: []ecstypes.Task{runtimeTask("app", "rt-9")}}
+	err := Forward(context.Background(), &Cli{Profile: "p"}, aws.Config{}, ecsFake, ForwardOptions{
+		Region: "eu-west-1", ClusterArn: "cluster/prod", TaskArn: "task/prod/abc", Container: "app",
+		Specs: []ForwardSpec{{LocalPort: "8080", RemotePort: "80"}, {LocalPort: "5432", Host: "db", RemotePort: "5432"}},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(f.started) != 2 || readies != 2 {
+		t.Fatalf("started=%d readies=%d", len(f.started), readies)
+	}
+	for _, target := range targets {
+		if target != "ecs:prod_abc_rt-9" {
+			t.Fatalf("target = %q", target)
+		}
+	}
+	if len(f.terminated) != 2 {
+		t.Fatalf("sessions should be terminated, got %v", f.terminated)
+	}
+
+	// Every forward is audited as a session of its own.
+	sessions := map[string][]string{}
+	for _, e := range readAudit(t, path) {
+		if e.Task != "task/prod/abc" || e.Container != "app" {
+			t.Fatalf("event target = %+v", e)
+		}
+		sessions[e.SessionID] = append(sessions[e.SessionID], e.Event+" "+e.Command)
+	}
+	want := map[string][]string{
+		"sess-8080": {"session-start forward -L 8080:80", "session-end forward -L 8080:80"},
+		"sess-5432": {"session-start forward -L 5432:db:5432", "session-end forward -L 5432:db:5432"},
+	}
+	if !reflect.DeepEqual(sessions, want) {
+		t.Fatalf("audit = %v", sessions)
+	}
+}
+
+func TestForwardReportsErrors(t *testing.T) {
+	if err := Forward(context.Background(), &Cli{}, aws.Config{}, &fakeECS{}, ForwardOptions{}); err == nil {
+		t.Fatal("no specs should fail")
+	}
+
+	stubSSM(t, &fakeSSM{startErr: errors.New("denied")})
+	ecsFake := &fakeECS{describeTasks: []ecstypes.Task{runtimeTask("app", "rt")}}
+	err := Forward(context.Background(), &Cli{}, aws.Config{}, ecsFake, ForwardOptions{
+		Container: "app", Specs: []ForwardSpec{{LocalPort: "1", RemotePort: "2"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("err = %v", err)
+	}
+
+	if err := Forward(context.Background(), &Cli{}, aws.Config{}, &fakeECS{}, ForwardOptions{
+		Container: "app", Specs: []ForwardSpec{{LocalPort: "1", RemotePort: "2"}},
+	}); err == nil {
+		t.Fatal("unknown task should fail")
+	}
+}
+
+func TestStartPortForwardPluginRejectsNil(t *testing.T) {
+	t.Parallel()
+	if err := startPortForwardPlugin(context.Background(), "r", "p", nil, ssmStartRequest{}, func() {}); err == nil {
+		t.Fatal("expected error for nil session")
+	}
+}
+
+func TestStartPortForwardPluginNoBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	sess := &ssm.StartSessionOutput{SessionId: aws.String("s")}
+	if err := startPortForwardPlugin(context.Background(), "r", "p", sess, ssmStartRequest{}, func() {}); err == nil {
+		t.Fatal("expected failure when the plugin is absent")
+	}
+}
+
+// fakePlugin drops an executable named session-manager-plugin on PATH that
+// runs the given shell body.
+func fakePlugin(t *testing.T, body string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell-script plugin stub needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" + body + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "session-manager-plugin"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestStartPortForwardPluginAnnouncesReady(t *testing.T) {
+	fakePlugin(t, `echo "Starting session with SessionId: $1"; echo "Port 8080 opened"; echo "Waiting for connections..."`)
+	sess := &ssm.StartSessionOutput{SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("t")}
+	readies := 0
+	err := startPortForwardPlugin(context.Background(), "eu-west-1", "p", sess, ssmStartRequest{Target: "ecs:x"}, func() { readies++ })
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if readies != 1 {
+		t.Fatalf("ready called %d times", readies)
+	}
+}
+
+func TestStartPortForwardPluginFailureIncludesOutput(t *testing.T) {
+	fakePlugin(t, `echo "TargetNotConnected: target is not connected" >&2; exit 1`)
+	sess := &ssm.StartSessionOutput{SessionId: aws.String("s")}
+	err := startPortForwardPlugin(context.Background(), "eu-west-1", "p", sess, ssmStartRequest{}, func() {})
+	if err == nil || !strings.Contains(err.Error(), "TargetNotConnected") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -1,8 +1,7 @@
 package cli
 
 import (
-	"fmt"
-	"os"
+	"io"
 	"strings"
 	"unicode/utf8"
 
@@ -10,8 +9,7 @@ import (
 )
 
 const (
-	clearHistoryOption    = "🗑️  Clear History"
-	historyDisplayMaxRune = 100
+	historyDisplayMaxRune  = 100
 	historyDisplayEllipsis = "…"
 )
 
@@ -39,69 +37,21 @@ func truncateForDisplay(s string) string {
 	return string(runes[:cutoff]) + historyDisplayEllipsis
 }
 
-// BubbleteaHistorySelect shows the last-N history entries and returns the
-// command the user picked (in its original, untruncated form). The display
-// strings are kept distinct from the original commands via displayToOriginal
-// so we never have to round-trip through a possibly-mangled label.
-func BubbleteaHistorySelect(label string, items []string) (string, error) {
-	displayItems := make([]string, 0, len(items))
-	displayToOriginal := make(map[string]string, len(items))
-	for _, cmd := range items {
-		d := truncateForDisplay(cmd)
-		// Ensure each display string is unique so the map lookup is exact.
-		// Duplicate raw commands are dropped upstream by GetLastUniqueHistory.
-		for _, existing := range displayItems {
-			if existing == d {
-				d = d + " "
-				break
-			}
-		}
-		displayItems = append(displayItems, d)
-		displayToOriginal[d] = cmd
-	}
-	allItems := append(displayItems, clearHistoryOption)
-	m := initialModel(label, allItems, "", false)
-	m.historyMode = true
+// HistoryReplayer re-runs a history entry chosen with ctrl+h from any
+// picker. main wires it to the same SSO/config/ExecECS path the picker uses;
+// nil disables the shortcut.
+var HistoryReplayer func(HistoryEntry) error
 
-	for {
-		opts := append([]tea.ProgramOption{tea.WithMouseAllMotion(), tea.WithAltScreen()}, historyExtraOpts...)
-		p := tea.NewProgram(ideModel{menu: m}, opts...)
-		finalModel, err := p.Run()
-		if err != nil {
-			historyMenuOpen = false
-			return "", err
-		}
-		im, ok := finalModel.(ideModel)
-		if !ok {
-			historyMenuOpen = false
-			return "", fmt.Errorf("unexpected model type")
-		}
-		mm := im.menu
-		if mm.choice == clearHistoryOption {
-			_ = os.Remove(historyFile)
-			fmt.Println("History cleared.")
-			displayItems = nil
-			displayToOriginal = map[string]string{}
-			allItems = []string{clearHistoryOption}
-			m = initialModel(label, allItems, "", false)
-			m.historyMode = true
-			continue
-		}
-		historyMenuOpen = false
-		// Map the selected display string back to the original command.
-		if original, ok := displayToOriginal[mm.choice]; ok {
-			if mm.quitting && mmWasMouseClick(mm) {
-				fmt.Println("\nCopied to clipboard (select and copy):\n" + original)
-				return "", nil
-			}
-			return original, nil
-		}
-		return mm.choice, nil
-	}
-}
+// historyExec adapts HistoryReplayer to tea.ExecCommand so bubbletea hands
+// the terminal over for the duration of the session and takes it back
+// afterwards.
+type historyExec struct{ entry HistoryEntry }
 
-// Helper to detect if the last quit was due to a mouse click (to be set in menuModel)
-func mmWasMouseClick(m menuModel) bool {
-	// This is a placeholder. You will need to set a flag in menuModel.Update when a mouse click event occurs.
-	return m.mouseClicked
-}
+func (h historyExec) Run() error { return HistoryReplayer(h.entry) }
+
+func (historyExec) SetStdin(io.Reader)  {}
+func (historyExec) SetStdout(io.Writer) {}
+func (historyExec) SetStderr(io.Writer) {}
+
+// historyDoneMsg reports the outcome of a ctrl+h replay back to the menu.
+type historyDoneMsg struct{ err error }
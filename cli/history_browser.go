@@ -0,0 +1,466 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// historyDetailRuns is how many recent runs the detail pane lists.
+const historyDetailRuns = 5
+
+// historyFilterKeys maps the field prefixes accepted in the search box to
+// the entry field they narrow. The short forms match the CLI flags.
+var historyFilterKeys = map[string]string{
+	"pr": "profile", "profile": "profile",
+	"rg": "region", "region": "region",
+	"cl": "cluster", "cluster": "cluster",
+	"se": "service", "service": "service",
+}
+
+// historyQuery is the parsed search box: `field:value` tokens narrow by
+// profile/region/cluster/service, every other word must appear somewhere in
+// the entry. All matching is case-insensitive substring matching, so a
+// cluster name matches its ARN.
+type historyQuery struct {
+	fields map[string]string
+	words  []string
+}
+
+func parseHistoryQuery(s string) historyQuery {
+	q := historyQuery{fields: map[string]string{}}
+	for _, tok := range strings.Fields(strings.ToLower(s)) {
+		if k, v, ok := strings.Cut(tok, ":"); ok {
+			if field, known := historyFilterKeys[k]; known {
+				q.fields[field] = v
+				continue
+			}
+		}
+		q.words = append(q.words, tok)
+	}
+	return q
+}
+
+func (q historyQuery) matches(e HistoryEntry) bool {
+	values := map[string]string{
+		"profile": e.Profile,
+		"region":  e.Region,
+		"cluster": e.Cluster,
+		"service": e.Service,
+	}
+	for field, want := range q.fields {
+		if !strings.Contains(strings.ToLower(values[field]), want) {
+			return false
+		}
+	}
+	hay := strings.ToLower(strings.Join([]string{e.Profile, e.Region, e.Cluster, e.Service, e.Task, e.Container, e.Command}, " "))
+	for _, w := range q.words {
+		if !strings.Contains(hay, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// HistoryFilter renders the -pr/-rg/-cl/-se flags as search-box filters so
+// `exec-ecs -history -pr prod` opens the browser already narrowed to prod.
+func (c *Cli) HistoryFilter() string {
+	var parts []string
+	for _, f := range []struct{ key, value string }{
+		{"pr", c.Profile}, {"rg", c.Region}, {"cl", c.ClusterArn}, {"se", c.Service},
+	} {
+		if f.value != "" {
+			parts = append(parts, f.key+":"+f.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// historyBrowser is the full-history picker: incremental search over every
+// target ever used, recency/frequency ordering, a detail pane for the
+// highlighted target, per-target deletion and date-based pruning.
+type historyBrowser struct {
+	targets []HistoryTarget
+	visible []HistoryTarget
+	search  textinput.Model
+	prune   textinput.Model
+	pruning bool
+	byFreq  bool
+	confirm bool
+	cursor  int
+	offset  int
+	status  string
+	choice  HistoryEntry
+	chosen  bool
+	done    bool
+	width   int
+	height  int
+	now     func() time.Time
+}
+
+func newHistoryBrowser(filter string) historyBrowser {
+	search := textinput.New()
+	search.Prompt = "Search: "
+	search.Placeholder = "words, or pr:/rg:/cl:/se: filters"
+	search.CharLimit = 200
+	search.SetValue(filter)
+	search.CursorEnd()
+	search.Focus()
+
+	prune := textinput.New()
+	prune.Prompt = "Delete entries older than (days): "
+	prune.CharLimit = 6
+
+	b := historyBrowser{search: search, prune: prune, now: time.Now}
+	b.reload()
+	return b
+}
+
+// reload re-reads the history file, e.g. after a deletion.
+func (b *historyBrowser) reload() {
+	b.targets = GroupHistory(LoadHistory())
+	b.refilter()
+}
+
+func (b *historyBrowser) refilter() {
+	q := parseHistoryQuery(b.search.Value())
+	b.visible = nil
+	for _, t := range b.targets {
+		if q.matches(t.Latest()) {
+			b.visible = append(b.visible, t)
+		}
+	}
+	if b.byFreq {
+		// targets is already newest-first, so a stable sort keeps recency
+		// as the tie-breaker.
+		sort.SliceStable(b.visible, func(i, j int) bool { return b.visible[i].Count() > b.visible[j].Count() })
+	}
+	b.cursor = max(0, min(b.cursor, len(b.visible)-1))
+	b.scroll()
+}
+
+// listRows is how many targets fit above the detail pane.
+func (b historyBrowser) listRows() int {
+	if b.height == 0 {
+		return defaultItemsPerPage
+	}
+	// Box border and padding, title, search (with margins), summary, the
+	// selected row's border, the detail pane and the status bar take 21
+	// lines with a full detail pane.
+	return max(3, min(b.height, maxLayoutHeight)-(16+historyDetailRuns))
+}
+
+func (b *historyBrowser) scroll() {
+	rows := b.listRows()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+rows {
+		b.offset = b.cursor - rows + 1
+	}
+	b.offset = max(0, min(b.offset, len(b.visible)-rows))
+}
+
+func (b historyBrowser) selected() (HistoryTarget, bool) {
+	if len(b.visible) == 0 {
+		return HistoryTarget{}, false
+	}
+	return b.visible[b.cursor], true
+}
+
+func (b historyBrowser) Init() tea.Cmd { return textinput.Blink }
+
+func (b historyBrowser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		b.width, b.height = msg.Width, msg.Height
+		b.search.Width = max(10, msg.Width-20)
+		b.scroll()
+		return b, nil
+	case tea.KeyMsg:
+		if b.pruning {
+			return b.updatePrune(msg)
+		}
+		key := msg.String()
+		if b.confirm && key != "ctrl+d" {
+			b.confirm = false
+			b.status = ""
+		}
+		switch key {
+		case "ctrl+c":
+			b.done = true
+			return b, tea.Quit
+		case "esc":
+			if b.search.Value() != "" {
+				b.search.SetValue("")
+				b.refilter()
+				return b, nil
+			}
+			b.done = true
+			return b, tea.Quit
+		case "enter":
+			if t, ok := b.selected(); ok {
+				b.choice, b.chosen, b.done = t.Latest(), true, true
+				return b, tea.Quit
+			}
+			return b, nil
+		case "up", "ctrl+p":
+			if b.cursor > 0 {
+				b.cursor--
+			}
+		case "down", "ctrl+n":
+			if b.cursor < len(b.visible)-1 {
+				b.cursor++
+			}
+		case "pgup":
+			b.cursor = max(0, b.cursor-b.listRows())
+		case "pgdown":
+			b.cursor = max(0, min(len(b.visible)-1, b.cursor+b.listRows()))
+		case "tab":
+			b.byFreq = !b.byFreq
+			b.cursor = 0
+			b.refilter()
+		case "ctrl+d":
+			b.deleteSelected()
+		case "ctrl+x":
+			b.pruning = true
+			b.status = ""
+			b.prune.SetValue("")
+			b.search.Blur()
+			return b, b.prune.Focus()
+		default:
+			before := b.search.Value()
+			var cmd tea.Cmd
+			b.search, cmd = b.search.Update(msg)
+			if b.search.Value() != before {
+				b.cursor = 0
+				b.refilter()
+			}
+			return b, cmd
+		}
+		b.scroll()
+		return b, nil
+	}
+	var cmd tea.Cmd
+	b.search, cmd = b.search.Update(msg)
+	return b, cmd
+}
+
+// deleteSelected asks for confirmation on the first ctrl+d and deletes
+// every run of the highlighted target on the second.
+func (b *historyBrowser) deleteSelected() {
+	t, ok := b.selected()
+	if !ok {
+		return
+	}
+	if !b.confirm {
+		b.confirm = true
+		b.status = fmt.Sprintf("Delete %d run(s) of %q? Press ctrl+d again to confirm.", t.Count(), truncateForDisplay(t.Latest().Label()))
+		return
+	}
+	b.confirm = false
+	n, err := DeleteHistoryTarget(t)
+	if err != nil {
+		b.status = "Delete failed: " + err.Error()
+		return
+	}
+	b.status = fmt.Sprintf("Deleted %d run(s).", n)
+	b.reload()
+}
+
+func (b historyBrowser) updatePrune(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		b.done = true
+		return b, tea.Quit
+	case "esc":
+		b.pruning = false
+		b.prune.Blur()
+		return b, b.search.Focus()
+	case "enter":
+		days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(b.prune.Value()), "d"))
+		if err != nil || days < 0 {
+			b.status = "Enter a whole number of days."
+			return b, nil
+		}
+		b.pruning = false
+		b.prune.Blur()
+		n, err := PruneHistory(b.now().Add(-time.Duration(days) * 24 * time.Hour))
+		if err != nil {
+			b.status = "Prune failed: " + err.Error()
+		} else {
+			b.status = fmt.Sprintf("Pruned %d entries older than %d days.", n, days)
+			b.reload()
+		}
+		return b, b.search.Focus()
+	}
+	var cmd tea.Cmd
+	b.prune, cmd = b.prune.Update(msg)
+	return b, cmd
+}
+
+// View wraps the browser in the same box and status bar as the pickers.
+func (b historyBrowser) View() string {
+	if b.done {
+		return ""
+	}
+	box := lipgloss.NewStyle().
+		Border(CurrentTheme.BorderStyle, true).
+		BorderForeground(CurrentTheme.MainBorder).
+		Background(CurrentTheme.MainBg).
+		Padding(1, 2).
+		Width(max(20, b.termWidth()-2)).
+		Render(b.body())
+	status := lipgloss.NewStyle().
+		Background(CurrentTheme.StatusBg).
+		Foreground(CurrentTheme.StatusFg).
+		Padding(0, 2).
+		Width(b.termWidth()).
+		Render(b.help())
+	return box + "\n" + status
+}
+
+// termWidth is the terminal width, assuming 80 columns until the first
+// WindowSizeMsg arrives.
+func (b historyBrowser) termWidth() int {
+	if b.width == 0 {
+		return 80
+	}
+	return b.width
+}
+
+func (b historyBrowser) body() string {
+	width := max(20, b.termWidth()-8)
+
+	var s strings.Builder
+	title := lipgloss.NewStyle().Foreground(CurrentTheme.TitleFg).Bold(true).Render("Command History")
+	app := lipgloss.NewStyle().Foreground(CurrentTheme.MainBorder).Bold(true).Render("exec-ecs")
+	s.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, title, strings.Repeat(" ", max(1, width-lipgloss.Width(title)-lipgloss.Width(app))), app))
+	s.WriteString("\n")
+	if b.pruning {
+		s.WriteString(CurrentTheme.FilterStyle.Render(b.prune.View()))
+	} else {
+		s.WriteString(CurrentTheme.FilterStyle.Render(b.search.View()))
+	}
+	s.WriteString("\n")
+
+	order := "recency"
+	if b.byFreq {
+		order = "frequency"
+	}
+	summary := fmt.Sprintf("%d of %d targets · sorted by %s", len(b.visible), len(b.targets), order)
+	if b.status != "" {
+		summary = b.status
+	}
+	s.WriteString(CurrentTheme.ItemStyle.Render(fitRunes(summary, width)))
+	s.WriteString("\n")
+
+	rows := b.listRows()
+	for i := b.offset; i < min(b.offset+rows, len(b.visible)); i++ {
+		t := b.visible[i]
+		meta := fmt.Sprintf("  ×%d  %s", t.Count(), humanAgo(b.now(), t.LastUsed()))
+		label := fitRunes(truncateForDisplay(t.Latest().Label()), width-utf8.RuneCountInString(meta)-4)
+		if i == b.cursor {
+			s.WriteString(CurrentTheme.SelectedItem.Render(selectedMarker + " " + label + meta))
+		} else {
+			s.WriteString(CurrentTheme.ItemStyle.Render("  " + label + meta))
+		}
+		s.WriteString("\n")
+	}
+	if len(b.visible) == 0 {
+		s.WriteString(CurrentTheme.ItemStyle.Render("  (no matching history)"))
+		s.WriteString("\n")
+	}
+
+	s.WriteString("\n")
+	if t, ok := b.selected(); ok {
+		s.WriteString(b.detail(t, width))
+	}
+	return s.String()
+}
+
+// detail renders the pane under the list: where the target points, how
+// often and when it was used, and its most recent runs.
+func (b historyBrowser) detail(t HistoryTarget, width int) string {
+	e := t.Latest()
+	profile := e.Profile
+	if profile == "" {
+		profile = "(not recorded)"
+	}
+	lines := []string{
+		"Target   " + profile + " · " + e.Region + " · " + displayTail(e.Cluster) + " › " + displayTail(e.Service) + " › " + e.Container,
+		"Command  " + truncateForDisplay(e.Command),
+		fmt.Sprintf("Used     %d time(s) · first %s · last %s", t.Count(), formatHistoryTime(t.FirstUsed()), formatHistoryTime(t.LastUsed())),
+	}
+	for i, r := range t.Runs {
+		if i == historyDetailRuns {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %s  exit %d  %s  task %s",
+			formatHistoryTime(r.StartedAt), r.ExitCode,
+			(time.Duration(r.DurationMs)*time.Millisecond).Round(time.Second), displayTail(r.Task)))
+	}
+	for i, l := range lines {
+		lines[i] = fitRunes(l, width)
+	}
+	return CurrentTheme.ItemStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (b historyBrowser) help() string {
+	if b.pruning {
+		return "Enter Prune  esc Cancel"
+	}
+	return "↑↓ Move  Enter Run  type Search  tab Sort  ctrl+d Delete  ctrl+x Prune  esc Back"
+}
+
+// BrowseHistory opens the history browser, pre-filtered by filter, and
+// returns the entry the user chose to run. ok is false when they backed out.
+func BrowseHistory(filter string) (HistoryEntry, bool, error) {
+	opts := append([]tea.ProgramOption{tea.WithAltScreen()}, historyExtraOpts...)
+	final, err := tea.NewProgram(newHistoryBrowser(filter), opts...).Run()
+	if err != nil {
+		return HistoryEntry{}, false, err
+	}
+	b := final.(historyBrowser)
+	return b.choice, b.chosen, nil
+}
+
+// fitRunes cuts s to at most n runes, marking the cut with an ellipsis.
+func fitRunes(s string, n int) string {
+	if n < 1 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:max(0, n-1)]) + historyDisplayEllipsis
+}
+
+// humanAgo renders how long before now t was, coarsely.
+func humanAgo(now, t time.Time) string {
+	if t.IsZero() {
+		return "—"
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+}
+
+func formatHistoryTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
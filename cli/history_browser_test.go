@@ -0,0 +1,282 @@
+package cli
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseHistoryQuery(t *testing.T) {
+	t.Parallel()
+
+	q := parseHistoryQuery("PR:Prod se:api  tail cl:web foo:bar")
+	want := historyQuery{
+		fields: map[string]string{"profile": "prod", "service": "api", "cluster": "web"},
+		words:  []string{"tail", "foo:bar"},
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Fatalf("got %+v want %+v", q, want)
+	}
+}
+
+func TestHistoryQueryMatches(t *testing.T) {
+	t.Parallel()
+
+	e := HistoryEntry{
+		Profile: "prod", Region: "eu-west-1",
+		Cluster: "arn:aws:ecs:eu-west-1:1:cluster/web", Service: "arn:aws:ecs:eu-west-1:1:service/web/api",
+		Task: "arn:aws:ecs:eu-west-1:1:task/web/abc123", Container: "app", Command: "tail -f /var/log/app.log",
+	}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"pr:prod cl:web", true},
+		{"pr:dev", false},
+		{"rg:us-", false},
+		{"se:api TAIL", true},
+		{"abc123", true},
+		{"tail missing", false},
+	}
+	for _, tc := range tests {
+		if got := parseHistoryQuery(tc.query).matches(e); got != tc.want {
+			t.Errorf("%q matches = %v want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestCliHistoryFilter(t *testing.T) {
+	t.Parallel()
+
+	if got := (&Cli{}).HistoryFilter(); got != "" {
+		t.Fatalf("no flags: %q", got)
+	}
+	c := &Cli{Profile: "prod", Region: "eu-west-1", ClusterArn: "web", Service: "api"}
+	if got, want := c.HistoryFilter(), "pr:prod rg:eu-west-1 cl:web se:api"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+// seedBrowserHistory writes "ls" once, "top" three times and "df" once,
+// in that order, so recency and frequency orderings differ.
+func seedBrowserHistory(t *testing.T) {
+	t.Helper()
+	setHistoryFile(t)
+	now := time.Now()
+	for i, cmd := range []string{"ls", "top", "top", "top", "df"} {
+		AppendToHistory(timedEntry(cmd, now.Add(time.Duration(i-5)*time.Hour)))
+	}
+}
+
+func browserCommands(b historyBrowser) []string {
+	var cmds []string
+	for _, t := range b.visible {
+		cmds = append(cmds, t.Latest().Command)
+	}
+	return cmds
+}
+
+func pressBrowser(b historyBrowser, msgs ...tea.Msg) historyBrowser {
+	for _, msg := range msgs {
+		m, _ := b.Update(msg)
+		b = m.(historyBrowser)
+	}
+	return b
+}
+
+func typeRunes(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestHistoryBrowserSortAndSearch(t *testing.T) {
+	seedBrowserHistory(t)
+
+	b := newHistoryBrowser("")
+	if got := browserCommands(b); !reflect.DeepEqual(got, []string{"df", "top", "ls"}) {
+		t.Fatalf("recency order = %v", got)
+	}
+	b = pressBrowser(b, tea.KeyMsg{Type: tea.KeyTab})
+	if got := browserCommands(b); !reflect.DeepEqual(got, []string{"top", "df", "ls"}) {
+		t.Fatalf("frequency order = %v", got)
+	}
+	b = pressBrowser(b, typeRunes("ls"))
+	if got := browserCommands(b); !reflect.DeepEqual(got, []string{"ls"}) {
+		t.Fatalf("search results = %v", got)
+	}
+	b = pressBrowser(b, tea.KeyMsg{Type: tea.KeyEsc})
+	if b.done || len(b.visible) != 3 {
+		t.Fatalf("esc should clear the search first: done=%v visible=%d", b.done, len(b.visible))
+	}
+	b = pressBrowser(b, tea.KeyMsg{Type: tea.KeyEsc})
+	if !b.done || b.chosen {
+		t.Fatal("second esc should leave without a choice")
+	}
+}
+
+func TestHistoryBrowserPresetFilter(t *testing.T) {
+	seedBrowserHistory(t)
+
+	if b := newHistoryBrowser("cl:nope"); len(b.visible) != 0 {
+		t.Fatalf("filter should hide everything, got %v", browserCommands(b))
+	}
+	b := newHistoryBrowser("cl:cl se:svc")
+	if len(b.visible) != 3 {
+		t.Fatalf("filter should keep everything, got %v", browserCommands(b))
+	}
+	if !strings.Contains(newHistoryBrowser("cl:nope").View(), "(no matching history)") {
+		t.Fatal("empty result should say so")
+	}
+}
+
+func TestHistoryBrowserNavigateAndChoose(t *testing.T) {
+	seedBrowserHistory(t)
+
+	b := pressBrowser(newHistoryBrowser(""),
+		tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyDown},
+		tea.KeyMsg{Type: tea.KeyUp},
+		tea.KeyMsg{Type: tea.KeyPgDown}, tea.KeyMsg{Type: tea.KeyPgUp}, tea.KeyMsg{Type: tea.KeyDown},
+	)
+	if b.cursor != 1 {
+		t.Fatalf("cursor = %d", b.cursor)
+	}
+	b = pressBrowser(b, tea.KeyMsg{Type: tea.KeyEnter})
+	if !b.chosen || b.choice.Command != "top" {
+		t.Fatalf("choice = %+v chosen=%v", b.choice, b.chosen)
+	}
+	if b.View() != "" {
+		t.Fatal("a finished browser should render nothing")
+	}
+}
+
+func TestHistoryBrowserDeleteNeedsConfirmation(t *testing.T) {
+	seedBrowserHistory(t)
+
+	ctrlD := tea.KeyMsg{Type: tea.KeyCtrlD}
+	b := pressBrowser(newHistoryBrowser(""), tea.KeyMsg{Type: tea.KeyDown}, ctrlD)
+	if !b.confirm || !strings.Contains(b.status, "Delete 3 run(s)") {
+		t.Fatalf("first ctrl+d should ask: %q", b.status)
+	}
+	// Any other key cancels.
+	b = pressBrowser(b, tea.KeyMsg{Type: tea.KeyUp})
+	if b.confirm || len(LoadHistory()) != 5 {
+		t.Fatal("cancelled delete must not touch the file")
+	}
+
+	b = pressBrowser(b, tea.KeyMsg{Type: tea.KeyDown}, ctrlD, ctrlD)
+	if got := browserCommands(b); !reflect.DeepEqual(got, []string{"df", "ls"}) {
+		t.Fatalf("after delete = %v (status %q)", got, b.status)
+	}
+	if n := len(LoadHistory()); n != 2 {
+		t.Fatalf("file still has %d entries", n)
+	}
+}
+
+func TestHistoryBrowserPrune(t *testing.T) {
+	seedBrowserHistory(t)
+
+	ctrlX := tea.KeyMsg{Type: tea.KeyCtrlX}
+	enter := tea.KeyMsg{Type: tea.KeyEnter}
+	b := pressBrowser(newHistoryBrowser(""), ctrlX, typeRunes("x"), enter)
+	if !b.pruning || !strings.Contains(b.status, "whole number") {
+		t.Fatalf("bad input should keep the prompt open: %q", b.status)
+	}
+	if !strings.Contains(b.View(), "older than") || !strings.Contains(b.help(), "Prune") {
+		t.Fatal("prune prompt not rendered")
+	}
+	b = pressBrowser(b, tea.KeyMsg{Type: tea.KeyEsc})
+	if b.pruning || b.done {
+		t.Fatal("esc should only close the prune prompt")
+	}
+
+	// Entries are 5h..1h old; moving the browser's clock 22.5h ahead puts
+	// the "older than 1 day" cutoff between the last two.
+	b.now = func() time.Time { return time.Now().Add(24*time.Hour - 90*time.Minute) }
+	b = pressBrowser(b, ctrlX, typeRunes("1d"), enter)
+	if b.pruning || !strings.Contains(b.status, "Pruned 4") {
+		t.Fatalf("status = %q", b.status)
+	}
+	if got := browserCommands(b); !reflect.DeepEqual(got, []string{"df"}) {
+		t.Fatalf("after prune = %v", got)
+	}
+}
+
+func TestHistoryBrowserViewShowsDetail(t *testing.T) {
+	seedBrowserHistory(t)
+
+	b := pressBrowser(newHistoryBrowser(""),
+		tea.WindowSizeMsg{Width: 120, Height: 40}, tea.KeyMsg{Type: tea.KeyDown})
+	out := b.View()
+	for _, want := range []string{"Command History", "3 of 3 targets", "sorted by recency", "Used     3 time(s)", "exit 0", "ctrl+d Delete"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("view missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistoryBrowserScrollsLongLists(t *testing.T) {
+	setHistoryFile(t)
+	for i := 0; i < 30; i++ {
+		AppendToHistory(cmdEntry(strings.Repeat("x", i+1)))
+	}
+	b := pressBrowser(newHistoryBrowser(""), tea.WindowSizeMsg{Width: 80, Height: 24})
+	rows := b.listRows()
+	for i := 0; i < rows+2; i++ {
+		b = pressBrowser(b, tea.KeyMsg{Type: tea.KeyDown})
+	}
+	if b.offset != 3 || b.cursor != rows+2 {
+		t.Fatalf("offset=%d cursor=%d rows=%d", b.offset, b.cursor, rows)
+	}
+}
+
+func TestBrowseHistoryRunsProgram(t *testing.T) {
+	seedBrowserHistory(t)
+	in := newScriptedKeys('\r')
+	defer in.Close()
+	prev := historyExtraOpts
+	historyExtraOpts = []tea.ProgramOption{tea.WithInput(in), tea.WithOutput(io.Discard)}
+	t.Cleanup(func() { historyExtraOpts = prev })
+
+	got, ok, err := (&Cli{}).BrowseHistory("top")
+	if err != nil || !ok || got.Command != "top" {
+		t.Fatalf("got=%+v ok=%v err=%v", got, ok, err)
+	}
+}
+
+func TestHumanAgo(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[time.Duration]string{
+		10 * time.Second: "just now",
+		5 * time.Minute:  "5m ago",
+		3 * time.Hour:    "3h ago",
+		50 * time.Hour:   "2d ago",
+	}
+	for d, want := range tests {
+		if got := humanAgo(now, now.Add(-d)); got != want {
+			t.Errorf("humanAgo(%v) = %q want %q", d, got, want)
+		}
+	}
+	if got := humanAgo(now, time.Time{}); got != "—" {
+		t.Errorf("zero time = %q", got)
+	}
+	if got := formatHistoryTime(time.Time{}); got != "unknown" {
+		t.Errorf("formatHistoryTime(zero) = %q", got)
+	}
+}
+
+func TestFitRunes(t *testing.T) {
+	t.Parallel()
+
+	if got := fitRunes("héllo", 10); got != "héllo" {
+		t.Fatalf("short = %q", got)
+	}
+	if got := fitRunes("héllo wörld", 6); got != "héllo…" {
+		t.Fatalf("cut = %q", got)
+	}
+}
@@ -0,0 +1,282 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// historyFile is a `var` so tests can rebind it. In normal runs it always
+// resolves to the standard config dir; we only fall back to legacy paths via
+// migrateLegacyPaths() at startup.
+var historyFile = historyPath()
+
+// legacyHistoryFile is the plain-text history written before entries were
+// structured. It is converted into historyFile the first time history is
+// touched.
+var legacyHistoryFile = legacyHistoryPath()
+
+// HistoryEntry is one exec session, stored as a line of JSON in
+// historyFile.
+type HistoryEntry struct {
+	Profile    string    `json:"profile,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Cluster    string    `json:"cluster,omitempty"`
+	Service    string    `json:"service,omitempty"`
+	Task       string    `json:"task,omitempty"`
+	Container  string    `json:"container,omitempty"`
+	Command    string    `json:"command"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	DurationMs int64     `json:"durationMs"`
+	ExitCode   int       `json:"exitCode"`
+}
+
+// Replayable reports whether the entry names enough of a target to run
+// again. Entries migrated from unrecognised plain-text lines are not.
+func (e HistoryEntry) Replayable() bool {
+	return e.Cluster != "" && e.Container != "" && (e.Task != "" || e.Service != "")
+}
+
+// key identifies "the same thing run again": everything except the task
+// (which changes on every deploy) and the per-run measurements.
+func (e HistoryEntry) key() string {
+	return strings.Join([]string{e.Profile, e.Region, e.Cluster, e.Service, e.Container, e.Command}, "\x00")
+}
+
+// Label renders the entry on one line for pickers.
+func (e HistoryEntry) Label() string {
+	if !e.Replayable() {
+		return e.Command
+	}
+	where := displayTail(e.Service)
+	if where == "" {
+		where = displayTail(e.Task)
+	}
+	target := displayTail(e.Cluster) + " › " + where + " › " + e.Container
+	if e.Profile != "" {
+		target = e.Profile + "@" + e.Region + " " + target
+	}
+	return target + ": " + e.Command
+}
+
+// AppendToHistory adds an entry to the history file. Failures are silent:
+// losing a history line must never break a session.
+func AppendToHistory(e HistoryEntry) {
+	migrateLegacyHistory()
+	_ = EnsureConfigDir()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return // fail silently
+	}
+	defer f.Close()
+	_, _ = f.Write(append(line, '\n'))
+}
+
+// LoadHistory returns every entry, oldest first. Lines that fail to parse
+// are skipped so one corrupt write doesn't hide the rest.
+func LoadHistory() []HistoryEntry {
+	migrateLegacyHistory()
+	data, err := os.ReadFile(historyFile)
+	if err != nil {
+		return nil
+	}
+	var entries []HistoryEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e HistoryEntry
+		if json.Unmarshal(line, &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// HistoryTarget groups every run of the same target+command (see key),
+// newest run first.
+type HistoryTarget struct {
+	Runs []HistoryEntry
+}
+
+// Latest is the most recent run; replaying a target replays this entry.
+func (t HistoryTarget) Latest() HistoryEntry { return t.Runs[0] }
+
+// Count is how many times the target was used.
+func (t HistoryTarget) Count() int { return len(t.Runs) }
+
+// LastUsed and FirstUsed are zero for entries migrated from plain-text
+// history, which carried no timestamps.
+func (t HistoryTarget) LastUsed() time.Time  { return t.Runs[0].StartedAt }
+func (t HistoryTarget) FirstUsed() time.Time { return t.Runs[len(t.Runs)-1].StartedAt }
+
+// GroupHistory folds entries (oldest first, as LoadHistory returns them)
+// into targets, most recently used first.
+func GroupHistory(entries []HistoryEntry) []HistoryTarget {
+	index := make(map[string]int)
+	var targets []HistoryTarget
+	for i := len(entries) - 1; i >= 0; i-- {
+		k := entries[i].key()
+		if j, ok := index[k]; ok {
+			targets[j].Runs = append(targets[j].Runs, entries[i])
+			continue
+		}
+		index[k] = len(targets)
+		targets = append(targets, HistoryTarget{Runs: []HistoryEntry{entries[i]}})
+	}
+	return targets
+}
+
+// DeleteHistory removes every entry matching drop and returns how many went.
+// The file is rewritten through a temp file so a crash never truncates it.
+func DeleteHistory(drop func(HistoryEntry) bool) (int, error) {
+	entries := LoadHistory()
+	var buf bytes.Buffer
+	removed := 0
+	for _, e := range entries {
+		if drop(e) {
+			removed++
+			continue
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	tmp := historyFile + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, historyFile); err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+	return removed, nil
+}
+
+// DeleteHistoryTarget removes every run of t.
+func DeleteHistoryTarget(t HistoryTarget) (int, error) {
+	k := t.Latest().key()
+	return DeleteHistory(func(e HistoryEntry) bool { return e.key() == k })
+}
+
+// PruneHistory removes entries started before cutoff. Entries migrated from
+// plain-text history have no start time and count as older than anything.
+func PruneHistory(cutoff time.Time) (int, error) {
+	return DeleteHistory(func(e HistoryEntry) bool { return e.StartedAt.Before(cutoff) })
+}
+
+// legacyHistoryLine matches what ExecECS used to write as plain text.
+var legacyHistoryLine = regexp.MustCompile(`^# ecs exec cluster=(\S*) task=(\S*) container=(\S*) region=(\S*) command=(".*")$`)
+
+// parseLegacyHistoryLine converts one plain-text history line. Lines in the
+// old `# ecs exec ...` format keep their target; anything else survives as a
+// bare command.
+func parseLegacyHistoryLine(line string) HistoryEntry {
+	m := legacyHistoryLine.FindStringSubmatch(line)
+	if m == nil {
+		return HistoryEntry{Command: line}
+	}
+	cmd, err := strconv.Unquote(m[5])
+	if err != nil {
+		return HistoryEntry{Command: line}
+	}
+	return HistoryEntry{Cluster: m[1], Task: m[2], Container: m[3], Region: m[4], Command: cmd}
+}
+
+// migrateLegacyHistory converts the plain-text history into JSONL once, then
+// moves the old file aside so it is never imported twice.
+func migrateLegacyHistory() {
+	if _, err := os.Stat(historyFile); !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	data, err := os.ReadFile(legacyHistoryFile)
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		out, err := json.Marshal(parseLegacyHistoryLine(line))
+		if err != nil {
+			continue
+		}
+		buf.Write(append(out, '\n'))
+	}
+	if err := os.WriteFile(historyFile, buf.Bytes(), 0o600); err != nil {
+		return
+	}
+	_ = os.Rename(legacyHistoryFile, legacyHistoryFile+".migrated")
+}
+
+// ResolveHistoryTarget turns a history entry into a live target. The
+// recorded task is used while it is still running; once it has stopped (a
+// deploy, a scale-in) any running task of the same service is picked
+// instead, since its containers carry the same names.
+func ResolveHistoryTarget(ctx context.Context, c *Cli, client ECSClient, e HistoryEntry) (State, error) {
+	state := State{Profile: e.Profile, Region: e.Region, ClusterArn: e.Cluster, Service: e.Service, TaskArn: e.Task, Container: e.Container}
+	if !e.Replayable() {
+		return state, errors.New("this history entry has no cluster/container recorded, so it cannot be replayed")
+	}
+	return resolveRunningTask(ctx, c, client, state, "the entry has no service")
+}
+
+// resolveRunningTask keeps state.TaskArn while that task is running and
+// otherwise swaps in a running task of state.Service. noService finishes
+// the error for when there is no service to pick from.
+func resolveRunningTask(ctx context.Context, c *Cli, client ECSClient, state State, noService string) (State, error) {
+	task := state.TaskArn
+	if task != "" {
+		c.LogAWSCommand("ecs", "describe-tasks", "--cluster", state.ClusterArn, "--tasks", task, "--profile", c.Profile, "--region", state.Region)
+		out, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{Cluster: aws.String(state.ClusterArn), Tasks: []string{task}})
+		if err != nil {
+			return state, fmt.Errorf("describe task: %w", err)
+		}
+		if len(out.Tasks) > 0 && aws.ToString(out.Tasks[0].LastStatus) == "RUNNING" {
+			return state, nil
+		}
+	}
+
+	if state.Service == "" || IsPseudoService(state.Service) {
+		return state, fmt.Errorf("task %s is no longer running and %s to pick a replacement from", displayTail(task), noService)
+	}
+	c.LogAWSCommand("ecs", "list-tasks", "--cluster", state.ClusterArn, "--service-name", state.Service, "--profile", c.Profile, "--region", state.Region)
+	arns, err := listAllTaskArns(ctx, client, state.ClusterArn, state.Service)
+	if err != nil {
+		return state, fmt.Errorf("list tasks: %w", err)
+	}
+	if len(arns) == 0 {
+		return state, fmt.Errorf("service %s has no running tasks", displayTail(state.Service))
+	}
+	if task != "" {
+		fmt.Printf("Task %s has stopped; using %s from the same service.\n", displayTail(task), displayTail(arns[0]))
+	}
+	state.TaskArn = arns[0]
+	return state, nil
+}
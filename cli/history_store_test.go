@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestResolveHistoryTargetKeepsRunningTask(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{describeTasks: []ecstypes.Task{{LastStatus: aws.String("RUNNING")}}}
+	state, err := ResolveHistoryTarget(context.Background(), &Cli{}, f, cmdEntry("ls"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if state.TaskArn != "t1" || state.ClusterArn != "cl" || state.Service != "svc" || state.Container != "app" {
+		t.Fatalf("state = %+v", state)
+	}
+	if f.taskCalls != 0 {
+		t.Fatal("a running task should not trigger list-tasks")
+	}
+}
+
+func TestResolveHistoryTargetFallsBackToService(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{
+		describeTasks: []ecstypes.Task{{LastStatus: aws.String("STOPPED")}},
+		tasksPages:    [][]string{{"t2", "t3"}},
+	}
+	state, err := ResolveHistoryTarget(context.Background(), &Cli{}, f, cmdEntry("ls"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if state.TaskArn != "t2" {
+		t.Fatalf("TaskArn = %q, want a task from the service", state.TaskArn)
+	}
+
+	// A task that no longer exists at all is treated the same way.
+	f = &fakeECS{tasksPages: [][]string{{"t4"}}}
+	if state, err = ResolveHistoryTarget(context.Background(), &Cli{}, f, cmdEntry("ls")); err != nil || state.TaskArn != "t4" {
+		t.Fatalf("state=%+v err=%v", state, err)
+	}
+}
+
+func TestResolveHistoryTargetErrors(t *testing.T) {
+	t.Parallel()
+
+	noService := cmdEntry("ls")
+	noService.Service = ""
+	tests := []struct {
+		name  string
+		f     *fakeECS
+		entry HistoryEntry
+		want  string
+	}{
+		{"not replayable", &fakeECS{}, HistoryEntry{Command: "aws s3 ls"}, "cannot be replayed"},
+		{"describe fails", &fakeECS{describeTaskErr: errors.New("boom")}, cmdEntry("ls"), "describe task"},
+		{"stopped without service", &fakeECS{}, noService, "no service"},
+		{"list fails", &fakeECS{taskErr: errors.New("boom")}, cmdEntry("ls"), "list tasks"},
+		{"service empty", &fakeECS{}, cmdEntry("ls"), "no running tasks"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ResolveHistoryTarget(context.Background(), &Cli{}, tc.f, tc.entry)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func timedEntry(cmd string, at time.Time) HistoryEntry {
+	e := cmdEntry(cmd)
+	e.StartedAt = at
+	return e
+}
+
+func TestGroupHistory(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	other := timedEntry("ls", t0.Add(time.Minute))
+	other.Task = "t2" // same target after a deploy
+	entries := []HistoryEntry{
+		timedEntry("ls", t0),
+		timedEntry("top", t0.Add(30*time.Second)),
+		other,
+	}
+	got := GroupHistory(entries)
+	if len(got) != 2 {
+		t.Fatalf("groups = %+v", got)
+	}
+	ls := got[0]
+	if ls.Latest().Task != "t2" || ls.Count() != 2 || !ls.FirstUsed().Equal(t0) || !ls.LastUsed().Equal(t0.Add(time.Minute)) {
+		t.Fatalf("ls group = %+v", ls)
+	}
+	if got[1].Latest().Command != "top" || got[1].Count() != 1 {
+		t.Fatalf("top group = %+v", got[1])
+	}
+}
+
+func TestDeleteHistoryTarget(t *testing.T) {
+	setHistoryFile(t)
+	AppendToHistory(cmdEntry("ls"))
+	AppendToHistory(cmdEntry("top"))
+	AppendToHistory(cmdEntry("ls"))
+
+	n, err := DeleteHistoryTarget(GroupHistory(LoadHistory())[0])
+	if err != nil || n != 2 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if got := historyCommands(LoadHistory()); len(got) != 1 || got[0] != "top" {
+		t.Fatalf("left = %v", got)
+	}
+	if n, err := DeleteHistory(func(HistoryEntry) bool { return false }); n != 0 || err != nil {
+		t.Fatalf("no-op delete: n=%d err=%v", n, err)
+	}
+}
+
+func TestDeleteHistoryUnwritable(t *testing.T) {
+	path := setHistoryFile(t)
+	AppendToHistory(cmdEntry("ls"))
+	if err := os.Chmod(filepath.Dir(path), 0o500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(filepath.Dir(path), 0o700) })
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	if _, err := DeleteHistory(func(HistoryEntry) bool { return true }); err == nil {
+		t.Fatal("expected an error rewriting a read-only history dir")
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	setHistoryFile(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	AppendToHistory(HistoryEntry{Command: "migrated"})
+	AppendToHistory(timedEntry("old", now.Add(-40*24*time.Hour)))
+	AppendToHistory(timedEntry("new", now.Add(-time.Hour)))
+
+	n, err := PruneHistory(now.Add(-30 * 24 * time.Hour))
+	if err != nil || n != 2 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if got := historyCommands(LoadHistory()); len(got) != 1 || got[0] != "new" {
+		t.Fatalf("left = %v", got)
+	}
+}
@@ -1,87 +1,151 @@
 package cli
 
 import (
-	"io"
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
-
-	tea "github.com/charmbracelet/bubbletea"
+	"time"
 )
 
 func setHistoryFile(t *testing.T) string {
 	t.Helper()
 	tmp := t.TempDir()
-	path := filepath.Join(tmp, "history")
-	prev := historyFile
+	path := filepath.Join(tmp, "history.jsonl")
+	prev, prevLegacy := historyFile, legacyHistoryFile
 	historyFile = path
-	t.Cleanup(func() { historyFile = prev })
+	legacyHistoryFile = filepath.Join(tmp, "history")
+	// Sessions are audited too; keep them out of the real audit log.
+	prevAudit, prevSpool := auditFile, auditSpoolDir
+	auditFile = filepath.Join(tmp, "audit.jsonl")
+	auditSpoolDir = filepath.Join(tmp, "audit-spool")
+	t.Cleanup(func() {
+		historyFile, legacyHistoryFile = prev, prevLegacy
+		auditFile, auditSpoolDir = prevAudit, prevSpool
+	})
 	return path
 }
 
+func cmdEntry(cmd string) HistoryEntry {
+	return HistoryEntry{Region: "eu-west-1", Cluster: "cl", Service: "svc", Task: "t1", Container: "app", Command: cmd}
+}
+
+func historyCommands(entries []HistoryEntry) []string {
+	var cmds []string
+	for _, e := range entries {
+		cmds = append(cmds, e.Command)
+	}
+	return cmds
+}
+
 func TestAppendAndReadHistory(t *testing.T) {
 	setHistoryFile(t)
 
-	AppendToHistory("one")
-	AppendToHistory("two")
-	AppendToHistory("one")
-	AppendToHistory("three")
+	AppendToHistory(cmdEntry("one"))
+	AppendToHistory(cmdEntry("two"))
+	AppendToHistory(cmdEntry("one"))
+	AppendToHistory(cmdEntry("three"))
 
-	got := GetLastUniqueHistory(5)
-	want := []string{"three", "one", "two"}
+	got := historyCommands(LoadHistory())
+	want := []string{"one", "two", "one", "three"}
 	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("history = %v want %v", got, want)
 	}
 }
 
-func TestGetLastUniqueHistoryLimit(t *testing.T) {
+func TestHistoryEntryRoundTrip(t *testing.T) {
 	setHistoryFile(t)
-
-	for _, cmd := range []string{"a", "b", "c", "d", "e", "f"} {
-		AppendToHistory(cmd)
-	}
-
-	got := GetLastUniqueHistory(3)
-	if len(got) != 3 {
-		t.Fatalf("expected 3, got %v", got)
+	want := HistoryEntry{
+		Profile: "dev", Region: "eu-west-1", Cluster: "arn:cl", Service: "arn:svc", Task: "arn:task",
+		Container: "app", Command: "ls -la", StartedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		DurationMs: 1500, ExitCode: 3,
 	}
-	if !reflect.DeepEqual(got, []string{"f", "e", "d"}) {
-		t.Fatalf("history = %v", got)
+	AppendToHistory(want)
+	got := LoadHistory()
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Fatalf("got %+v want %+v", got, want)
 	}
 }
 
-func TestGetLastUniqueHistoryMissingFile(t *testing.T) {
-	tmp := t.TempDir()
-	prev := historyFile
-	historyFile = filepath.Join(tmp, "absent")
-	t.Cleanup(func() { historyFile = prev })
+func TestLoadHistoryMissingFile(t *testing.T) {
+	setHistoryFile(t)
 
-	if got := GetLastUniqueHistory(5); got != nil {
+	if got := LoadHistory(); got != nil {
 		t.Fatalf("expected nil, got %v", got)
 	}
 }
 
-func TestGetLastUniqueHistoryIgnoresBlanks(t *testing.T) {
+func TestLoadHistorySkipsBlankAndCorruptLines(t *testing.T) {
 	path := setHistoryFile(t)
-	if err := os.WriteFile(path, []byte("alpha\n\n\nalpha\nbeta\n\n"), 0o600); err != nil {
+	data := `{"command":"alpha","cluster":"cl","container":"app","task":"t"}` + "\n\n{not json\n" +
+		`{"command":"beta","cluster":"cl","container":"app","task":"t"}` + "\n\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
 		t.Fatalf("write: %v", err)
 	}
-	got := GetLastUniqueHistory(5)
-	want := []string{"beta", "alpha"}
+	got := historyCommands(LoadHistory())
+	want := []string{"alpha", "beta"}
 	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("got %v want %v", got, want)
 	}
 }
 
 func TestAppendHistoryUnwritable(t *testing.T) {
-	prev := historyFile
+	setHistoryFile(t)
 	historyFile = "/proc/should-not-be-writable/exec-ecs-test"
-	t.Cleanup(func() { historyFile = prev })
 
 	// Should not panic, just fail silently.
-	AppendToHistory("anything")
+	AppendToHistory(cmdEntry("anything"))
+}
+
+func TestMigrateLegacyHistory(t *testing.T) {
+	path := setHistoryFile(t)
+	legacy := `# ecs exec cluster=arn:cl task=arn:task container=app region=eu-west-1 command="ls \"-la\""` +
+		"\n\naws s3 ls\n# ecs exec cluster=x task=y container=z region=r command=bad-quote\n"
+	if err := os.WriteFile(legacyHistoryFile, []byte(legacy), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	got := LoadHistory()
+	want := []HistoryEntry{
+		{Cluster: "arn:cl", Task: "arn:task", Container: "app", Region: "eu-west-1", Command: `ls "-la"`},
+		{Command: "aws s3 ls"},
+		{Command: "# ecs exec cluster=x task=y container=z region=r command=bad-quote"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("jsonl history not written: %v", err)
+	}
+	if _, err := os.Stat(legacyHistoryFile); !os.IsNotExist(err) {
+		t.Fatalf("legacy file should be moved aside, stat err = %v", err)
+	}
+	if _, err := os.Stat(legacyHistoryFile + ".migrated"); err != nil {
+		t.Fatalf("legacy backup missing: %v", err)
+	}
+
+	// A second load must not import the legacy file again.
+	AppendToHistory(cmdEntry("new"))
+	if n := len(LoadHistory()); n != 4 {
+		t.Fatalf("expected 4 entries after append, got %d", n)
+	}
+}
+
+func TestHistoryEntryLabel(t *testing.T) {
+	t.Parallel()
+	e := HistoryEntry{Profile: "dev", Region: "eu-west-1", Cluster: "arn:aws:ecs:r:1:cluster/main", Service: "arn:aws:ecs:r:1:service/main/web", Container: "app", Command: "ls"}
+	if got, want := e.Label(), "dev@eu-west-1 main › web › app: ls"; got != want {
+		t.Fatalf("Label = %q want %q", got, want)
+	}
+	e.Profile, e.Service, e.Task = "", "", "arn:aws:ecs:r:1:task/main/abc"
+	if got, want := e.Label(), "main › abc › app: ls"; got != want {
+		t.Fatalf("Label = %q want %q", got, want)
+	}
+	if got := (HistoryEntry{Command: "aws s3 ls"}).Label(); got != "aws s3 ls" {
+		t.Fatalf("bare Label = %q", got)
+	}
 }
 
 func TestTruncateForDisplay(t *testing.T) {
@@ -106,47 +170,25 @@ func TestTruncateForDisplay(t *testing.T) {
 	}
 }
 
-func TestCliBubbleteaHistorySelectDelegates(t *testing.T) {
-	setHistoryFile(t)
-	in := newScriptedKeys('\r')
-	defer in.Close()
-	prev := historyExtraOpts
-	historyExtraOpts = []tea.ProgramOption{tea.WithInput(in), tea.WithOutput(io.Discard)}
-	t.Cleanup(func() { historyExtraOpts = prev })
-
-	c := &Cli{}
-	got, err := c.BubbleteaHistorySelect("History", []string{"aws ecs exec foo"})
-	if err != nil {
-		t.Fatalf("err: %v", err)
-	}
-	if got != "aws ecs exec foo" {
-		t.Fatalf("got %q", got)
-	}
-}
-
-func TestBubbleteaHistorySelectPicksFirst(t *testing.T) {
-	setHistoryFile(t)
-	in := newScriptedKeys('\r')
-	defer in.Close()
-	prev := historyExtraOpts
-	historyExtraOpts = []tea.ProgramOption{tea.WithInput(in), tea.WithOutput(io.Discard)}
-	t.Cleanup(func() { historyExtraOpts = prev })
+func TestHistoryExecRunsReplayer(t *testing.T) {
+	prev := HistoryReplayer
+	t.Cleanup(func() { HistoryReplayer = prev })
 
-	got, err := BubbleteaHistorySelect("History", []string{"aws ecs ... one", "aws ecs ... two"})
-	if err != nil {
-		t.Fatalf("err: %v", err)
+	var got HistoryEntry
+	HistoryReplayer = func(e HistoryEntry) error {
+		got = e
+		return errors.New("replay failed")
 	}
-	if got != "aws ecs ... one" {
-		t.Fatalf("expected first item, got %q", got)
+	cmd := historyExec{entry: cmdEntry("ls")}
+	cmd.SetStdin(nil)
+	cmd.SetStdout(nil)
+	cmd.SetStderr(nil)
+	if err := cmd.Run(); err == nil || got.Command != "ls" {
+		t.Fatalf("err=%v entry=%+v", err, got)
 	}
-}
 
-func TestMmWasMouseClick(t *testing.T) {
-	t.Parallel()
-	if mmWasMouseClick(menuModel{}) {
-		t.Fatal("default menuModel should report no click")
-	}
-	if !mmWasMouseClick(menuModel{mouseClicked: true}) {
-		t.Fatal("mouseClicked=true should report click")
+	m := initialModel("", []string{"a"}, "", false)
+	if _, next := m.Update(historyDoneMsg{err: errors.New("boom")}); next == nil {
+		t.Fatal("finishing a replay should redraw the menu")
 	}
 }
@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// defaultLogsSince is how far back `logs` starts when -since isn't given.
+const defaultLogsSince = 10 * time.Minute
+
+// filterLogStreamsMax is the most stream names FilterLogEvents accepts.
+const filterLogStreamsMax = 100
+
+// logsPollInterval paces -follow, swapped out in tests. Following polls
+// FilterLogEvents rather than using StartLiveTail: live tail sessions end
+// after three hours and are billed by the minute, and polling needs nothing
+// beyond logs:FilterLogEvents.
+var logsPollInterval = 2 * time.Second
+
+// LogsECS is the part of the ECS API `logs` uses.
+type LogsECS interface {
+	ecsTaskLister
+	ecsTaskDescriber
+	DescribeTaskDefinition(ctx context.Context, params *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error)
+}
+
+// CloudWatchLogs is the part of the CloudWatch Logs API `logs` uses.
+type CloudWatchLogs interface {
+	FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error)
+}
+
+// LogsClients are the AWS APIs `logs` calls. Logs returns a client for a
+// region, since awslogs-region may put a log group outside the task's.
+type LogsClients struct {
+	ECS  LogsECS
+	Logs func(region string) CloudWatchLogs
+}
+
+// NewLogsClients is NewECSClient for `logs`.
+func NewLogsClients(cfg aws.Config, region string) LogsClients {
+	return LogsClients{
+		ECS: ecs.NewFromConfig(cfg, func(o *ecs.Options) { o.Region = region }),
+		Logs: func(region string) CloudWatchLogs {
+			return cloudwatchlogs.NewFromConfig(cfg, func(o *cloudwatchlogs.Options) { o.Region = region })
+		},
+	}
+}
+
+// LogSource is the awslogs stream of one container in one task.
+type LogSource struct {
+	Task      string
+	Container string
+	Region    string
+	Group     string
+	Stream    string
+}
+
+// LogsOptions controls TailLogs.
+type LogsOptions struct {
+	// Since is how far back to start (0 means defaultLogsSince).
+	Since time.Duration
+	// Grep is a CloudWatch Logs filter pattern; plain text matches as a
+	// phrase.
+	Grep string
+	// Follow keeps polling for new events until ctx is cancelled.
+	Follow bool
+	// Stdout receives the events. nil means os.Stdout.
+	Stdout io.Writer
+}
+
+// ResolveLogSources finds the awslogs stream of state's container: in
+// state's task, or with allTasks in every task of state's service.
+func ResolveLogSources(ctx context.Context, c *Cli, client LogsECS, state State, allTasks bool) ([]LogSource, error) {
+	arns := []string{state.TaskArn}
+	if allTasks {
+		if state.Service == "" || IsPseudoService(state.Service) {
+			return nil, fmt.Errorf("-all-tasks follows the tasks of one service; choose a service rather than standalone or all tasks")
+		}
+		c.LogAWSCommand("ecs", "list-tasks", "--cluster", state.ClusterArn, "--service-name", state.Service, "--profile", c.Profile, "--region", state.Region)
+		var err error
+		if arns, err = listAllTaskArns(ctx, client, state.ClusterArn, state.Service); err != nil {
+			return nil, fmt.Errorf("list tasks: %w", err)
+		}
+		if len(arns) == 0 {
+			return nil, fmt.Errorf("no running task in service %s", displayTail(state.Service))
+		}
+	}
+
+	c.LogAWSCommand("ecs", "describe-tasks", "--cluster", state.ClusterArn, "--tasks", strings.Join(arns, " "), "--profile", c.Profile, "--region", state.Region)
+	tasks, err := describeAllTasks(ctx, client, state.ClusterArn, arns)
+	if err != nil {
+		return nil, fmt.Errorf("describe tasks: %w", err)
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("task %s not found", displayTail(state.TaskArn))
+	}
+	// Tasks mid-deployment may run two revisions; describe each once.
+	defs := map[string]*ecstypes.TaskDefinition{}
+	sources := make([]LogSource, 0, len(tasks))
+	for _, task := range tasks {
+		arn := aws.ToString(task.TaskDefinitionArn)
+		def, ok := defs[arn]
+		if !ok {
+			c.LogAWSCommand("ecs", "describe-task-definition", "--task-definition", arn, "--profile", c.Profile, "--region", state.Region)
+			out, err := client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: task.TaskDefinitionArn})
+			if err != nil {
+				return nil, fmt.Errorf("describe task definition: %w", err)
+			}
+			def, defs[arn] = out.TaskDefinition, out.TaskDefinition
+		}
+		src, err := logSource(task, def, state.Container, state.Region)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// logSource derives where awslogs writes container's output in task:
+// the stream is <awslogs-stream-prefix>/<container>/<task ID>.
+func logSource(task ecstypes.Task, def *ecstypes.TaskDefinition, container, region string) (LogSource, error) {
+	var cd *ecstypes.ContainerDefinition
+	if def != nil {
+		for i := range def.ContainerDefinitions {
+			if aws.ToString(def.ContainerDefinitions[i].Name) == container {
+				cd = &def.ContainerDefinitions[i]
+			}
+		}
+	}
+	if cd == nil {
+		return LogSource{}, fmt.Errorf("container %s is not in task definition %s", container, displayTail(aws.ToString(task.TaskDefinitionArn)))
+	}
+	lc := cd.LogConfiguration
+	if lc == nil || lc.LogDriver != ecstypes.LogDriverAwslogs {
+		return LogSource{}, unsupportedLogDriver(container, lc)
+	}
+	group := lc.Options["awslogs-group"]
+	if group == "" {
+		return LogSource{}, fmt.Errorf("container %s uses awslogs without awslogs-group", container)
+	}
+	prefix := lc.Options["awslogs-stream-prefix"]
+	if prefix == "" {
+		return LogSource{}, fmt.Errorf("container %s uses awslogs without awslogs-stream-prefix, so its streams are named after Docker container IDs and can't be found from the task; set awslogs-stream-prefix in the task definition, or look in log group %s", container, group)
+	}
+	if r := lc.Options["awslogs-region"]; r != "" {
+		region = r
+	}
+	id := displayTail(aws.ToString(task.TaskArn))
+	return LogSource{
+		Task:      id,
+		Container: container,
+		Region:    region,
+		Group:     group,
+		Stream:    prefix + "/" + container + "/" + id,
+	}, nil
+}
+
+// unsupportedLogDriver explains why a container's logs can't be followed
+// and where they went instead.
+func unsupportedLogDriver(container string, lc *ecstypes.LogConfiguration) error {
+	if lc == nil {
+		return fmt.Errorf("container %s has no log configuration, so its output stays with the container runtime on the host; add an awslogs logConfiguration to the task definition to follow it here", container)
+	}
+	if lc.LogDriver == ecstypes.LogDriverAwsfirelens {
+		dest := "the output FireLens is configured with"
+		if name := lc.Options["Name"]; name != "" {
+			dest = "the " + name + " output"
+			if group := lc.Options["log_group_name"]; group != "" {
+				dest += " (log group " + group + ")"
+			}
+		}
+		return fmt.Errorf("container %s sends its logs through FireLens to %s; the log router names those streams, so exec-ecs can't follow them. Read them where FireLens delivers them, or switch the container to the awslogs driver", container, dest)
+	}
+	return fmt.Errorf("container %s uses the %s log driver; exec-ecs can only follow containers that use awslogs", container, lc.LogDriver)
+}
+
+// logFilterPattern turns -grep into a filter pattern. Text that already
+// looks like filter pattern syntax (JSON or space-delimited selectors,
+// quoted terms, ?alternatives, %regex%) is passed as it is; anything else
+// matches as a phrase.
+func logFilterPattern(grep string) string {
+	if grep == "" || strings.ContainsAny(grep[:1], `{["?%`) {
+		return grep
+	}
+	return `"` + strings.ReplaceAll(grep, `"`, `\"`) + `"`
+}
+
+// logPrefixColors tell tasks apart when several are followed at once.
+var logPrefixColors = []lipgloss.Color{"6", "3", "5", "2", "4", "1", "14", "11", "13", "10", "12", "9"}
+
+// TailLogs prints the events in sources from opts.Since ago, one line per
+// event, and with opts.Follow keeps printing new ones until ctx ends. With
+// several sources each line starts with its task and container, coloured
+// per task.
+func TailLogs(ctx context.Context, c *Cli, clients LogsClients, sources []LogSource, opts LogsOptions) error {
+	out := opts.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+	if opts.Since <= 0 {
+		opts.Since = defaultLogsSince
+	}
+
+	prefixes := map[string]string{}
+	if len(sources) > 1 {
+		for i, src := range sources {
+			style := lipgloss.NewStyle().Foreground(logPrefixColors[i%len(logPrefixColors)])
+			prefixes[src.Stream] = style.Render("["+src.Task+"/"+src.Container+"]") + " "
+		}
+	}
+	var mu sync.Mutex
+	emit := func(stream, message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = io.WriteString(out, prefixes[stream]+strings.TrimRight(message, "\r\n")+"\n")
+	}
+
+	// One poller per log group and batch of streams.
+	type batch struct {
+		region, group string
+		streams       []string
+	}
+	byGroup := map[[2]string][]string{}
+	for _, src := range sources {
+		key := [2]string{src.Region, src.Group}
+		byGroup[key] = append(byGroup[key], src.Stream)
+	}
+	var batches []batch
+	for key, streams := range byGroup {
+		for start := 0; start < len(streams); start += filterLogStreamsMax {
+			end := min(start+filterLogStreamsMax, len(streams))
+			batches = append(batches, batch{region: key[0], group: key[1], streams: streams[start:end]})
+		}
+	}
+	sort.Slice(batches, func(i, j int) bool { return batches[i].group < batches[j].group })
+
+	since := time.Now().Add(-opts.Since)
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = pollLogEvents(ctx, c, clients.Logs(b.region), b.region, b.group, b.streams, since, opts, emit)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pollLogEvents pages through the events of streams in group from since
+// on. Following, it asks again from the newest timestamp seen; events at
+// that timestamp come back each time, so their IDs are remembered to skip
+// them.
+func pollLogEvents(ctx context.Context, c *Cli, client CloudWatchLogs, region, group string, streams []string, since time.Time, opts LogsOptions, emit func(stream, message string)) error {
+	args := []string{"filter-log-events", "--log-group-name", group, "--log-stream-names"}
+	args = append(args, streams...)
+	args = append(args, "--start-time", fmt.Sprint(since.UnixMilli()))
+	pattern := logFilterPattern(opts.Grep)
+	if pattern != "" {
+		args = append(args, "--filter-pattern", pattern)
+	}
+	c.LogAWSCommand("logs", append(args, "--profile", c.Profile, "--region", region)...)
+
+	start := since.UnixMilli()
+	seen := map[string]int64{}
+	for {
+		newest := start
+		input := &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:   aws.String(group),
+			LogStreamNames: streams,
+			StartTime:      aws.Int64(start),
+		}
+		if pattern != "" {
+			input.FilterPattern = aws.String(pattern)
+		}
+		for {
+			out, err := client.FilterLogEvents(ctx, input)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("read log group %s: %w", group, err)
+			}
+			for _, e := range out.Events {
+				id, ts := aws.ToString(e.EventId), aws.ToInt64(e.Timestamp)
+				if _, dup := seen[id]; dup {
+					continue
+				}
+				seen[id] = ts
+				if ts > newest {
+					newest = ts
+				}
+				emit(aws.ToString(e.LogStreamName), aws.ToString(e.Message))
+			}
+			if aws.ToString(out.NextToken) == "" {
+				break
+			}
+			input.NextToken = out.NextToken
+		}
+		if !opts.Follow {
+			return nil
+		}
+
+		start = newest
+		for id, ts := range seen {
+			if ts < start {
+				delete(seen, id)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logsPollInterval):
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// fakeLogsECS serves tasks and one task definition per ARN.
+type fakeLogsECS struct {
+	fakeECS
+	defs     map[string]ecstypes.TaskDefinition
+	defCalls int
+}
+
+func (f *fakeLogsECS) DescribeTaskDefinition(_ context.Context, in *ecs.DescribeTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+	f.defCalls++
+	def := f.defs[aws.ToString(in.TaskDefinition)]
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &def}, nil
+}
+
+// fakeLogs returns one scripted response per FilterLogEvents call and
+// records the inputs.
+type fakeLogs struct {
+	pages  []*cloudwatchlogs.FilterLogEventsOutput
+	inputs []cloudwatchlogs.FilterLogEventsInput
+	// onEmpty runs once the pages are used up, e.g. to end -follow.
+	onEmpty func()
+}
+
+func (f *fakeLogs) FilterLogEvents(_ context.Context, in *cloudwatchlogs.FilterLogEventsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	f.inputs = append(f.inputs, *in)
+	if len(f.pages) == 0 {
+		if f.onEmpty != nil {
+			f.onEmpty()
+		}
+		return &cloudwatchlogs.FilterLogEventsOutput{}, nil
+	}
+	page := f.pages[0]
+	f.pages = f.pages[1:]
+	return page, nil
+}
+
+func logEvent(id string, ts int64, stream, msg string) cwltypes.FilteredLogEvent {
+	return cwltypes.FilteredLogEvent{EventId: aws.String(id), Timestamp: aws.Int64(ts), LogStreamName: aws.String(stream), Message: aws.String(msg)}
+}
+
+func awslogsDef(arn string, options map[string]string) ecstypes.TaskDefinition {
+	return ecstypes.TaskDefinition{
+		TaskDefinitionArn: aws.String(arn),
+		ContainerDefinitions: []ecstypes.ContainerDefinition{
+			{Name: aws.String("envoy")},
+			{Name: aws.String("app"), LogConfiguration: &ecstypes.LogConfiguration{LogDriver: ecstypes.LogDriverAwslogs, Options: options}},
+		},
+	}
+}
+
+func TestResolveLogSources(t *testing.T) {
+	t.Parallel()
+
+	task := func(id, def string) ecstypes.Task {
+		return ecstypes.Task{TaskArn: aws.String("arn:aws:ecs:eu-west-1:1:task/web/" + id), TaskDefinitionArn: aws.String(def)}
+	}
+	f := &fakeLogsECS{
+		fakeECS: fakeECS{describeTasks: []ecstypes.Task{task("aaa", "api:7"), task("bbb", "api:7")}, tasksPages: [][]string{{"aaa", "bbb"}}},
+		defs: map[string]ecstypes.TaskDefinition{
+			"api:7": awslogsDef("api:7", map[string]string{"awslogs-group": "/ecs/api", "awslogs-stream-prefix": "ecs", "awslogs-region": "us-east-1"}),
+		},
+	}
+	state := State{Region: "eu-west-1", ClusterArn: "web", Service: "api", TaskArn: "aaa", Container: "app"}
+	sources, err := ResolveLogSources(context.Background(), &Cli{}, f, state, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LogSource{Task: "aaa", Container: "app", Region: "us-east-1", Group: "/ecs/api", Stream: "ecs/app/aaa"}
+	if len(sources) != 2 || sources[0] != want || sources[1].Stream != "ecs/app/bbb" {
+		t.Fatalf("sources = %+v", sources)
+	}
+	if f.defCalls != 1 {
+		t.Fatalf("described the task definition %d times", f.defCalls)
+	}
+
+	state.Service = StandaloneTasksService
+	if _, err := ResolveLogSources(context.Background(), &Cli{}, f, state, true); err == nil {
+		t.Fatal("-all-tasks needs a service")
+	}
+}
+
+func TestLogSourceExplainsOtherDrivers(t *testing.T) {
+	t.Parallel()
+
+	task := ecstypes.Task{TaskArn: aws.String("arn:aws:ecs:eu-west-1:1:task/web/aaa"), TaskDefinitionArn: aws.String("api:7")}
+	withLogs := func(lc *ecstypes.LogConfiguration) *ecstypes.TaskDefinition {
+		return &ecstypes.TaskDefinition{ContainerDefinitions: []ecstypes.ContainerDefinition{{Name: aws.String("app"), LogConfiguration: lc}}}
+	}
+	cases := []struct {
+		name string
+		def  *ecstypes.TaskDefinition
+		want string
+	}{
+		{"firelens", withLogs(&ecstypes.LogConfiguration{LogDriver: ecstypes.LogDriverAwsfirelens, Options: map[string]string{"Name": "cloudwatch_logs", "log_group_name": "/firelens/api"}}),
+			"through FireLens to the cloudwatch_logs output (log group /firelens/api)"},
+		{"splunk", withLogs(&ecstypes.LogConfiguration{LogDriver: ecstypes.LogDriverSplunk}), "uses the splunk log driver"},
+		{"none", withLogs(nil), "has no log configuration"},
+		{"no prefix", withLogs(&ecstypes.LogConfiguration{LogDriver: ecstypes.LogDriverAwslogs, Options: map[string]string{"awslogs-group": "/ecs/api"}}), "without awslogs-stream-prefix"},
+		{"no container", withLogs(nil), "container worker is not in task definition api:7"},
+	}
+	for _, tc := range cases {
+		container := "app"
+		if tc.name == "no container" {
+			container = "worker"
+		}
+		if _, err := logSource(task, tc.def, container, "eu-west-1"); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+}
+
+func TestLogFilterPattern(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"":                           "",
+		"connection refused":         `"connection refused"`,
+		`say "hi"`:                   `"say \"hi\""`,
+		`{ $.level = "error" }`:      `{ $.level = "error" }`,
+		"?ERROR ?WARN":               "?ERROR ?WARN",
+		"%[0-9]{3} ms%":              "%[0-9]{3} ms%",
+		`[ip, user, status = 5*]`:    `[ip, user, status = 5*]`,
+		`"already quoted" -excluded`: `"already quoted" -excluded`,
+	}
+	for in, want := range cases {
+		if got := logFilterPattern(in); got != want {
+			t.Errorf("logFilterPattern(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTailLogsFollowsWithoutRepeats(t *testing.T) {
+	prev := logsPollInterval
+	t.Cleanup(func() { logsPollInterval = prev })
+	logsPollInterval = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now().UnixMilli()
+	logs := &fakeLogs{
+		pages: []*cloudwatchlogs.FilterLogEventsOutput{
+			{Events: []cwltypes.FilteredLogEvent{logEvent("1", now-300, "ecs/app/aaa", "booting\n")}, NextToken: aws.String("p2")},
+			{Events: []cwltypes.FilteredLogEvent{logEvent("2", now-200, "ecs/app/bbb", "ready")}},
+			// The next poll starts at event 2's timestamp and sees it again.
+			{Events: []cwltypes.FilteredLogEvent{logEvent("2", now-200, "ecs/app/bbb", "ready"), logEvent("3", now-150, "ecs/app/aaa", "GET /health")}},
+		},
+		onEmpty: cancel,
+	}
+	sources := []LogSource{
+		{Task: "aaa", Container: "app", Region: "eu-west-1", Group: "/ecs/api", Stream: "ecs/app/aaa"},
+		{Task: "bbb", Container: "app", Region: "eu-west-1", Group: "/ecs/api", Stream: "ecs/app/bbb"},
+	}
+	var out bytes.Buffer
+	clients := LogsClients{Logs: func(region string) CloudWatchLogs { return logs }}
+	err := TailLogs(ctx, &Cli{}, clients, sources, LogsOptions{Since: time.Hour, Grep: "GET", Follow: true, Stdout: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[aaa/app] booting\n[bbb/app] ready\n[aaa/app] GET /health\n"
+	if out.String() != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+	first := logs.inputs[0]
+	if aws.ToString(first.LogGroupName) != "/ecs/api" || len(first.LogStreamNames) != 2 || aws.ToString(first.FilterPattern) != `"GET"` {
+		t.Fatalf("first input = %+v", first)
+	}
+	if aws.ToString(logs.inputs[1].NextToken) != "p2" || aws.ToInt64(logs.inputs[2].StartTime) != now-200 || aws.ToInt64(logs.inputs[3].StartTime) != now-150 {
+		t.Fatalf("paging and start times: %+v", logs.inputs)
+	}
+}
+
+func TestTailLogsSingleSourceHasNoPrefix(t *testing.T) {
+	t.Parallel()
+
+	logs := &fakeLogs{pages: []*cloudwatchlogs.FilterLogEventsOutput{
+		{Events: []cwltypes.FilteredLogEvent{logEvent("1", 100, "ecs/app/aaa", "hello\r\n")}},
+	}}
+	var out bytes.Buffer
+	clients := LogsClients{Logs: func(string) CloudWatchLogs { return logs }}
+	src := []LogSource{{Task: "aaa", Container: "app", Group: "/ecs/api", Stream: "ecs/app/aaa"}}
+	if err := TailLogs(context.Background(), &Cli{}, clients, src, LogsOptions{Stdout: &out}); err != nil || out.String() != "hello\n" {
+		t.Fatalf("out=%q err=%v", out.String(), err)
+	}
+	if len(logs.inputs) != 1 {
+		t.Fatalf("without -follow it reads once, read %d times", len(logs.inputs))
+	}
+	if start := time.UnixMilli(aws.ToInt64(logs.inputs[0].StartTime)); time.Since(start) < defaultLogsSince-time.Minute {
+		t.Fatalf("start = %s", start)
+	}
+}
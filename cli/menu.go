@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -36,7 +35,6 @@ type menuModel struct {
 	textInput        textinput.Model
 	filterMode       bool
 	page             int
-	historyMode      bool
 	goBackTriggered  bool
 	showGoBack       bool
 	loading          bool
@@ -45,6 +43,9 @@ type menuModel struct {
 	loadCmd          tea.Cmd
 	loadErr          error
 	autoSelectSingle bool
+	// table, when set, renders items as aligned columns with a header and
+	// enables s/S sorting; choice is mapped back to the row's key.
+	table *menuTable
 
 	// Animation state for Matrix theme
 	frame      int
@@ -71,6 +72,7 @@ type menuModel struct {
 type tickMsg time.Time
 type loadItemsMsg struct {
 	items []string
+	table *menuTable
 	err   error
 }
 
@@ -166,6 +168,16 @@ func (m menuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 		m.loading = false
+		if msg.table != nil {
+			m.table = msg.table
+			msg.items = m.table.lines()
+			m.defaultSelected = m.table.lineFor(m.defaultSelected)
+			if m.hasDetails() && m.height > 0 {
+				// The window size came while loading; make room for the pane.
+				m.itemsPerPage = m.pageSize(m.height - 8)
+				m.viewport.Height = m.itemsPerPage + 2
+			}
+		}
 		m.items = msg.items
 		m.filteredItems = msg.items
 		if m.autoSelectSingle && len(msg.items) == 1 {
@@ -183,6 +195,11 @@ func (m menuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 		return m, textinput.Blink
+	case historyDoneMsg:
+		if msg.err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", msg.err)
+		}
+		return m, tea.ClearScreen
 	case tea.KeyMsg:
 		key := msg.String()
 		if m.loading {
@@ -245,6 +262,18 @@ func (m menuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.textInput.Focus()
 			return m, textinput.Blink
 
+		case "s", "S":
+			if m.table != nil {
+				if key == "s" {
+					m.table.nextSort()
+				} else {
+					m.table.reverse()
+				}
+				m.items = m.table.lines()
+				m.filterItems(m.textInput.Value())
+			}
+			return m, nil
+
 		case "esc":
 			// If this is theme selection and user hits esc, restore original theme
 			if m.isThemeSelection && m.originalTheme != nil {
@@ -314,25 +343,16 @@ func (m menuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 		case "ctrl+h":
-			if m.historyMode || historyMenuOpen {
+			if historyMenuOpen {
 				return m, nil
 			}
 			historyMenuOpen = true
-			history := GetLastUniqueHistory(5)
-			if len(history) == 0 {
-				historyMenuOpen = false
-				return m, nil
-			}
-			selected, err := BubbleteaHistorySelect("Command History (last 5 unique)", history)
+			selected, ok, err := BrowseHistory("")
 			historyMenuOpen = false
-			if err == nil && selected != "" {
-				fmt.Println("\nExecuting:", selected)
-				cmd := exec.Command("sh", "-c", selected)
-				cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
-				cmd.Stdin = os.Stdin
-				_ = cmd.Run()
-			}
 			m.reset()
+			if err == nil && ok && HistoryReplayer != nil {
+				return m, tea.Exec(historyExec{entry: selected}, func(err error) tea.Msg { return historyDoneMsg{err: err} })
+			}
 			return m, tea.ClearScreen
 		case "ctrl+t":
 			themeNames := GetThemeNames()
@@ -362,6 +382,9 @@ func (m menuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.filterMode {
 				itemIndex-- // extra line for filter input
 			}
+			if m.table != nil {
+				itemIndex-- // column header
+			}
 			start := m.page * m.itemsPerPage
 			end := min(start+m.itemsPerPage, len(m.filteredItems))
 			if itemIndex >= 0 && itemIndex < end-start {
@@ -409,6 +432,9 @@ func (m menuModel) View() string {
 		s.WriteString("\n")
 		s.WriteString(CurrentTheme.FilterStyle.Render("Filter: " + m.textInput.View()))
 	}
+	if m.table != nil {
+		s.WriteString("\n" + m.tableHeader())
+	}
 
 	start := m.page * m.itemsPerPage
 	end := min(start+m.itemsPerPage, len(m.filteredItems))
@@ -427,16 +453,15 @@ func (m menuModel) View() string {
 		s.WriteString(fmt.Sprintf("\nPage %d/%d", m.page+1, (len(m.filteredItems)-1)/m.itemsPerPage+1))
 	}
 
-	if m.historyMode {
-		help := "\nTo go back press esc key"
-		s.WriteString(CurrentTheme.HelpStyle.Render(help))
-		return s.String()
-	}
+	s.WriteString(m.detailPane())
 
 	help := "\n↑↓ Move • Enter Select • / Filter • q Quit • esc/ctrl+b Back • ctrl+h History"
 	if !m.showGoBack {
 		help = "\n↑↓ Move • Enter Select • / Filter • q Quit • ctrl+h History"
 	}
+	if m.table != nil {
+		help += " • s/S Sort"
+	}
 	if m.filterMode {
 		help = "\nEsc: Exit Filter • Enter Apply Filter"
 	}
@@ -502,7 +527,7 @@ func (m ideModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		availableHeight := effectiveHeight - 8
-		itemsPerPage := max(5, min(availableHeight, 20))
+		itemsPerPage := m.menu.pageSize(availableHeight)
 
 		m.menu.width = msg.Width
 		m.menu.height = effectiveHeight
@@ -545,6 +570,9 @@ func (m menuModel) menuViewOnly() string {
 		s.WriteString(CurrentTheme.FilterStyle.Render("Filter: " + m.textInput.View()))
 		s.WriteString("\n") // Add a newline after filter input so border/items always align
 	}
+	if m.table != nil {
+		s.WriteString(m.tableHeader() + "\n")
+	}
 	// Items with per-theme effects
 	start := m.page * m.itemsPerPage
 	end := min(start+m.itemsPerPage, len(m.filteredItems))
@@ -568,6 +596,7 @@ func (m menuModel) menuViewOnly() string {
 			s.WriteString("\n")
 		}
 		s.WriteString(mazeBottom + "\n")
+		s.WriteString(m.detailPane())
 		return s.String()
 	}
 	if CurrentTheme.Name == "Matrix" {
@@ -585,6 +614,7 @@ func (m menuModel) menuViewOnly() string {
 		}
 		s.WriteString(codeRainBottom + "\n")
 		s.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#00ff41")).Render("  ᚠᚮᛚᛚᚮᚡ Þᛂ ᚡᛡᛁᛐᛂ ᚱᛆᛒᛒᛁᛐ  "))
+		s.WriteString(m.detailPane())
 		return s.String()
 	}
 	for i := start; i < end; i++ {
@@ -604,8 +634,50 @@ func (m menuModel) menuViewOnly() string {
 	if len(m.filteredItems) > m.itemsPerPage {
 		s.WriteString(fmt.Sprintf("\nPage %d/%d", m.page+1, (len(m.filteredItems)-1)/m.itemsPerPage+1))
 	}
-	if m.historyMode {
-		s.WriteString(CurrentTheme.HelpStyle.Render("\nEsc Back"))
+	s.WriteString(m.detailPane())
+	return s.String()
+}
+
+// detailRows is how many rows the detail pane takes, its rule included.
+const detailRows = 9
+
+// hasDetails reports whether the menu shows a detail pane under its rows.
+func (m menuModel) hasDetails() bool {
+	return m.table != nil && m.table.details != nil
+}
+
+// pageSize is how many rows fit in available lines once the detail pane,
+// if any, has its share.
+func (m menuModel) pageSize(available int) int {
+	if m.hasDetails() {
+		available -= detailRows
+	}
+	return max(5, min(available, 20))
+}
+
+// detailPane renders the highlighted row's detail text below a rule, cut
+// to the pane's height and the menu's width.
+func (m menuModel) detailPane() string {
+	if !m.hasDetails() {
+		return ""
+	}
+	idx := m.page*m.itemsPerPage + m.cursor
+	if idx >= len(m.filteredItems) {
+		return ""
+	}
+	width := m.contentWidth()
+	var s strings.Builder
+	s.WriteString("\n" + lipgloss.NewStyle().Foreground(CurrentTheme.MainBorder).Render(strings.Repeat("─", width)) + "\n")
+	detail := m.table.detailFor(m.filteredItems[idx])
+	if detail == "" {
+		return s.String()
+	}
+	lines := strings.Split(detail, "\n")
+	for _, line := range lines[:min(len(lines), detailRows-1)] {
+		if r := []rune(line); len(r) > width {
+			line = string(r[:width-1]) + "…"
+		}
+		s.WriteString(CurrentTheme.ItemStyle.Render(line) + "\n")
 	}
 	return s.String()
 }
@@ -620,6 +692,11 @@ func (m menuModel) menuHeader() string {
 		Foreground(CurrentTheme.TitleFg).
 		Bold(true).
 		Render(m.label)
+	if env, ok := environmentStyle(CurrentEnvironment); ok {
+		// A classified target recolours the title bar, whatever the theme.
+		title = env.Render(m.label)
+		app = env.Render("exec-ecs · " + strings.ToUpper(CurrentEnvironment))
+	}
 
 	var s strings.Builder
 	if width > 32 {
@@ -645,6 +722,9 @@ func (m menuModel) breadcrumbLine() string {
 		Foreground(CurrentTheme.StatusFg).
 		Background(CurrentTheme.StatusBg).
 		Padding(0, 1)
+	if env, ok := environmentStyle(CurrentEnvironment); ok {
+		crumbStyle = env.Bold(false)
+	}
 	sepStyle := lipgloss.NewStyle().
 		Foreground(CurrentTheme.MainBorder)
 
@@ -711,6 +791,9 @@ func (m menuModel) menuHelpOnly() string {
 	}
 
 	if m.filterMode {
+		if m.table != nil {
+			return "Esc exits filter  Enter applies filter  column:value narrows one column"
+		}
 		return "Esc exits filter  Enter applies filter"
 	}
 	if m.loading {
@@ -719,8 +802,8 @@ func (m menuModel) menuHelpOnly() string {
 		}
 		return "Loading  q Quit"
 	}
-	if m.historyMode {
-		return "Esc Back"
+	if m.table != nil {
+		defaultShortcuts = "s Sort  S Reverse  " + defaultShortcuts
 	}
 	custom := CurrentTheme.HelpHint
 	if custom != "" {
@@ -737,6 +820,12 @@ func (m *menuModel) filterItems(filter string) {
 	}
 	filtered := make([]string, 0)
 	for _, item := range m.items {
+		if m.table != nil {
+			if m.table.matches(item, filter) {
+				filtered = append(filtered, item)
+			}
+			continue
+		}
 		if strings.Contains(strings.ToLower(item), strings.ToLower(filter)) {
 			filtered = append(filtered, item)
 		}
@@ -747,6 +836,11 @@ func (m *menuModel) filterItems(filter string) {
 	m.clampSelection()
 }
 
+// tableHeader renders the column titles, indented to line up with the rows.
+func (m menuModel) tableHeader() string {
+	return lipgloss.NewStyle().Foreground(CurrentTheme.TitleFg).Bold(true).Render("  " + m.table.header())
+}
+
 func (m *menuModel) clampSelection() {
 	if m.itemsPerPage <= 0 {
 		m.itemsPerPage = defaultItemsPerPage
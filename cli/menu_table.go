@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// menuTable lets the picker show rows of columns instead of plain strings.
+// The menu still works on one string per row (the aligned line), so paging,
+// cursor handling and the filter box are shared with ordinary pickers; the
+// table adds a header, per-column sorting and `column:value` filters, and
+// maps the chosen line back to its key.
+type menuTable struct {
+	headers []string
+	cells   [][]string
+	// sortBy holds per-cell sort keys where display order differs from
+	// string order (ages, for instance). A nil row uses the cells.
+	sortBy  [][]string
+	keys    []string
+	sortCol int // -1 keeps the order the rows were loaded in
+	desc    bool
+	// details holds optional per-row text the menu shows below the rows
+	// for the highlighted one.
+	details []string
+
+	order  []int
+	widths []int
+	lineOf []string
+	byLine map[string]int
+}
+
+func newMenuTable(headers []string, cells, sortBy [][]string, keys []string) *menuTable {
+	t := &menuTable{headers: headers, cells: cells, sortBy: sortBy, keys: keys, sortCol: -1}
+	t.widths = make([]int, len(headers))
+	for i, h := range headers {
+		t.widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, row := range cells {
+		for i, cell := range row {
+			t.widths[i] = max(t.widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	t.lineOf = make([]string, len(cells))
+	t.byLine = make(map[string]int, len(cells))
+	for i, row := range cells {
+		t.lineOf[i] = t.format(row)
+		if _, dup := t.byLine[t.lineOf[i]]; !dup {
+			t.byLine[t.lineOf[i]] = i
+		}
+	}
+	t.resort()
+	return t
+}
+
+func (t *menuTable) format(row []string) string {
+	parts := make([]string, len(row))
+	for i, cell := range row {
+		parts[i] = cell + strings.Repeat(" ", t.widths[i]-utf8.RuneCountInString(cell))
+	}
+	return strings.TrimRight(strings.Join(parts, "  "), " ")
+}
+
+// header renders the column titles, marking the sort column.
+func (t *menuTable) header() string {
+	row := make([]string, len(t.headers))
+	copy(row, t.headers)
+	if t.sortCol >= 0 {
+		arrow := "▲"
+		if t.desc {
+			arrow = "▼"
+		}
+		row[t.sortCol] += arrow
+	}
+	// The arrow may push a title past its column; widen for the header only.
+	parts := make([]string, len(row))
+	for i, cell := range row {
+		parts[i] = cell + strings.Repeat(" ", max(0, t.widths[i]-utf8.RuneCountInString(cell)))
+	}
+	return strings.TrimRight(strings.Join(parts, "  "), " ")
+}
+
+// lines returns the rows in display order.
+func (t *menuTable) lines() []string {
+	out := make([]string, len(t.order))
+	for i, idx := range t.order {
+		out[i] = t.lineOf[idx]
+	}
+	return out
+}
+
+// nextSort moves sorting to the next column, wrapping back to load order.
+func (t *menuTable) nextSort() {
+	t.sortCol++
+	if t.sortCol >= len(t.headers) {
+		t.sortCol = -1
+	}
+	t.desc = false
+	t.resort()
+}
+
+// reverse flips the sort direction.
+func (t *menuTable) reverse() {
+	t.desc = !t.desc
+	t.resort()
+}
+
+func (t *menuTable) sortKey(row, col int) string {
+	if row < len(t.sortBy) && t.sortBy[row] != nil {
+		return t.sortBy[row][col]
+	}
+	return strings.ToLower(t.cells[row][col])
+}
+
+func (t *menuTable) resort() {
+	t.order = make([]int, len(t.cells))
+	for i := range t.order {
+		t.order[i] = i
+	}
+	if t.sortCol < 0 {
+		if t.desc {
+			for i, j := 0, len(t.order)-1; i < j; i, j = i+1, j-1 {
+				t.order[i], t.order[j] = t.order[j], t.order[i]
+			}
+		}
+		return
+	}
+	sort.SliceStable(t.order, func(a, b int) bool {
+		ka, kb := t.sortKey(t.order[a], t.sortCol), t.sortKey(t.order[b], t.sortCol)
+		if t.desc {
+			return ka > kb
+		}
+		return ka < kb
+	})
+}
+
+// keyFor maps a rendered line back to its row's key.
+func (t *menuTable) keyFor(line string) string {
+	if i, ok := t.byLine[line]; ok {
+		return t.keys[i]
+	}
+	return line
+}
+
+// withDetails attaches per-row detail text, in load order.
+func (t *menuTable) withDetails(details []string) *menuTable {
+	t.details = details
+	return t
+}
+
+// detailFor is the detail text of a rendered line's row.
+func (t *menuTable) detailFor(line string) string {
+	if i, ok := t.byLine[line]; ok && i < len(t.details) {
+		return t.details[i]
+	}
+	return ""
+}
+
+// lineFor maps a key to its rendered line, for preselecting a row.
+func (t *menuTable) lineFor(key string) string {
+	for i, k := range t.keys {
+		if k == key {
+			return t.lineOf[i]
+		}
+	}
+	return ""
+}
+
+// matches reports whether line passes filter. `column:value` tokens (the
+// column title, lower case, without spaces) match within that column; any
+// other word may match in any column. Every token must match.
+func (t *menuTable) matches(line, filter string) bool {
+	row, ok := t.byLine[line]
+	if !ok {
+		return strings.Contains(strings.ToLower(line), strings.ToLower(filter))
+	}
+	for _, tok := range strings.Fields(strings.ToLower(filter)) {
+		if col, value, ok := strings.Cut(tok, ":"); ok {
+			if i := t.column(col); i >= 0 {
+				if !strings.Contains(strings.ToLower(t.cells[row][i]), value) {
+					return false
+				}
+				continue
+			}
+		}
+		if !strings.Contains(strings.ToLower(t.lineOf[row]), tok) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *menuTable) column(name string) int {
+	for i, h := range t.headers {
+		if strings.ReplaceAll(strings.ToLower(h), " ", "") == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleTable() *menuTable {
+	return newMenuTable(
+		[]string{"NAME", "ZONE"},
+		[][]string{{"web", "eu-1b"}, {"api", "eu-1a"}, {"worker", "eu-1a"}},
+		nil,
+		[]string{"k-web", "k-api", "k-worker"},
+	)
+}
+
+func TestMenuTableAlignsColumns(t *testing.T) {
+	t.Parallel()
+
+	tb := sampleTable()
+	want := []string{"web     eu-1b", "api     eu-1a", "worker  eu-1a"}
+	if got := tb.lines(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("lines = %q", got)
+	}
+	if got := tb.header(); got != "NAME    ZONE" {
+		t.Fatalf("header = %q", got)
+	}
+}
+
+func TestMenuTableSorts(t *testing.T) {
+	t.Parallel()
+
+	tb := sampleTable()
+	tb.nextSort()
+	if got := tb.lines()[0]; !strings.HasPrefix(got, "api") {
+		t.Fatalf("by name, first = %q", got)
+	}
+	if !strings.Contains(tb.header(), "NAME▲") {
+		t.Fatalf("header = %q", tb.header())
+	}
+	tb.reverse()
+	if got := tb.lines()[0]; !strings.HasPrefix(got, "worker") || !strings.Contains(tb.header(), "NAME▼") {
+		t.Fatalf("reversed: first = %q header = %q", got, tb.header())
+	}
+	// Sorting is stable, so ties keep load order.
+	tb.nextSort()
+	if got := tb.lines(); !strings.HasPrefix(got[0], "api") || !strings.HasPrefix(got[1], "worker") {
+		t.Fatalf("by zone = %q", got)
+	}
+	tb.nextSort()
+	if tb.sortCol != -1 || !strings.HasPrefix(tb.lines()[0], "web") {
+		t.Fatalf("should wrap to load order, col=%d", tb.sortCol)
+	}
+	tb.reverse()
+	if !strings.HasPrefix(tb.lines()[0], "worker") {
+		t.Fatalf("reversed load order = %q", tb.lines())
+	}
+}
+
+func TestMenuTableMatches(t *testing.T) {
+	t.Parallel()
+
+	tb := sampleTable()
+	line := tb.lineFor("k-api")
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"api", true},
+		{"API 1a", true},
+		{"zone:1a", true},
+		{"name:1a", false},
+		{"zone:1a api", true},
+		{"nope:api", false},
+	}
+	for _, tc := range tests {
+		if got := tb.matches(line, tc.filter); got != tc.want {
+			t.Errorf("matches(%q) = %v want %v", tc.filter, got, tc.want)
+		}
+	}
+	if !tb.matches("not a row", "row") {
+		t.Fatal("unknown lines fall back to substring matching")
+	}
+}
+
+func TestMenuTableKeys(t *testing.T) {
+	t.Parallel()
+
+	tb := sampleTable()
+	if got := tb.keyFor(tb.lineFor("k-worker")); got != "k-worker" {
+		t.Fatalf("round trip = %q", got)
+	}
+	if tb.lineFor("missing") != "" || tb.keyFor("other") != "other" {
+		t.Fatal("unknown keys and lines pass through")
+	}
+}
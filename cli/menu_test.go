@@ -384,10 +384,9 @@ func TestMenuModelViewHelp(t *testing.T) {
 	t.Parallel()
 	m := initialModel("pick", []string{"alpha"}, "", false)
 	m.itemsPerPage = 5
-	m.historyMode = true
 	out := m.View()
-	if out == "" {
-		t.Fatal("history-mode view should render help")
+	if !strings.Contains(out, "ctrl+h History") {
+		t.Fatalf("view should render help: %q", out)
 	}
 }
 
@@ -39,10 +39,13 @@ func EnsureConfigDir() error {
 	return os.MkdirAll(ConfigDir(), 0o700)
 }
 
-// historyPath / themePath / regionCacheFilePath centralise the on-disk layout
+// historyPath / themePath / auditPath / regionCacheFilePath centralise the on-disk layout
 // so any future move is a single-file change.
-func historyPath() string { return filepath.Join(ConfigDir(), "history") }
-func themePath() string   { return filepath.Join(ConfigDir(), "theme") }
+func historyPath() string       { return filepath.Join(ConfigDir(), "history.jsonl") }
+func legacyHistoryPath() string { return filepath.Join(ConfigDir(), "history") }
+func themePath() string         { return filepath.Join(ConfigDir(), "theme") }
+func auditPath() string         { return filepath.Join(ConfigDir(), "audit.jsonl") }
+func auditSpoolPath() string    { return filepath.Join(ConfigDir(), "audit-spool") }
 func regionCacheFilePath() string {
 	if v := os.Getenv("EXEC_ECS_REGION_CACHE_PATH"); v != "" {
 		return v
@@ -61,7 +64,7 @@ type legacyPath struct{ old, current string }
 func legacyPaths() []legacyPath {
 	h := homeDir()
 	return []legacyPath{
-		{filepath.Join(h, ".ecs_cli_history"), historyPath()},
+		{filepath.Join(h, ".ecs_cli_history"), legacyHistoryPath()},
 		{filepath.Join(h, ".ecs_cli_theme"), themePath()},
 		{filepath.Join(h, ".exec-ecs-region-cache.json"), regionCacheFilePath()},
 	}
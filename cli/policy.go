@@ -0,0 +1,302 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExitPolicyDenied is the exit status when the command policy refuses a
+// session (or a -policy-check finds it would).
+const ExitPolicyDenied = 3
+
+// Policy restricts which commands may be sent to which targets. It lives in
+// ConfigDir()/policy.yaml, or wherever `policy_file` in config.yaml points.
+//
+// Rules are tried in order against the target; the first rule that decides
+// wins. A rule decides when the command matches one of its deny patterns
+// (denied), one of its allow patterns (allowed), or when it has allow
+// patterns and the command matches none of them (denied). A rule with only
+// deny patterns that don't match passes the command on to the next rule.
+type Policy struct {
+	// Default decides commands no rule decides: "allow" (the default) or
+	// "deny".
+	Default string       `yaml:"default"`
+	Rules   []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule is one entry under `rules:`. Empty selectors match anything.
+// Selectors and command patterns are globs, where `*` also matches spaces
+// and slashes, or regular expressions when prefixed with `re:`. Either kind
+// has to match the whole value.
+type PolicyRule struct {
+	Name string `yaml:"name"`
+	// Environment is the target's class from config.yaml's environments.
+	Environment string   `yaml:"environment"`
+	Profile     string   `yaml:"profile"`
+	Cluster     string   `yaml:"cluster"`
+	Service     string   `yaml:"service"`
+	Container   string   `yaml:"container"`
+	Allow       []string `yaml:"allow"`
+	Deny        []string `yaml:"deny"`
+	// Message is shown when the rule denies a command.
+	Message string `yaml:"message"`
+
+	selectors []selector
+	allow     []*regexp.Regexp
+	deny      []*regexp.Regexp
+}
+
+type selector struct {
+	field string
+	re    *regexp.Regexp
+}
+
+// PolicyTarget is what a policy decision looks at.
+type PolicyTarget struct {
+	Environment string
+	Profile     string
+	Cluster     string
+	Service     string
+	Container   string
+	Command     string
+}
+
+// PolicyDecision is the outcome of Policy.Evaluate.
+type PolicyDecision struct {
+	Allowed bool
+	// Rule names the deciding rule, empty when the default decided.
+	Rule   string
+	Reason string
+}
+
+func (d PolicyDecision) verdict() string {
+	if d.Allowed {
+		return "allow"
+	}
+	return "deny"
+}
+
+// PolicyPath is where the policy is read from.
+func (c *Cli) PolicyPath() string {
+	if p := c.settings().PolicyFile; p != "" {
+		return expandHome(p)
+	}
+	return filepath.Join(ConfigDir(), "policy.yaml")
+}
+
+// LoadPolicy reads the policy file. A missing file means no policy (nil).
+// Unlike config.yaml, a policy that doesn't parse is an error the caller
+// must not ignore: a typo must not quietly lift the restrictions.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p *Policy) compile() error {
+	switch p.Default {
+	case "", "allow", "deny":
+	default:
+		return fmt.Errorf("default must be allow or deny, not %q", p.Default)
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("#%d", i+1)
+		}
+		for _, s := range []struct{ field, pattern string }{
+			{"environment", r.Environment}, {"profile", r.Profile}, {"cluster", r.Cluster},
+			{"service", r.Service}, {"container", r.Container},
+		} {
+			if s.pattern == "" {
+				continue
+			}
+			re, err := compilePolicyPattern(s.pattern)
+			if err != nil {
+				return fmt.Errorf("rule %s: %s: %w", r.Name, s.field, err)
+			}
+			r.selectors = append(r.selectors, selector{s.field, re})
+		}
+		var err error
+		if r.allow, err = compilePolicyPatterns(r.Allow); err != nil {
+			return fmt.Errorf("rule %s: allow: %w", r.Name, err)
+		}
+		if r.deny, err = compilePolicyPatterns(r.Deny); err != nil {
+			return fmt.Errorf("rule %s: deny: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func compilePolicyPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := compilePolicyPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+// compilePolicyPattern turns a glob, or a `re:` regular expression, into a
+// regexp anchored at both ends.
+func compilePolicyPattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		return regexp.Compile("^(?:" + expr + ")$")
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func (r *PolicyRule) appliesTo(t PolicyTarget) bool {
+	values := map[string]string{
+		"environment": t.Environment, "profile": t.Profile, "cluster": t.Cluster,
+		"service": t.Service, "container": t.Container,
+	}
+	for _, s := range r.selectors {
+		if !s.re.MatchString(values[s.field]) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate decides whether t.Command may be run on t. A nil policy allows
+// everything.
+func (p *Policy) Evaluate(t PolicyTarget) PolicyDecision {
+	if p == nil {
+		return PolicyDecision{Allowed: true, Reason: "no policy"}
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !r.appliesTo(t) {
+			continue
+		}
+		switch {
+		case matchesAny(r.deny, t.Command):
+			return PolicyDecision{Rule: r.Name, Reason: r.denial("the command matches a deny pattern")}
+		case matchesAny(r.allow, t.Command):
+			return PolicyDecision{Allowed: true, Rule: r.Name, Reason: "the command matches an allow pattern"}
+		case len(r.allow) > 0:
+			return PolicyDecision{Rule: r.Name, Reason: r.denial("the command matches none of the allowed patterns (" + strings.Join(r.Allow, ", ") + ")")}
+		}
+	}
+	if p.Default == "deny" {
+		return PolicyDecision{Reason: "no rule allows it and the policy denies by default"}
+	}
+	return PolicyDecision{Allowed: true, Reason: "no rule restricts it"}
+}
+
+func (r *PolicyRule) denial(why string) string {
+	if r.Message != "" {
+		return r.Message
+	}
+	return why
+}
+
+// checkPolicy evaluates the policy for a session and writes the decision
+// to the audit log, marked as a dry run under -policy-check.
+func (c *Cli) checkPolicy(ctx context.Context, opts ExecOptions) PolicyDecision {
+	t := PolicyTarget{
+		Environment: opts.Environment,
+		Profile:     c.Profile,
+		Cluster:     displayTail(opts.ClusterArn),
+		Service:     displayTail(opts.Service),
+		Container:   opts.Container,
+		Command:     opts.Command,
+	}
+	if IsPseudoService(opts.Service) {
+		t.Service = ""
+	}
+	d := c.Policy.Evaluate(t)
+	if c.Policy != nil {
+		c.appendAudit(ctx, AuditEvent{
+			Event:       AuditPolicy,
+			Profile:     c.Profile,
+			Region:      opts.Region,
+			Cluster:     opts.ClusterArn,
+			Service:     opts.Service,
+			Task:        opts.TaskArn,
+			Container:   opts.Container,
+			Command:     opts.Command,
+			Environment: opts.Environment,
+			Decision:    d.verdict(),
+			Rule:        d.Rule,
+			Reason:      d.Reason,
+			DryRun:      c.PolicyCheck,
+		})
+	}
+	return d
+}
+
+// policyCheckOutput receives -policy-check reports; swapped out in tests.
+var policyCheckOutput io.Writer = os.Stdout
+
+// decisionSource says which rule, or what else, decided.
+func decisionSource(d PolicyDecision) string {
+	if d.Rule == "" {
+		return d.Reason
+	}
+	return "rule " + d.Rule + ": " + d.Reason
+}
+
+// policyError explains a denial to the user.
+func policyError(opts ExecOptions, d PolicyDecision) error {
+	where := displayTail(opts.ClusterArn) + "/" + opts.Container
+	if d.Rule == "" {
+		return fmt.Errorf("policy denies %q in %s: %s", opts.Command, where, d.Reason)
+	}
+	return fmt.Errorf("policy rule %s denies %q in %s: %s", d.Rule, opts.Command, where, d.Reason)
+}
+
+// expandHome resolves a leading ~/ in paths from config.yaml.
+func expandHome(p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		return filepath.Join(homeDir(), rest)
+	}
+	return p
+}
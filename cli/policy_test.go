@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// setAuditFile points the audit log at a temp file for the test.
+func setAuditFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	prev := auditFile
+	auditFile = path
+	t.Cleanup(func() { auditFile = prev })
+	return path
+}
+
+func readAudit(t *testing.T, path string) []AuditEvent {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []AuditEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e AuditEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("bad audit line %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+const testPolicy = `
+rules:
+  - name: no-rm
+    deny: ["*rm -rf*"]
+  - name: prod-console
+    environment: prod
+    allow: ["bin/rails console --sandbox"]
+    message: Only sandboxed consoles are allowed in prod.
+  - name: staging-shells
+    environment: staging
+    container: "re:app|web"
+    allow: [bash, sh]
+`
+
+func loadTestPolicy(t *testing.T, yml string) *Policy {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(yml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	return p
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	t.Parallel()
+
+	p := loadTestPolicy(t, testPolicy)
+	cases := []struct {
+		target PolicyTarget
+		allow  bool
+		rule   string
+	}{
+		{PolicyTarget{Environment: EnvDev, Command: "bash"}, true, ""},
+		{PolicyTarget{Environment: EnvDev, Command: "sh -c 'rm -rf /tmp/x'"}, false, "no-rm"},
+		{PolicyTarget{Environment: EnvProd, Command: "bin/rails console --sandbox"}, true, "prod-console"},
+		{PolicyTarget{Environment: EnvProd, Command: "bash"}, false, "prod-console"},
+		{PolicyTarget{Environment: EnvStaging, Container: "app", Command: "bash"}, true, "staging-shells"},
+		{PolicyTarget{Environment: EnvStaging, Container: "app", Command: "python"}, false, "staging-shells"},
+		{PolicyTarget{Environment: EnvStaging, Container: "application", Command: "python"}, true, ""},
+	}
+	for _, tc := range cases {
+		d := p.Evaluate(tc.target)
+		if d.Allowed != tc.allow || d.Rule != tc.rule {
+			t.Errorf("Evaluate(%+v) = %+v, want allow=%v rule=%q", tc.target, d, tc.allow, tc.rule)
+		}
+	}
+	if d := p.Evaluate(PolicyTarget{Environment: EnvProd, Command: "bash"}); d.Reason != "Only sandboxed consoles are allowed in prod." {
+		t.Fatalf("denial should carry the rule's message, got %q", d.Reason)
+	}
+
+	strict := loadTestPolicy(t, "default: deny\nrules:\n  - allow: [date]\n")
+	if d := strict.Evaluate(PolicyTarget{Command: "date"}); !d.Allowed || d.Rule != "#1" {
+		t.Fatalf("unnamed rule: %+v", d)
+	}
+	if d := strict.Evaluate(PolicyTarget{Command: "bash"}); d.Allowed {
+		t.Fatal("a rule with an allow list denies what it doesn't list")
+	}
+	if d := (*Policy)(nil).Evaluate(PolicyTarget{Command: "bash"}); !d.Allowed {
+		t.Fatal("no policy allows everything")
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	t.Parallel()
+
+	if p, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.yaml")); p != nil || err != nil {
+		t.Fatalf("missing file: p=%v err=%v", p, err)
+	}
+	for _, yml := range []string{
+		"rules: [unclosed",
+		"default: maybe\n",
+		"rules:\n  - name: bad\n    deny: ['re:(']\n",
+		"rules:\n  - name: bad\n    cluster: 're:['\n",
+	} {
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		_ = os.WriteFile(path, []byte(yml), 0o600)
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("policy %q should not load", yml)
+		}
+	}
+}
+
+func TestExecECSEnforcesPolicy(t *testing.T) {
+	prev := startExecuteCommand
+	t.Cleanup(func() { startExecuteCommand = prev })
+	startExecuteCommand = func(context.Context, ecsExecuteCommander, ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		t.Fatal("a denied command must not reach ExecuteCommand")
+		return nil, nil
+	}
+	setHistoryFile(t)
+	audit := setAuditFile(t)
+
+	c := &Cli{Profile: "shop-prod", Policy: loadTestPolicy(t, testPolicy)}
+	opts := ExecOptions{Region: "eu-west-1", ClusterArn: prodClusterArn, TaskArn: "t1", Container: "app", Command: "bash", Environment: EnvProd}
+	code, err := ExecECS(context.Background(), c, aws.Config{}, opts)
+	if code != ExitPolicyDenied || err == nil || !strings.Contains(err.Error(), "prod-console") || !strings.Contains(err.Error(), "sandboxed") {
+		t.Fatalf("code=%d err=%v", code, err)
+	}
+	if len(LoadHistory()) != 0 {
+		t.Fatal("a denied command is not a session")
+	}
+
+	var out bytes.Buffer
+	prevOut := policyCheckOutput
+	t.Cleanup(func() { policyCheckOutput = prevOut })
+	policyCheckOutput = &out
+	c.PolicyCheck = true
+	opts.Command = "bin/rails console --sandbox"
+	if code, err := ExecECS(context.Background(), c, aws.Config{}, opts); code != 0 || err != nil {
+		t.Fatalf("policy check: code=%d err=%v", code, err)
+	}
+	if !strings.HasPrefix(out.String(), "allow: ") || !strings.Contains(out.String(), "rule prod-console") {
+		t.Fatalf("policy check output = %q", out.String())
+	}
+
+	events := readAudit(t, audit)
+	if len(events) != 2 {
+		t.Fatalf("audit = %+v", events)
+	}
+	if e := events[0]; e.Event != AuditPolicy || e.Decision != "deny" || e.Rule != "prod-console" || e.Task != "t1" || e.DryRun {
+		t.Fatalf("deny event = %+v", e)
+	}
+	if e := events[1]; e.Decision != "allow" || !e.DryRun || e.Environment != EnvProd {
+		t.Fatalf("dry-run event = %+v", e)
+	}
+}
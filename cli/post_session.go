@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Post-session menu items, in the order they are offered.
+const (
+	PostReconnect   = "Reconnect to the same container"
+	PostContainer   = "Pick another container"
+	PostTask        = "Pick another task"
+	PostService     = "Pick another service"
+	PostProfile     = "Switch profile"
+	PostTranscript  = "View session transcript"
+	PostCommandLine = "Copy command line"
+	PostQuit        = "Quit"
+)
+
+// PostSessionActions lists the post-session menu. The transcript is only
+// offered when the session was recorded.
+func PostSessionActions(recorded bool) []string {
+	items := []string{PostReconnect, PostContainer, PostTask, PostService, PostProfile}
+	if recorded {
+		items = append(items, PostTranscript)
+	}
+	return append(items, PostCommandLine, PostQuit)
+}
+
+// PostSessionLabel sums up the last session for the menu title.
+func PostSessionLabel(code int, err error, result SessionResult) string {
+	if result.StartedAt.IsZero() {
+		if err != nil {
+			return fmt.Sprintf("Session failed to start · exit %d", code)
+		}
+		return fmt.Sprintf("Session ended · exit %d", code)
+	}
+	return fmt.Sprintf("Session ended · exit %d · %s", code, result.Duration.Round(time.Second))
+}
+
+// CommandLine is a command that re-runs the session without the picker: a
+// named target from config.yaml when one covers state, flags otherwise. The
+// flags name the service rather than the task, whose ID changes with every
+// deploy; only standalone tasks are pinned with -tk. A prod target gets the
+// -confirm it needs to run without a terminal.
+func (c *Cli) CommandLine(state State, command, env string) string {
+	args := []string{"exec-ecs", "exec"}
+	if name, t, ok := c.targetFor(state); ok {
+		args = append(args, "@"+name)
+		if t.Container == "" {
+			args = append(args, "-cn", shellArg(state.Container))
+		}
+		defaultCommand := t.Command
+		if defaultCommand == "" {
+			defaultCommand = "bash"
+		}
+		if command != defaultCommand {
+			args = append(args, "-command", shellArg(command))
+		}
+	} else {
+		args = append(args, "-pr", shellArg(state.Profile), "-rg", shellArg(state.Region), "-cl", shellArg(displayTail(state.ClusterArn)))
+		if state.Service != "" && !IsPseudoService(state.Service) {
+			args = append(args, "-se", shellArg(displayTail(state.Service)))
+		} else {
+			args = append(args, "-tk", shellArg(displayTail(state.TaskArn)))
+		}
+		args = append(args, "-cn", shellArg(state.Container), "-command", shellArg(command))
+	}
+	if env == EnvProd {
+		name := displayTail(state.ClusterArn)
+		if state.Service != "" && !IsPseudoService(state.Service) {
+			name = displayTail(state.Service)
+		}
+		args = append(args, "-confirm", shellArg(name))
+	}
+	return strings.Join(args, " ")
+}
+
+// safeShellArg matches arguments that need no quoting.
+var safeShellArg = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+
+// shellArg quotes s for a POSIX shell unless it is safe as it is.
+func shellArg(s string) string {
+	if safeShellArg.MatchString(s) {
+		return s
+	}
+	return shellQuote(s)
+}
+
+// targetFor finds the first named target, by name, whose profile, region,
+// cluster and service are those of state and whose container, if it names
+// one, is too.
+func (c *Cli) targetFor(state State) (string, TargetConfig, bool) {
+	targets := c.settings().Targets
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := targets[name]
+		if t.Profile == state.Profile && t.Region == state.Region &&
+			displayTail(t.Cluster) == displayTail(state.ClusterArn) &&
+			t.Service != "" && displayTail(t.Service) == displayTail(state.Service) &&
+			(t.Container == "" || t.Container == state.Container) {
+			return name, t, true
+		}
+	}
+	return "", TargetConfig{}, false
+}
+
+// ShowTranscript writes a recording's output to w all at once.
+func ShowTranscript(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return replayCast(f, w, 1, 0, func(time.Duration) {})
+}
+
+// CopyToClipboard asks the terminal to put text on the clipboard (OSC 52).
+// Terminals that don't support it ignore the request, so callers print the
+// text as well. It does nothing unless w is a terminal.
+var CopyToClipboard = func(w *os.File, text string) {
+	if !term.IsTerminal(int(w.Fd())) {
+		return
+	}
+	fmt.Fprintf(w, "\x1b]52;c;%s\x07", base64.StdEncoding.EncodeToString([]byte(text)))
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestPostSessionActions(t *testing.T) {
+	t.Parallel()
+
+	if items := PostSessionActions(false); slices.Contains(items, PostTranscript) || items[0] != PostReconnect || items[len(items)-1] != PostQuit {
+		t.Fatalf("unrecorded = %v", items)
+	}
+	if items := PostSessionActions(true); !slices.Contains(items, PostTranscript) {
+		t.Fatalf("recorded = %v", items)
+	}
+}
+
+func TestPostSessionLabel(t *testing.T) {
+	t.Parallel()
+
+	ran := SessionResult{StartedAt: time.Now(), Duration: 192*time.Second + 400*time.Millisecond}
+	if got := PostSessionLabel(0, nil, ran); got != "Session ended · exit 0 · 3m12s" {
+		t.Fatalf("label = %q", got)
+	}
+	if got := PostSessionLabel(1, errors.New("ecs:ExecuteCommand failed"), SessionResult{}); got != "Session failed to start · exit 1" {
+		t.Fatalf("label = %q", got)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	t.Parallel()
+
+	state := State{
+		Profile: "shop", Region: "eu-west-1", ClusterArn: prodClusterArn,
+		Service:   "arn:aws:ecs:eu-west-1:111111111111:service/web-prod/api",
+		TaskArn:   "arn:aws:ecs:eu-west-1:111111111111:task/web-prod/0abc",
+		Container: "app",
+	}
+	c := &Cli{}
+	want := "exec-ecs exec -pr shop -rg eu-west-1 -cl web-prod -se api -cn app -command 'bin/rails console'"
+	if got := c.CommandLine(state, "bin/rails console", ""); got != want {
+		t.Fatalf("flags:\n got %s\nwant %s", got, want)
+	}
+
+	standalone := state
+	standalone.Service = StandaloneTasksService
+	want = "exec-ecs exec -pr shop -rg eu-west-1 -cl web-prod -tk 0abc -cn app -command bash -confirm web-prod"
+	if got := c.CommandLine(standalone, "bash", EnvProd); got != want {
+		t.Fatalf("standalone prod:\n got %s\nwant %s", got, want)
+	}
+
+	c.Config = &Config{Targets: map[string]TargetConfig{
+		"other":    {Profile: "shop", Region: "eu-west-1", Cluster: "web-prod", Service: "worker"},
+		"web-prod": {Profile: "shop", Region: "eu-west-1", Cluster: "web-prod", Service: "api", Command: "bin/rails console"},
+	}}
+	if got := c.CommandLine(state, "bin/rails console", EnvProd); got != "exec-ecs exec @web-prod -cn app -confirm api" {
+		t.Fatalf("target: %s", got)
+	}
+	if got := c.CommandLine(state, "sh", ""); got != "exec-ecs exec @web-prod -cn app -command sh" {
+		t.Fatalf("target with command: %s", got)
+	}
+}
+
+func TestExecECSReportsResultAndTranscript(t *testing.T) {
+	setConfigDir(t)
+	setHistoryFile(t)
+	prevStart, prevStarter := startExecuteCommand, sessionStarter
+	t.Cleanup(func() { startExecuteCommand, sessionStarter = prevStart, prevStarter })
+	startExecuteCommand = func(context.Context, ecsExecuteCommander, ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	sessionStarter = func(_ context.Context, _ string, _ *ecstypes.Session, opts ptyOptions) (int, error) {
+		_, _ = opts.Recorder.Output().Write([]byte("root@task:/# exit\r\n"))
+		return 0, nil
+	}
+
+	var result SessionResult
+	opts := ExecOptions{Region: "r", ClusterArn: "c", TaskArn: "t", Container: "app", Command: "bash", Record: true, Stdout: &bytes.Buffer{}, Result: &result}
+	if _, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, opts); err != nil {
+		t.Fatalf("ExecECS: %v", err)
+	}
+	if result.StartedAt.IsZero() || result.Duration < 0 || result.Recording == "" {
+		t.Fatalf("result = %+v", result)
+	}
+
+	var out bytes.Buffer
+	if err := ShowTranscript(result.Recording, &out); err != nil || out.String() != "root@task:/# exit\r\n" {
+		t.Fatalf("transcript = %q err=%v", out.String(), err)
+	}
+}
@@ -46,6 +46,64 @@ func (c *Cli) PromptSelectLoadedBreadcrumb(loadingLabel, label string, defaultSe
 	return selectedItem, false, nil
 }
 
+// PromptTaskLoadedBreadcrumb shows the task picker as a table of the rows
+// load returns and yields the chosen task's ARN.
+func (c *Cli) PromptTaskLoadedBreadcrumb(loadingLabel, label string, defaultArn string, showGoBack bool, breadcrumb string, load func() ([]TaskRow, error)) (string, bool, error) {
+	selected, goBack, err := bubbleteaSelectTable(loadingLabel, label, defaultArn, showGoBack, breadcrumb, func() (*menuTable, error) {
+		rows, err := load()
+		if err != nil {
+			return nil, err
+		}
+		return taskTable(rows), nil
+	}, promptExtraOpts...)
+	if err != nil || goBack {
+		return selected, goBack, err
+	}
+	if selected == "" {
+		exitFn(0)
+	}
+	return selected, false, nil
+}
+
+// PromptServiceLoadedBreadcrumb is PromptTaskLoadedBreadcrumb for the
+// service picker, with the highlighted service's deployments and events
+// under the table.
+func (c *Cli) PromptServiceLoadedBreadcrumb(loadingLabel, label string, defaultArn string, showGoBack bool, breadcrumb string, load func() ([]ServiceRow, error)) (string, bool, error) {
+	selected, goBack, err := bubbleteaSelectTable(loadingLabel, label, defaultArn, showGoBack, breadcrumb, func() (*menuTable, error) {
+		rows, err := load()
+		if err != nil {
+			return nil, err
+		}
+		return serviceTable(rows), nil
+	}, promptExtraOpts...)
+	if err != nil || goBack {
+		return selected, goBack, err
+	}
+	if selected == "" {
+		exitFn(0)
+	}
+	return selected, false, nil
+}
+
+// PromptStoppedTaskBreadcrumb is PromptTaskLoadedBreadcrumb for the
+// stopped-task browser.
+func (c *Cli) PromptStoppedTaskBreadcrumb(loadingLabel, label string, defaultArn string, breadcrumb string, load func() ([]StoppedTask, error)) (string, bool, error) {
+	selected, goBack, err := bubbleteaSelectTable(loadingLabel, label, defaultArn, true, breadcrumb, func() (*menuTable, error) {
+		tasks, err := load()
+		if err != nil {
+			return nil, err
+		}
+		return stoppedTable(tasks), nil
+	}, promptExtraOpts...)
+	if err != nil || goBack {
+		return selected, goBack, err
+	}
+	if selected == "" {
+		exitFn(0)
+	}
+	return selected, false, nil
+}
+
 // bubbleteaSelect runs the picker. Extra tea.ProgramOption values are appended
 // to the default `tea.WithAltScreen` so tests can inject a scripted input
 // stream / capture stdout via tea.WithInput / tea.WithOutput.
@@ -70,6 +128,19 @@ func bubbleteaSelectLoaded(loadingLabel, label string, defaultSelected string, s
 	return runBubbleteaSelect(m, label, defaultSelected, extraOpts...)
 }
 
+// bubbleteaSelectTable is bubbleteaSelectLoaded for a loader that builds a
+// table; the returned choice is the chosen row's key.
+func bubbleteaSelectTable(loadingLabel, label string, defaultKey string, showGoBack bool, breadcrumb string, load func() (*menuTable, error), extraOpts ...tea.ProgramOption) (string, bool, error) {
+	m := initialModelWithBreadcrumb(label, nil, defaultKey, showGoBack, breadcrumb)
+	m.loading = true
+	m.loadingMessage = loadingLabel
+	m.loadCmd = func() tea.Msg {
+		table, err := load()
+		return loadItemsMsg{table: table, err: err}
+	}
+	return runBubbleteaSelect(m, label, defaultKey, extraOpts...)
+}
+
 func runBubbleteaSelect(m menuModel, label, defaultSelected string, extraOpts ...tea.ProgramOption) (string, bool, error) {
 	if strings.Contains(label, "Theme") {
 		m.originalTheme = CurrentTheme
@@ -104,6 +175,9 @@ func runBubbleteaSelect(m menuModel, label, defaultSelected string, extraOpts ..
 	if mm.loadErr != nil {
 		return "", mm.goBackTriggered, mm.loadErr
 	}
+	if mm.table != nil && mm.choice != "" {
+		mm.choice = mm.table.keyFor(mm.choice)
+	}
 	if mm.themeChanged {
 		if mm.choice != "" {
 			return mm.choice, mm.goBackTriggered, nil
@@ -10,6 +10,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 	"golang.org/x/term"
@@ -17,30 +18,113 @@ import (
 
 // runPTYCommand runs cmd on a PTY, wires stdin/stdout/SIGWINCH like a real
 // terminal would, and returns the child's exit code once it terminates.
-func runPTYCommand(cmd *exec.Cmd) (int, error) {
+//
+// When stdin is not a terminal (scripts, CI, `make`) or opts.Stdin replaces
+// it, the raw-mode and resize plumbing is skipped and the child gets a
+// fixed-size PTY instead.
+//
+// With opts.Recorder set, everything read from the PTY and everything typed
+// into it is also teed into the recording with timestamps.
+//
+// On the user's own terminal, opts.Escape at the start of a line begins an
+// ssh-style escape sequence (see escapeScanner); ~. and ~^Z end the session
+// with ErrDisconnected and ErrSuspended.
+//
+// With opts.StatusLine set, the bottom row of the user's terminal shows a
+// status bar (see statusOverlay) and the child's PTY is a row shorter.
+func runPTYCommand(cmd *exec.Cmd, opts ptyOptions) (int, error) {
+	stdout := opts.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	var stdin io.Reader = os.Stdin
+	if opts.Stdin != nil {
+		stdin = opts.Stdin
+	}
+	recs := &recordingSwitch{rec: opts.Recorder, start: opts.StartRecording}
+	stdout = recordingTee{w: stdout, rec: recs}
+	interactive := opts.Stdin == nil && term.IsTerminal(int(os.Stdin.Fd()))
+
+	var overlay *statusOverlay
+	if interactive && opts.StatusLine != nil {
+		if cols, rows, err := term.GetSize(int(os.Stdin.Fd())); err == nil && rows > 2 {
+			overlay = newStatusOverlay(stdout, os.Stdout, opts.StatusLine, cols, rows)
+			stdout = overlay
+		}
+	}
+	// childSize is the terminal size the child sees, short of the bar.
+	childSize := func() (int, int, error) {
+		cols, rows, err := term.GetSize(int(os.Stdin.Fd()))
+		if err == nil && overlay != nil {
+			overlay.resize(cols, rows)
+			rows--
+		}
+		return cols, rows, err
+	}
+
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		return 1, fmt.Errorf("start pty: %w", err)
 	}
 	defer func() { _ = ptmx.Close() }()
 
-	resizeCh := make(chan os.Signal, 1)
-	signal.Notify(resizeCh, syscall.SIGWINCH)
-	defer signal.Stop(resizeCh)
-	go func() {
-		for range resizeCh {
-			_ = pty.InheritSize(os.Stdin, ptmx)
+	restore := func() {}
+	if interactive {
+		resizeCh := make(chan os.Signal, 1)
+		signal.Notify(resizeCh, syscall.SIGWINCH)
+		defer signal.Stop(resizeCh)
+		go func() {
+			for range resizeCh {
+				cols, rows, err := childSize()
+				if err != nil {
+					continue
+				}
+				_ = pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+				if rec := recs.current(); rec != nil {
+					rec.resize(cols, rows)
+				}
+			}
+		}()
+		if rec := opts.Recorder; rec != nil {
+			if cols, rows, err := childSize(); err == nil {
+				rec.begin(cols, rows)
+			}
 		}
-	}()
-	resizeCh <- syscall.SIGWINCH
+		resizeCh <- syscall.SIGWINCH
 
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		_ = cmd.Wait()
-		return 1, fmt.Errorf("raw mode: %w", err)
+		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			_ = cmd.Wait()
+			return 1, fmt.Errorf("raw mode: %w", err)
+		}
+		restore = func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }
+		defer restore()
+
+		if overlay != nil {
+			// In raw mode, so the line feed that makes room for the bar
+			// keeps the cursor's column.
+			overlay.start()
+			defer overlay.stop()
+			ticker := time.NewTicker(time.Second)
+			done := make(chan struct{})
+			defer func() { ticker.Stop(); close(done) }()
+			go func() {
+				for {
+					select {
+					case <-ticker.C:
+						overlay.tick()
+					case <-done:
+						return
+					}
+				}
+			}()
+		}
+	} else {
+		_ = pty.Setsize(ptmx, &pty.Winsize{Rows: 24, Cols: 200})
+		if rec := opts.Recorder; rec != nil {
+			rec.begin(200, 24)
+		}
 	}
-	restore := func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }
-	defer restore()
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
@@ -60,21 +144,87 @@ func runPTYCommand(cmd *exec.Cmd) (int, error) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		_, _ = io.Copy(os.Stdout, ptmx)
+		_, _ = io.Copy(stdout, ptmx)
 	}()
 
+	var scanner *escapeScanner
+	if interactive && opts.Escape != 0 {
+		scanner = newEscapeScanner(opts.Escape, opts.Suspendable)
+	}
+	left := make(chan error, 1)
+	// escape runs an escape command and reports whether the session is
+	// over.
+	escape := func(command byte) bool {
+		say := func(msg string) {
+			line := "\r\n[exec-ecs] " + msg + "\r\n"
+			if overlay != nil {
+				overlay.say(line)
+				return
+			}
+			fmt.Fprint(os.Stdout, line)
+		}
+		switch command {
+		case escDisconnect, escSuspend:
+			reason := ErrDisconnected
+			if command == escSuspend {
+				reason = ErrSuspended
+			}
+			left <- reason
+			say("closing the session")
+			if opts.Terminate != nil {
+				opts.Terminate()
+			}
+			if cmd.Process != nil {
+				_ = cmd.Process.Kill()
+			}
+			return true
+		case escInfo:
+			info := ""
+			if opts.Info != nil {
+				info = opts.Info() + "\r\n"
+			}
+			say(info + "recording: " + recs.status())
+		case escRecord:
+			cols, rows, err := childSize()
+			if err != nil {
+				cols, rows = 200, 24
+			}
+			say(recs.toggle(cols, rows))
+		case escHelp:
+			say(escapeHelp(opts.Escape, opts.Suspendable))
+		}
+		return false
+	}
+
 	stopStdin := make(chan struct{})
 	go func() {
+		// The escape scanner looks at one keystroke at a time; piped input
+		// such as a cp upload goes in larger writes.
 		buf := make([]byte, 1)
+		if scanner == nil && !interactive {
+			buf = make([]byte, 32*1024)
+		}
 		for {
 			select {
 			case <-stopStdin:
 				return
 			default:
 			}
-			n, err := os.Stdin.Read(buf)
+			n, err := stdin.Read(buf)
 			if n > 0 {
-				if _, werr := ptmx.Write(buf[:n]); werr != nil {
+				send, command := buf[:n], byte(0)
+				if scanner != nil {
+					send, command = scanner.feed(buf[0])
+				}
+				if len(send) > 0 {
+					if _, werr := ptmx.Write(send); werr != nil {
+						return
+					}
+					if rec := recs.current(); rec != nil {
+						_, _ = rec.Input().Write(send)
+					}
+				}
+				if command != 0 && escape(command) {
 					return
 				}
 			}
@@ -87,7 +237,13 @@ func runPTYCommand(cmd *exec.Cmd) (int, error) {
 	wg.Wait()
 	close(stopStdin)
 
-	if err := cmd.Wait(); err != nil {
+	waitErr := cmd.Wait()
+	select {
+	case err := <-left:
+		return ExitSessionError, err
+	default:
+	}
+	if err := waitErr; err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			return exitErr.ExitCode(), nil
 		}
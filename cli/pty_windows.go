@@ -7,6 +7,6 @@ import (
 	"os/exec"
 )
 
-func runPTYCommand(cmd *exec.Cmd) (int, error) {
+func runPTYCommand(cmd *exec.Cmd, opts ptyOptions) (int, error) {
 	return 1, errors.New("interactive ECS exec sessions are not supported on Windows")
 }
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Reconnect modes for `reconnect.mode` in config.yaml.
+const (
+	// ReconnectAsk offers to reconnect when a session drops (the default).
+	ReconnectAsk = "ask"
+	// ReconnectAuto reconnects without asking.
+	ReconnectAuto = "auto"
+	// ReconnectOff leaves a dropped session dropped.
+	ReconnectOff = "off"
+)
+
+const (
+	defaultReconnectAttempts = 5
+	maxReconnectDelay        = 30 * time.Second
+	// reconnectStableAfter is how long a reconnected session must stay up
+	// before its next drop gets a fresh set of attempts.
+	reconnectStableAfter = time.Minute
+)
+
+// ReconnectConfig controls what happens when an interactive session drops.
+type ReconnectConfig struct {
+	// Mode is ask, auto or off (empty means ask).
+	Mode string `yaml:"mode"`
+	// Attempts is how many times to try before giving up
+	// (0 means defaultReconnectAttempts).
+	Attempts int `yaml:"attempts"`
+}
+
+// reconnectDelay is the wait before attempt n (1-based): 1s, 2s, 4s, ...
+// capped at maxReconnectDelay. Swapped out in tests.
+var reconnectDelay = func(n int) time.Duration {
+	if n > 5 {
+		return maxReconnectDelay
+	}
+	return time.Second << (n - 1)
+}
+
+// SessionDropped tells an abnormal disconnect from a session the user
+// ended. session-manager-plugin exits 0 whatever the remote shell did, so a
+// non-zero code without an error means the plugin lost the session (a VPN
+// blip, a laptop lid). Only meaningful for sessions without
+// CaptureExitStatus, whose code is the remote command's.
+func (c *Cli) SessionDropped(code int, err error) bool {
+	return err == nil && code != 0 && !c.PolicyCheck
+}
+
+// ReconnectSession re-opens a dropped session to the same container,
+// waiting longer between each attempt. Before every attempt revalidate
+// refreshes the SSO session, and a task that has stopped in the meantime is
+// replaced by a running task of the same service. It returns the options
+// the last session ran with, so the caller can follow a replacement task.
+//
+// In ask mode the user is asked first; without a terminal to ask on, or
+// with reconnect off, it returns the drop as it was.
+func (c *Cli) ReconnectSession(ctx context.Context, awsCfg aws.Config, client ECSClient, opts ExecOptions, code int, revalidate func(context.Context) error) (ExecOptions, int, error) {
+	settings := c.settings().Reconnect
+	switch settings.Mode {
+	case ReconnectOff:
+		return opts, code, nil
+	case ReconnectAuto:
+	default:
+		if !stdinIsTerminal() || !askReconnect(opts, code) {
+			return opts, code, nil
+		}
+	}
+	attempts := settings.Attempts
+	if attempts <= 0 {
+		attempts = defaultReconnectAttempts
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		delay := reconnectDelay(attempt)
+		fmt.Fprintf(confirmOutput, "Reconnecting to %s (attempt %d/%d) in %s...\n", sessionTarget(opts), attempt, attempts, delay)
+		select {
+		case <-ctx.Done():
+			return opts, ExitSessionError, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		// While the network is still down this fails too, so it counts as
+		// an attempt rather than ending the reconnect.
+		if err := revalidate(ctx); err != nil {
+			lastErr = err
+			continue
+		}
+		state, err := resolveRunningTask(ctx, c, client, State{
+			Profile: c.Profile, Region: opts.Region, ClusterArn: opts.ClusterArn,
+			Service: opts.Service, TaskArn: opts.TaskArn, Container: opts.Container,
+		}, "it was not opened through a service")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		opts.TaskArn = state.TaskArn
+
+		started := time.Now()
+		code, err = ExecECS(ctx, c, awsCfg, opts)
+		if errors.Is(err, ErrDisconnected) || errors.Is(err, ErrSuspended) {
+			// Left on purpose with an escape sequence.
+			return opts, code, err
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !c.SessionDropped(code, err) {
+			return opts, code, nil
+		}
+		lastErr = fmt.Errorf("session dropped again (plugin exited with code %d)", code)
+		if time.Since(started) >= reconnectStableAfter {
+			// It was back long enough to count as a new drop.
+			attempt = 0
+		}
+	}
+	return opts, ExitSessionError, fmt.Errorf("gave up reconnecting after %d attempts: %w", attempts, lastErr)
+}
+
+// askReconnect offers a reconnect after a drop. Enter means yes.
+func askReconnect(opts ExecOptions, code int) bool {
+	fmt.Fprintf(confirmOutput, "\nSession to %s dropped (plugin exited with code %d). Reconnect? [Y/n] ", sessionTarget(opts), code)
+	line, err := bufio.NewReader(confirmInput).ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "", "y", "yes":
+		return true
+	}
+	return false
+}
+
+// sessionTarget names a session's container for messages.
+func sessionTarget(opts ExecOptions) string {
+	return displayTail(opts.ClusterArn) + "/" + displayTail(opts.TaskArn) + "/" + opts.Container
+}
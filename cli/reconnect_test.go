@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// stubReconnect makes reconnects instant and scripts the plugin's exit
+// codes, returning the tasks each session was opened on.
+func stubReconnect(t *testing.T, codes ...int) *[]string {
+	t.Helper()
+	prevStart, prevStarter, prevDelay := startExecuteCommand, sessionStarter, reconnectDelay
+	prevIn, prevOut, prevTTY := confirmInput, confirmOutput, stdinIsTerminal
+	t.Cleanup(func() {
+		startExecuteCommand, sessionStarter, reconnectDelay = prevStart, prevStarter, prevDelay
+		confirmInput, confirmOutput, stdinIsTerminal = prevIn, prevOut, prevTTY
+	})
+	reconnectDelay = func(int) time.Duration { return 0 }
+	confirmOutput = &bytes.Buffer{}
+	stdinIsTerminal = func() bool { return true }
+	setHistoryFile(t)
+
+	var tasks []string
+	startExecuteCommand = func(_ context.Context, _ ecsExecuteCommander, opts ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		tasks = append(tasks, opts.TaskArn)
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	sessionStarter = func(context.Context, string, *ecstypes.Session, ptyOptions) (int, error) {
+		code := codes[0]
+		if len(codes) > 1 {
+			codes = codes[1:]
+		}
+		return code, nil
+	}
+	return &tasks
+}
+
+func running(arn string) ecstypes.Task {
+	return ecstypes.Task{TaskArn: aws.String(arn), LastStatus: aws.String("RUNNING")}
+}
+
+func TestSessionDropped(t *testing.T) {
+	t.Parallel()
+
+	c := &Cli{}
+	if c.SessionDropped(0, nil) || c.SessionDropped(1, errors.New("ExecuteCommand failed")) {
+		t.Fatal("a clean exit or a failed start is not a drop")
+	}
+	if !c.SessionDropped(255, nil) {
+		t.Fatal("a non-zero plugin exit is a drop")
+	}
+	if (&Cli{PolicyCheck: true}).SessionDropped(ExitPolicyDenied, nil) {
+		t.Fatal("-policy-check never connects, so nothing drops")
+	}
+}
+
+func TestReconnectSessionRetriesWithBackoff(t *testing.T) {
+	tasks := stubReconnect(t, 255, 0)
+	c := &Cli{Profile: "dev", Config: &Config{Reconnect: ReconnectConfig{Mode: ReconnectAuto}}}
+	f := &fakeECS{describeTasks: []ecstypes.Task{running("t1")}}
+	validated := 0
+	revalidate := func(context.Context) error {
+		validated++
+		if validated == 1 {
+			return errors.New("network is unreachable")
+		}
+		return nil
+	}
+
+	opts := ExecOptions{Region: "eu-west-1", ClusterArn: "c", Service: "api", TaskArn: "t1", Container: "app", Command: "bash"}
+	got, code, err := c.ReconnectSession(context.Background(), aws.Config{}, f, opts, 255, revalidate)
+	if err != nil || code != 0 || got.TaskArn != "t1" {
+		t.Fatalf("code=%d err=%v task=%q", code, err, got.TaskArn)
+	}
+	// Attempt 1 fails to revalidate, 2 drops again, 3 ends cleanly.
+	if validated != 3 || strings.Join(*tasks, ",") != "t1,t1" {
+		t.Fatalf("validated=%d tasks=%v", validated, *tasks)
+	}
+	if !strings.Contains(confirmOutput.(*bytes.Buffer).String(), "attempt 3/5") {
+		t.Fatalf("output = %q", confirmOutput.(*bytes.Buffer).String())
+	}
+}
+
+func TestReconnectSessionFallsBackToSibling(t *testing.T) {
+	tasks := stubReconnect(t, 0)
+	c := &Cli{Config: &Config{Reconnect: ReconnectConfig{Mode: ReconnectAuto}}}
+	stopped := ecstypes.Task{TaskArn: aws.String("t1"), LastStatus: aws.String("STOPPED")}
+	f := &fakeECS{describeTasks: []ecstypes.Task{stopped}, tasksPages: [][]string{{"t2"}}}
+
+	opts := ExecOptions{Region: "eu-west-1", ClusterArn: "c", Service: "api", TaskArn: "t1", Container: "app"}
+	got, code, err := c.ReconnectSession(context.Background(), aws.Config{}, f, opts, 255, func(context.Context) error { return nil })
+	if err != nil || code != 0 || got.TaskArn != "t2" || strings.Join(*tasks, ",") != "t2" {
+		t.Fatalf("code=%d err=%v task=%q tasks=%v", code, err, got.TaskArn, *tasks)
+	}
+
+	// A standalone task has no siblings to fall back to.
+	f = &fakeECS{describeTasks: []ecstypes.Task{stopped}}
+	opts.Service = StandaloneTasksService
+	c.Config.Reconnect.Attempts = 2
+	_, code, err = c.ReconnectSession(context.Background(), aws.Config{}, f, opts, 255, func(context.Context) error { return nil })
+	if code != ExitSessionError || err == nil || !strings.Contains(err.Error(), "after 2 attempts") || !strings.Contains(err.Error(), "no longer running") {
+		t.Fatalf("code=%d err=%v", code, err)
+	}
+}
+
+func TestReconnectSessionAsks(t *testing.T) {
+	tasks := stubReconnect(t, 0)
+	c := &Cli{}
+	f := &fakeECS{describeTasks: []ecstypes.Task{running("t1")}}
+	opts := ExecOptions{Region: "eu-west-1", ClusterArn: "c", TaskArn: "t1", Container: "app"}
+	noop := func(context.Context) error { return nil }
+
+	for _, answer := range []string{"n\n", ""} {
+		confirmInput = strings.NewReader(answer)
+		if _, code, err := c.ReconnectSession(context.Background(), aws.Config{}, f, opts, 255, noop); code != 255 || err != nil {
+			t.Fatalf("answer %q: code=%d err=%v", answer, code, err)
+		}
+	}
+	stdinIsTerminal = func() bool { return false }
+	if _, code, _ := c.ReconnectSession(context.Background(), aws.Config{}, f, opts, 255, noop); code != 255 || len(*tasks) != 0 {
+		t.Fatal("without a terminal there is no one to ask")
+	}
+
+	stdinIsTerminal = func() bool { return true }
+	confirmInput = strings.NewReader("\n")
+	if _, code, err := c.ReconnectSession(context.Background(), aws.Config{}, f, opts, 255, noop); code != 0 || err != nil || len(*tasks) != 1 {
+		t.Fatalf("enter should reconnect: code=%d err=%v tasks=%v", code, err, *tasks)
+	}
+
+	off := &Cli{Config: &Config{Reconnect: ReconnectConfig{Mode: ReconnectOff}}}
+	if _, code, _ := off.ReconnectSession(context.Background(), aws.Config{}, f, opts, 255, noop); code != 255 || len(*tasks) != 1 {
+		t.Fatal("mode off must not reconnect")
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	t.Parallel()
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+	for i, w := range want {
+		if got := reconnectDelay(i + 1); got != w {
+			t.Errorf("reconnectDelay(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
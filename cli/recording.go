@@ -0,0 +1,382 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultRecordingRetentionDays = 30
+	recordingExt                  = ".cast"
+)
+
+// RecordingsDir is where session recordings are written.
+func RecordingsDir() string { return filepath.Join(ConfigDir(), "recordings") }
+
+// RecordingEnabled reports whether sessions should be recorded: the -record
+// and -no-record flags win over recording.enabled in config.yaml.
+func (c *Cli) RecordingEnabled() bool {
+	switch {
+	case c.NoRecord:
+		return false
+	case c.Record:
+		return true
+	}
+	return c.settings().Recording.Enabled
+}
+
+// castHeader is the first line of an asciicast v2 file.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// castRecorder writes an asciicast v2 file
+// (https://docs.asciinema.org/manual/asciicast/v2/): a JSON header line,
+// then one `[seconds, "o"|"i"|"r", data]` array per event. It is safe for
+// the concurrent output/input goroutines runPTYCommand runs.
+type castRecorder struct {
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	path    string
+	title   string
+	start   time.Time
+	started bool
+	size    [2]int
+	pending map[string][]byte
+	now     func() time.Time
+	// paused drops events until the recording is resumed (~r).
+	paused bool
+}
+
+// newCastRecorder creates the recording file. The header is written by
+// begin, once the terminal size is known.
+func newCastRecorder(path, title string) (*castRecorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &castRecorder{
+		f:       f,
+		w:       bufio.NewWriter(f),
+		path:    path,
+		title:   title,
+		pending: map[string][]byte{},
+		now:     time.Now,
+	}, nil
+}
+
+// begin writes the header. Calling it again is a no-op.
+func (r *castRecorder) begin(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beginLocked(width, height)
+}
+
+func (r *castRecorder) beginLocked(width, height int) {
+	if r.started {
+		return
+	}
+	r.started = true
+	r.start = r.now()
+	r.size = [2]int{width, height}
+	env := map[string]string{}
+	for _, k := range []string{"TERM", "SHELL"} {
+		if v := os.Getenv(k); v != "" {
+			env[k] = v
+		}
+	}
+	line, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     r.title,
+		Env:       env,
+	})
+	_, _ = r.w.Write(append(line, '\n'))
+}
+
+// event appends one event. Bytes that end mid-way through a UTF-8 sequence
+// are held back until the rest arrives, since every event must be a valid
+// JSON string.
+func (r *castRecorder) event(kind string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beginLocked(200, 24)
+	if r.paused {
+		return
+	}
+
+	buf := append(r.pending[kind], data...)
+	cut := len(buf)
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending[kind] = append([]byte(nil), buf[cut:]...)
+	if cut == 0 {
+		return
+	}
+	r.writeEvent(kind, string(buf[:cut]))
+}
+
+func (r *castRecorder) writeEvent(kind, data string) {
+	elapsed := r.now().Sub(r.start).Seconds()
+	line, _ := json.Marshal([]any{json.Number(fmt.Sprintf("%.6f", elapsed)), kind, data})
+	_, _ = r.w.Write(append(line, '\n'))
+}
+
+// togglePaused pauses or resumes the recording and reports whether it is
+// now paused.
+func (r *castRecorder) togglePaused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = !r.paused
+	return r.paused
+}
+
+func (r *castRecorder) isPaused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.paused
+}
+
+// resize records a terminal size change.
+func (r *castRecorder) resize(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started {
+		r.beginLocked(width, height)
+		return
+	}
+	if r.size == [2]int{width, height} {
+		return
+	}
+	r.size = [2]int{width, height}
+	r.writeEvent("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// Output and Input adapt the recorder to the io.Writer plumbing in
+// runPTYCommand.
+func (r *castRecorder) Output() io.Writer { return castStream{r, "o"} }
+func (r *castRecorder) Input() io.Writer  { return castStream{r, "i"} }
+
+type castStream struct {
+	r    *castRecorder
+	kind string
+}
+
+func (s castStream) Write(p []byte) (int, error) {
+	s.r.event(s.kind, p)
+	return len(p), nil
+}
+
+// Close flushes any held-back bytes and closes the file.
+func (r *castRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beginLocked(200, 24)
+	for _, kind := range []string{"o", "i"} {
+		if rest := r.pending[kind]; len(rest) > 0 {
+			r.writeEvent(kind, string(rest))
+		}
+	}
+	if err := r.w.Flush(); err != nil {
+		_ = r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// recordingFileName builds `<UTC time>_<cluster>_<task>_<container>.cast`
+// so a directory listing sorts chronologically and says where each session
+// ran.
+func recordingFileName(now time.Time, clusterArn, taskArn, container string) string {
+	parts := []string{now.UTC().Format("20060102T150405Z")}
+	for _, p := range []string{displayTail(clusterArn), displayTail(taskArn), container} {
+		p = unsafeNameChars.ReplaceAllString(p, "-")
+		if p == "" {
+			p = "unknown"
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, "_") + recordingExt
+}
+
+// startRecording prunes old recordings, then opens a new one for the
+// session described by opts.
+func startRecording(c *Cli, opts ExecOptions) (*castRecorder, error) {
+	rc := c.settings().Recording
+	days := rc.RetentionDays
+	if days == 0 {
+		days = defaultRecordingRetentionDays
+	}
+	var maxAge time.Duration
+	if days > 0 {
+		maxAge = time.Duration(days) * 24 * time.Hour
+	}
+	if _, err := PruneRecordings(RecordingsDir(), maxAge, rc.MaxFiles, time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs: pruning recordings:", err)
+	}
+
+	name := recordingFileName(time.Now(), opts.ClusterArn, opts.TaskArn, opts.Container)
+	title := fmt.Sprintf("%s/%s/%s: %s", displayTail(opts.ClusterArn), displayTail(opts.TaskArn), opts.Container, opts.Command)
+	path := filepath.Join(RecordingsDir(), name)
+	// Two sessions against the same container within a second share a
+	// name; number the later ones rather than overwrite.
+	for i := 2; ; i++ {
+		rec, err := newCastRecorder(path, title)
+		if !errors.Is(err, fs.ErrExist) || i > 100 {
+			return rec, err
+		}
+		path = filepath.Join(RecordingsDir(), strings.TrimSuffix(name, recordingExt)+fmt.Sprintf("-%d", i)+recordingExt)
+	}
+}
+
+// RecordingFile is one entry in the recordings directory.
+type RecordingFile struct {
+	Path    string
+	ModTime time.Time
+}
+
+// ListRecordings returns the recordings in dir, newest first.
+func ListRecordings(dir string) ([]RecordingFile, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []RecordingFile
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != recordingExt {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, RecordingFile{Path: filepath.Join(dir, e.Name()), ModTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime.After(files[j].ModTime) })
+	return files, nil
+}
+
+// PruneRecordings deletes recordings older than maxAge (0 disables the age
+// limit) and all but the newest maxFiles (0 disables the count limit). It
+// returns how many files were removed.
+func PruneRecordings(dir string, maxAge time.Duration, maxFiles int, now time.Time) (int, error) {
+	files, err := ListRecordings(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i, f := range files {
+		tooOld := maxAge > 0 && now.Sub(f.ModTime) > maxAge
+		tooMany := maxFiles > 0 && i >= maxFiles
+		if !tooOld && !tooMany {
+			continue
+		}
+		if err := os.Remove(f.Path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// ResolveRecordingPath accepts either a path or a bare file name inside the
+// recordings directory.
+func ResolveRecordingPath(name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+	if filepath.Base(name) == name {
+		candidate := filepath.Join(RecordingsDir(), name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return name
+}
+
+// Replay plays an asciicast v2 recording to w. Delays between output events
+// are divided by speed; maxIdle (when > 0) caps any single pause so long
+// think-times don't stall the playback.
+func Replay(r io.Reader, w io.Writer, speed float64, maxIdle time.Duration) error {
+	return replayCast(r, w, speed, maxIdle, time.Sleep)
+}
+
+func replayCast(r io.Reader, w io.Writer, speed float64, maxIdle time.Duration, sleep func(time.Duration)) error {
+	if speed <= 0 {
+		return fmt.Errorf("speed must be positive, got %v", speed)
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !sc.Scan() {
+		return errors.New("empty recording")
+	}
+	var header castHeader
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil || header.Version != 2 {
+		return errors.New("not an asciicast v2 recording")
+	}
+
+	prev := 0.0
+	for sc.Scan() {
+		var ev []json.RawMessage
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil || len(ev) != 3 {
+			return fmt.Errorf("malformed event: %s", sc.Text())
+		}
+		var (
+			at   float64
+			kind string
+			data string
+		)
+		if json.Unmarshal(ev[0], &at) != nil || json.Unmarshal(ev[1], &kind) != nil || json.Unmarshal(ev[2], &data) != nil {
+			return fmt.Errorf("malformed event: %s", sc.Text())
+		}
+		if kind != "o" {
+			continue
+		}
+		delay := time.Duration((at - prev) / speed * float64(time.Second))
+		if maxIdle > 0 && delay > maxIdle {
+			delay = maxIdle
+		}
+		if delay > 0 {
+			sleep(delay)
+		}
+		prev = at
+		if _, err := io.WriteString(w, data); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
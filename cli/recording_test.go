@@ -0,0 +1,326 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestRecordingEnabledPrecedence(t *testing.T) {
+	t.Parallel()
+
+	on := &Config{Recording: RecordingConfig{Enabled: true}}
+	cases := []struct {
+		c    Cli
+		want bool
+	}{
+		{Cli{}, false},
+		{Cli{Config: on}, true},
+		{Cli{Record: true}, true},
+		{Cli{Config: on, NoRecord: true}, false},
+		{Cli{Record: true, NoRecord: true}, false},
+	}
+	for i, tc := range cases {
+		if got := tc.c.RecordingEnabled(); got != tc.want {
+			t.Fatalf("case %d: RecordingEnabled = %v", i, got)
+		}
+	}
+}
+
+// readCast returns the header and event lines of a recording.
+func readCast(t *testing.T, path string) (castHeader, [][]any) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		t.Fatal("empty recording")
+	}
+	var h castHeader
+	if err := json.Unmarshal(sc.Bytes(), &h); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	var events [][]any
+	for sc.Scan() {
+		var ev []any
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("event %q: %v", sc.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	return h, events
+}
+
+func TestCastRecorderWritesAsciicastV2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec", "s.cast")
+	rec, err := newCastRecorder(path, "prod/abc/app: bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Unix(1700000000, 0)
+	rec.now = func() time.Time { return clock }
+
+	rec.begin(120, 40)
+	rec.begin(1, 1) // second call is ignored
+	clock = clock.Add(1500 * time.Millisecond)
+	_, _ = rec.Output().Write([]byte("$ "))
+	_, _ = rec.Input().Write([]byte("ls\r"))
+	rec.resize(120, 40) // unchanged size is not an event
+	rec.resize(100, 30)
+	// "é" split across writes must not produce invalid JSON.
+	_, _ = rec.Output().Write([]byte{0xc3})
+	_, _ = rec.Output().Write([]byte{0xa9, '\n'})
+	_, _ = rec.Output().Write([]byte{0xe2, 0x82})
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, events := readCast(t, path)
+	if h.Version != 2 || h.Width != 120 || h.Height != 40 || h.Timestamp != 1700000000 || h.Title != "prod/abc/app: bash" {
+		t.Fatalf("header = %+v", h)
+	}
+	want := [][]any{
+		{1.5, "o", "$ "},
+		{1.5, "i", "ls\r"},
+		{1.5, "r", "100x30"},
+		{1.5, "o", "é\n"},
+		{1.5, "o", "��"}, // a truncated sequence at Close is replaced
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v", events)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if events[i][j] != want[i][j] {
+				t.Fatalf("event %d = %v want %v", i, events[i], want[i])
+			}
+		}
+	}
+	if st, _ := os.Stat(path); st.Mode().Perm() != 0o600 {
+		t.Fatalf("recording mode = %v", st.Mode().Perm())
+	}
+}
+
+func TestCastRecorderCloseWithoutBegin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.cast")
+	rec, err := newCastRecorder(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rec.Close()
+	h, events := readCast(t, path)
+	if h.Width != 200 || h.Height != 24 || len(events) != 0 {
+		t.Fatalf("header=%+v events=%v", h, events)
+	}
+	if _, err := newCastRecorder(path, ""); err == nil {
+		t.Fatal("existing recordings must never be overwritten")
+	}
+}
+
+func TestRecordingFileName(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2026, 3, 4, 5, 6, 7, 0, time.FixedZone("x", 3600))
+	got := recordingFileName(at, "arn:aws:ecs:r:1:cluster/prod", "arn:aws:ecs:r:1:task/prod/abc123", "my app")
+	if got != "20260304T040607Z_prod_abc123_my-app.cast" {
+		t.Fatalf("name = %q", got)
+	}
+	if got := recordingFileName(at, "", "", ""); got != "20260304T040607Z_unknown_unknown_unknown.cast" {
+		t.Fatalf("empty name = %q", got)
+	}
+}
+
+func touchRecording(t *testing.T, dir, name string, mod time.Time) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPruneRecordings(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	touchRecording(t, dir, "old.cast", now.Add(-40*24*time.Hour))
+	touchRecording(t, dir, "a.cast", now.Add(-3*time.Hour))
+	touchRecording(t, dir, "b.cast", now.Add(-2*time.Hour))
+	touchRecording(t, dir, "c.cast", now.Add(-1*time.Hour))
+	touchRecording(t, dir, "notes.txt", now.Add(-400*24*time.Hour))
+
+	removed, err := PruneRecordings(dir, 30*24*time.Hour, 2, now)
+	if err != nil || removed != 2 {
+		t.Fatalf("removed=%d err=%v", removed, err)
+	}
+	files, _ := ListRecordings(dir)
+	if len(files) != 2 || filepath.Base(files[0].Path) != "c.cast" || filepath.Base(files[1].Path) != "b.cast" {
+		t.Fatalf("kept = %+v", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Fatal("non-recordings must be left alone")
+	}
+
+	if n, err := PruneRecordings(filepath.Join(dir, "missing"), time.Hour, 1, now); n != 0 || err != nil {
+		t.Fatalf("missing dir: %d %v", n, err)
+	}
+}
+
+func TestResolveRecordingPath(t *testing.T) {
+	dir := setConfigDir(t)
+	_ = os.MkdirAll(RecordingsDir(), 0o700)
+	inDir := touchRecording(t, RecordingsDir(), "x.cast", time.Now())
+
+	if got := ResolveRecordingPath("x.cast"); got != inDir {
+		t.Fatalf("bare name = %q", got)
+	}
+	other := touchRecording(t, dir, "y.cast", time.Now())
+	if got := ResolveRecordingPath(other); got != other {
+		t.Fatalf("path = %q", got)
+	}
+	if got := ResolveRecordingPath("nope.cast"); got != "nope.cast" {
+		t.Fatalf("missing = %q", got)
+	}
+}
+
+const sampleCast = `{"version": 2, "width": 80, "height": 24}
+[0.5, "o", "hello "]
+[0.7, "i", "x"]
+[1.5, "o", "world"]
+[31.5, "o", "!"]
+`
+
+func TestReplayHonoursSpeedAndIdleCap(t *testing.T) {
+	t.Parallel()
+
+	var (
+		out    bytes.Buffer
+		sleeps []time.Duration
+	)
+	err := replayCast(strings.NewReader(sampleCast), &out, 2, 3*time.Second, func(d time.Duration) { sleeps = append(sleeps, d) })
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.String() != "hello world!" {
+		t.Fatalf("output = %q", out.String())
+	}
+	want := []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, 3 * time.Second}
+	if len(sleeps) != len(want) {
+		t.Fatalf("sleeps = %v", sleeps)
+	}
+	for i := range want {
+		if sleeps[i] != want[i] {
+			t.Fatalf("sleeps = %v want %v", sleeps, want)
+		}
+	}
+}
+
+func TestReplayRejectsBadInput(t *testing.T) {
+	t.Parallel()
+
+	noSleep := func(time.Duration) {}
+	for name, in := range map[string]string{
+		"empty":     "",
+		"v1 header": `{"version": 1}` + "\n",
+		"bad event": `{"version": 2}` + "\n[1, \"o\"]\n",
+		"bad time":  `{"version": 2}` + "\n[\"x\", \"o\", \"a\"]\n",
+	} {
+		if err := replayCast(strings.NewReader(in), &bytes.Buffer{}, 1, 0, noSleep); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if err := replayCast(strings.NewReader(sampleCast), &bytes.Buffer{}, 0, 0, noSleep); err == nil {
+		t.Fatal("zero speed should fail")
+	}
+	if err := Replay(strings.NewReader(`{"version": 2}`+"\n[0, \"o\", \"a\"]\n"), &bytes.Buffer{}, 1, 0); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+}
+
+func TestExecECSRecordsSession(t *testing.T) {
+	setConfigDir(t)
+	setHistoryFile(t)
+	prevStart := startExecuteCommand
+	prevStarter := sessionStarter
+	t.Cleanup(func() {
+		startExecuteCommand = prevStart
+		sessionStarter = prevStarter
+	})
+	startExecuteCommand = func(context.Context, ecsExecuteCommander, ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	sessionStarter = func(_ context.Context, _ string, _ *ecstypes.Session, opts ptyOptions) (int, error) {
+		if opts.Recorder == nil {
+			t.Fatal("Record should hand runPTYCommand a recorder")
+		}
+		_, _ = opts.Recorder.Output().Write([]byte("root@task:/# "))
+		return 0, nil
+	}
+
+	opts := ExecOptions{Region: "r", ClusterArn: "cluster/prod", TaskArn: "task/prod/abc", Container: "app", Command: "bash", Record: true, Stdout: &bytes.Buffer{}}
+	for i := 0; i < 2; i++ {
+		if _, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, opts); err != nil {
+			t.Fatalf("ExecECS: %v", err)
+		}
+	}
+	files, err := ListRecordings(RecordingsDir())
+	if err != nil || len(files) != 2 {
+		t.Fatalf("recordings = %+v err=%v", files, err)
+	}
+	for _, f := range files {
+		if !strings.Contains(filepath.Base(f.Path), "_prod_abc_app") {
+			t.Fatalf("name = %q", f.Path)
+		}
+		h, events := readCast(t, f.Path)
+		if h.Title != "prod/abc/app: bash" || len(events) != 1 {
+			t.Fatalf("header=%+v events=%v", h, events)
+		}
+	}
+}
+
+func TestExecECSRecordingFailureDoesNotBlockSession(t *testing.T) {
+	dir := setConfigDir(t)
+	setHistoryFile(t)
+	// A file where the recordings dir should be makes recording impossible.
+	_ = os.WriteFile(filepath.Join(dir, "recordings"), nil, 0o600)
+
+	prevStart := startExecuteCommand
+	prevStarter := sessionStarter
+	t.Cleanup(func() {
+		startExecuteCommand = prevStart
+		sessionStarter = prevStarter
+	})
+	startExecuteCommand = func(context.Context, ecsExecuteCommander, ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	ran := false
+	sessionStarter = func(_ context.Context, _ string, _ *ecstypes.Session, opts ptyOptions) (int, error) {
+		ran = true
+		if opts.Recorder != nil {
+			t.Fatal("no recorder expected")
+		}
+		return 0, nil
+	}
+	if _, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, ExecOptions{Record: true}); err != nil || !ran {
+		t.Fatalf("session should still run: ran=%v err=%v", ran, err)
+	}
+}
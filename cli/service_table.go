@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// describeServicesBatchSize is the most services DescribeServices accepts
+// per call.
+const describeServicesBatchSize = 10
+
+// serviceDetailEvents is how many of a service's latest events the detail
+// pane shows.
+const serviceDetailEvents = 5
+
+// ecsServiceInspector lists a cluster's services and describes them.
+type ecsServiceInspector interface {
+	ecsServiceLister
+	ecsServiceDescriber
+}
+
+// ServiceRow is one service as the service picker shows it.
+type ServiceRow struct {
+	Arn     string
+	Name    string
+	Desired int32
+	Running int32
+	Pending int32
+	// Rollout is the primary deployment's rollout state: IN_PROGRESS,
+	// COMPLETED or FAILED.
+	Rollout string
+	TaskDef string
+	Launch  string
+	Exec    bool
+	// Deployments are newest first, the primary one included.
+	Deployments []ServiceDeployment
+	// Events are the service's latest events, newest first.
+	Events []ServiceEvent
+}
+
+// ServiceDeployment is one of a service's deployments.
+type ServiceDeployment struct {
+	Status        string
+	TaskDef       string
+	Desired       int32
+	Running       int32
+	Pending       int32
+	Failed        int32
+	Rollout       string
+	RolloutReason string
+	UpdatedAt     time.Time
+}
+
+// ServiceEvent is one entry of a service's event log.
+type ServiceEvent struct {
+	At      time.Time
+	Message string
+}
+
+// serviceTableHeaders are the service picker's column titles.
+var serviceTableHeaders = []string{"SERVICE", "DESIRED", "RUNNING", "PENDING", "ROLLOUT", "TASK DEF", "LAUNCH", "EXEC"}
+
+// ListServiceRows lists the cluster's services and describes them in
+// batches, so the picker can show how each one is doing. Rows are sorted
+// by name.
+func (c *Cli) ListServiceRows(ctx context.Context, client ecsServiceInspector, clusterArn string) ([]ServiceRow, error) {
+	arns, err := listAllServiceArns(ctx, client, clusterArn)
+	if err != nil || len(arns) == 0 {
+		return nil, err
+	}
+	c.LogAWSCommand("ecs", "describe-services", "--cluster", clusterArn, "--services", strings.Join(arns, " "), "--profile", c.Profile, "--region", c.Region)
+	services, err := describeAllServices(ctx, client, clusterArn, arns)
+	if err != nil {
+		return nil, err
+	}
+	rows := serviceRows(services)
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+	return rows, nil
+}
+
+// describeAllServices describes arns in batches of
+// describeServicesBatchSize.
+func describeAllServices(ctx context.Context, client ecsServiceDescriber, clusterArn string, arns []string) ([]ecstypes.Service, error) {
+	var services []ecstypes.Service
+	for start := 0; start < len(arns); start += describeServicesBatchSize {
+		end := min(start+describeServicesBatchSize, len(arns))
+		out, err := client.DescribeServices(ctx, &ecs.DescribeServicesInput{
+			Cluster:  &clusterArn,
+			Services: arns[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, out.Services...)
+	}
+	return services, nil
+}
+
+func serviceRows(services []ecstypes.Service) []ServiceRow {
+	rows := make([]ServiceRow, 0, len(services))
+	for _, s := range services {
+		row := ServiceRow{
+			Arn:     aws.ToString(s.ServiceArn),
+			Name:    aws.ToString(s.ServiceName),
+			Desired: s.DesiredCount,
+			Running: s.RunningCount,
+			Pending: s.PendingCount,
+			TaskDef: taskDefLabel(aws.ToString(s.TaskDefinition)),
+			Launch:  string(s.LaunchType),
+			Exec:    s.EnableExecuteCommand,
+		}
+		if len(s.CapacityProviderStrategy) > 0 {
+			row.Launch = aws.ToString(s.CapacityProviderStrategy[0].CapacityProvider)
+		}
+		for _, d := range s.Deployments {
+			dep := ServiceDeployment{
+				Status:        aws.ToString(d.Status),
+				TaskDef:       taskDefLabel(aws.ToString(d.TaskDefinition)),
+				Desired:       d.DesiredCount,
+				Running:       d.RunningCount,
+				Pending:       d.PendingCount,
+				Failed:        d.FailedTasks,
+				Rollout:       string(d.RolloutState),
+				RolloutReason: aws.ToString(d.RolloutStateReason),
+				UpdatedAt:     aws.ToTime(d.UpdatedAt),
+			}
+			if dep.Status == "PRIMARY" {
+				row.Rollout = dep.Rollout
+				if row.Launch == "" && len(d.CapacityProviderStrategy) > 0 {
+					row.Launch = aws.ToString(d.CapacityProviderStrategy[0].CapacityProvider)
+				}
+			}
+			row.Deployments = append(row.Deployments, dep)
+		}
+		sort.SliceStable(row.Deployments, func(i, j int) bool {
+			return row.Deployments[i].UpdatedAt.After(row.Deployments[j].UpdatedAt)
+		})
+		for i, e := range s.Events {
+			if i == serviceDetailEvents {
+				break
+			}
+			row.Events = append(row.Events, ServiceEvent{At: aws.ToTime(e.CreatedAt), Message: aws.ToString(e.Message)})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// serviceTable lays rows out for the picker, keyed by service ARN, with the
+// deployments and latest events of each service as its detail. Pseudo
+// services (whose ARN is the pseudo name) get dashes.
+func serviceTable(rows []ServiceRow) *menuTable {
+	now := tableNow()
+	cells := make([][]string, len(rows))
+	sortBy := make([][]string, len(rows))
+	keys := make([]string, len(rows))
+	details := make([]string, len(rows))
+	for i, r := range rows {
+		keys[i] = r.Arn
+		if IsPseudoService(r.Arn) {
+			cells[i] = []string{r.Arn, "-", "-", "-", "-", "-", "-", "-"}
+			sortBy[i] = append([]string(nil), cells[i]...)
+			continue
+		}
+		exec := "off"
+		if r.Exec {
+			exec = "on"
+		}
+		cells[i] = []string{r.Name, fmt.Sprint(r.Desired), fmt.Sprint(r.Running), fmt.Sprint(r.Pending), dashIfEmpty(r.Rollout), dashIfEmpty(r.TaskDef), dashIfEmpty(r.Launch), exec}
+		sortBy[i] = make([]string, len(cells[i]))
+		for col, cell := range cells[i] {
+			sortBy[i][col] = strings.ToLower(cell)
+		}
+		for col, n := range []int32{r.Desired, r.Running, r.Pending} {
+			sortBy[i][col+1] = fmt.Sprintf("%010d", n)
+		}
+		details[i] = serviceDetail(now, r)
+	}
+	return newMenuTable(serviceTableHeaders, cells, sortBy, keys).withDetails(details)
+}
+
+// serviceDetail is the detail pane for a service: one line per deployment,
+// then its latest events.
+func serviceDetail(now time.Time, r ServiceRow) string {
+	var lines []string
+	for _, d := range r.Deployments {
+		line := fmt.Sprintf("%-7s  %s  %s  %d/%d running, %d pending", d.Status, d.TaskDef, dashIfEmpty(d.Rollout), d.Running, d.Desired, d.Pending)
+		if d.Failed > 0 {
+			line += fmt.Sprintf(", %d failed", d.Failed)
+		}
+		if age := compactAge(now, d.UpdatedAt); age != "" {
+			line += ", updated " + age + " ago"
+		}
+		if d.RolloutReason != "" && d.Rollout != string(ecstypes.DeploymentRolloutStateCompleted) {
+			line += " · " + d.RolloutReason
+		}
+		lines = append(lines, line)
+	}
+	for _, e := range r.Events {
+		lines = append(lines, fmt.Sprintf("%4s  %s", compactAge(now, e.At), e.Message))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// fakeServiceECS describes only the services asked for and records each
+// batch.
+type fakeServiceECS struct {
+	fakeECS
+	batches [][]string
+}
+
+func (f *fakeServiceECS) DescribeServices(_ context.Context, in *ecs.DescribeServicesInput, _ ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	f.batches = append(f.batches, in.Services)
+	var out []ecstypes.Service
+	for _, arn := range in.Services {
+		for _, s := range f.services {
+			if aws.ToString(s.ServiceArn) == arn {
+				out = append(out, s)
+			}
+		}
+	}
+	return &ecs.DescribeServicesOutput{Services: out}, nil
+}
+
+func richService(name string) ecstypes.Service {
+	return ecstypes.Service{
+		ServiceArn:           aws.String("arn:aws:ecs:eu-west-1:1:service/web/" + name),
+		ServiceName:          aws.String(name),
+		TaskDefinition:       aws.String("arn:aws:ecs:eu-west-1:1:task-definition/" + name + ":12"),
+		DesiredCount:         3,
+		RunningCount:         2,
+		PendingCount:         1,
+		LaunchType:           ecstypes.LaunchTypeFargate,
+		EnableExecuteCommand: true,
+		Deployments: []ecstypes.Deployment{
+			{
+				Status: aws.String("ACTIVE"), TaskDefinition: aws.String(name + ":11"), DesiredCount: 3, RunningCount: 2,
+				RolloutState: ecstypes.DeploymentRolloutStateCompleted, UpdatedAt: aws.Time(tableClock.Add(-2 * time.Hour)),
+			},
+			{
+				Status: aws.String("PRIMARY"), TaskDefinition: aws.String(name + ":12"), DesiredCount: 3, PendingCount: 1, FailedTasks: 4,
+				RolloutState: ecstypes.DeploymentRolloutStateInProgress, RolloutStateReason: aws.String("ECS deployment ecs-svc/1 in progress."),
+				UpdatedAt: aws.Time(tableClock.Add(-3 * time.Minute)),
+			},
+		},
+		Events: []ecstypes.ServiceEvent{
+			{CreatedAt: aws.Time(tableClock.Add(-time.Minute)), Message: aws.String("(service " + name + ") has started 1 tasks: (task abc).")},
+			{CreatedAt: aws.Time(tableClock.Add(-2 * time.Minute)), Message: aws.String("(service " + name + ") is unable to consistently start tasks successfully.")},
+		},
+	}
+}
+
+func TestListServiceRowsDescribesInBatches(t *testing.T) {
+	t.Parallel()
+
+	var arns []string
+	f := &fakeServiceECS{}
+	for i := 23; i > 0; i-- {
+		s := richService(fmt.Sprintf("svc-%02d", i))
+		arns = append(arns, aws.ToString(s.ServiceArn))
+		f.services = append(f.services, s)
+	}
+	f.servicesPages = [][]string{arns}
+	rows, err := (&Cli{}).ListServiceRows(context.Background(), f, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.batches) != 3 || len(f.batches[0]) != 10 || len(f.batches[2]) != 3 {
+		t.Fatalf("batches = %d", len(f.batches))
+	}
+	if len(rows) != 23 || rows[0].Name != "svc-01" || rows[22].Name != "svc-23" {
+		t.Fatalf("rows not sorted by name: %s .. %s", rows[0].Name, rows[len(rows)-1].Name)
+	}
+	r := rows[0]
+	if r.Rollout != "IN_PROGRESS" || r.TaskDef != "svc-01:12" || r.Launch != "FARGATE" || !r.Exec || r.Deployments[0].Status != "PRIMARY" {
+		t.Fatalf("row = %+v", r)
+	}
+}
+
+func TestServiceTable(t *testing.T) {
+	setTableNow(t)
+
+	rows := serviceRows([]ecstypes.Service{richService("api")})
+	rows = append(rows, ServiceRow{Arn: AllTasksService, Name: AllTasksService})
+	table := serviceTable(rows)
+	lines := table.lines()
+	if lines[0] != "api          3        2        1        IN_PROGRESS  api:12    FARGATE  on" {
+		t.Fatalf("row = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], AllTasksService+"  -") || table.detailFor(lines[1]) != "" {
+		t.Fatalf("pseudo row = %q", lines[1])
+	}
+
+	want := strings.Join([]string{
+		"PRIMARY  api:12  IN_PROGRESS  0/3 running, 1 pending, 4 failed, updated 3m ago · ECS deployment ecs-svc/1 in progress.",
+		"ACTIVE   api:11  COMPLETED  2/3 running, 0 pending, updated 2h ago",
+		"  1m  (service api) has started 1 tasks: (task abc).",
+		"  2m  (service api) is unable to consistently start tasks successfully.",
+	}, "\n")
+	if got := table.detailFor(lines[0]); got != want {
+		t.Fatalf("detail:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMenuShowsHighlightedDetail(t *testing.T) {
+	setTableNow(t)
+
+	first, second := richService("api"), richService("worker")
+	second.Events[0].Message = aws.String("(service worker) has reached a steady state.")
+	rows := serviceRows([]ecstypes.Service{first, second})
+	m := initialModel("Choose ECS service", nil, rows[1].Arn, true)
+	m.loading, m.height = true, 28
+	next, _ := m.Update(loadItemsMsg{table: serviceTable(rows)})
+	m = next.(menuModel)
+	if m.itemsPerPage != 20-detailRows {
+		t.Fatalf("itemsPerPage = %d", m.itemsPerPage)
+	}
+	view := m.menuViewOnly()
+	if !strings.Contains(view, "steady state") || strings.Contains(view, "has started 1 tasks") {
+		t.Fatalf("detail is not the highlighted service's:\n%s", view)
+	}
+}
@@ -0,0 +1,347 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// StatusLineEnabled reports whether sessions get a status bar: the
+// -status-line and -no-status-line flags win over status_line in
+// config.yaml.
+func (c *Cli) StatusLineEnabled() bool {
+	switch {
+	case c.NoStatusLine:
+		return false
+	case c.StatusLine:
+		return true
+	}
+	return c.settings().StatusLine
+}
+
+// statusLine is the bar at the bottom of an interactive session.
+type statusLine struct {
+	profile     string
+	region      string
+	target      string
+	container   string
+	environment string
+	startedAt   time.Time
+	// tokenExpiry reports when the profile's SSO token runs out; nil, or
+	// false, when there is no token to show.
+	tokenExpiry func() (time.Time, bool)
+}
+
+// newStatusLine describes the session opts opened at startedAt.
+func newStatusLine(c *Cli, opts ExecOptions, startedAt time.Time) statusLine {
+	parts := []string{displayTail(opts.ClusterArn)}
+	if opts.Service != "" && !IsPseudoService(opts.Service) {
+		parts = append(parts, displayTail(opts.Service))
+	}
+	parts = append(parts, displayTail(opts.TaskArn))
+	return statusLine{
+		profile:     c.Profile,
+		region:      opts.Region,
+		target:      strings.Join(parts, "/"),
+		container:   opts.Container,
+		environment: opts.Environment,
+		startedAt:   startedAt,
+		tokenExpiry: c.ssoTokenExpiry(),
+	}
+}
+
+// ssoTokenExpiry reads the expiry of the profile's cached SSO token each
+// time it is called, so a login in another terminal shows up. It is nil
+// for profiles that don't use SSO.
+func (c *Cli) ssoTokenExpiry() func() (time.Time, bool) {
+	sso, err := c.LookupSSOSessionConfig(c.Profile)
+	if err != nil || sso == nil {
+		return nil
+	}
+	path := ssoCachePath(sso.CacheKey())
+	return func() (time.Time, bool) {
+		t := loadCachedSSOToken(path)
+		if t == nil {
+			return time.Time{}, false
+		}
+		return t.ExpiresAt, true
+	}
+}
+
+// text is the bar's content at now, unstyled.
+func (s statusLine) text(now time.Time) string {
+	fields := []string{}
+	if s.environment != "" {
+		fields = append(fields, strings.ToUpper(s.environment))
+	}
+	profile := s.profile
+	if profile == "" {
+		profile = "default"
+	}
+	fields = append(fields,
+		profile+" · "+s.region,
+		s.target,
+		s.container,
+		"up "+now.Sub(s.startedAt).Round(time.Second).String(),
+	)
+	if s.tokenExpiry != nil {
+		if expires, ok := s.tokenExpiry(); ok {
+			if left := expires.Sub(now); left > 0 {
+				fields = append(fields, "SSO "+shortDuration(left))
+			} else {
+				fields = append(fields, "SSO expired")
+			}
+		}
+	}
+	return " " + strings.Join(fields, " │ ") + " "
+}
+
+// render is the bar as it is drawn on a terminal width columns wide: in the
+// environment's colours for a classified target, the theme's otherwise.
+func (s statusLine) render(width int) string {
+	text := s.text(time.Now())
+	for lipgloss.Width(text) > width {
+		r := []rune(text)
+		text = string(r[:len(r)-1])
+	}
+	text += strings.Repeat(" ", width-lipgloss.Width(text))
+	style := lipgloss.NewStyle().Foreground(CurrentTheme.StatusFg).Background(CurrentTheme.StatusBg)
+	if colors, ok := environmentColors[s.environment]; ok {
+		style = lipgloss.NewStyle().Foreground(colors.Fg).Background(colors.Bg).Bold(true)
+	}
+	return style.Render(text)
+}
+
+// shortDuration shows d to the minute: 3h05m, 42m.
+func shortDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+// statusClobbers are sequences after which the bar must be drawn again:
+// switching screens, resetting the terminal or its scroll region, and
+// clearing to the end of the screen.
+var statusClobbers = [][]byte{
+	[]byte("\x1b[?1049"),
+	[]byte("\x1b[?1047"),
+	[]byte("\x1b[?47"),
+	[]byte("\x1b[r"),
+	[]byte("\x1b[!p"),
+	[]byte("\x1bc"),
+	[]byte("\x1b[J"),
+	[]byte("\x1b[0J"),
+	[]byte("\x1b[2J"),
+}
+
+// statusClobberTail is how much of a write is kept to find a clobbering
+// sequence split across writes.
+const statusClobberTail = 7
+
+// statusOverlay keeps a status bar on the bottom row of the user's
+// terminal. The session gets the rows above it as a scroll region and a
+// PTY one row shorter, so it never writes there itself.
+//
+// Session output goes through Write, which looks for sequences that wipe
+// the bar and then draws it again. The bar is only drawn between escape
+// sequences and whole characters, so it can't split one. It saves and
+// restores the cursor around itself, which clobbers a cursor the session
+// saved the same way; full-screen apps that rely on that are rare.
+type statusOverlay struct {
+	mu     sync.Mutex
+	out    io.Writer // the session's output
+	term   io.Writer // the user's terminal, for the bar itself
+	render func(width int) string
+
+	cols, rows int
+	started    bool
+	dirty      bool
+	tail       []byte
+	seq        seqTracker
+}
+
+func newStatusOverlay(out, term io.Writer, render func(width int) string, cols, rows int) *statusOverlay {
+	return &statusOverlay{out: out, term: term, render: render, cols: cols, rows: rows}
+}
+
+// start makes room for the bar below the cursor and draws it.
+func (o *statusOverlay) start() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// A line feed scrolls the screen up if the cursor is on the bottom
+	// row; moving back up leaves it where it was otherwise.
+	fmt.Fprint(o.term, "\n\x1b[A")
+	o.started = true
+	o.drawLocked(true)
+}
+
+// resize follows a new terminal size.
+func (o *statusOverlay) resize(cols, rows int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.started && rows > o.rows {
+		// The old bar row is now part of the session's region.
+		fmt.Fprintf(o.term, "\x1b7\x1b[%d;1H\x1b[2K\x1b8", o.rows)
+	}
+	o.cols, o.rows = cols, rows
+	o.dirty = true
+	o.flushLocked()
+}
+
+// tick redraws the bar so the clocks on it move.
+func (o *statusOverlay) tick() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.started && o.seq.idle() {
+		o.drawLocked(o.dirty)
+		o.dirty = false
+	}
+}
+
+// stop gives the whole screen back to the terminal.
+func (o *statusOverlay) stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.started {
+		return
+	}
+	o.started = false
+	fmt.Fprintf(o.term, "\x1b7\x1b[%d;1H\x1b[2K\x1b[r\x1b8", o.rows)
+}
+
+func (o *statusOverlay) Write(p []byte) (int, error) {
+	return o.write(o.out, p)
+}
+
+// say prints a message of exec-ecs's own, such as an escape command's
+// reply, straight to the terminal. It is kept out of the recording but
+// otherwise treated like session output, so it never lands inside a
+// redraw of the bar.
+func (o *statusOverlay) say(msg string) {
+	_, _ = o.write(o.term, []byte(msg))
+}
+
+func (o *statusOverlay) write(w io.Writer, p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n, err := w.Write(p)
+	o.seq.feed(p[:n])
+
+	// The tail of the last write plus the start of this one covers
+	// sequences split between the two.
+	edge := append(o.tail, p[:min(n, statusClobberTail)]...)
+	for _, c := range statusClobbers {
+		if bytes.Contains(p[:n], c) || bytes.Contains(edge, c) {
+			o.dirty = true
+			break
+		}
+	}
+	if n >= statusClobberTail {
+		o.tail = append(o.tail[:0], p[n-statusClobberTail:n]...)
+	} else {
+		o.tail = append(o.tail, p[:n]...)
+		o.tail = o.tail[max(0, len(o.tail)-statusClobberTail):]
+	}
+
+	o.flushLocked()
+	return n, err
+}
+
+// flushLocked draws the bar if it was wiped and nothing is half-written.
+func (o *statusOverlay) flushLocked() {
+	if o.started && o.dirty && o.seq.idle() {
+		o.drawLocked(true)
+		o.dirty = false
+	}
+}
+
+// drawLocked draws the bar, setting the scroll region again first when
+// region is set.
+func (o *statusOverlay) drawLocked(region bool) {
+	if o.rows < 2 {
+		return
+	}
+	if region {
+		fmt.Fprintf(o.term, "\x1b7\x1b[1;%dr\x1b8", o.rows-1)
+	}
+	fmt.Fprintf(o.term, "\x1b7\x1b[%d;1H\x1b[2K%s\x1b8", o.rows, o.render(o.cols))
+}
+
+// seqTracker follows a terminal output stream far enough to tell whether
+// it stopped inside an escape sequence or a UTF-8 character.
+type seqTracker struct {
+	state seqState
+	// utf8 counts the continuation bytes still expected.
+	utf8 int
+}
+
+type seqState uint8
+
+const (
+	seqGround seqState = iota
+	seqEsc
+	seqCSI
+	// seqString is the body of an OSC, DCS, APC, PM or SOS string.
+	seqString
+	seqStringEsc
+)
+
+func (t *seqTracker) feed(p []byte) {
+	for _, b := range p {
+		switch t.state {
+		case seqGround:
+			switch {
+			case b == 0x1b:
+				t.state, t.utf8 = seqEsc, 0
+			case b&0xc0 == 0x80 && t.utf8 > 0:
+				t.utf8--
+			case b >= 0xf0:
+				t.utf8 = 3
+			case b >= 0xe0:
+				t.utf8 = 2
+			case b >= 0xc0:
+				t.utf8 = 1
+			default:
+				t.utf8 = 0
+			}
+		case seqEsc:
+			switch {
+			case b == '[':
+				t.state = seqCSI
+			case b == ']', b == 'P', b == '_', b == '^', b == 'X':
+				t.state = seqString
+			case b >= 0x20 && b <= 0x2f:
+				// An intermediate byte, as in ESC ( B.
+			default:
+				t.state = seqGround
+			}
+		case seqCSI:
+			if b >= 0x40 && b <= 0x7e {
+				t.state = seqGround
+			}
+		case seqString:
+			switch b {
+			case 0x07:
+				t.state = seqGround
+			case 0x1b:
+				t.state = seqStringEsc
+			}
+		case seqStringEsc:
+			if b == '\\' {
+				t.state = seqGround
+			} else {
+				t.state = seqString
+			}
+		}
+	}
+}
+
+// idle reports whether the stream is between sequences and characters.
+func (t *seqTracker) idle() bool { return t.state == seqGround && t.utf8 == 0 }
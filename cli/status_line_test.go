@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestStatusLineText(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start.Add(12*time.Minute + 4*time.Second)
+	s := statusLine{
+		profile: "shop", region: "eu-west-1", target: "web-prod/api/0abc", container: "app",
+		environment: EnvProd, startedAt: start,
+		tokenExpiry: func() (time.Time, bool) { return now.Add(3*time.Hour + 5*time.Minute), true },
+	}
+	want := " PROD │ shop · eu-west-1 │ web-prod/api/0abc │ app │ up 12m4s │ SSO 3h05m "
+	if got := s.text(now); got != want {
+		t.Fatalf("text:\n got %q\nwant %q", got, want)
+	}
+
+	s.environment = ""
+	s.tokenExpiry = func() (time.Time, bool) { return now.Add(-time.Minute), true }
+	if got := s.text(now); !strings.HasSuffix(got, "│ SSO expired ") || strings.Contains(got, "PROD") {
+		t.Fatalf("expired: %q", got)
+	}
+	s.tokenExpiry = nil
+	if got := s.text(now); strings.Contains(got, "SSO") {
+		t.Fatalf("no SSO: %q", got)
+	}
+}
+
+func TestStatusLineRenderFitsWidth(t *testing.T) {
+	t.Parallel()
+
+	s := statusLine{profile: "shop", region: "eu-west-1", target: "web-prod/api/0abc", container: "app", startedAt: time.Now()}
+	for _, width := range []int{10, 80} {
+		if got := s.render(width); !strings.Contains(got, "shop") || lipgloss.Width(got) != width {
+			t.Fatalf("width %d: %q", width, got)
+		}
+	}
+}
+
+func TestStatusOverlayRedrawsAfterClobber(t *testing.T) {
+	t.Parallel()
+
+	var out, term bytes.Buffer
+	o := newStatusOverlay(&out, &term, func(int) string { return "BAR" }, 80, 24)
+	o.start()
+	if got := term.String(); !strings.Contains(got, "\x1b[1;23r") || !strings.Contains(got, "\x1b[24;1H\x1b[2KBAR") {
+		t.Fatalf("start drew %q", got)
+	}
+
+	draws := func() int { return strings.Count(term.String(), "BAR") }
+	_, _ = o.Write([]byte("plain output\r\n"))
+	if draws() != 1 {
+		t.Fatal("plain output must not redraw")
+	}
+	// vim leaving the alternate screen, split across two writes.
+	_, _ = o.Write([]byte("bye\x1b[?10"))
+	_, _ = o.Write([]byte("49l"))
+	if draws() != 2 {
+		t.Fatalf("draws = %d after leaving the alternate screen", draws())
+	}
+	if out.String() != "plain output\r\nbye\x1b[?1049l" {
+		t.Fatalf("session output = %q", out.String())
+	}
+
+	// Never inside a sequence or a character.
+	_, _ = o.Write([]byte("\x1b[2J\x1b]0;ti"))
+	o.tick()
+	_, _ = o.Write([]byte("tle\x07\xe2\x94"))
+	o.tick()
+	if draws() != 2 {
+		t.Fatalf("drew inside a sequence: %q", term.String())
+	}
+	_, _ = o.Write([]byte("\x82"))
+	if draws() != 3 {
+		t.Fatalf("draws = %d after the clear", draws())
+	}
+
+	o.resize(100, 30)
+	if !strings.Contains(term.String(), "\x1b[1;29r") {
+		t.Fatalf("resize: %q", term.String())
+	}
+	o.stop()
+	if !strings.HasSuffix(term.String(), "\x1b7\x1b[30;1H\x1b[2K\x1b[r\x1b8") {
+		t.Fatalf("stop: %q", term.String())
+	}
+}
+
+func TestStatusOverlaySayBypassesRecording(t *testing.T) {
+	t.Parallel()
+
+	var out, term bytes.Buffer
+	o := newStatusOverlay(&out, &term, func(int) string { return "BAR" }, 80, 24)
+	o.start()
+	o.say("\r\n[exec-ecs] closing the session\r\n")
+	if out.Len() != 0 {
+		t.Fatalf("message reached the session output: %q", out.String())
+	}
+	if !strings.HasSuffix(term.String(), "BAR\x1b8\r\n[exec-ecs] closing the session\r\n") {
+		t.Fatalf("terminal = %q", term.String())
+	}
+}
+
+func TestStatusLineEnabled(t *testing.T) {
+	t.Parallel()
+
+	on := &Config{StatusLine: true}
+	cases := []struct {
+		c    Cli
+		want bool
+	}{
+		{Cli{}, false},
+		{Cli{Config: on}, true},
+		{Cli{StatusLine: true}, true},
+		{Cli{Config: on, NoStatusLine: true}, false},
+	}
+	for i, tc := range cases {
+		if got := tc.c.StatusLineEnabled(); got != tc.want {
+			t.Errorf("case %d: got %v", i, got)
+		}
+	}
+}
+
+func TestExecECSWiresStatusLine(t *testing.T) {
+	setHistoryFile(t)
+	prevStart, prevStarter := startExecuteCommand, sessionStarter
+	t.Cleanup(func() { startExecuteCommand, sessionStarter = prevStart, prevStarter })
+	startExecuteCommand = func(context.Context, ecsExecuteCommander, ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{
+			SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("tok"),
+		}}, nil
+	}
+	var bar string
+	sessionStarter = func(_ context.Context, _ string, _ *ecstypes.Session, opts ptyOptions) (int, error) {
+		if opts.StatusLine != nil {
+			bar = opts.StatusLine(200)
+		}
+		return 0, nil
+	}
+
+	opts := ExecOptions{Region: "eu-west-1", ClusterArn: prodClusterArn, Service: "api", TaskArn: "t1", Container: "app", Command: "bash"}
+	if _, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, opts); err != nil || bar != "" {
+		t.Fatalf("off by default: bar=%q err=%v", bar, err)
+	}
+	if _, err := ExecECS(context.Background(), &Cli{Profile: "shop", StatusLine: true}, aws.Config{}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(bar, "shop · eu-west-1 │ web-prod/api/t1 │ app │ up ") {
+		t.Fatalf("bar = %q", bar)
+	}
+}
@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// stoppedLogsLead is how far before a stopped task's end its logs start,
+// for tasks that ran longer than that; the lines just before a crash are
+// the ones that explain it.
+const stoppedLogsLead = 10 * time.Minute
+
+// ecsStoppedTaskLister lists and describes tasks that have stopped.
+type ecsStoppedTaskLister interface {
+	ecsTaskLister
+	ecsTaskDescriber
+}
+
+// StoppedTask is one stopped task as the stopped-task browser shows it.
+type StoppedTask struct {
+	Arn     string
+	ID      string
+	TaskDef string
+	// StopCode is ECS's category for the stop, such as
+	// EssentialContainerExited or TaskFailedToStart.
+	StopCode      string
+	StoppedReason string
+	CreatedAt     time.Time
+	StartedAt     time.Time
+	StoppingAt    time.Time
+	StoppedAt     time.Time
+	Containers    []StoppedContainer
+}
+
+// StoppedContainer is one container of a stopped task.
+type StoppedContainer struct {
+	Name       string
+	LastStatus string
+	// ExitCode is nil for a container that never ran.
+	ExitCode *int32
+	Reason   string
+}
+
+// ListStoppedTasks lists the service's stopped tasks, newest task
+// definition revision first and, within a revision, the most recent stop
+// first. ECS keeps stopped tasks for about an hour. For
+// StandaloneTasksService only tasks that no service owned are returned.
+func (c *Cli) ListStoppedTasks(ctx context.Context, client ecsStoppedTaskLister, clusterArn, serviceName string) ([]StoppedTask, error) {
+	args := []string{"--cluster", clusterArn, "--desired-status", "STOPPED"}
+	if serviceName != "" && !IsPseudoService(serviceName) {
+		args = append(args, "--service-name", serviceName)
+	}
+	c.LogAWSCommand("ecs", append(append([]string{"list-tasks"}, args...), "--profile", c.Profile, "--region", c.Region)...)
+	arns, err := listTaskArnsByStatus(ctx, client, clusterArn, serviceName, ecstypes.DesiredStatusStopped)
+	if err != nil || len(arns) == 0 {
+		return nil, err
+	}
+	c.LogAWSCommand("ecs", "describe-tasks", "--cluster", clusterArn, "--tasks", strings.Join(arns, " "), "--profile", c.Profile, "--region", c.Region)
+	tasks, err := describeAllTasks(ctx, client, clusterArn, arns)
+	if err != nil {
+		return nil, err
+	}
+	if serviceName == StandaloneTasksService {
+		standalone := tasks[:0]
+		for _, t := range tasks {
+			if !strings.HasPrefix(aws.ToString(t.Group), "service:") {
+				standalone = append(standalone, t)
+			}
+		}
+		tasks = standalone
+	}
+	return stoppedTasks(tasks), nil
+}
+
+func stoppedTasks(tasks []ecstypes.Task) []StoppedTask {
+	stopped := make([]StoppedTask, 0, len(tasks))
+	for _, t := range tasks {
+		arn := aws.ToString(t.TaskArn)
+		s := StoppedTask{
+			Arn:           arn,
+			ID:            arn[strings.LastIndex(arn, "/")+1:],
+			TaskDef:       taskDefLabel(aws.ToString(t.TaskDefinitionArn)),
+			StopCode:      string(t.StopCode),
+			StoppedReason: aws.ToString(t.StoppedReason),
+			CreatedAt:     aws.ToTime(t.CreatedAt),
+			StartedAt:     aws.ToTime(t.StartedAt),
+			StoppingAt:    aws.ToTime(t.StoppingAt),
+			StoppedAt:     aws.ToTime(t.StoppedAt),
+		}
+		for _, ct := range t.Containers {
+			s.Containers = append(s.Containers, StoppedContainer{
+				Name:       aws.ToString(ct.Name),
+				LastStatus: aws.ToString(ct.LastStatus),
+				ExitCode:   ct.ExitCode,
+				Reason:     aws.ToString(ct.Reason),
+			})
+		}
+		stopped = append(stopped, s)
+	}
+	sort.SliceStable(stopped, func(i, j int) bool {
+		a, b := stopped[i], stopped[j]
+		af, ar := splitTaskDef(a.TaskDef)
+		bf, br := splitTaskDef(b.TaskDef)
+		switch {
+		case af != bf:
+			return af < bf
+		case ar != br:
+			return ar > br
+		}
+		return a.StoppedAt.After(b.StoppedAt)
+	})
+	return stopped
+}
+
+// splitTaskDef splits family:revision, so revision 10 sorts after 9.
+func splitTaskDef(label string) (string, int) {
+	family, rev, _ := strings.Cut(label, ":")
+	n, _ := strconv.Atoi(rev)
+	return family, n
+}
+
+// Ran is how long the task ran, or zero if it never started.
+func (t StoppedTask) Ran() time.Duration {
+	if t.StartedAt.IsZero() || t.StoppedAt.IsZero() {
+		return 0
+	}
+	return t.StoppedAt.Sub(t.StartedAt)
+}
+
+// LogsSince is the -since that covers the task's logs: from its creation,
+// or stoppedLogsLead before it stopped if it ran longer than that, with a
+// minute to spare for clock skew.
+func (t StoppedTask) LogsSince(now time.Time) time.Duration {
+	from := t.CreatedAt
+	if lead := t.StoppedAt.Add(-stoppedLogsLead); !t.StoppedAt.IsZero() && lead.After(from) {
+		from = lead
+	}
+	if from.IsZero() {
+		return defaultLogsSince
+	}
+	return now.Sub(from) + time.Minute
+}
+
+// exitLabel is a container's exit code, or "-" if it has none.
+func (c StoppedContainer) exitLabel() string {
+	if c.ExitCode == nil {
+		return "-"
+	}
+	return strconv.Itoa(int(*c.ExitCode))
+}
+
+// stoppedTableHeaders are the stopped-task browser's column titles.
+var stoppedTableHeaders = []string{"TASK DEF", "TASK", "STOPPED", "RAN", "STOP CODE", "EXIT CODES", "REASON"}
+
+// stoppedTable lays stopped tasks out for the browser, keyed by task ARN,
+// in the order ListStoppedTasks returns them so each revision's tasks stay
+// together. Ages sort by time rather than by their text.
+func stoppedTable(tasks []StoppedTask) *menuTable {
+	now := tableNow()
+	cells := make([][]string, len(tasks))
+	sortBy := make([][]string, len(tasks))
+	keys := make([]string, len(tasks))
+	for i, t := range tasks {
+		id := t.ID
+		if len(id) > shortTaskIDLen {
+			id = id[:shortTaskIDLen]
+		}
+		exits := make([]string, len(t.Containers))
+		for j, ct := range t.Containers {
+			exits[j] = ct.Name + "=" + ct.exitLabel()
+		}
+		ran := ""
+		if t.Ran() > 0 {
+			ran = compactAge(t.StoppedAt, t.StartedAt)
+		}
+		cells[i] = []string{t.TaskDef, id, dashIfEmpty(compactAge(now, t.StoppedAt)), dashIfEmpty(ran), dashIfEmpty(t.StopCode), dashIfEmpty(strings.Join(exits, " ")), dashIfEmpty(truncateForDisplay(t.StoppedReason))}
+		sortBy[i] = make([]string, len(cells[i]))
+		for col, cell := range cells[i] {
+			sortBy[i][col] = strings.ToLower(cell)
+		}
+		family, rev := splitTaskDef(t.TaskDef)
+		sortBy[i][0] = fmt.Sprintf("%s:%010d", strings.ToLower(family), rev)
+		sortBy[i][2] = fmt.Sprintf("%020d", now.Sub(t.StoppedAt))
+		sortBy[i][3] = fmt.Sprintf("%020d", t.Ran())
+		keys[i] = t.Arn
+	}
+	return newMenuTable(stoppedTableHeaders, cells, sortBy, keys)
+}
+
+// ContainerItems are the menu lines for the task's containers, in order,
+// each with its exit code and reason.
+func (t StoppedTask) ContainerItems() []string {
+	width := 0
+	for _, ct := range t.Containers {
+		width = max(width, len(ct.Name))
+	}
+	items := make([]string, len(t.Containers))
+	for i, ct := range t.Containers {
+		items[i] = strings.TrimRight(fmt.Sprintf("%-*s  exit %-3s  %s", width, ct.Name, ct.exitLabel(), truncateForDisplay(ct.Reason)), " ")
+	}
+	return items
+}
+
+// WriteStoppedTask prints everything ECS recorded about why the task
+// stopped, with times in the local zone.
+func WriteStoppedTask(w io.Writer, t StoppedTask) {
+	stamp := func(ts time.Time) string {
+		if ts.IsZero() {
+			return "-"
+		}
+		return ts.Local().Format("2006-01-02 15:04:05 MST")
+	}
+	fmt.Fprintf(w, "Task       %s\n", t.Arn)
+	fmt.Fprintf(w, "Task def   %s\n", t.TaskDef)
+	fmt.Fprintf(w, "Stop code  %s\n", dashIfEmpty(t.StopCode))
+	fmt.Fprintf(w, "Reason     %s\n", dashIfEmpty(t.StoppedReason))
+	fmt.Fprintf(w, "Created    %s\n", stamp(t.CreatedAt))
+	fmt.Fprintf(w, "Started    %s\n", stamp(t.StartedAt))
+	fmt.Fprintf(w, "Stopping   %s\n", stamp(t.StoppingAt))
+	fmt.Fprintf(w, "Stopped    %s", stamp(t.StoppedAt))
+	if ran := t.Ran(); ran > 0 {
+		fmt.Fprintf(w, " (ran %s)", ran.Round(time.Second))
+	}
+	fmt.Fprintln(w)
+	if len(t.Containers) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nContainers")
+	width := 0
+	for _, ct := range t.Containers {
+		width = max(width, len(ct.Name))
+	}
+	for _, ct := range t.Containers {
+		line := fmt.Sprintf("  %-*s  %-8s  exit %-3s  %s", width, ct.Name, dashIfEmpty(ct.LastStatus), ct.exitLabel(), ct.Reason)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func stoppedTask(id, def string, stoppedAt time.Time, group string, containers ...ecstypes.Container) ecstypes.Task {
+	return ecstypes.Task{
+		TaskArn:           aws.String("arn:aws:ecs:eu-west-1:1:task/web/" + id),
+		TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:1:task-definition/" + def),
+		Group:             aws.String(group),
+		StopCode:          ecstypes.TaskStopCodeEssentialContainerExited,
+		StoppedReason:     aws.String("Essential container in task exited"),
+		CreatedAt:         aws.Time(stoppedAt.Add(-time.Minute)),
+		StartedAt:         aws.Time(stoppedAt.Add(-40 * time.Second)),
+		StoppedAt:         aws.Time(stoppedAt),
+		Containers:        containers,
+	}
+}
+
+func TestListStoppedTasksGroupsByRevision(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	f := &fakeECS{
+		tasksPages: [][]string{{"a", "b"}, {"c", "d"}},
+		describeTasks: []ecstypes.Task{
+			stoppedTask("a", "api:9", now.Add(-3*time.Minute), "service:api"),
+			stoppedTask("b", "api:10", now.Add(-5*time.Minute), "service:api"),
+			stoppedTask("c", "api:10", now.Add(-time.Minute), "service:api"),
+			stoppedTask("d", "api:9", now.Add(-time.Minute), "service:api"),
+		},
+	}
+	tasks, err := (&Cli{}).ListStoppedTasks(context.Background(), f, "web", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, task := range tasks {
+		order = append(order, task.ID)
+	}
+	if got := strings.Join(order, " "); got != "c b d a" {
+		t.Fatalf("order = %s", got)
+	}
+	if f.taskStatuses[0] != ecstypes.DesiredStatusStopped || f.taskServices[0] != "api" || f.taskCalls != 2 {
+		t.Fatalf("listed %v %v in %d calls", f.taskStatuses, f.taskServices, f.taskCalls)
+	}
+
+	f = &fakeECS{
+		tasksPages:    [][]string{{"a", "b"}},
+		describeTasks: []ecstypes.Task{stoppedTask("a", "api:9", now, "service:api"), stoppedTask("b", "job:1", now, "family:job")},
+	}
+	tasks, err = (&Cli{}).ListStoppedTasks(context.Background(), f, "web", StandaloneTasksService)
+	if err != nil || len(tasks) != 1 || tasks[0].ID != "b" || f.taskServices[0] != "" {
+		t.Fatalf("standalone: %+v %v", tasks, err)
+	}
+}
+
+func TestStoppedTable(t *testing.T) {
+	prev := tableNow
+	t.Cleanup(func() { tableNow = prev })
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	tableNow = func() time.Time { return now }
+
+	task := stoppedTask("0123456789abcdef", "api:10", now.Add(-4*time.Minute), "service:api",
+		ecstypes.Container{Name: aws.String("app"), ExitCode: aws.Int32(137), Reason: aws.String("OutOfMemoryError: Container killed due to memory usage")},
+		ecstypes.Container{Name: aws.String("envoy")},
+	)
+	failed := stoppedTask("fedcba9876543210", "api:9", now.Add(-2*time.Minute), "service:api")
+	failed.StopCode, failed.StartedAt = ecstypes.TaskStopCodeTaskFailedToStart, nil
+	table := stoppedTable(stoppedTasks([]ecstypes.Task{failed, task}))
+
+	lines := table.lines()
+	if !strings.HasPrefix(lines[0], "api:10    0123456789ab  4m       40s  EssentialContainerExited  app=137 envoy=-  Essential container in task exited") {
+		t.Fatalf("row 0 = %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "2m       -    TaskFailedToStart") {
+		t.Fatalf("row 1 = %q", lines[1])
+	}
+	if key := table.keyFor(lines[1]); key != aws.ToString(failed.TaskArn) {
+		t.Fatalf("key = %q", key)
+	}
+}
+
+func TestStoppedTaskDetails(t *testing.T) {
+	t.Parallel()
+
+	stop := time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local)
+	task := stoppedTasks([]ecstypes.Task{stoppedTask("abc", "api:10", stop, "service:api",
+		ecstypes.Container{Name: aws.String("app"), LastStatus: aws.String("STOPPED"), ExitCode: aws.Int32(1), Reason: aws.String("CannotPullContainerError")},
+		ecstypes.Container{Name: aws.String("sidecar"), LastStatus: aws.String("STOPPED"), ExitCode: aws.Int32(0)},
+	)})[0]
+
+	items := task.ContainerItems()
+	if items[0] != "app      exit 1    CannotPullContainerError" || items[1] != "sidecar  exit 0" {
+		t.Fatalf("items = %q", items)
+	}
+
+	var out bytes.Buffer
+	WriteStoppedTask(&out, task)
+	for _, want := range []string{
+		"Stop code  EssentialContainerExited\n",
+		"Stopped    2026-03-01 09:00:00 ",
+		" (ran 40s)\n",
+		"  app      STOPPED   exit 1    CannotPullContainerError\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+
+	if got := task.LogsSince(stop.Add(time.Hour)); got != time.Hour+2*time.Minute {
+		t.Fatalf("since created: %s", got)
+	}
+	task.CreatedAt = stop.Add(-24 * time.Hour)
+	if got := task.LogsSince(stop.Add(time.Hour)); got != time.Hour+stoppedLogsLead+time.Minute {
+		t.Fatalf("long-running: %s", got)
+	}
+}
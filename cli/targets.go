@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Task selection strategies for named targets.
+const (
+	StrategyNewest = "newest"
+	StrategyOldest = "oldest"
+	StrategyRandom = "random"
+	StrategyAZ     = "az"
+)
+
+// TargetConfig is one entry under `targets:` in config.yaml. Every field
+// except the strategy can be overridden by the matching flag, so
+// `exec-ecs @web-prod -cn sidecar` reuses the rest of the bookmark.
+type TargetConfig struct {
+	Profile   string `yaml:"profile"`
+	Region    string `yaml:"region"`
+	Cluster   string `yaml:"cluster"`
+	Service   string `yaml:"service"`
+	Container string `yaml:"container"`
+	// Command replaces the -command default; an explicit -command wins.
+	Command string `yaml:"command"`
+	// Strategy picks one of the service's running tasks: newest (the
+	// default), oldest, random, or az to stay in AZ.
+	Strategy string `yaml:"strategy"`
+	AZ       string `yaml:"az"`
+}
+
+// taskPicker is the random source for StrategyRandom, swapped out in tests.
+var taskPicker = rand.IntN
+
+// LookupTarget returns the named target from config.yaml, checking that its
+// strategy is one we know.
+func (c *Cli) LookupTarget(name string) (TargetConfig, error) {
+	targets := c.settings().Targets
+	t, ok := targets[name]
+	if !ok {
+		names := make([]string, 0, len(targets))
+		for n := range targets {
+			names = append(names, "@"+n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return t, fmt.Errorf("unknown target @%s: no targets are defined in %s", name, configPath())
+		}
+		return t, fmt.Errorf("unknown target @%s (defined: %s)", name, strings.Join(names, ", "))
+	}
+	switch t.Strategy {
+	case "", StrategyNewest, StrategyOldest, StrategyRandom:
+	case StrategyAZ:
+		if t.AZ == "" {
+			return t, fmt.Errorf("target @%s: strategy az needs an az", name)
+		}
+	default:
+		return t, fmt.Errorf("target @%s: unknown strategy %q (want newest, oldest, random or az)", name, t.Strategy)
+	}
+	return t, nil
+}
+
+// ApplyTarget copies t into the fields the flags left empty.
+func (c *Cli) ApplyTarget(t TargetConfig) {
+	fill := func(dst *string, v string) {
+		if *dst == "" {
+			*dst = v
+		}
+	}
+	fill(&c.Profile, t.Profile)
+	fill(&c.Region, t.Region)
+	fill(&c.ClusterArn, t.Cluster)
+	fill(&c.Service, t.Service)
+	fill(&c.Container, t.Container)
+	if t.Command != "" && !c.explicit["command"] {
+		c.Command = t.Command
+	}
+}
+
+// ResolveNamedTarget turns a named target into a live task without
+// prompting: the service's tasks are listed and described, and t.Strategy
+// picks one of those that are running. A -tk flag skips the pick.
+func ResolveNamedTarget(ctx context.Context, c *Cli, client ECSClient, t TargetConfig, state State) (State, error) {
+	if state.Profile == "" || state.Region == "" {
+		return state, fmt.Errorf("target @%s needs a profile and region (in config.yaml, or via -pr and -rg)", c.Target)
+	}
+	state, err := resolveCluster(ctx, c, client, state)
+	if err != nil {
+		return state, err
+	}
+	if state.TaskArn == "" {
+		if state, err = resolveService(ctx, c, client, state); err != nil {
+			return state, err
+		}
+		c.LogAWSCommand("ecs", "list-tasks", "--cluster", state.ClusterArn, "--service-name", state.Service, "--profile", c.Profile, "--region", c.Region)
+		arns, err := listAllTaskArns(ctx, client, state.ClusterArn, state.Service)
+		if err != nil {
+			return state, fmt.Errorf("list tasks: %w", err)
+		}
+		if len(arns) == 0 {
+			return state, fmt.Errorf("service %s has no running tasks", displayTail(state.Service))
+		}
+		c.LogAWSCommand("ecs", "describe-tasks", "--cluster", state.ClusterArn, "--tasks", strings.Join(arns, " "), "--profile", c.Profile, "--region", c.Region)
+		tasks, err := describeAllTasks(ctx, client, state.ClusterArn, arns)
+		if err != nil {
+			return state, fmt.Errorf("describe tasks: %w", err)
+		}
+		task, err := pickTaskByStrategy(tasks, t.Strategy, t.AZ)
+		if err != nil {
+			return state, fmt.Errorf("target @%s: %w", c.Target, err)
+		}
+		state.TaskArn = aws.ToString(task.TaskArn)
+	}
+	return resolveContainer(ctx, c, client, state)
+}
+
+// pickTaskByStrategy applies a selection strategy to the running tasks
+// among tasks.
+func pickTaskByStrategy(tasks []ecstypes.Task, strategy, az string) (ecstypes.Task, error) {
+	var running []ecstypes.Task
+	for _, t := range tasks {
+		if aws.ToString(t.LastStatus) == "RUNNING" {
+			running = append(running, t)
+		}
+	}
+	if len(running) == 0 {
+		return ecstypes.Task{}, fmt.Errorf("none of the %d task(s) is running", len(tasks))
+	}
+
+	if strategy == StrategyAZ {
+		var inAZ []ecstypes.Task
+		seen := map[string]bool{}
+		var zones []string
+		for _, t := range running {
+			zone := aws.ToString(t.AvailabilityZone)
+			if zone == az {
+				inAZ = append(inAZ, t)
+			} else if !seen[zone] {
+				seen[zone] = true
+				zones = append(zones, zone)
+			}
+		}
+		if len(inAZ) == 0 {
+			return ecstypes.Task{}, fmt.Errorf("no running task in %s (tasks are in %s)", az, strings.Join(zones, ", "))
+		}
+		running = inAZ
+	}
+
+	switch strategy {
+	case StrategyRandom:
+		return running[taskPicker(len(running))], nil
+	case StrategyOldest:
+		sort.SliceStable(running, func(i, j int) bool { return taskStarted(running[i]).Before(taskStarted(running[j])) })
+	default:
+		sort.SliceStable(running, func(i, j int) bool { return taskStarted(running[i]).After(taskStarted(running[j])) })
+	}
+	return running[0], nil
+}
+
+// taskStarted is when the task started running, or when it was created if
+// ECS hasn't reported a start yet.
+func taskStarted(t ecstypes.Task) time.Time {
+	if t.StartedAt != nil {
+		return *t.StartedAt
+	}
+	return aws.ToTime(t.CreatedAt)
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+func TestLookupTarget(t *testing.T) {
+	t.Parallel()
+
+	c := &Cli{Config: &Config{Targets: map[string]TargetConfig{
+		"web":      {Service: "api"},
+		"db":       {Strategy: StrategyOldest},
+		"bad":      {Strategy: "fastest"},
+		"zoneless": {Strategy: StrategyAZ},
+	}}}
+	if got, err := c.LookupTarget("web"); err != nil || got.Service != "api" {
+		t.Fatalf("got=%+v err=%v", got, err)
+	}
+	tests := map[string]string{
+		"nope":     "defined: @bad, @db, @web, @zoneless",
+		"bad":      `unknown strategy "fastest"`,
+		"zoneless": "needs an az",
+	}
+	for name, want := range tests {
+		if _, err := c.LookupTarget(name); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LookupTarget(%q) err = %v, want %q", name, err, want)
+		}
+	}
+	if _, err := (&Cli{}).LookupTarget("web"); err == nil || !strings.Contains(err.Error(), "no targets are defined") {
+		t.Fatalf("empty config err = %v", err)
+	}
+}
+
+func TestApplyTargetKeepsFlags(t *testing.T) {
+	t.Parallel()
+
+	target := TargetConfig{Profile: "prod", Region: "eu-west-1", Cluster: "web", Service: "api", Container: "app", Command: "rails c"}
+	c := &Cli{Container: "sidecar", Command: "bash"}
+	c.ApplyTarget(target)
+	if c.Profile != "prod" || c.Region != "eu-west-1" || c.ClusterArn != "web" || c.Service != "api" {
+		t.Fatalf("target not applied: %+v", c)
+	}
+	if c.Container != "sidecar" {
+		t.Fatalf("-cn should win, got %q", c.Container)
+	}
+	if c.Command != "rails c" {
+		t.Fatalf("target command should replace the default, got %q", c.Command)
+	}
+
+	c = &Cli{Command: "uptime", explicit: map[string]bool{"command": true}}
+	c.ApplyTarget(target)
+	if c.Command != "uptime" {
+		t.Fatalf("explicit -command should win, got %q", c.Command)
+	}
+}
+
+func strategyTask(arn, status, az string, started time.Time) ecstypes.Task {
+	return ecstypes.Task{
+		TaskArn:          aws.String(arn),
+		LastStatus:       aws.String(status),
+		AvailabilityZone: aws.String(az),
+		StartedAt:        aws.Time(started),
+	}
+}
+
+func TestPickTaskByStrategy(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tasks := []ecstypes.Task{
+		strategyTask("mid", "RUNNING", "a", base.Add(time.Hour)),
+		strategyTask("old", "RUNNING", "b", base),
+		strategyTask("new", "RUNNING", "a", base.Add(2*time.Hour)),
+		strategyTask("stopping", "DEACTIVATING", "c", base.Add(3*time.Hour)),
+	}
+	prev := taskPicker
+	taskPicker = func(n int) int { return n - 1 }
+	t.Cleanup(func() { taskPicker = prev })
+
+	tests := []struct {
+		strategy, az, want string
+	}{
+		{"", "", "new"},
+		{StrategyNewest, "", "new"},
+		{StrategyOldest, "", "old"},
+		{StrategyRandom, "", "new"},
+		{StrategyAZ, "a", "new"},
+		{StrategyAZ, "b", "old"},
+	}
+	for _, tc := range tests {
+		got, err := pickTaskByStrategy(tasks, tc.strategy, tc.az)
+		if err != nil || aws.ToString(got.TaskArn) != tc.want {
+			t.Errorf("%s/%s: got %s err=%v, want %s", tc.strategy, tc.az, aws.ToString(got.TaskArn), err, tc.want)
+		}
+	}
+
+	if _, err := pickTaskByStrategy(tasks, StrategyAZ, "c"); err == nil || !strings.Contains(err.Error(), "tasks are in a, b") {
+		t.Fatalf("AZ miss err = %v", err)
+	}
+	if _, err := pickTaskByStrategy(tasks[3:], "", ""); err == nil {
+		t.Fatal("no running task should be an error")
+	}
+
+	// A task that hasn't reported StartedAt yet sorts by CreatedAt.
+	pending := ecstypes.Task{TaskArn: aws.String("fresh"), LastStatus: aws.String("RUNNING"), CreatedAt: aws.Time(base.Add(5 * time.Hour))}
+	if got, _ := pickTaskByStrategy(append([]ecstypes.Task{pending}, tasks...), "", ""); aws.ToString(got.TaskArn) != "fresh" {
+		t.Fatalf("got %s", aws.ToString(got.TaskArn))
+	}
+}
+
+func TestResolveNamedTarget(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	older := strategyTask("t1", "RUNNING", "a", base)
+	newest := strategyTask("t2", "RUNNING", "a", base.Add(time.Hour))
+	older.Containers = []ecstypes.Container{{Name: aws.String("app")}}
+	newest.Containers = older.Containers
+	f := &fakeECS{
+		tasksPages:    [][]string{{"t1", "t2"}},
+		describeTasks: []ecstypes.Task{older, newest},
+	}
+	c := &Cli{Target: "web"}
+	state, err := ResolveNamedTarget(context.Background(), c, f, TargetConfig{}, State{
+		Profile: "p", Region: "r", ClusterArn: "web", Service: "api",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if state.TaskArn != "t2" || state.Container != "app" {
+		t.Fatalf("state = %+v", state)
+	}
+
+	// -tk pins the task and skips the listing.
+	f = &fakeECS{describeTasks: []ecstypes.Task{containerTask("app")}}
+	state, err = ResolveNamedTarget(context.Background(), c, f, TargetConfig{}, State{
+		Profile: "p", Region: "r", ClusterArn: "web", TaskArn: "pinned",
+	})
+	if err != nil || state.TaskArn != "pinned" || f.taskCalls != 0 {
+		t.Fatalf("state=%+v err=%v listCalls=%d", state, err, f.taskCalls)
+	}
+}
+
+func TestResolveNamedTargetErrors(t *testing.T) {
+	t.Parallel()
+
+	full := State{Profile: "p", Region: "r", ClusterArn: "web", Service: "api"}
+	tests := []struct {
+		name  string
+		f     *fakeECS
+		state State
+		want  string
+	}{
+		{"no profile", &fakeECS{}, State{Region: "r"}, "needs a profile and region"},
+		{"cluster lookup", &fakeECS{clusterErr: errors.New("boom")}, State{Profile: "p", Region: "r"}, "list clusters"},
+		{"service lookup", &fakeECS{serviceErr: errors.New("boom")}, State{Profile: "p", Region: "r", ClusterArn: "web"}, "list services"},
+		{"list tasks", &fakeECS{taskErr: errors.New("boom")}, full, "list tasks"},
+		{"no tasks", &fakeECS{}, full, "no running tasks"},
+		{"describe", &fakeECS{tasksPages: [][]string{{"t1"}}, describeTaskErr: errors.New("boom")}, full, "describe tasks"},
+		{"none running", &fakeECS{tasksPages: [][]string{{"t1"}}, describeTasks: []ecstypes.Task{{LastStatus: aws.String("PENDING")}}}, full, "@web: none of the 1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ResolveNamedTarget(context.Background(), &Cli{Target: "web"}, tc.f, TargetConfig{}, tc.state)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// batchDescriber records the size of each DescribeTasks call.
+type batchDescriber struct{ batches []int }
+
+func (b *batchDescriber) DescribeTasks(_ context.Context, in *ecs.DescribeTasksInput, _ ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	b.batches = append(b.batches, len(in.Tasks))
+	out := &ecs.DescribeTasksOutput{}
+	for _, arn := range in.Tasks {
+		out.Tasks = append(out.Tasks, ecstypes.Task{TaskArn: aws.String(arn)})
+	}
+	return out, nil
+}
+
+func TestDescribeAllTasksBatches(t *testing.T) {
+	t.Parallel()
+
+	arns := make([]string, 250)
+	for i := range arns {
+		arns[i] = "t"
+	}
+	b := &batchDescriber{}
+	tasks, err := describeAllTasks(context.Background(), b, "c", arns)
+	if err != nil || len(tasks) != 250 {
+		t.Fatalf("tasks=%d err=%v", len(tasks), err)
+	}
+	if len(b.batches) != 3 || b.batches[0] != 100 || b.batches[2] != 50 {
+		t.Fatalf("batches = %v", b.batches)
+	}
+}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// defaultProtectionMinutes is how long each protection grant lasts when
+// config.yaml doesn't say; it is renewed while the session stays open, so
+// this only bounds how long a crashed run keeps the task pinned.
+const defaultProtectionMinutes = 30
+
+// getTaskProtectionBatchSize is the most tasks GetTaskProtection accepts.
+const getTaskProtectionBatchSize = 10
+
+type ecsTaskProtector interface {
+	ecsTaskProtectionGetter
+	UpdateTaskProtection(ctx context.Context, params *ecs.UpdateTaskProtectionInput, optFns ...func(*ecs.Options)) (*ecs.UpdateTaskProtectionOutput, error)
+}
+
+// ProtectionEnabled reports whether sessions should protect their task from
+// scale-in: -protect and -no-protect win over protection.enabled in
+// config.yaml.
+func (c *Cli) ProtectionEnabled() bool {
+	switch {
+	case c.NoProtect:
+		return false
+	case c.Protect:
+		return true
+	}
+	return c.settings().Protection.Enabled
+}
+
+func (c *Cli) protectionMinutes() int {
+	if m := c.settings().Protection.ExpiresMinutes; m > 0 {
+		return m
+	}
+	return defaultProtectionMinutes
+}
+
+// protectTask turns on scale-in protection for the session's task and
+// returns a func that turns it off again. Swapped out in tests.
+var protectTask = startTaskProtection
+
+// startTaskProtection enables protection for opts.TaskArn and renews it at
+// half its lifetime until the returned release func is called. A task that
+// is already protected for longer (by the application itself, say) is left
+// alone, and so is its protection on release. Failures only warn: losing
+// the protection must not cost anyone their session.
+func startTaskProtection(ctx context.Context, c *Cli, client ecsTaskProtector, opts ExecOptions) func() {
+	minutes := c.protectionMinutes()
+	lifetime := time.Duration(minutes) * time.Minute
+
+	if until, err := taskProtectedUntil(ctx, client, opts.ClusterArn, opts.TaskArn); err == nil && until.After(time.Now().Add(lifetime)) {
+		fmt.Fprintf(os.Stderr, "Task is already protected from scale-in until %s; leaving that as it is.\n", until.Local().Format("15:04"))
+		return func() {}
+	}
+
+	update := func(ctx context.Context, enable bool) error {
+		c.LogAWSCommand("ecs", "update-task-protection", "--cluster", opts.ClusterArn, "--tasks", opts.TaskArn, fmt.Sprintf("--protection-enabled=%t", enable), "--expires-in-minutes", fmt.Sprint(minutes), "--profile", c.Profile, "--region", opts.Region)
+		in := &ecs.UpdateTaskProtectionInput{Cluster: &opts.ClusterArn, Tasks: []string{opts.TaskArn}, ProtectionEnabled: enable}
+		if enable {
+			in.ExpiresInMinutes = aws.Int32(int32(minutes))
+		}
+		out, err := client.UpdateTaskProtection(ctx, in)
+		if err != nil {
+			return err
+		}
+		if len(out.Failures) > 0 {
+			return fmt.Errorf("%s", aws.ToString(out.Failures[0].Reason))
+		}
+		return nil
+	}
+	if err := update(ctx, true); err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs: could not protect the task from scale-in:", err)
+		return func() {}
+	}
+	fmt.Fprintf(os.Stderr, "Task protected from scale-in (renewed every %s while the session is open).\n", protectionRenewInterval(lifetime))
+
+	renewCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(protectionRenewInterval(lifetime))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				if err := update(renewCtx, true); err != nil && renewCtx.Err() == nil {
+					fmt.Fprintln(os.Stderr, "\r\nexec-ecs: could not renew scale-in protection:", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+		if err := update(context.WithoutCancel(ctx), false); err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs: could not remove scale-in protection:", err)
+		}
+	}
+}
+
+// protectionRenewInterval is how often protection is renewed, swapped out
+// in tests.
+var protectionRenewInterval = func(lifetime time.Duration) time.Duration { return lifetime / 2 }
+
+func taskProtectedUntil(ctx context.Context, client ecsTaskProtectionGetter, clusterArn, taskArn string) (time.Time, error) {
+	out, err := client.GetTaskProtection(ctx, &ecs.GetTaskProtectionInput{Cluster: &clusterArn, Tasks: []string{taskArn}})
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, p := range out.ProtectedTasks {
+		if p.ProtectionEnabled {
+			return aws.ToTime(p.ExpirationDate), nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// fillTaskProtection sets ProtectedUntil on the service tasks among rows.
+// Protection is a nice-to-have in the picker, so errors (typically a
+// missing ecs:GetTaskProtection permission) just leave the column empty.
+func fillTaskProtection(ctx context.Context, client ecsTaskProtectionGetter, clusterArn string, rows []TaskRow) {
+	var arns []string
+	byArn := make(map[string]*TaskRow, len(rows))
+	for i := range rows {
+		if !rows[i].Standalone() {
+			arns = append(arns, rows[i].Arn)
+			byArn[rows[i].Arn] = &rows[i]
+		}
+	}
+	for start := 0; start < len(arns); start += getTaskProtectionBatchSize {
+		end := min(start+getTaskProtectionBatchSize, len(arns))
+		out, err := client.GetTaskProtection(ctx, &ecs.GetTaskProtectionInput{Cluster: &clusterArn, Tasks: arns[start:end]})
+		if err != nil {
+			return
+		}
+		for _, p := range out.ProtectedTasks {
+			if row := byArn[aws.ToString(p.TaskArn)]; row != nil && p.ProtectionEnabled {
+				row.ProtectedUntil = aws.ToTime(p.ExpirationDate)
+			}
+		}
+	}
+}
+
+// drainingStatuses are the task states in which ECS is already taking the
+// task down.
+var drainingStatuses = map[string]bool{"DEACTIVATING": true, "STOPPING": true, "DEPROVISIONING": true, "STOPPED": true}
+
+// TaskWarnings lists reasons a session in row's task may be cut short: the
+// task is draining, or its service is mid-deployment and may replace it.
+func (c *Cli) TaskWarnings(ctx context.Context, client ecsServiceDescriber, clusterArn, service string, row TaskRow) []string {
+	var warnings []string
+	if drainingStatuses[row.Status] || row.Desired == "STOPPED" {
+		warnings = append(warnings, fmt.Sprintf("The task is being stopped (status %s, desired %s); the session may be cut off.", row.Status, dashIfEmpty(row.Desired)))
+	}
+	if service == "" || IsPseudoService(service) {
+		return warnings
+	}
+	c.LogAWSCommand("ecs", "describe-services", "--cluster", clusterArn, "--services", service, "--profile", c.Profile, "--region", c.Region)
+	out, err := client.DescribeServices(ctx, &ecs.DescribeServicesInput{Cluster: &clusterArn, Services: []string{service}})
+	if err != nil || len(out.Services) == 0 {
+		return warnings
+	}
+	if d := deploymentInProgress(out.Services[0].Deployments); d != "" {
+		warnings = append(warnings, fmt.Sprintf("The service has a deployment in progress (%s); this task may be replaced.", d))
+	}
+	return warnings
+}
+
+// deploymentInProgress describes the rollout under way, or returns "".
+func deploymentInProgress(deployments []ecstypes.Deployment) string {
+	for _, d := range deployments {
+		if aws.ToString(d.Status) == "PRIMARY" && d.RolloutState == ecstypes.DeploymentRolloutStateInProgress {
+			return fmt.Sprintf("%s, %d of %d tasks running", taskDefLabel(aws.ToString(d.TaskDefinition)), d.RunningCount, d.DesiredCount)
+		}
+	}
+	if len(deployments) > 1 {
+		return fmt.Sprintf("%d deployments active", len(deployments))
+	}
+	return ""
+}
+
+// protectionLabel formats the PROTECTED column: time left, or "-".
+func protectionLabel(now, until time.Time) string {
+	if until.IsZero() || !until.After(now) {
+		return "-"
+	}
+	return compactAge(until, now)
+}
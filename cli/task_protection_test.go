@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+type fakeProtector struct {
+	mu        sync.Mutex
+	until     time.Time
+	updateErr error
+	updates   []*ecs.UpdateTaskProtectionInput
+}
+
+func (f *fakeProtector) GetTaskProtection(_ context.Context, in *ecs.GetTaskProtectionInput, _ ...func(*ecs.Options)) (*ecs.GetTaskProtectionOutput, error) {
+	if f.until.IsZero() {
+		return &ecs.GetTaskProtectionOutput{ProtectedTasks: []ecstypes.ProtectedTask{{TaskArn: &in.Tasks[0]}}}, nil
+	}
+	return &ecs.GetTaskProtectionOutput{ProtectedTasks: []ecstypes.ProtectedTask{{TaskArn: &in.Tasks[0], ProtectionEnabled: true, ExpirationDate: aws.Time(f.until)}}}, nil
+}
+
+func (f *fakeProtector) UpdateTaskProtection(_ context.Context, in *ecs.UpdateTaskProtectionInput, _ ...func(*ecs.Options)) (*ecs.UpdateTaskProtectionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, in)
+	return &ecs.UpdateTaskProtectionOutput{}, f.updateErr
+}
+
+func (f *fakeProtector) calls() []*ecs.UpdateTaskProtectionInput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*ecs.UpdateTaskProtectionInput(nil), f.updates...)
+}
+
+func TestProtectionEnabled(t *testing.T) {
+	t.Parallel()
+
+	on := &Config{Protection: ProtectionConfig{Enabled: true}}
+	cases := []struct {
+		c    Cli
+		want bool
+	}{
+		{Cli{}, false},
+		{Cli{Protect: true}, true},
+		{Cli{Config: on}, true},
+		{Cli{Config: on, NoProtect: true}, false},
+	}
+	for i, tc := range cases {
+		if got := tc.c.ProtectionEnabled(); got != tc.want {
+			t.Errorf("case %d: ProtectionEnabled = %v", i, got)
+		}
+	}
+	if got := (&Cli{Config: &Config{Protection: ProtectionConfig{ExpiresMinutes: 90}}}).protectionMinutes(); got != 90 {
+		t.Fatalf("protectionMinutes = %d", got)
+	}
+}
+
+func TestStartTaskProtectionRenewsAndReleases(t *testing.T) {
+	prev := protectionRenewInterval
+	t.Cleanup(func() { protectionRenewInterval = prev })
+	protectionRenewInterval = func(time.Duration) time.Duration { return time.Millisecond }
+
+	f := &fakeProtector{}
+	release := startTaskProtection(context.Background(), &Cli{}, f, ExecOptions{ClusterArn: "web", TaskArn: "t1"})
+	deadline := time.Now().Add(time.Second)
+	for len(f.calls()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	release()
+
+	calls := f.calls()
+	if len(calls) < 3 {
+		t.Fatalf("expected the protection to be renewed, got %d update(s)", len(calls))
+	}
+	first, last := calls[0], calls[len(calls)-1]
+	if !first.ProtectionEnabled || aws.ToInt32(first.ExpiresInMinutes) != defaultProtectionMinutes {
+		t.Fatalf("first update = %+v", first)
+	}
+	if last.ProtectionEnabled {
+		t.Fatal("release must turn protection off")
+	}
+}
+
+func TestStartTaskProtectionLeavesLongerProtectionAlone(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeProtector{until: time.Now().Add(24 * time.Hour)}
+	startTaskProtection(context.Background(), &Cli{}, f, ExecOptions{ClusterArn: "web", TaskArn: "t1"})()
+	if n := len(f.calls()); n != 0 {
+		t.Fatalf("expected no updates, got %d", n)
+	}
+
+	f = &fakeProtector{updateErr: errors.New("not a service task")}
+	startTaskProtection(context.Background(), &Cli{}, f, ExecOptions{ClusterArn: "web", TaskArn: "t1"})()
+	if n := len(f.calls()); n != 1 {
+		t.Fatalf("a failed grant should not be renewed or released, got %d updates", n)
+	}
+}
+
+func TestExecECSProtectsTask(t *testing.T) {
+	prevStart, prevStarter, prevProtect := startExecuteCommand, sessionStarter, protectTask
+	t.Cleanup(func() { startExecuteCommand, sessionStarter, protectTask = prevStart, prevStarter, prevProtect })
+	startExecuteCommand = func(context.Context, ecsExecuteCommander, ExecOptions) (*ecs.ExecuteCommandOutput, error) {
+		return &ecs.ExecuteCommandOutput{Session: &ecstypes.Session{SessionId: aws.String("s"), StreamUrl: aws.String("wss://x"), TokenValue: aws.String("t")}}, nil
+	}
+	var events []string
+	protectTask = func(context.Context, *Cli, ecsTaskProtector, ExecOptions) func() {
+		events = append(events, "protect")
+		return func() { events = append(events, "release") }
+	}
+	sessionStarter = func(context.Context, string, *ecstypes.Session, ptyOptions) (int, error) {
+		events = append(events, "session")
+		return 0, nil
+	}
+	setHistoryFile(t)
+
+	if _, err := ExecECS(context.Background(), &Cli{}, aws.Config{}, ExecOptions{Region: "eu-west-1", TaskArn: "t1", Protect: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(events, ","); got != "protect,session,release" {
+		t.Fatalf("events = %s", got)
+	}
+}
+
+func TestListTaskRowsShowsProtection(t *testing.T) {
+	setTableNow(t)
+
+	f := &fakeECS{
+		tasksPages:    [][]string{{"a"}},
+		describeTasks: []ecstypes.Task{richTask("a", "RUNNING", time.Hour)},
+		protected: []ecstypes.ProtectedTask{{
+			TaskArn:           aws.String("arn:aws:ecs:eu-west-1:1:task/web/a"),
+			ProtectionEnabled: true,
+			ExpirationDate:    aws.Time(tableClock.Add(45 * time.Minute)),
+		}},
+	}
+	rows, err := (&Cli{}).ListTaskRows(context.Background(), f, "web", "api")
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("rows = %v, %v", rows, err)
+	}
+	if line := taskTable(rows).lines()[0]; !strings.HasSuffix(line, "on    45m") {
+		t.Fatalf("line = %q", line)
+	}
+
+	f = &fakeECS{tasksPages: [][]string{{"a"}}, describeTasks: f.describeTasks, protectionErr: errors.New("denied")}
+	if rows, err := (&Cli{}).ListTaskRows(context.Background(), f, "web", "api"); err != nil || !rows[0].ProtectedUntil.IsZero() {
+		t.Fatalf("a protection lookup failure should be ignored: %v, %v", rows, err)
+	}
+}
+
+func TestTaskWarnings(t *testing.T) {
+	t.Parallel()
+
+	f := &fakeECS{services: []ecstypes.Service{{Deployments: []ecstypes.Deployment{
+		{Status: aws.String("PRIMARY"), RolloutState: ecstypes.DeploymentRolloutStateInProgress, TaskDefinition: aws.String("arn:aws:ecs:eu-west-1:1:task-definition/api:13"), RunningCount: 1, DesiredCount: 3},
+		{Status: aws.String("ACTIVE")},
+	}}}}
+	c := &Cli{}
+	got := c.TaskWarnings(context.Background(), f, "web", "api", TaskRow{Status: "DEACTIVATING", Desired: "STOPPED"})
+	if len(got) != 2 || !strings.Contains(got[0], "being stopped") || !strings.Contains(got[1], "api:13, 1 of 3") {
+		t.Fatalf("warnings = %q", got)
+	}
+	if got := c.TaskWarnings(context.Background(), f, "web", AllTasksService, TaskRow{Status: "RUNNING", Desired: "RUNNING"}); len(got) != 0 {
+		t.Fatalf("pseudo service warnings = %q", got)
+	}
+
+	f.services[0].Deployments = []ecstypes.Deployment{{Status: aws.String("PRIMARY"), RolloutState: ecstypes.DeploymentRolloutStateCompleted}}
+	if got := c.TaskWarnings(context.Background(), f, "web", "api", TaskRow{Status: "RUNNING", Desired: "RUNNING"}); len(got) != 0 {
+		t.Fatalf("steady service warnings = %q", got)
+	}
+	if got := deploymentInProgress([]ecstypes.Deployment{{}, {}}); got != "2 deployments active" {
+		t.Fatalf("deploymentInProgress = %q", got)
+	}
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// shortTaskIDLen is how much of a task ID the picker shows, like a short
+// git hash; it is plenty to tell a service's tasks apart.
+const shortTaskIDLen = 12
+
+// ecsTaskInspector lists a service's tasks, describes them and reads their
+// scale-in protection.
+type ecsTaskInspector interface {
+	ecsTaskLister
+	ecsTaskDescriber
+	ecsTaskProtectionGetter
+}
+
+// TaskRow is one task as the task picker shows it.
+type TaskRow struct {
+	Arn     string
+	ID      string
+	Status  string
+	Desired string
+	Health  string
+	AZ      string
+	IP      string
+	Started time.Time
+	TaskDef string
+	Launch  string
+	Exec    bool
+	// ProtectedUntil is when the task's scale-in protection expires (zero
+	// when it has none).
+	ProtectedUntil time.Time
+	// Group is "service:<name>" for service tasks and "family:<name>" (or
+	// whatever RunTask was given) for standalone ones.
+	Group     string
+	StartedBy string
+}
+
+// Standalone reports whether the task was not started by a service.
+func (r TaskRow) Standalone() bool {
+	return !strings.HasPrefix(r.Group, "service:")
+}
+
+// taskTableHeaders are the picker's column titles. Filters name a column by
+// its title in lower case without spaces, e.g. `taskdef:api:12`.
+var taskTableHeaders = []string{"TASK", "STATUS", "HEALTH", "AZ", "IP", "AGE", "TASK DEF", "LAUNCH", "EXEC", "PROTECTED"}
+
+// taskOriginHeaders are added for cluster-level views, where tasks from
+// different services and jobs are mixed.
+var taskOriginHeaders = []string{"GROUP", "STARTED BY"}
+
+// ListTaskRows lists the service's tasks and describes them in batches, so
+// the picker can show more than the ARN. For StandaloneTasksService only
+// tasks that no service owns are returned.
+func (c *Cli) ListTaskRows(ctx context.Context, client ecsTaskInspector, clusterArn, serviceName string) ([]TaskRow, error) {
+	arns, err := listAllTaskArns(ctx, client, clusterArn, serviceName)
+	if err != nil || len(arns) == 0 {
+		return nil, err
+	}
+	c.LogAWSCommand("ecs", "describe-tasks", "--cluster", clusterArn, "--tasks", strings.Join(arns, " "), "--profile", c.Profile, "--region", c.Region)
+	tasks, err := describeAllTasks(ctx, client, clusterArn, arns)
+	if err != nil {
+		return nil, err
+	}
+	rows := taskRows(tasks)
+	if serviceName == StandaloneTasksService {
+		standalone := rows[:0]
+		for _, r := range rows {
+			if r.Standalone() {
+				standalone = append(standalone, r)
+			}
+		}
+		rows = standalone
+	}
+	fillTaskProtection(ctx, client, clusterArn, rows)
+	return rows, nil
+}
+
+func taskRows(tasks []ecstypes.Task) []TaskRow {
+	rows := make([]TaskRow, 0, len(tasks))
+	for _, t := range tasks {
+		arn := aws.ToString(t.TaskArn)
+		launch := aws.ToString(t.CapacityProviderName)
+		if launch == "" {
+			launch = string(t.LaunchType)
+		}
+		rows = append(rows, TaskRow{
+			Arn:       arn,
+			ID:        arn[strings.LastIndex(arn, "/")+1:],
+			Status:    aws.ToString(t.LastStatus),
+			Desired:   aws.ToString(t.DesiredStatus),
+			Health:    string(t.HealthStatus),
+			AZ:        aws.ToString(t.AvailabilityZone),
+			IP:        taskPrivateIP(t),
+			Started:   aws.ToTime(t.StartedAt),
+			TaskDef:   taskDefLabel(aws.ToString(t.TaskDefinitionArn)),
+			Launch:    launch,
+			Exec:      t.EnableExecuteCommand,
+			Group:     aws.ToString(t.Group),
+			StartedBy: aws.ToString(t.StartedBy),
+		})
+	}
+	return rows
+}
+
+// taskPrivateIP reads the awsvpc ENI address, falling back to the first
+// container network interface (bridge and host tasks have neither).
+func taskPrivateIP(t ecstypes.Task) string {
+	for _, a := range t.Attachments {
+		for _, d := range a.Details {
+			if aws.ToString(d.Name) == "privateIPv4Address" {
+				return aws.ToString(d.Value)
+			}
+		}
+	}
+	for _, c := range t.Containers {
+		for _, ni := range c.NetworkInterfaces {
+			if ip := aws.ToString(ni.PrivateIpv4Address); ip != "" {
+				return ip
+			}
+		}
+	}
+	return ""
+}
+
+// taskDefLabel shortens a task definition ARN to family:revision.
+func taskDefLabel(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// compactAge formats how long ago t was in the largest whole unit.
+func compactAge(now, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// tableNow is the clock for task ages, swapped out in tests.
+var tableNow = time.Now
+
+// taskTable lays rows out for the picker, keyed by task ARN. Ages sort by
+// start time rather than by their text, and tasks that haven't started yet
+// sort as the youngest. The group and started-by columns appear only when
+// the rows are not all from one service.
+func taskTable(rows []TaskRow) *menuTable {
+	now := tableNow()
+	headers := taskTableHeaders
+	if mixedOrigins(rows) {
+		headers = append(append([]string(nil), taskTableHeaders...), taskOriginHeaders...)
+	}
+	cells := make([][]string, len(rows))
+	sortBy := make([][]string, len(rows))
+	keys := make([]string, len(rows))
+	for i, r := range rows {
+		exec := "off"
+		if r.Exec {
+			exec = "on"
+		}
+		id := r.ID
+		if len(id) > shortTaskIDLen {
+			id = id[:shortTaskIDLen]
+		}
+		cells[i] = []string{id, r.Status, dashIfEmpty(r.Health), dashIfEmpty(r.AZ), dashIfEmpty(r.IP), dashIfEmpty(compactAge(now, r.Started)), r.TaskDef, dashIfEmpty(r.Launch), exec, protectionLabel(now, r.ProtectedUntil)}
+		if len(headers) > len(taskTableHeaders) {
+			cells[i] = append(cells[i], dashIfEmpty(r.Group), dashIfEmpty(r.StartedBy))
+		}
+		sortBy[i] = make([]string, len(cells[i]))
+		for col, cell := range cells[i] {
+			sortBy[i][col] = strings.ToLower(cell)
+		}
+		age := time.Duration(0)
+		if !r.Started.IsZero() {
+			age = now.Sub(r.Started)
+		}
+		sortBy[i][5] = fmt.Sprintf("%020d", age)
+		keys[i] = r.Arn
+	}
+	return newMenuTable(headers, cells, sortBy, keys)
+}
+
+// mixedOrigins reports whether rows include a standalone task or tasks from
+// more than one service.
+func mixedOrigins(rows []TaskRow) bool {
+	for _, r := range rows {
+		if r.Standalone() || r.Group != rows[0].Group {
+			return true
+		}
+	}
+	return false
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
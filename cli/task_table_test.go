@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var tableClock = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func setTableNow(t *testing.T) {
+	t.Helper()
+	prev := tableNow
+	tableNow = func() time.Time { return tableClock }
+	t.Cleanup(func() { tableNow = prev })
+}
+
+func richTask(id, status string, age time.Duration) ecstypes.Task {
+	return ecstypes.Task{
+		TaskArn:              aws.String("arn:aws:ecs:eu-west-1:1:task/web/" + id),
+		LastStatus:           aws.String(status),
+		HealthStatus:         ecstypes.HealthStatusHealthy,
+		AvailabilityZone:     aws.String("eu-west-1a"),
+		StartedAt:            aws.Time(tableClock.Add(-age)),
+		TaskDefinitionArn:    aws.String("arn:aws:ecs:eu-west-1:1:task-definition/api:12"),
+		LaunchType:           ecstypes.LaunchTypeFargate,
+		EnableExecuteCommand: true,
+		Group:                aws.String("service:api"),
+		Attachments: []ecstypes.Attachment{{Details: []ecstypes.KeyValuePair{
+			{Name: aws.String("subnetId"), Value: aws.String("subnet-1")},
+			{Name: aws.String("privateIPv4Address"), Value: aws.String("10.0.1.5")},
+		}}},
+	}
+}
+
+func TestTaskRows(t *testing.T) {
+	t.Parallel()
+
+	bridge := ecstypes.Task{
+		TaskArn:              aws.String("arn:aws:ecs:eu-west-1:1:task/web/bbb"),
+		LastStatus:           aws.String("PENDING"),
+		CapacityProviderName: aws.String("spot"),
+		LaunchType:           ecstypes.LaunchTypeEc2,
+		Containers: []ecstypes.Container{{NetworkInterfaces: []ecstypes.NetworkInterface{
+			{PrivateIpv4Address: aws.String("172.17.0.2")},
+		}}},
+	}
+	rows := taskRows([]ecstypes.Task{richTask("aaa", "RUNNING", time.Hour), bridge})
+	got := rows[0]
+	if got.ID != "aaa" || got.Status != "RUNNING" || got.Health != "HEALTHY" || got.AZ != "eu-west-1a" ||
+		got.IP != "10.0.1.5" || got.TaskDef != "api:12" || got.Launch != "FARGATE" || !got.Exec {
+		t.Fatalf("row = %+v", got)
+	}
+	if rows[1].IP != "172.17.0.2" || rows[1].Launch != "spot" || !rows[1].Started.IsZero() || rows[1].Exec {
+		t.Fatalf("bridge row = %+v", rows[1])
+	}
+	if ip := taskPrivateIP(ecstypes.Task{}); ip != "" {
+		t.Fatalf("no network = %q", ip)
+	}
+}
+
+func TestCompactAge(t *testing.T) {
+	t.Parallel()
+
+	tests := map[time.Duration]string{
+		20 * time.Second: "20s",
+		5 * time.Minute:  "5m",
+		30 * time.Hour:   "30h",
+		72 * time.Hour:   "3d",
+	}
+	for d, want := range tests {
+		if got := compactAge(tableClock, tableClock.Add(-d)); got != want {
+			t.Errorf("compactAge(%v) = %q want %q", d, got, want)
+		}
+	}
+	if got := compactAge(tableClock, time.Time{}); got != "" {
+		t.Errorf("zero = %q", got)
+	}
+}
+
+func TestTaskTableSortsAgeByTime(t *testing.T) {
+	setTableNow(t)
+
+	rows := taskRows([]ecstypes.Task{
+		richTask("0123456789abcdef", "RUNNING", 3*time.Hour),
+		richTask("b", "RUNNING", 30*time.Minute),
+		richTask("c", "RUNNING", 2*24*time.Hour),
+	})
+	rows = append(rows, TaskRow{Arn: "arn:aws:ecs:eu-west-1:1:task/web/d", ID: "d", Status: "PROVISIONING", Group: "service:api"})
+	tb := taskTable(rows)
+	if line := tb.lineFor(rows[0].Arn); !strings.HasPrefix(line, "0123456789ab  RUNNING") || !strings.Contains(line, "3h") || !strings.HasSuffix(line, "on    -") {
+		t.Fatalf("line = %q", line)
+	}
+	if line := tb.lineFor("arn:aws:ecs:eu-west-1:1:task/web/d"); !strings.Contains(line, "PROVISIONING  -") || !strings.HasSuffix(line, "off   -") {
+		t.Fatalf("unstarted line = %q", line)
+	}
+	for tb.sortCol != 5 {
+		tb.nextSort()
+	}
+	var order []string
+	for _, line := range tb.lines() {
+		order = append(order, strings.Fields(line)[0])
+	}
+	if strings.Join(order, " ") != "d b 0123456789ab c" {
+		t.Fatalf("age order = %v", order)
+	}
+	if !tb.matches(tb.lineFor(rows[1].Arn), "taskdef:api:12 age:30m") {
+		t.Fatal("column filter on task def and age")
+	}
+}
+
+func TestCliListTaskRows(t *testing.T) {
+	t.Parallel()
+
+	c := &Cli{}
+	f := &fakeECS{tasksPages: [][]string{{"a"}}, describeTasks: []ecstypes.Task{richTask("a", "RUNNING", time.Minute)}}
+	rows, err := c.ListTaskRows(context.Background(), f, "c", "s")
+	if err != nil || len(rows) != 1 || rows[0].ID != "a" {
+		t.Fatalf("rows=%+v err=%v", rows, err)
+	}
+	if rows, err := c.ListTaskRows(context.Background(), &fakeECS{}, "c", "s"); err != nil || rows != nil {
+		t.Fatalf("no tasks: rows=%v err=%v", rows, err)
+	}
+	f = &fakeECS{tasksPages: [][]string{{"a"}}, describeTaskErr: errors.New("denied")}
+	if _, err := c.ListTaskRows(context.Background(), f, "c", "s"); err == nil {
+		t.Fatal("describe error should surface")
+	}
+}
+
+// repeatingKey sends key every few milliseconds until closed, so a picker
+// that ignores keys while loading still sees one once the rows are in.
+type repeatingKey struct {
+	key  byte
+	done chan struct{}
+}
+
+func (r *repeatingKey) Read(p []byte) (int, error) {
+	select {
+	case <-r.done:
+		return 0, errors.New("closed")
+	case <-time.After(10 * time.Millisecond):
+		p[0] = r.key
+		return 1, nil
+	}
+}
+
+func TestPromptTaskLoadedReturnsArn(t *testing.T) {
+	setTableNow(t)
+	in := &repeatingKey{key: '\r', done: make(chan struct{})}
+	defer close(in.done)
+	prev := promptExtraOpts
+	promptExtraOpts = []tea.ProgramOption{tea.WithInput(in), tea.WithOutput(&bytes.Buffer{})}
+	t.Cleanup(func() { promptExtraOpts = prev })
+
+	rows := taskRows([]ecstypes.Task{richTask("a", "RUNNING", time.Hour), richTask("b", "RUNNING", time.Minute)})
+	got, goBack, err := (&Cli{}).PromptTaskLoadedBreadcrumb("Loading", "Choose ECS task", rows[1].Arn, true, "", func() ([]TaskRow, error) {
+		return rows, nil
+	})
+	if err != nil || goBack || got != rows[1].Arn {
+		t.Fatalf("got=%q goBack=%v err=%v", got, goBack, err)
+	}
+
+	_, _, err = (&Cli{}).PromptTaskLoadedBreadcrumb("Loading", "Choose ECS task", "", true, "", func() ([]TaskRow, error) {
+		return nil, errors.New("boom")
+	})
+	if err == nil {
+		t.Fatal("load error should surface")
+	}
+}
+
+func TestMenuTableMode(t *testing.T) {
+	setTableNow(t)
+
+	rows := taskRows([]ecstypes.Task{richTask("a", "RUNNING", time.Hour), richTask("b", "STOPPED", time.Minute)})
+	m := initialModel("Choose ECS task", nil, rows[1].Arn, true)
+	m.loading = true
+	next, _ := m.Update(loadItemsMsg{table: taskTable(rows)})
+	m = next.(menuModel)
+	if m.cursor != 1 {
+		t.Fatalf("default row not preselected: cursor=%d", m.cursor)
+	}
+	view := m.View()
+	if !strings.Contains(view, "TASK  STATUS") || !strings.Contains(view, "s/S Sort") {
+		t.Fatalf("view missing table header:\n%s", view)
+	}
+	if !strings.Contains(m.menuViewOnly(), "TASK DEF") || !strings.Contains(m.menuHelpOnly(), "s Sort") {
+		t.Fatal("ide view missing table chrome")
+	}
+
+	// Sort by status descending puts STOPPED first.
+	next, _ = m.Update(keyMsg("s"))
+	next, _ = next.Update(keyMsg("s"))
+	next, _ = next.Update(keyMsg("S"))
+	m = next.(menuModel)
+	if !strings.Contains(m.filteredItems[0], "STOPPED") {
+		t.Fatalf("sorted = %q", m.filteredItems)
+	}
+
+	m.filterMode = true
+	if !strings.Contains(m.menuHelpOnly(), "column:value") {
+		t.Fatal("filter help should mention column filters")
+	}
+	m.filterItems("status:run")
+	if len(m.filteredItems) != 1 || !strings.Contains(m.filteredItems[0], "RUNNING") {
+		t.Fatalf("filtered = %q", m.filteredItems)
+	}
+}
+
+func TestListTaskRowsClusterLevel(t *testing.T) {
+	t.Parallel()
+
+	job := richTask("job", "RUNNING", time.Minute)
+	job.Group = aws.String("family:migrate")
+	job.StartedBy = aws.String("events-rule/nightly")
+	svc := richTask("svc", "RUNNING", time.Minute)
+	newFake := func() *fakeECS {
+		return &fakeECS{tasksPages: [][]string{{"job", "svc"}}, describeTasks: []ecstypes.Task{job, svc}}
+	}
+
+	f := newFake()
+	rows, err := (&Cli{}).ListTaskRows(context.Background(), f, "c", StandaloneTasksService)
+	if err != nil || len(rows) != 1 || rows[0].ID != "job" || rows[0].StartedBy != "events-rule/nightly" {
+		t.Fatalf("standalone rows=%+v err=%v", rows, err)
+	}
+	if f.taskServices[0] != "" {
+		t.Fatalf("cluster-level listing sent service %q", f.taskServices[0])
+	}
+
+	f = newFake()
+	rows, _ = (&Cli{}).ListTaskRows(context.Background(), f, "c", AllTasksService)
+	if len(rows) != 2 {
+		t.Fatalf("all rows = %+v", rows)
+	}
+	tb := taskTable(rows)
+	if !strings.Contains(tb.header(), "GROUP") || !tb.matches(tb.lineFor(rows[0].Arn), "startedby:nightly") {
+		t.Fatalf("mixed view needs origin columns: %q", tb.header())
+	}
+	if strings.Contains(taskTable(rows[1:]).header(), "GROUP") {
+		t.Fatal("a single service's tasks don't need origin columns")
+	}
+
+	f = newFake()
+	_, _ = (&Cli{}).ListTaskRows(context.Background(), f, "c", "arn:aws:ecs:r:1:service/web/api")
+	if f.taskServices[0] != "arn:aws:ecs:r:1:service/web/api" {
+		t.Fatalf("service listing sent %q", f.taskServices[0])
+	}
+}
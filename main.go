@@ -1,14 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"ecs-tool/cli"
 	"ecs-tool/installer"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -43,12 +46,74 @@ func main() {
 	installer.CheckAndInstallDependencies()
 
 	c := initializeCLI(ctx)
+	cli.HistoryReplayer = func(e cli.HistoryEntry) error {
+		// Replay on a copy so the entry's profile/region don't leak into
+		// the picker the user returns to.
+		replay := *c
+		return replayHistoryEntry(ctx, &replay, e)
+	}
 
 	if c.History {
-		showHistoryAndExecute(c)
+		showHistoryAndExecute(ctx, c)
 		return
 	}
 
+	if c.Target != "" {
+		t, err := c.LookupTarget(c.Target)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			os.Exit(cli.ExitUsage)
+		}
+		c.ApplyTarget(t)
+	}
+
+	if c.Once && c.Subcommand != "" && c.Subcommand != "exec" {
+		fmt.Fprintf(os.Stderr, "exec-ecs: -once runs a single exec session; it cannot be combined with %s\n", c.Subcommand)
+		os.Exit(cli.ExitUsage)
+	}
+	if c.PolicyCheck && c.Subcommand != "" && c.Subcommand != "exec" {
+		fmt.Fprintf(os.Stderr, "exec-ecs: -policy-check checks exec sessions; it does not apply to %s\n", c.Subcommand)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if c.Subcommand == "logs" {
+		// Before -all-tasks, which logs takes to mean every task's logs.
+		os.Exit(runLogs(ctx, c))
+	}
+	if c.AllTasks {
+		os.Exit(runAllTasks(ctx, c))
+	}
+	if c.Once {
+		os.Exit(runOnce(ctx, c))
+	}
+
+	if c.Subcommand == "forward" {
+		os.Exit(runForward(ctx, c))
+	}
+	if c.Subcommand == "cp" {
+		os.Exit(runCopy(ctx, c))
+	}
+	if c.Subcommand == "doctor" {
+		os.Exit(runDoctor(ctx, c))
+	}
+	if c.Subcommand == "debug" {
+		os.Exit(runDebug(ctx, c))
+	}
+	if c.Subcommand == "stopped" {
+		os.Exit(runStopped(ctx, c))
+	}
+	if c.Subcommand == "replay" {
+		os.Exit(runReplay(c))
+	}
+	if c.Subcommand == "dashboard" {
+		// Enter on a service carries on into the usual task picker below.
+		if code, picked := runDashboard(ctx, c); !picked {
+			os.Exit(code)
+		}
+	} else if c.Target != "" {
+		os.Exit(runNamedTarget(ctx, c))
+	}
+
 	state := stepState{
 		Profile:    c.Profile,
 		Region:     c.Region,
@@ -58,8 +123,8 @@ func main() {
 		Container:  c.Container,
 	}
 
-	// Outer loop: after each exec session ends, drop the user back into the
-	// picker (rewinding to the cluster step) so they can run another command
+	// Outer loop: after each exec session ends, the post-session menu says
+	// where to rewind the picker to, so the user can run another command
 	// without restarting the binary. The interactive picker itself handles
 	// ctrl+b back-navigation and ctrl+c clean exit.
 	awsCfg := aws.Config{}
@@ -70,32 +135,790 @@ func main() {
 		if err != nil {
 			c.LogUserFriendlyError("Selection failed", err, "See error details above.", "", 0)
 		}
+		env, err := guardTarget(ctx, c, awsCfg, state)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			resetFrom(&state, stepContainer)
+			continue
+		}
 
-		exitCode, execErr := cli.ExecECS(ctx, c, awsCfg, cli.ExecOptions{
-			Region:     state.Region,
-			ClusterArn: state.ClusterArn,
-			TaskArn:    state.TaskArn,
-			Container:  state.Container,
-			Command:    c.Command,
-		})
+		var result cli.SessionResult
+		opts := cli.ExecOptions{
+			Region:      state.Region,
+			ClusterArn:  state.ClusterArn,
+			Service:     state.Service,
+			TaskArn:     state.TaskArn,
+			Container:   state.Container,
+			Command:     c.Command,
+			Record:      c.RecordingEnabled(),
+			Protect:     c.ProtectionEnabled(),
+			Environment: env,
+			Result:      &result,
+			Suspendable: true,
+		}
+		exitCode, execErr := cli.ExecECS(ctx, c, awsCfg, opts)
+		if c.PolicyCheck {
+			// Nothing connected, so there is no session to follow up on.
+			os.Exit(exitCode)
+		}
+		exitCode, execErr = reconnectIfDropped(ctx, c, awsCfg, &state, opts, exitCode, execErr)
+		if errors.Is(execErr, cli.ErrSuspended) {
+			// ~^Z: straight back to the picker, with the task still chosen.
+			resetFrom(&state, stepContainer)
+			continue
+		}
 		if execErr != nil {
 			fmt.Fprintln(os.Stderr, "exec-ecs:", execErr)
 		}
-		if exitCode != 0 {
-			fmt.Fprintf(os.Stderr, "session exited with code %d\n", exitCode)
+
+		opts.TaskArn = state.TaskArn
+		postSessionMenu(c, &state, opts, result, exitCode, execErr)
+	}
+}
+
+// postSessionMenu shows how the session went and asks what to do next.
+// The transcript and the command line are shown in place of the menu,
+// which comes back once they have been read. Any other choice rewinds
+// state for the picker.
+func postSessionMenu(c *cli.Cli, state *stepState, opts cli.ExecOptions, result cli.SessionResult, code int, err error) {
+	label := cli.PostSessionLabel(code, err, result)
+	items := cli.PostSessionActions(result.Recording != "")
+	for {
+		action, _ := c.PromptSelectBreadcrumb(label, items, cli.PostReconnect, false, breadcrumbFor(*state, finalStep))
+		switch action {
+		case cli.PostTranscript:
+			if err := cli.ShowTranscript(result.Recording, os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			}
+			waitForEnter()
+			continue
+		case cli.PostCommandLine:
+			line := c.CommandLine(toCliState(*state), opts.Command, opts.Environment)
+			cli.CopyToClipboard(os.Stdout, line)
+			fmt.Println(line)
+			waitForEnter()
+			continue
+		case cli.PostQuit:
+			os.Exit(0)
 		}
+		rewindAfterSession(state, action)
+		return
+	}
+}
 
-		// Re-enter at the container step for the same task so running a
-		// second command does not force the user back through cluster/service/task.
-		resetFrom(&state, stepContainer)
+// rewindAfterSession clears what the post-session action asks to pick
+// again, so the picker resumes there.
+func rewindAfterSession(state *stepState, action string) {
+	switch action {
+	case cli.PostContainer:
+		resetFrom(state, stepContainer)
+	case cli.PostTask:
+		resetFrom(state, stepTask)
+	case cli.PostService:
+		resetFrom(state, stepService)
+	case cli.PostProfile:
+		// Clearing the profile makes the picker start there, and the
+		// profile step reloads the AWS config for whatever is chosen.
+		resetFrom(state, stepRegion)
+		state.Profile = ""
 	}
 }
 
+// waitForEnter holds output on screen until the user is done with it,
+// since the menu that follows takes over the whole terminal.
+func waitForEnter() {
+	fmt.Fprint(os.Stderr, "\nPress Enter to return to the menu.")
+	_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+}
+
+// runOnce is the scripting entry point: resolve the target from the flags
+// without any picker, run the command a single time and hand back the remote
+// command's exit status. Nothing here may prompt — a missing or ambiguous
+// selector, or an expired SSO session, is reported and fails the run.
+func runOnce(ctx context.Context, c *cli.Cli) int {
+	if c.Profile == "" || c.Region == "" {
+		fmt.Fprintln(os.Stderr, "exec-ecs: --once needs -pr and -rg")
+		return cli.ExitUsage
+	}
+
+	awsCfg, err := loadScriptingConfig(ctx, c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitSessionError
+	}
+
+	flags := cli.State{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+		TaskArn:    c.TaskArn,
+		Container:  c.Container,
+	}
+	client := cli.NewECSClient(awsCfg, c.Region)
+	var state cli.State
+	if c.Target != "" {
+		// A named target already says how to choose among several tasks.
+		var t cli.TargetConfig
+		if t, err = c.LookupTarget(c.Target); err == nil {
+			state, err = cli.ResolveNamedTarget(ctx, c, client, t, flags)
+		}
+	} else {
+		state, err = cli.ResolveTarget(ctx, c, client, flags)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+	env, err := c.GuardTarget(ctx, client, state)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+
+	code, err := cli.ExecECS(ctx, c, awsCfg, cli.ExecOptions{
+		Region:            state.Region,
+		ClusterArn:        state.ClusterArn,
+		Service:           state.Service,
+		TaskArn:           state.TaskArn,
+		Container:         state.Container,
+		Command:           c.Command,
+		CaptureExitStatus: true,
+		Record:            c.RecordingEnabled(),
+		Protect:           c.ProtectionEnabled(),
+		Environment:       env,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+	}
+	return code
+}
+
+// loadScriptingConfig loads the AWS config for a non-interactive run and
+// checks the credentials up front, since nothing may prompt for an SSO login.
+func loadScriptingConfig(ctx context.Context, c *cli.Cli) (aws.Config, error) {
+	c.LogAWSCommand("configure", "get", "region", "--profile", c.Profile)
+	awsCfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(c.Region),
+		config.WithSharedConfigProfile(c.Profile),
+	)
+	if err != nil {
+		return awsCfg, fmt.Errorf("unable to load AWS configuration: %w", err)
+	}
+	c.LogAWSCommand("sts", "get-caller-identity", "--profile", c.Profile)
+	if err := c.CheckSSOSession(ctx, sts.NewFromConfig(awsCfg), c.Profile); err != nil {
+		return awsCfg, fmt.Errorf("no valid credentials for profile %q (log in by running exec-ecs interactively once): %w", c.Profile, err)
+	}
+	return awsCfg, nil
+}
+
+// runAllTasks fans the command out to every task of one service. Like
+// runOnce it never prompts; the cluster and service must be unambiguous.
+func runAllTasks(ctx context.Context, c *cli.Cli) int {
+	if c.Profile == "" || c.Region == "" {
+		fmt.Fprintln(os.Stderr, "exec-ecs: --all-tasks needs -pr and -rg")
+		return cli.ExitUsage
+	}
+	if c.TaskArn != "" {
+		fmt.Fprintln(os.Stderr, "exec-ecs: --all-tasks and -tk are mutually exclusive")
+		return cli.ExitUsage
+	}
+	if c.Output != cli.FanOutPrefix && c.Output != cli.FanOutJSON {
+		fmt.Fprintf(os.Stderr, "exec-ecs: unknown -output %q (want prefix or json)\n", c.Output)
+		return cli.ExitUsage
+	}
+
+	awsCfg, err := loadScriptingConfig(ctx, c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitSessionError
+	}
+
+	client := cli.NewECSClient(awsCfg, c.Region)
+	state, tasks, err := cli.ResolveServiceTasks(ctx, c, client, cli.State{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+		Container:  c.Container,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+	env, err := c.GuardTarget(ctx, client, state)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+
+	_, code := cli.FanOut(ctx, c, awsCfg, cli.FanOutOptions{
+		Region:      state.Region,
+		ClusterArn:  state.ClusterArn,
+		Service:     state.Service,
+		Container:   state.Container,
+		Command:     c.Command,
+		TaskArns:    tasks,
+		Parallel:    c.Parallel,
+		Format:      c.Output,
+		Environment: env,
+	})
+	return code
+}
+
+// runForward reuses the picker to choose a container, then keeps one SSM
+// port-forwarding session per -L spec open until the user hits Ctrl-C.
+func runForward(ctx context.Context, c *cli.Cli) int {
+	specs := make([]cli.ForwardSpec, 0, len(c.Forwards))
+	for _, raw := range c.Forwards {
+		spec, err := cli.ParseForwardSpec(raw)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			return cli.ExitUsage
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		fmt.Fprintln(os.Stderr, "exec-ecs: forward needs at least one -L local:remote or -L local:host:remote")
+		return cli.ExitUsage
+	}
+
+	state := stepState{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+		TaskArn:    c.TaskArn,
+		Container:  c.Container,
+	}
+	awsCfg, err := selectTarget(ctx, c, &state)
+	if err != nil {
+		c.LogUserFriendlyError("Selection failed", err, "See error details above.", "", 0)
+	}
+	env, err := guardTarget(ctx, c, awsCfg, state)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Println("Starting port forwarding; press Ctrl-C to stop.")
+	err = cli.Forward(sigCtx, c, awsCfg, cli.NewECSClient(awsCfg, state.Region), cli.ForwardOptions{
+		Region:      state.Region,
+		ClusterArn:  state.ClusterArn,
+		Service:     state.Service,
+		TaskArn:     state.TaskArn,
+		Container:   state.Container,
+		Specs:       specs,
+		Environment: env,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitSessionError
+	}
+	return 0
+}
+
+// runCopy reuses the picker to choose a container, then copies SRC to DST
+// with one side prefixed by ':' to mark the container path.
+func runCopy(ctx context.Context, c *cli.Cli) int {
+	if len(c.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: exec-ecs cp [flags] SRC DST   (prefix the container path with ':', e.g. :/tmp/heap.hprof)")
+		return cli.ExitUsage
+	}
+	if _, _, _, err := cli.ParseCopyPaths(c.Args[0], c.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+
+	state := stepState{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+		TaskArn:    c.TaskArn,
+		Container:  c.Container,
+	}
+	awsCfg, err := selectTarget(ctx, c, &state)
+	if err != nil {
+		c.LogUserFriendlyError("Selection failed", err, "See error details above.", "", 0)
+	}
+	env, err := guardTarget(ctx, c, awsCfg, state)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+
+	err = cli.Copy(ctx, c, awsCfg, cli.CopyOptions{
+		Region:      state.Region,
+		ClusterArn:  state.ClusterArn,
+		Service:     state.Service,
+		TaskArn:     state.TaskArn,
+		Container:   state.Container,
+		Src:         c.Args[0],
+		Dst:         c.Args[1],
+		Environment: env,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitSessionError
+	}
+	return 0
+}
+
+// runLogs reuses the picker to choose a container, then prints its
+// CloudWatch Logs, or those of every task of its service with -all-tasks.
+func runLogs(ctx context.Context, c *cli.Cli) int {
+	state := stepState{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+		TaskArn:    c.TaskArn,
+		Container:  c.Container,
+	}
+	awsCfg, err := selectTarget(ctx, c, &state)
+	if err != nil {
+		c.LogUserFriendlyError("Selection failed", err, "See error details above.", "", 0)
+	}
+
+	clients := cli.NewLogsClients(awsCfg, state.Region)
+	sources, err := cli.ResolveLogSources(ctx, c, clients.ECS, toCliState(state), c.AllTasks)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = cli.TailLogs(sigCtx, c, clients, sources, cli.LogsOptions{
+		Since:  c.Since,
+		Grep:   c.Grep,
+		Follow: c.Follow,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitSessionError
+	}
+	return 0
+}
+
+// runStopped is `exec-ecs stopped`: pick a service, then browse its stopped
+// tasks.
+func runStopped(ctx context.Context, c *cli.Cli) int {
+	state := stepState{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+	}
+	awsCfg, loaded, err := runSelectionUntil(ctx, c, &state, aws.Config{}, false, stepTask)
+	if err == nil && !loaded {
+		// Everything up to the service came from flags or a target.
+		if err = ensureSSOLogin(ctx, c); err == nil {
+			awsCfg, err = loadAWSConfig(ctx, c)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+	browseStoppedTasks(ctx, c, awsCfg, state)
+	return 0
+}
+
+// runDashboard is `exec-ecs dashboard`: pick a profile and region, then
+// watch the chosen cluster (or all of them). It reports whether the user
+// picked a service, which is then in c.ClusterArn and c.Service.
+func runDashboard(ctx context.Context, c *cli.Cli) (int, bool) {
+	state := stepState{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+	}
+	awsCfg, loaded, err := runSelectionUntil(ctx, c, &state, aws.Config{}, false, stepCluster)
+	if err == nil && !loaded {
+		if err = ensureSSOLogin(ctx, c); err == nil {
+			awsCfg, err = loadAWSConfig(ctx, c)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage, false
+	}
+	client := cli.NewECSClient(awsCfg, state.Region)
+
+	var clusters []string
+	if state.ClusterArn != "" {
+		clusters = []string{state.ClusterArn}
+	} else {
+		const allClusters = "(all clusters)"
+		var arns map[string]string
+		choice, goBack, err := c.PromptSelectLoadedBreadcrumb("Connecting to ECS...", "Choose ECS cluster for the dashboard", allClusters, false, breadcrumbFor(state, stepCluster), false, func() ([]string, error) {
+			names, m, err := c.ListClusterNamesArns(ctx, client)
+			if err != nil {
+				return nil, err
+			}
+			if len(names) == 0 {
+				return nil, errNoClusters
+			}
+			arns = m
+			return append([]string{allClusters}, names...), nil
+		})
+		if errors.Is(err, errNoClusters) {
+			fmt.Fprintln(os.Stderr, "exec-ecs: no ECS clusters found in region", state.Region)
+			return cli.ExitUsage, false
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			return cli.ExitUsage, false
+		}
+		if goBack {
+			return 0, false
+		}
+		if choice != allClusters {
+			clusters = []string{arns[choice]}
+		}
+	}
+
+	pick, err := c.RunDashboard(ctx, client, clusters)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitSessionError, false
+	}
+	if pick == nil {
+		return 0, false
+	}
+	c.Profile, c.Region = state.Profile, state.Region
+	c.ClusterArn, c.Service = pick.ClusterArn, pick.Service
+	return 0, true
+}
+
+// browseStoppedTasks shows the service's stopped tasks until the user goes
+// back. Choosing one of a task's containers prints why the task stopped,
+// followed by the container's logs up to the stop.
+func browseStoppedTasks(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state stepState) {
+	clients := cli.NewLogsClients(awsCfg, state.Region)
+	breadcrumb := breadcrumbFor(state, stepTask)
+	var (
+		tasks    []cli.StoppedTask
+		selected string
+	)
+	for {
+		arn, goBack, err := c.PromptStoppedTaskBreadcrumb("Fetching stopped ECS tasks...", "Choose stopped ECS task", selected, breadcrumb, func() ([]cli.StoppedTask, error) {
+			var err error
+			tasks, err = c.ListStoppedTasks(ctx, clients.ECS, state.ClusterArn, state.Service)
+			if err == nil && len(tasks) == 0 {
+				err = errNoTasks
+			}
+			return tasks, err
+		})
+		if goBack {
+			return
+		}
+		if errors.Is(err, errNoTasks) {
+			fmt.Println("No stopped ECS tasks found; ECS keeps them for about an hour.")
+			return
+		}
+		if err != nil {
+			fmt.Println("Failed to list stopped ECS tasks:", err)
+			return
+		}
+		selected = arn
+		for _, task := range tasks {
+			if task.Arn == arn {
+				browseStoppedContainers(ctx, c, clients, state, task, breadcrumb)
+			}
+		}
+	}
+}
+
+// browseStoppedContainers lets the user read the logs of each of a stopped
+// task's containers in turn, starting with the first one that failed.
+func browseStoppedContainers(ctx context.Context, c *cli.Cli, clients cli.LogsClients, state stepState, task cli.StoppedTask, breadcrumb string) {
+	if len(task.Containers) == 0 {
+		cli.WriteStoppedTask(os.Stdout, task)
+		waitForEnter()
+		return
+	}
+	items := task.ContainerItems()
+	choice := items[0]
+	for i, ct := range task.Containers {
+		if ct.ExitCode == nil || *ct.ExitCode != 0 {
+			choice = items[i]
+			break
+		}
+	}
+	label := fmt.Sprintf("Task %s stopped (%s): choose a container for its logs", task.ID, task.StopCode)
+	for {
+		var goBack bool
+		choice, goBack = c.PromptSelectBreadcrumb(label, items, choice, true, breadcrumb)
+		if goBack {
+			return
+		}
+		for i, item := range items {
+			if item == choice {
+				showStoppedContainer(ctx, c, clients, state, task, task.Containers[i].Name)
+				waitForEnter()
+			}
+		}
+	}
+}
+
+// showStoppedContainer prints the task's stop details and the container's
+// logs from around the stop. Ctrl-C cuts the logs short.
+func showStoppedContainer(ctx context.Context, c *cli.Cli, clients cli.LogsClients, state stepState, task cli.StoppedTask, container string) {
+	cli.WriteStoppedTask(os.Stdout, task)
+	target := toCliState(state)
+	target.TaskArn, target.Container = task.Arn, container
+	sources, err := cli.ResolveLogSources(ctx, c, clients.ECS, target, false)
+	if err != nil {
+		fmt.Printf("\nNo logs for %s: %v\n", container, err)
+		return
+	}
+	fmt.Printf("\nLogs of %s (%s %s):\n", container, sources[0].Group, sources[0].Stream)
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	if err := cli.TailLogs(sigCtx, c, clients, sources, cli.LogsOptions{Since: task.LogsSince(time.Now())}); err != nil && sigCtx.Err() == nil {
+		fmt.Println("Failed to read logs:", err)
+	}
+}
+
+// selectTarget fills state from the `@name` target when one was given, and
+// from the picker otherwise.
+func selectTarget(ctx context.Context, c *cli.Cli, state *stepState) (aws.Config, error) {
+	if c.Target == "" {
+		awsCfg, loaded, err := runInteractiveSelection(ctx, c, state, aws.Config{}, false)
+		if err == nil && !loaded {
+			// The flags named the whole target, so no picker step ran.
+			if err = ensureSSOLogin(ctx, c); err == nil {
+				awsCfg, err = loadAWSConfig(ctx, c)
+			}
+		}
+		return awsCfg, err
+	}
+	t, err := c.LookupTarget(c.Target)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if c.Profile == "" {
+		return aws.Config{}, fmt.Errorf("target @%s has no profile; set one in config.yaml or pass -pr", c.Target)
+	}
+	if err := ensureSSOLogin(ctx, c); err != nil {
+		return aws.Config{}, err
+	}
+	awsCfg, err := loadAWSConfig(ctx, c)
+	if err != nil {
+		return awsCfg, err
+	}
+	resolved, err := cli.ResolveNamedTarget(ctx, c, cli.NewECSClient(awsCfg, c.Region), t, toCliState(*state))
+	if err != nil {
+		return awsCfg, err
+	}
+	*state = fromCliState(resolved)
+	return awsCfg, nil
+}
+
+// runNamedTarget connects straight to `@name` without the picker and exits
+// with the session's exit code once it ends.
+func runNamedTarget(ctx context.Context, c *cli.Cli) int {
+	state := stepState{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+		TaskArn:    c.TaskArn,
+		Container:  c.Container,
+	}
+	awsCfg, err := selectTarget(ctx, c, &state)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+	env, err := guardTarget(ctx, c, awsCfg, state)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+	opts := cli.ExecOptions{
+		Region:      state.Region,
+		ClusterArn:  state.ClusterArn,
+		Service:     state.Service,
+		TaskArn:     state.TaskArn,
+		Container:   state.Container,
+		Command:     c.Command,
+		Record:      c.RecordingEnabled(),
+		Protect:     c.ProtectionEnabled(),
+		Environment: env,
+	}
+	code, err := cli.ExecECS(ctx, c, awsCfg, opts)
+	code, err = reconnectIfDropped(ctx, c, awsCfg, &state, opts, code, err)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitSessionError
+	}
+	return code
+}
+
+// runDoctor checks the chosen target for the usual ECS Exec problems and
+// exits non-zero when any check fails.
+func runDoctor(ctx context.Context, c *cli.Cli) int {
+	state := stepState{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+		TaskArn:    c.TaskArn,
+		Container:  c.Container,
+	}
+	awsCfg, err := selectTarget(ctx, c, &state)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+	report := cli.Doctor(ctx, c, cli.NewDoctorClients(awsCfg, state.Region), toCliState(state))
+	if err := cli.WriteDoctorReport(os.Stdout, report, c.Output == cli.FanOutJSON); err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitSessionError
+	}
+	if report.Failed() {
+		return cli.ExitChecksFailed
+	}
+	return 0
+}
+
+// runDebug starts a throwaway copy of the chosen service's task, opens a
+// session in it and stops it again, so debugging never touches a task that
+// serves traffic.
+func runDebug(ctx context.Context, c *cli.Cli) int {
+	state := stepState{
+		Profile:    c.Profile,
+		Region:     c.Region,
+		ClusterArn: c.ClusterArn,
+		Service:    c.Service,
+	}
+	var awsCfg aws.Config
+	if c.Target != "" {
+		if _, err := c.LookupTarget(c.Target); err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			return cli.ExitUsage
+		}
+		if c.Profile == "" {
+			fmt.Fprintf(os.Stderr, "exec-ecs: target @%s has no profile; set one in config.yaml or pass -pr\n", c.Target)
+			return cli.ExitUsage
+		}
+		if err := ensureSSOLogin(ctx, c); err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			return cli.ExitUsage
+		}
+		cfg, err := loadAWSConfig(ctx, c)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			return cli.ExitUsage
+		}
+		resolved, err := cli.ResolveDebugService(ctx, c, cli.NewECSClient(cfg, c.Region), toCliState(state))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			return cli.ExitUsage
+		}
+		state, awsCfg = fromCliState(resolved), cfg
+	} else {
+		cfg, loaded, err := runSelectionUntil(ctx, c, &state, aws.Config{}, false, stepTask)
+		if err == nil && !loaded {
+			// Everything up to the service came from flags.
+			if err = ensureSSOLogin(ctx, c); err == nil {
+				cfg, err = loadAWSConfig(ctx, c)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			return cli.ExitUsage
+		}
+		awsCfg = cfg
+	}
+	env, err := guardTarget(ctx, c, awsCfg, state)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+
+	opts := cli.DebugOptions{
+		Region:      state.Region,
+		ClusterArn:  state.ClusterArn,
+		Service:     state.Service,
+		Container:   c.Container,
+		Command:     c.Command,
+		Environment: env,
+	}
+	if c.Target == "" {
+		opts.ChooseContainer = func(names []string) (string, error) {
+			name, _ := c.PromptSelect("Choose container to debug", names, "", false)
+			return name, nil
+		}
+	}
+	// ^C cancels the wait; Debug still stops the task on the way out.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	code, err := cli.Debug(ctx, c, awsCfg, cli.NewDebugClient(awsCfg, state.Region), opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+	}
+	return code
+}
+
+// runReplay plays back a session recording. With no argument it lists the
+// recordings available in the config dir instead.
+func runReplay(c *cli.Cli) int {
+	if len(c.Args) == 0 {
+		files, err := cli.ListRecordings(cli.RecordingsDir())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+			return cli.ExitSessionError
+		}
+		if len(files) == 0 {
+			fmt.Println("No recordings found in", cli.RecordingsDir())
+			return 0
+		}
+		fmt.Println("Recordings (newest first):")
+		for _, f := range files {
+			fmt.Println(" ", filepath.Base(f.Path))
+		}
+		fmt.Println("Play one with: exec-ecs replay [-speed 2] <file>")
+		return 0
+	}
+	if len(c.Args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: exec-ecs replay [-speed N] [-max-idle D] <file>")
+		return cli.ExitUsage
+	}
+
+	f, err := os.Open(cli.ResolveRecordingPath(c.Args[0]))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+	defer func() { _ = f.Close() }()
+	if err := cli.Replay(f, os.Stdout, c.Speed, c.MaxIdle); err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return cli.ExitUsage
+	}
+	return 0
+}
+
 func runInteractiveSelection(ctx context.Context, c *cli.Cli, state *stepState, awsCfg aws.Config, awsCfgLoaded bool) (aws.Config, bool, error) {
+	return runSelectionUntil(ctx, c, state, awsCfg, awsCfgLoaded, finalStep)
+}
+
+// runSelectionUntil runs the picker steps before until, for commands such as
+// `debug` that need a service but start their own task.
+func runSelectionUntil(ctx context.Context, c *cli.Cli, state *stepState, awsCfg aws.Config, awsCfgLoaded bool, until int) (aws.Config, bool, error) {
 	step := initialSelectionStep(*state)
 	ssoEnsured := awsCfgLoaded
 
-	for step < finalStep {
+	for step < until {
+		// Colour the picker by what is chosen so far; tag rules only
+		// apply once the target is complete (see guardTarget).
+		cli.CurrentEnvironment = c.ClassifyTarget(ctx, nil, toCliState(*state))
 		switch step {
 		case stepProfile:
 			profiles := c.SelectProfileList()
@@ -312,40 +1135,29 @@ func pickCluster(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state *step
 
 func pickService(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state *stepState) (int, error) {
 	client := cli.NewECSClient(awsCfg, c.Region)
-	var serviceArns map[string]string
 
 	c.LogAWSCommand("ecs", "list-services", "--cluster", state.ClusterArn, "--profile", c.Profile, "--region", c.Region)
-	selected, goBack, err := c.PromptSelectLoadedBreadcrumb("Fetching ECS services...", "Choose ECS service", getKeyByValue(serviceArns, state.Service), true, breadcrumbFor(*state, stepService), false, func() ([]string, error) {
-		services, arns, err := c.ListServiceNamesArns(ctx, client, state.ClusterArn)
+	selected, goBack, err := c.PromptServiceLoadedBreadcrumb("Fetching ECS services...", "Choose ECS service", state.Service, true, breadcrumbFor(*state, stepService), func() ([]cli.ServiceRow, error) {
+		rows, err := c.ListServiceRows(ctx, client, state.ClusterArn)
 		if err != nil {
 			return nil, err
 		}
-		if len(services) == 0 {
-			return nil, errNoServices
+		// Tasks outside any service are reached through the cluster-level
+		// entries, so a cluster without services still has something to pick.
+		for _, pseudo := range []string{cli.AllTasksService, cli.StandaloneTasksService} {
+			rows = append(rows, cli.ServiceRow{Arn: pseudo, Name: pseudo})
 		}
-		serviceArns = arns
-		return services, nil
+		return rows, nil
 	})
 	if goBack {
 		return serviceBackDelta(state), nil
 	}
-	if errors.Is(err, errNoServices) {
-		fmt.Println("No ECS services found in cluster:", displayName(state.ClusterArn))
-		choice, goBack := c.PromptSelectBreadcrumb("No ECS services found. What now?",
-			[]string{"Choose region", "Choose cluster"}, "Choose region", true, breadcrumbFor(*state, stepService))
-		if goBack || choice == "Choose region" || state.AutoSelectedCluster {
-			resetFrom(state, stepCluster)
-			return stepRegion - stepService, nil
-		}
-		resetFrom(state, stepService)
-		return int(cli.ActionBack), nil
-	}
 	if err != nil {
 		fmt.Println("Failed to list ECS services:", err)
 		resetFrom(state, stepService)
 		return int(cli.ActionBack), nil
 	}
-	state.Service = serviceArns[selected]
+	state.Service = selected
 	c.Service = state.Service
 	resetFrom(state, stepTask)
 	return int(cli.ActionAdvance), nil
@@ -362,40 +1174,115 @@ func serviceBackDelta(state *stepState) int {
 
 func pickTask(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state *stepState) (int, error) {
 	client := cli.NewECSClient(awsCfg, c.Region)
-	var taskArns map[string]string
 
-	c.LogAWSCommand("ecs", "list-tasks", "--cluster", state.ClusterArn, "--service-name", state.Service, "--profile", c.Profile, "--region", c.Region)
-	selected, goBack, err := c.PromptSelectLoadedBreadcrumb("Fetching ECS tasks...", "Choose ECS task", getKeyByValue(taskArns, state.TaskArn), true, breadcrumbFor(*state, stepTask), false, func() ([]string, error) {
-		tasks, arns, err := c.ListTaskNamesArns(ctx, client, state.ClusterArn, state.Service)
+	c.LogListTasks(state.ClusterArn, state.Service)
+	var rows []cli.TaskRow
+	selected, goBack, err := c.PromptTaskLoadedBreadcrumb("Fetching ECS tasks...", "Choose ECS task", state.TaskArn, true, breadcrumbFor(*state, stepTask), func() ([]cli.TaskRow, error) {
+		var err error
+		rows, err = c.ListTaskRows(ctx, client, state.ClusterArn, state.Service)
 		if err != nil {
 			return nil, err
 		}
-		if len(tasks) == 0 {
+		if len(rows) == 0 {
 			return nil, errNoTasks
 		}
-		taskArns = arns
-		return tasks, nil
+		return rows, nil
 	})
 	if goBack {
 		resetFrom(state, stepTask)
 		return int(cli.ActionBack), nil
 	}
 	if errors.Is(err, errNoTasks) {
-		fmt.Println("No ECS tasks found. Going back.")
-		resetFrom(state, stepTask)
-		return int(cli.ActionBack), nil
+		// A crash-looping service has nothing running to exec into; what
+		// it left behind says why.
+		choice, goBack := c.PromptSelectBreadcrumb("No running ECS tasks", []string{"Show stopped tasks", "Go back"}, "Show stopped tasks", true, breadcrumbFor(*state, stepTask))
+		if goBack || choice != "Show stopped tasks" {
+			resetFrom(state, stepTask)
+			return int(cli.ActionBack), nil
+		}
+		browseStoppedTasks(ctx, c, awsCfg, *state)
+		return int(cli.ActionRetry), nil
 	}
 	if err != nil {
 		fmt.Println("Failed to list ECS tasks:", err)
 		resetFrom(state, stepTask)
 		return int(cli.ActionBack), nil
 	}
-	state.TaskArn = taskArns[selected]
+	for _, row := range rows {
+		if row.Arn != selected {
+			continue
+		}
+		if !row.Exec {
+			next, done := offerEnableExec(ctx, c, awsCfg, state)
+			if done {
+				return next, nil
+			}
+		}
+		if warnings := c.TaskWarnings(ctx, client, state.ClusterArn, state.Service, row); len(warnings) > 0 {
+			choice, goBack := c.PromptSelectBreadcrumb("⚠ "+strings.Join(warnings, " "), []string{"Use this task anyway", "Choose another task"}, "Choose another task", true, breadcrumbFor(*state, stepTask))
+			if goBack || choice != "Use this task anyway" {
+				return int(cli.ActionRetry), nil
+			}
+		}
+	}
+	state.TaskArn = selected
 	c.TaskArn = state.TaskArn
 	resetFrom(state, stepContainer)
 	return int(cli.ActionAdvance), nil
 }
 
+// offerEnableExec handles a chosen task that has ECS Exec off, which
+// ExecuteCommand would refuse. For a service task it offers to turn ECS Exec
+// on for the service and moves on to a task of the redeployment. done is
+// false when the user goes on with the chosen task anyway.
+func offerEnableExec(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state *stepState) (int, bool) {
+	const (
+		enable  = "Enable ECS Exec on the service and redeploy"
+		another = "Choose another task"
+		anyway  = "Use this task anyway"
+	)
+	label := "ECS Exec is off for this task"
+	items := []string{enable, another, anyway}
+	if cli.IsPseudoService(state.Service) {
+		// Standalone tasks only get it from RunTask.
+		label = "ECS Exec is off for this task; only a new task started with --enable-execute-command can have it"
+		items = items[1:]
+	}
+	choice, goBack := c.PromptSelectBreadcrumb(label, items, items[0], true, breadcrumbFor(*state, stepTask))
+	switch {
+	case goBack || choice == another:
+		return int(cli.ActionRetry), true
+	case choice == anyway:
+		return 0, false
+	}
+
+	client := cli.NewExecEnableClient(awsCfg, c.Region)
+	target := toCliState(*state)
+	target.TaskArn = ""
+	ok, err := c.ConfirmEnableExec(ctx, client, target)
+	if err != nil || !ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		}
+		fmt.Println("Leaving the service as it is.")
+		waitForEnter()
+		return int(cli.ActionRetry), true
+	}
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	arn, err := c.EnableServiceExec(sigCtx, client, target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		waitForEnter()
+		return int(cli.ActionRetry), true
+	}
+	fmt.Println("Task", displayName(arn), "is ready.")
+	state.TaskArn = arn
+	c.TaskArn = arn
+	resetFrom(state, stepContainer)
+	return int(cli.ActionAdvance), true
+}
+
 func pickContainer(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state *stepState) (int, error) {
 	client := cli.NewECSClient(awsCfg, c.Region)
 
@@ -432,11 +1319,28 @@ func pickContainer(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state *st
 var (
 	errNoClusters   = errors.New("no ECS clusters")
 	errNoRegions    = errors.New("no ECS regions")
-	errNoServices   = errors.New("no ECS services")
 	errNoTasks      = errors.New("no ECS tasks")
 	errNoContainers = errors.New("no containers")
 )
 
+// reconnectIfDropped offers a reconnect when the session dropped rather
+// than ended, and moves state to the task the last session ran on.
+func reconnectIfDropped(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state *stepState, opts cli.ExecOptions, code int, err error) (int, error) {
+	if !c.SessionDropped(code, err) {
+		return code, err
+	}
+	revalidate := func(ctx context.Context) error { return validateSSOSession(ctx, c, awsCfg) }
+	opts, code, err = c.ReconnectSession(ctx, awsCfg, cli.NewECSClient(awsCfg, opts.Region), opts, code, revalidate)
+	state.TaskArn = opts.TaskArn
+	return code, err
+}
+
+// guardTarget classifies the chosen target and, for prod, asks for the
+// typed confirmation before anything connects to it.
+func guardTarget(ctx context.Context, c *cli.Cli, awsCfg aws.Config, state stepState) (string, error) {
+	return c.GuardTarget(ctx, cli.NewECSClient(awsCfg, state.Region), toCliState(state))
+}
+
 func toCliState(s stepState) cli.State {
 	return cli.State{
 		Profile: s.Profile, Region: s.Region, ClusterArn: s.ClusterArn,
@@ -487,6 +1391,20 @@ func initializeCLI(ctx context.Context) *cli.Cli {
 	cli.ApplySavedThemeSelection()
 	c := cli.ParseArgs()
 	_ = ctx
+	// A broken config.yaml or policy must stop us rather than be skipped,
+	// or a typo would lift the prod guard or every restriction in it.
+	cfg, err := cli.LoadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs: config:", err)
+		os.Exit(cli.ExitUsage)
+	}
+	c.Config = cfg
+	policy, err := cli.LoadPolicy(c.PolicyPath())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs: command policy:", err)
+		os.Exit(cli.ExitUsage)
+	}
+	c.Policy = policy
 	switch {
 	case c.Version:
 		fmt.Println("exec-ecs version", installer.Version)
@@ -597,21 +1515,75 @@ func createSpinner(suffix string) *spinner.Spinner {
 	return sp
 }
 
-func showHistoryAndExecute(c *cli.Cli) {
-	history := c.GetLastUniqueHistory(5)
-	if len(history) == 0 {
+func showHistoryAndExecute(ctx context.Context, c *cli.Cli) {
+	if len(cli.LoadHistory()) == 0 {
 		fmt.Println("No command history found.")
 		return
 	}
-	selected, err := c.BubbleteaHistorySelect("Command History (last 5 unique)", history)
-	if err != nil || selected == "" {
+	selected, ok, err := c.BrowseHistory(c.HistoryFilter())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+		return
+	}
+	if !ok {
 		return
 	}
-	fmt.Println("Executing:", selected)
-	cmd := exec.Command("sh", "-c", selected)
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
-	cmd.Stdin = os.Stdin
-	_ = cmd.Run()
+	if err := replayHistoryEntry(ctx, c, selected); err != nil {
+		fmt.Fprintln(os.Stderr, "exec-ecs:", err)
+	}
+}
+
+// replayHistoryEntry re-runs a history entry through the same SSO/config and
+// ExecECS path as a fresh selection. A recorded task that has since stopped
+// is swapped for a running task of the same service.
+func replayHistoryEntry(ctx context.Context, c *cli.Cli, e cli.HistoryEntry) error {
+	if !e.Replayable() {
+		return fmt.Errorf("history entry %q has no target recorded and cannot be replayed", e.Command)
+	}
+	if e.Profile != "" {
+		c.Profile = e.Profile
+	}
+	if c.Profile == "" {
+		return errors.New("history entry has no profile recorded; pass -pr to choose one")
+	}
+	c.Region = e.Region
+
+	if err := ensureSSOLogin(ctx, c); err != nil {
+		return err
+	}
+	awsCfg, err := loadAWSConfig(ctx, c)
+	if err != nil {
+		return err
+	}
+	client := cli.NewECSClient(awsCfg, e.Region)
+	state, err := cli.ResolveHistoryTarget(ctx, c, client, e)
+	if err != nil {
+		return err
+	}
+	env, err := c.GuardTarget(ctx, client, state)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Executing:", e.Label())
+	code, err := cli.ExecECS(ctx, c, awsCfg, cli.ExecOptions{
+		Region:      state.Region,
+		ClusterArn:  state.ClusterArn,
+		Service:     state.Service,
+		TaskArn:     state.TaskArn,
+		Container:   state.Container,
+		Command:     e.Command,
+		Record:      c.RecordingEnabled(),
+		Protect:     c.ProtectionEnabled(),
+		Environment: env,
+	})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		fmt.Fprintf(os.Stderr, "session exited with code %d\n", code)
+	}
+	return nil
 }
 
 func getKeyByValue(m map[string]string, value string) string {
@@ -4,9 +4,14 @@ import (
 	"context"
 	"ecs-tool/cli"
 	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -237,7 +242,7 @@ region = eu-west-1
 func TestNoResultErrorsAreDistinct(t *testing.T) {
 	t.Parallel()
 
-	errs := []error{errNoRegions, errNoClusters, errNoServices, errNoTasks, errNoContainers}
+	errs := []error{errNoRegions, errNoClusters, errNoTasks, errNoContainers}
 	for i, err := range errs {
 		for j, other := range errs {
 			if i != j && err == other {
@@ -246,3 +251,221 @@ func TestNoResultErrorsAreDistinct(t *testing.T) {
 		}
 	}
 }
+
+func TestRunOnceRequiresProfileAndRegion(t *testing.T) {
+	t.Parallel()
+
+	if got := runOnce(context.Background(), &cli.Cli{Profile: "p"}); got != cli.ExitUsage {
+		t.Fatalf("runOnce without region = %d, want %d", got, cli.ExitUsage)
+	}
+}
+
+func TestRunForwardValidatesSpecsBeforePicker(t *testing.T) {
+	t.Parallel()
+
+	if got := runForward(context.Background(), &cli.Cli{}); got != cli.ExitUsage {
+		t.Fatalf("runForward without -L = %d", got)
+	}
+	if got := runForward(context.Background(), &cli.Cli{Forwards: []string{"nope"}}); got != cli.ExitUsage {
+		t.Fatalf("runForward with bad -L = %d", got)
+	}
+}
+
+func TestRunCopyValidatesArgsBeforePicker(t *testing.T) {
+	t.Parallel()
+
+	if got := runCopy(context.Background(), &cli.Cli{Args: []string{":/a"}}); got != cli.ExitUsage {
+		t.Fatalf("runCopy with one arg = %d", got)
+	}
+	if got := runCopy(context.Background(), &cli.Cli{Args: []string{"a", "b"}}); got != cli.ExitUsage {
+		t.Fatalf("runCopy without a container path = %d", got)
+	}
+}
+
+func TestRunAllTasksValidatesFlags(t *testing.T) {
+	t.Parallel()
+
+	if got := runAllTasks(context.Background(), &cli.Cli{Profile: "p"}); got != cli.ExitUsage {
+		t.Fatalf("runAllTasks without region = %d", got)
+	}
+	if got := runAllTasks(context.Background(), &cli.Cli{Profile: "p", Region: "r", TaskArn: "t", Output: cli.FanOutPrefix}); got != cli.ExitUsage {
+		t.Fatalf("runAllTasks with -tk = %d", got)
+	}
+	if got := runAllTasks(context.Background(), &cli.Cli{Profile: "p", Region: "r", Output: "yaml"}); got != cli.ExitUsage {
+		t.Fatalf("runAllTasks with bad -output = %d", got)
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if got := runReplay(&cli.Cli{}); got != 0 {
+		t.Fatalf("listing an empty recordings dir = %d", got)
+	}
+	if got := runReplay(&cli.Cli{Args: []string{"a", "b"}}); got != cli.ExitUsage {
+		t.Fatalf("two args = %d", got)
+	}
+	if got := runReplay(&cli.Cli{Args: []string{"missing.cast"}}); got != cli.ExitUsage {
+		t.Fatalf("missing file = %d", got)
+	}
+
+	if err := os.MkdirAll(cli.RecordingsDir(), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	rec := filepath.Join(cli.RecordingsDir(), "s.cast")
+	if err := os.WriteFile(rec, []byte(`{"version": 2, "width": 80, "height": 24}`+"\n[0, \"o\", \"\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := runReplay(&cli.Cli{}); got != 0 {
+		t.Fatalf("listing = %d", got)
+	}
+	if got := runReplay(&cli.Cli{Args: []string{"s.cast"}, Speed: 1}); got != 0 {
+		t.Fatalf("replay = %d", got)
+	}
+	if got := runReplay(&cli.Cli{Args: []string{"s.cast"}, Speed: 0}); got != cli.ExitUsage {
+		t.Fatalf("replay with zero speed = %d", got)
+	}
+}
+
+func TestReplayHistoryEntryRejectsIncompleteEntries(t *testing.T) {
+	t.Parallel()
+
+	if err := replayHistoryEntry(context.Background(), &cli.Cli{}, cli.HistoryEntry{Command: "aws s3 ls"}); err == nil {
+		t.Fatal("a bare migrated command should not be replayable")
+	}
+	e := cli.HistoryEntry{Region: "r", Cluster: "c", Task: "t", Container: "app", Command: "ls"}
+	if err := replayHistoryEntry(context.Background(), &cli.Cli{}, e); err == nil || !strings.Contains(err.Error(), "-pr") {
+		t.Fatalf("entry without a profile: err = %v", err)
+	}
+}
+
+func TestRunNamedTargetRejectsBadTargets(t *testing.T) {
+	t.Parallel()
+
+	if got := runNamedTarget(context.Background(), &cli.Cli{Target: "missing"}); got != cli.ExitUsage {
+		t.Fatalf("unknown target = %d", got)
+	}
+	c := &cli.Cli{Target: "web", Config: &cli.Config{Targets: map[string]cli.TargetConfig{"web": {Region: "r"}}}}
+	if got := runNamedTarget(context.Background(), c); got != cli.ExitUsage {
+		t.Fatalf("target without a profile = %d", got)
+	}
+}
+
+func TestRunDoctorRejectsBadTargets(t *testing.T) {
+	t.Parallel()
+
+	if got := runDoctor(context.Background(), &cli.Cli{Target: "missing"}); got != cli.ExitUsage {
+		t.Fatalf("unknown target = %d", got)
+	}
+}
+
+func TestRunDebugRejectsBadTargets(t *testing.T) {
+	t.Parallel()
+
+	if got := runDebug(context.Background(), &cli.Cli{Target: "missing"}); got != cli.ExitUsage {
+		t.Fatalf("unknown target = %d", got)
+	}
+}
+
+func TestRewindAfterSession(t *testing.T) {
+	t.Parallel()
+
+	full := stepState{Profile: "p", Region: "r", ClusterArn: "c", Service: "s", TaskArn: "t", Container: "k"}
+	cases := []struct {
+		action string
+		want   int
+	}{
+		{cli.PostReconnect, finalStep},
+		{cli.PostContainer, stepContainer},
+		{cli.PostTask, stepTask},
+		{cli.PostService, stepService},
+		{cli.PostProfile, stepProfile},
+	}
+	for _, tc := range cases {
+		state := full
+		rewindAfterSession(&state, tc.action)
+		if got := initialSelectionStep(state); got != tc.want {
+			t.Errorf("%s: step = %d, want %d", tc.action, got, tc.want)
+		}
+		if tc.action == cli.PostService && (state.ClusterArn != "c" || state.TaskArn != "") {
+			t.Errorf("another service keeps the cluster and clears the task: %+v", state)
+		}
+	}
+}
+
+// fakeAWS points the SDK at a local server with static credentials for
+// profile "test" and returns the API calls it receives. STS answers
+// GetCallerIdentity, ECS DescribeTasks returns one running task with an
+// "app" container, and every other ECS call gets an empty answer.
+func fakeAWS(t *testing.T) func() []string {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.Header.Get("X-Amz-Target")
+		call := target[strings.LastIndex(target, ".")+1:]
+		if target == "" {
+			_ = r.ParseForm()
+			call = r.PostForm.Get("Action")
+		}
+		mu.Lock()
+		calls = append(calls, call)
+		mu.Unlock()
+		switch call {
+		case "GetCallerIdentity":
+			w.Header().Set("Content-Type", "text/xml")
+			_, _ = io.WriteString(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult><Arn>arn:aws:sts::111111111111:assumed-role/dev/me</Arn><UserId>me</UserId><Account>111111111111</Account></GetCallerIdentityResult></GetCallerIdentityResponse>`)
+		case "DescribeTasks":
+			_, _ = io.WriteString(w, `{"tasks":[{"taskArn":"arn:aws:ecs:eu-west-1:111111111111:task/web/abc","lastStatus":"RUNNING","enableExecuteCommand":true,"containers":[{"name":"app"}]}]}`)
+		default:
+			if target == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = io.WriteString(w, `{}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "config")
+	credFile := filepath.Join(dir, "credentials")
+	_ = os.WriteFile(cfgFile, []byte("[profile test]\nregion = eu-west-1\n"), 0o600)
+	_ = os.WriteFile(credFile, []byte("[test]\naws_access_key_id = AKIDTEST\naws_secret_access_key = secret\n"), 0o600)
+	t.Setenv("AWS_CONFIG_FILE", cfgFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credFile)
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(calls)
+	}
+}
+
+func TestRunDoctorFromFlagsLoadsConfig(t *testing.T) {
+	calls := fakeAWS(t)
+
+	c := &cli.Cli{
+		Subcommand: "doctor", Output: cli.FanOutJSON,
+		Profile: "test", Region: "eu-west-1", ClusterArn: "web", Service: "api",
+		TaskArn: "arn:aws:ecs:eu-west-1:111111111111:task/web/abc", Container: "app",
+	}
+	runDoctor(context.Background(), c)
+	if !slices.Contains(calls(), "DescribeTasks") {
+		t.Fatalf("doctor never reached ECS; calls = %v", calls())
+	}
+}
+
+func TestRunDebugFromFlagsLoadsConfig(t *testing.T) {
+	calls := fakeAWS(t)
+
+	c := &cli.Cli{Subcommand: "debug", Profile: "test", Region: "eu-west-1", ClusterArn: "web", Service: "api", Container: "app"}
+	if got := runDebug(context.Background(), c); got == 0 {
+		t.Fatal("a service the fake doesn't know should fail the run")
+	}
+	if !slices.Contains(calls(), "DescribeServices") {
+		t.Fatalf("debug never reached ECS; calls = %v", calls())
+	}
+}